@@ -0,0 +1,138 @@
+// Command headless renders the sample scene without a display and writes the frames as PNG, JPEG or PPM images.
+//
+// Usage:
+//
+//	go run ./cmd/headless -width 800 -height 600 -frames 36 -out frames/turntable_%03d.png
+//
+// When more than one frame is rendered the camera orbits around the world origin, producing a turntable. A scene file
+// can be rendered instead of the sample scene:
+//
+//	go run ./cmd/headless -scene scenes/sample.json -camera camera
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/entities"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"github.com/tsagae/software3d/pkg/renderer"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	width := flag.Int("width", 800, "width of the rendered images")
+	height := flag.Int("height", 600, "height of the rendered images")
+	frames := flag.Int("frames", 1, "number of frames to render")
+	out := flag.String("out", "render.png", "output path, the extension selects the format (.png, .jpg, .ppm). May contain a verb for the frame index, e.g. frame_%03d.png")
+	meshDir := flag.String("meshes", "meshes", "directory containing the sample meshes")
+	turntable := flag.Float64("turntable", 360, "degrees the camera orbits around the origin over all the frames")
+	fov := flag.Float64("fov", entities.DefaultCameraFov, "vertical field of view of the camera in degrees, overriding the one of the scene")
+	ortho := flag.Float64("ortho", 0, "height of the view volume of an orthographic camera, 0 uses a perspective camera")
+	sceneFile := flag.String("scene", "", "scene file (.json) or glTF asset (.gltf, .glb) to render instead of the sample scene")
+	cameraName := flag.String("camera", "camera", "name of the node of the camera")
+	flag.Parse()
+
+	var sceneGraph *entities.SceneGraph
+	var err error
+	switch ext := strings.ToLower(filepath.Ext(*sceneFile)); {
+	case *sceneFile == "":
+		sceneGraph, err = sampleScene(*meshDir)
+	case ext == ".gltf" || ext == ".glb":
+		sceneGraph, err = entities.NewSceneGraphFromGLTFFile(*sceneFile)
+	default:
+		sceneGraph, err = entities.NewSceneGraphFromFile(*sceneFile)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	cameraNode := sceneGraph.GetNode(*cameraName)
+	if cameraNode == nil {
+		fmt.Fprintf(os.Stderr, "the scene has no node %q\n", *cameraName)
+		os.Exit(1)
+	}
+	camera, ok := cameraNode.GameObject.(*entities.CameraObject)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "node %q is not a camera\n", *cameraName)
+		os.Exit(1)
+	}
+	// the field of view of the cameras of scene files is kept unless it's set explicitly
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "fov" {
+			camera.SetFov(basics.Scalar(*fov))
+		}
+	})
+	if *ortho > 0 {
+		camera.SetOrthographic(true)
+		camera.SetOrthoHeight(basics.Scalar(*ortho))
+	}
+
+	step := basics.Scalar(*turntable) / basics.Scalar(*frames)
+	orbit := basics.NewTransform(1, basics.NewQuaternionFromAngleAndAxis(step, basics.Up()), basics.Vector3{})
+	update := func(frame int, sceneGraph *entities.SceneGraph) {
+		if frame == 0 {
+			return
+		}
+		cameraNode.CumulateWorldTransform(&orbit)
+	}
+
+	err = renderer.RenderToFiles(sceneGraph, cameraNode, *width, *height, *frames, *out, update)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func sampleScene(meshDir string) (*entities.SceneGraph, error) {
+	var specularExp basics.Scalar = 600
+	white := basics.Vector3FromColor(color.White)
+
+	meshMaterials := map[string]graphics.Material{
+		"cube":         graphics.NewMaterial("cube", basics.Vector3FromColor(color.RGBA{R: 180, G: 25, B: 25, A: 255}), white, specularExp),
+		"sphere":       graphics.NewMaterial("sphere", basics.Vector3FromColor(color.RGBA{B: 180, A: 255}), white, specularExp),
+		"lowpolyplane": graphics.NewMaterial("plane", basics.Vector3FromColor(color.RGBA{R: 70, G: 50, B: 30, A: 255}), basics.Vector3{}, specularExp),
+		"torus":        graphics.NewMaterial("torus", basics.Vector3FromColor(color.RGBA{G: 180, A: 255}), white, specularExp),
+		"quad":         graphics.NewMaterial("quad", basics.Vector3FromColor(color.RGBA{R: 200, G: 200, B: 30, A: 255}), basics.Vector3{}, specularExp),
+	}
+	meshes := make(map[string]graphics.Mesh)
+	for name, material := range meshMaterials {
+		mesh, err := graphics.NewMeshFromFile(filepath.Join(meshDir, name+".obj"), material)
+		if err != nil {
+			return nil, err
+		}
+		meshes[name] = mesh
+	}
+
+	sceneGraph := entities.NewSceneGraph()
+
+	cameraObj := entities.NewCameraObject("mainCamera")
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(cameraObj, "camera"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(1.5, 1, -3)))
+	rotateCameraT := basics.NewTransform(1, basics.NewQuaternionFromAngleAndAxis(-20, basics.Up()), basics.Vector3{})
+	sceneGraph.GetNode("camera").CumulateBeforeLocalTranform(&rotateCameraT)
+
+	quadObj := entities.NewModelObject("quad", meshes["quad"], true)
+	planeObj := entities.NewModelObject("planeObj", meshes["lowpolyplane"], true)
+	cubeObj := entities.NewModelObject("cubeObj", meshes["cube"], true)
+	torusObj := entities.NewModelObject("torusObj", meshes["torus"], false)
+	sphereObj := entities.NewModelObject("sphereObj", meshes["sphere"], false)
+
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(quadObj, "quad"), basics.NewTransform(5, basics.NewQuaternionFromEulerAngles(0, 90, 0), basics.NewVector3(0, 0, 0)))
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(torusObj, "torus"), basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(20, 20, 0), basics.NewVector3(3, 1, 3)))
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(cubeObj, "cube"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, 0)))
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(sphereObj, "sphere"), basics.NewTransform(0.6, basics.NewIdentityQuaternion(), basics.NewVector3(-1, 1, 1)))
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(planeObj, "plane"), basics.NewTransform(5, basics.NewIdentityQuaternion(), basics.NewVector3(0, -2, 0)))
+
+	// Lighting
+	simpleFallOff := func(lightDistance basics.Scalar) basics.Scalar {
+		return basics.Clamp(0, 1, 1-(lightDistance/basics.Scalar(50)))
+	}
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewLightObject("light1", color.RGBA{150, 150, 150, 255}, simpleFallOff), "light1"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 5, 0)))
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewLightObject("light2", color.RGBA{80, 150, 20, 255}, simpleFallOff), "light2"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(2, 2, 2)))
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewHemisphereLightObject("ambient", color.RGBA{30, 30, 30, 255}, color.RGBA{30, 30, 30, 255}), "ambient"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.Vector3{}))
+
+	return sceneGraph, nil
+}
@@ -7,7 +7,6 @@ import (
 	"github.com/tsagae/software3d/pkg/graphics"
 	"github.com/tsagae/software3d/pkg/renderer"
 	"image/color"
-	"os"
 	"runtime"
 	"time"
 
@@ -102,7 +101,7 @@ func run(renderMode uint8, loop func(graph *entities.SceneGraph), sceneGraph *en
 		gl.BindFramebuffer(gl.DRAW_FRAMEBUFFER, 0)
 	}
 
-	var objRenderer = renderer.NewRasterRenderer(sceneGraph.GetNode("camera"), 1, winWidth, winHeight)
+	var objRenderer = renderer.NewRasterRenderer(sceneGraph.GetNode("camera"), winWidth, winHeight)
 	objRenderer.SetRenderMode(renderMode)
 
 	var imageBuffer *graphics.ImageBuffer
@@ -110,17 +109,15 @@ func run(renderMode uint8, loop func(graph *entities.SceneGraph), sceneGraph *en
 	var startTime time.Time = time.Now()
 	var elapsed time.Duration
 	var elapsedSum time.Duration
-	camera := sceneGraph.GetNode("camera")
-	if camera == nil {
-		panic("camera not found in scene graph")
-	}
+	camera := objRenderer.Camera()
 
 	for !window.ShouldClose() {
 		elapsed = time.Since(startTime)
 		elapsedSum += elapsed
 
 		if frames%20 == 0 && elapsed.Milliseconds() != 0 {
-			fmt.Printf("avg ms: %v \n", elapsedSum.Milliseconds()/int64(frames))
+			stats := objRenderer.CullingStats()
+			fmt.Printf("avg ms: %v, culled models: %d/%d \n", elapsedSum.Milliseconds()/int64(frames), stats.Culled, stats.Models)
 			elapsedSum = 0
 			frames = 0
 			//fmt.Println("FPS: ", 1000/elapsed.Milliseconds(), "ms: ", elapsed.Milliseconds())
@@ -128,7 +125,10 @@ func run(renderMode uint8, loop func(graph *entities.SceneGraph), sceneGraph *en
 		startTime = time.Now()
 		frames++
 
-		imageBuffer = objRenderer.RenderSceneGraph(sceneGraph)
+		imageBuffer, err = objRenderer.RenderSceneGraph(sceneGraph)
+		if err != nil {
+			panic(err)
+		}
 		loop(sceneGraph)
 
 		var w, h = window.GetSize()
@@ -206,6 +206,21 @@ func inputHandler(window *glfw.Window, camera *entities.SceneGraphNode, r *rende
 	if window.GetKey(glfw.Key2) == glfw.Press {
 		r.SetRenderMode(renderer.RendermodeWireframe)
 	}
+	if window.GetKey(glfw.Key3) == glfw.Press {
+		r.SetRenderMode(renderer.RendermodePhong)
+	}
+	if window.GetKey(glfw.Key4) == glfw.Press {
+		r.SetRenderMode(renderer.RendermodeShadedWireframe)
+	}
+	if window.GetKey(glfw.Key5) == glfw.Press {
+		r.SetAntialiasing(renderer.AntialiasingNone)
+	}
+	if window.GetKey(glfw.Key6) == glfw.Press {
+		r.SetAntialiasing(renderer.AntialiasingMSAA4)
+	}
+	if window.GetKey(glfw.Key7) == glfw.Press {
+		r.SetAntialiasing(renderer.AntialiasingFXAA)
+	}
 	cameraPitch = basics.Clamp(-89, 89, cameraPitch)
 	camera.SetViewRotation(cameraYaw, cameraPitch)
 	camera.CumulateWorldTransform(&movement)
@@ -242,16 +257,8 @@ func mainLoop(sceneGraph *entities.SceneGraph) {
 }
 */
 
-func readMeshFromFile(fileName string, meshColor color.RGBA) graphics.Mesh {
-	f, err := os.Open(fileName)
-	if err != nil {
-		panic(err)
-	}
-	mesh, err := graphics.NewMeshFromReader(f, basics.Vector3FromColor(meshColor))
-	if err != nil {
-		panic(err)
-	}
-	err = f.Close()
+func readMeshFromFile(fileName string, material graphics.Material) graphics.Mesh {
+	mesh, err := graphics.NewMeshFromFile(fileName, material)
 	if err != nil {
 		panic(err)
 	}
@@ -259,24 +266,25 @@ func readMeshFromFile(fileName string, meshColor color.RGBA) graphics.Mesh {
 }
 
 func loadMeshes() map[string]graphics.Mesh {
+	var specularExp basics.Scalar = 600
+	white := basics.Vector3FromColor(color.White)
+
 	meshes := make(map[string]graphics.Mesh)
 
-	meshes["cube"] = readMeshFromFile("meshes/cube.obj", color.RGBA{R: 180, G: 25, B: 25, A: 255})
+	meshes["cube"] = readMeshFromFile("meshes/cube.obj", graphics.NewMaterial("cube", basics.Vector3FromColor(color.RGBA{R: 180, G: 25, B: 25, A: 255}), white, specularExp))
 
-	meshes["sphere"] = readMeshFromFile("meshes/sphere.obj", color.RGBA{B: 180, A: 255})
+	meshes["sphere"] = readMeshFromFile("meshes/sphere.obj", graphics.NewMaterial("sphere", basics.Vector3FromColor(color.RGBA{B: 180, A: 255}), white, specularExp))
 
-	meshes["plane"] = readMeshFromFile("meshes/lowpolyplane.obj", color.RGBA{R: 70, G: 50, B: 30, A: 255})
+	meshes["plane"] = readMeshFromFile("meshes/lowpolyplane.obj", graphics.NewMaterial("plane", basics.Vector3FromColor(color.RGBA{R: 70, G: 50, B: 30, A: 255}), basics.Vector3{}, specularExp))
 
-	meshes["torus"] = readMeshFromFile("meshes/torus.obj", color.RGBA{G: 180, A: 255})
+	meshes["torus"] = readMeshFromFile("meshes/torus.obj", graphics.NewMaterial("torus", basics.Vector3FromColor(color.RGBA{G: 180, A: 255}), white, specularExp))
 
-	meshes["quad"] = readMeshFromFile("meshes/quad.obj", color.RGBA{R: 200, G: 200, B: 30, A: 255})
+	meshes["quad"] = readMeshFromFile("meshes/quad.obj", graphics.NewMaterial("quad", basics.Vector3FromColor(color.RGBA{R: 200, G: 200, B: 30, A: 255}), basics.Vector3{}, specularExp))
 
 	return meshes
 }
 
 func setup() *entities.SceneGraph {
-	var specularExp basics.Scalar = 600
-
 	sceneGraph := entities.NewSceneGraph()
 
 	meshes := loadMeshes()
@@ -288,17 +296,17 @@ func setup() *entities.SceneGraph {
 	cameraNode := sceneGraph.GetNode("camera")
 	cameraNode.CumulateBeforeLocalTranform(&rotateCameraT)
 
-	quadObj := entities.NewModelObject("quad", meshes["quad"], true, specularExp, true)
+	quadObj := entities.NewModelObject("quad", meshes["quad"], true)
 	sceneGraph.AddChild("world", entities.NewSceneGraphNode(quadObj, "quad"), basics.NewTransform(5, basics.NewQuaternionFromEulerAngles(0, 90, 0), basics.NewVector3(0, 0, 0)))
 
-	planeObj := entities.NewModelObject("planeObj", meshes["plane"], true, specularExp, true)
+	planeObj := entities.NewModelObject("planeObj", meshes["plane"], true)
 
-	cubeObj := entities.NewModelObject("cubeObj", meshes["cube"], true, specularExp, false)
+	cubeObj := entities.NewModelObject("cubeObj", meshes["cube"], true)
 
-	torusObj := entities.NewModelObject("torusObj", meshes["torus"], false, specularExp, false)
+	torusObj := entities.NewModelObject("torusObj", meshes["torus"], false)
 	sceneGraph.AddChild("world", entities.NewSceneGraphNode(torusObj, "torus"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(3, 1, 3)))
 
-	sphereObj := entities.NewModelObject("sphereObj", meshes["sphere"], false, specularExp, false)
+	sphereObj := entities.NewModelObject("sphereObj", meshes["sphere"], false)
 	sceneGraph.AddChild("world", entities.NewSceneGraphNode(cubeObj, "cube"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, 0)))
 	sceneGraph.AddChild("world", entities.NewSceneGraphNode(sphereObj, "sphere"), basics.NewTransform(0.6, basics.NewIdentityQuaternion(), basics.NewVector3(-1, 1, 1)))
 	//sceneGraph.AddChild("world", entities.NewSceneGraphNode(planeObj, "plane2"), basics.NewTransform(2, basics.NewQuaternionFromAngleAndAxis(45, basics.Up()), basics.NewVector3(1, -3, 5)))
@@ -334,13 +342,12 @@ func setup() *entities.SceneGraph {
 
 	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewLightObject("light1", color.RGBA{150, 150, 150, 255}, simpleFallOff), "ligh1"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 5, 0)))
 	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewLightObject("light2", color.RGBA{80, 150, 20, 255}, simpleFallOff), "ligh2"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(2, 2, 2)))
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewHemisphereLightObject("ambient", color.RGBA{30, 30, 30, 255}, color.RGBA{30, 30, 30, 255}), "ambient"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.Vector3{}))
 
 	return sceneGraph
 }
 
 func setupOnlyCube() *entities.SceneGraph {
-	var specularExp basics.Scalar = 20
-
 	sceneGraph := entities.NewSceneGraph()
 
 	meshes := loadMeshes()
@@ -352,7 +359,7 @@ func setupOnlyCube() *entities.SceneGraph {
 	cameraNode := sceneGraph.GetNode("camera")
 	cameraNode.CumulateWorldTransform(&rotateCameraT)
 
-	cubeObj := entities.NewModelObject("cubeObj", meshes["cube"], true, specularExp, false)
+	cubeObj := entities.NewModelObject("cubeObj", meshes["cube"], true)
 
 	sceneGraph.AddChild("world", entities.NewSceneGraphNode(cubeObj, "cube"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, 0)))
 
@@ -360,8 +367,6 @@ func setupOnlyCube() *entities.SceneGraph {
 }
 
 func setupClipping() *entities.SceneGraph {
-	var specularExp basics.Scalar = 20
-
 	sceneGraph := entities.NewSceneGraph()
 
 	meshes := loadMeshes()
@@ -374,7 +379,7 @@ func setupClipping() *entities.SceneGraph {
 	cameraNode := sceneGraph.GetNode("camera")
 	cameraNode.CumulateWorldTransform(&rotateCameraT)
 
-	planeObj := entities.NewModelObject("planeObj", meshes["quad"], true, specularExp, true)
+	planeObj := entities.NewModelObject("planeObj", meshes["quad"], true)
 
 	sceneGraph.AddChild("world", entities.NewSceneGraphNode(planeObj, "plane"), basics.NewTransform(10, basics.NewQuaternionFromEulerAngles(0, 90, 0), basics.NewVector3(0, 0, 10)))
 
@@ -386,6 +391,7 @@ func setupClipping() *entities.SceneGraph {
 
 	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewLightObject("light1", color.RGBA{150, 150, 150, 255}, simpleFallOff), "ligh1"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 5, 0)))
 	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewLightObject("light2", color.RGBA{80, 150, 20, 255}, simpleFallOff), "ligh2"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(2, 2, 2)))
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewHemisphereLightObject("ambient", color.RGBA{30, 30, 30, 255}, color.RGBA{30, 30, 30, 255}), "ambient"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.Vector3{}))
 
 	return sceneGraph
 }
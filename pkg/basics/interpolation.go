@@ -54,3 +54,15 @@ func FindWeights2D(v1, v2, v3, target *Vector3) (Scalar, Scalar, Scalar) {
 	w3 := 1 - w1 - w2
 	return w1, w2, w3
 }
+
+// SmoothStep Returns 0 if x <= edge0, 1 if x >= edge1 and a smooth hermite interpolation in between
+func SmoothStep(edge0 Scalar, edge1 Scalar, x Scalar) Scalar {
+	if edge0 == edge1 {
+		if x < edge0 {
+			return 0
+		}
+		return 1
+	}
+	t := Clamp(0, 1, (x-edge0)/(edge1-edge0))
+	return t * t * (3 - 2*t)
+}
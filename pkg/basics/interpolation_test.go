@@ -15,3 +15,11 @@ func TestFindWeights3(t *testing.T) {
 	assert.True(t, w1.Equals(0))
 	assert.True(t, w2.Equals(1))
 }
+
+func TestSmoothStep(t *testing.T) {
+	assert.Equal(t, Scalar(0), SmoothStep(1, 2, 0.5))
+	assert.Equal(t, Scalar(1), SmoothStep(1, 2, 3))
+	assert.Equal(t, Scalar(0.5), SmoothStep(1, 2, 1.5))
+	assert.True(t, SmoothStep(1, 2, 1.2) < SmoothStep(1, 2, 1.3))
+	assert.Equal(t, Scalar(1), SmoothStep(1, 1, 1), "equal edges are a step")
+}
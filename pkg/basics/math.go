@@ -42,6 +42,10 @@ func Cos(n Scalar) Scalar {
 	return Scalar(math.Cos(float64(n)))
 }
 
+func Tan(n Scalar) Scalar {
+	return Scalar(math.Tan(float64(n)))
+}
+
 func Asin(n Scalar) Scalar {
 	return Scalar(math.Asin(float64(n)))
 }
@@ -0,0 +1,294 @@
+package entities
+
+import (
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"math"
+	"slices"
+)
+
+const bvhLeafSize = 4 // maximum number of triangles in a leaf
+
+// BVH Bounding volume hierarchy over the world space triangles of all the models of a scene graph, used to cast rays
+// into the scene. The hierarchy is built once, Refit updates it after the transforms of the nodes change
+type BVH struct {
+	sceneGraph *SceneGraph
+	models     []bvhModel
+	triangles  []bvhTriangle // the triangles of each model are consecutive, in the order of the mesh
+	order      []int         // indices in triangles sorted so that the triangles of each leaf are consecutive
+	nodes      []bvhNode     // the root is nodes[0], the children of a node are after it
+}
+
+// RayHit A triangle hit by a ray
+type RayHit struct {
+	Node        *SceneGraphNode // node of the model hit
+	Triangle    int             // index of the triangle in the mesh of the model
+	Barycentric basics.Vector3  // weights of the 3 vertices of the triangle at the hit point
+	Point       basics.Vector3  // hit point in world space
+	Distance    basics.Scalar   // distance from the origin of the ray
+}
+
+type bvhModel struct {
+	node           *SceneGraphNode
+	model          *ModelObject
+	mesh           graphics.Mesh
+	worldTransform basics.Transform // used to compute the positions of the triangles
+	firstTriangle  int              // index in BVH.triangles of the first triangle of the model
+}
+
+type bvhTriangle struct {
+	positions [3]basics.Vector3 // in world space
+	model     int               // index in BVH.models
+	face      int               // index of the triangle in the mesh
+}
+
+// bvhNode an inner node when count is 0, its children are at left and left+1. Leaves contain the triangles in
+// BVH.order from first to first+count
+type bvhNode struct {
+	box   graphics.AABB
+	left  int
+	first int
+	count int
+}
+
+// NewBVH Returns the hierarchy of the triangles of the models in the scene graph
+func NewBVH(sceneGraph *SceneGraph) *BVH {
+	b := &BVH{sceneGraph: sceneGraph}
+	b.build()
+	return b
+}
+
+// TriangleCount Returns the number of triangles in the hierarchy
+func (b *BVH) TriangleCount() int {
+	return len(b.triangles)
+}
+
+// Refit Updates the world positions of the triangles of the models whose world transform changed and the boxes of the
+// hierarchy containing them, the structure of the tree is kept. When models have been added to or removed from the
+// scene graph the hierarchy is rebuilt. Returns true if anything changed
+func (b *BVH) Refit() bool {
+	nodes := modelNodes(b.sceneGraph)
+	if len(nodes) != len(b.models) {
+		b.build()
+		return true
+	}
+	for i, node := range nodes {
+		if node != b.models[i].node || node.GameObject != b.models[i].model {
+			b.build()
+			return true
+		}
+	}
+
+	changed := false
+	for i := range b.models {
+		model := &b.models[i]
+		worldT := model.node.WorldTransform()
+		if worldT == model.worldTransform {
+			continue
+		}
+		changed = true
+		model.worldTransform = worldT
+		for j := 0; j < model.mesh.TriangleCount(); j++ {
+			b.triangles[model.firstTriangle+j].positions = worldTrianglePositions(&model.mesh, j, &worldT)
+		}
+	}
+	if !changed {
+		return false
+	}
+	// children are after their parent, so going backwards refits them first
+	for i := len(b.nodes) - 1; i >= 0; i-- {
+		node := &b.nodes[i]
+		if node.count > 0 {
+			node.box = b.trianglesBox(node.first, node.first+node.count)
+		} else {
+			node.box = b.nodes[node.left].box
+			node.box.ThisUnion(b.nodes[node.left+1].box)
+		}
+	}
+	return true
+}
+
+// Intersect Returns the closest triangle hit by the ray from origin along direction, at a distance between minDistance
+// and maxDistance. Only the triangles facing the origin of the ray are hit, like the back face culling of the renderer
+func (b *BVH) Intersect(origin basics.Vector3, direction basics.Vector3, minDistance basics.Scalar, maxDistance basics.Scalar) (RayHit, bool) {
+	direction = direction.Normalized()
+	inverse := basics.NewVector3(1/direction.X, 1/direction.Y, 1/direction.Z)
+	var hit RayHit
+	found := false
+	closest := maxDistance
+	if len(b.nodes) == 0 {
+		return hit, false
+	}
+	stack := []int{0}
+	for len(stack) > 0 {
+		node := &b.nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+		if !rayHitsBox(&node.box, &origin, &inverse, minDistance, closest) {
+			continue
+		}
+		if node.count == 0 {
+			stack = append(stack, node.left, node.left+1)
+			continue
+		}
+		for i := node.first; i < node.first+node.count; i++ {
+			triangle := &b.triangles[b.order[i]]
+			distance, u, v, ok := intersectTriangle(&triangle.positions, &origin, &direction)
+			if !ok || distance < minDistance || distance > closest {
+				continue
+			}
+			closest = distance
+			found = true
+			hit = RayHit{
+				Node:        b.models[triangle.model].node,
+				Triangle:    triangle.face,
+				Barycentric: basics.NewVector3(1-u-v, u, v),
+				Point:       origin.Add(direction.Mul(distance)),
+				Distance:    distance,
+			}
+		}
+	}
+	return hit, found
+}
+
+// modelNodes Returns the nodes holding a ModelObject in breadth first order
+func modelNodes(sceneGraph *SceneGraph) []*SceneGraphNode {
+	var nodes []*SceneGraphNode
+	queue := []*SceneGraphNode{sceneGraph.GetRoot()}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		if _, ok := node.GameObject.(*ModelObject); ok {
+			nodes = append(nodes, node)
+		}
+		queue = append(queue, node.childNodes...)
+	}
+	return nodes
+}
+
+func worldTrianglePositions(mesh *graphics.Mesh, face int, worldT *basics.Transform) [3]basics.Vector3 {
+	var positions [3]basics.Vector3
+	for i, index := range mesh.Face(face) {
+		positions[i] = mesh.VertexPosition(index)
+		worldT.ApplyToPoint(&positions[i])
+	}
+	return positions
+}
+
+func (b *BVH) build() {
+	b.models = b.models[:0]
+	b.triangles = b.triangles[:0]
+	b.order = b.order[:0]
+	b.nodes = b.nodes[:0]
+	for _, node := range modelNodes(b.sceneGraph) {
+		model := node.GameObject.(*ModelObject)
+		mesh := model.Mesh()
+		worldT := node.WorldTransform()
+		b.models = append(b.models, bvhModel{node: node, model: model, mesh: mesh, worldTransform: worldT, firstTriangle: len(b.triangles)})
+		for i := 0; i < mesh.TriangleCount(); i++ {
+			b.order = append(b.order, len(b.triangles))
+			b.triangles = append(b.triangles, bvhTriangle{positions: worldTrianglePositions(&mesh, i, &worldT), model: len(b.models) - 1, face: i})
+		}
+	}
+	if len(b.triangles) == 0 {
+		return
+	}
+	b.nodes = append(b.nodes, bvhNode{})
+	b.split(0, 0, len(b.triangles))
+}
+
+// split fills the node with the triangles from first to end, splitting them at the median of the centroids along the
+// longest axis of their box until they fit in a leaf
+func (b *BVH) split(node int, first int, end int) {
+	box := b.trianglesBox(first, end)
+	if end-first <= bvhLeafSize {
+		b.nodes[node] = bvhNode{box: box, first: first, count: end - first}
+		return
+	}
+	centroids := graphics.NewEmptyAABB()
+	for i := first; i < end; i++ {
+		centroids.ThisExtend(triangleCentroid(&b.triangles[b.order[i]]))
+	}
+	size := centroids.Max.Sub(centroids.Min)
+	axis := func(v basics.Vector3) basics.Scalar { return v.X }
+	if size.Y > size.X && size.Y >= size.Z {
+		axis = func(v basics.Vector3) basics.Scalar { return v.Y }
+	} else if size.Z > size.X && size.Z > size.Y {
+		axis = func(v basics.Vector3) basics.Scalar { return v.Z }
+	}
+	slices.SortFunc(b.order[first:end], func(t0, t1 int) int {
+		c0, c1 := axis(triangleCentroid(&b.triangles[t0])), axis(triangleCentroid(&b.triangles[t1]))
+		if c0 < c1 {
+			return -1
+		}
+		if c0 > c1 {
+			return 1
+		}
+		return 0
+	})
+	middle := (first + end) / 2
+	left := len(b.nodes)
+	b.nodes = append(b.nodes, bvhNode{}, bvhNode{})
+	b.nodes[node] = bvhNode{box: box, left: left}
+	b.split(left, first, middle)
+	b.split(left+1, middle, end)
+}
+
+func (b *BVH) trianglesBox(first int, end int) graphics.AABB {
+	box := graphics.NewEmptyAABB()
+	for i := first; i < end; i++ {
+		for _, p := range b.triangles[b.order[i]].positions {
+			box.ThisExtend(p)
+		}
+	}
+	return box
+}
+
+func triangleCentroid(t *bvhTriangle) basics.Vector3 {
+	return t.positions[0].Add(t.positions[1]).Add(t.positions[2]).Div(3)
+}
+
+// rayHitsBox Returns true if the ray enters the box between minDistance and maxDistance (slab test)
+func rayHitsBox(box *graphics.AABB, origin *basics.Vector3, inverse *basics.Vector3, minDistance basics.Scalar, maxDistance basics.Scalar) bool {
+	near, far := float64(minDistance), float64(maxDistance)
+	slab := func(min basics.Scalar, max basics.Scalar, o basics.Scalar, inv basics.Scalar) {
+		t0, t1 := float64((min-o)*inv), float64((max-o)*inv)
+		if math.IsNaN(t0) || math.IsNaN(t1) { // the ray is parallel to the slab and starts on its border
+			return
+		}
+		if t0 > t1 {
+			t0, t1 = t1, t0
+		}
+		near, far = math.Max(near, t0), math.Min(far, t1)
+	}
+	slab(box.Min.X, box.Max.X, origin.X, inverse.X)
+	slab(box.Min.Y, box.Max.Y, origin.Y, inverse.Y)
+	slab(box.Min.Z, box.Max.Z, origin.Z, inverse.Z)
+	return near <= far
+}
+
+// intersectTriangle Returns the distance along the ray of the point where it hits the front of the triangle and the
+// barycentric coordinates of the second and third vertex (Möller–Trumbore)
+func intersectTriangle(positions *[3]basics.Vector3, origin *basics.Vector3, direction *basics.Vector3) (basics.Scalar, basics.Scalar, basics.Scalar, bool) {
+	edge1 := positions[1].Sub(positions[0])
+	edge2 := positions[2].Sub(positions[0])
+	// the outward normal of the triangle is edge1 x edge2, the ray must go against it
+	if edge1.Cross(edge2).Dot(*direction) >= 0 {
+		return 0, 0, 0, false
+	}
+	p := direction.Cross(edge2)
+	determinant := edge1.Dot(p)
+	if basics.Abs(determinant) < 1e-12 {
+		return 0, 0, 0, false
+	}
+	toOrigin := origin.Sub(positions[0])
+	u := toOrigin.Dot(p) / determinant
+	if u < 0 || u > 1 {
+		return 0, 0, 0, false
+	}
+	q := toOrigin.Cross(edge1)
+	v := direction.Dot(q) / determinant
+	if v < 0 || u+v > 1 {
+		return 0, 0, 0, false
+	}
+	return edge2.Dot(q) / determinant, u, v, true
+}
@@ -0,0 +1,117 @@
+package entities
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"math/rand"
+	"testing"
+)
+
+// bvhTestGrid Returns a size x size grid of quads on the plane z = 0 facing -z, two triangles for each quad
+func bvhTestGrid(size int) graphics.Mesh {
+	var geometry []graphics.VertexAttributes
+	var connectivity []graphics.TriangleConnectivity
+	for y := 0; y <= size; y++ {
+		for x := 0; x <= size; x++ {
+			position := basics.NewVector3(basics.Scalar(x), basics.Scalar(y), 0)
+			geometry = append(geometry, graphics.NewVertexAttributes(position, basics.Vector3{}, basics.Backward(), basics.Vector3{}))
+		}
+	}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			v := y*(size+1) + x
+			connectivity = append(connectivity, graphics.TriangleConnectivity{v, v + size + 1, v + 1}, graphics.TriangleConnectivity{v + 1, v + size + 1, v + size + 2})
+		}
+	}
+	return graphics.NewMesh(geometry, connectivity)
+}
+
+func bvhTestScene() *SceneGraph {
+	sceneGraph := NewSceneGraph()
+	grid := bvhTestGrid(10)
+	sceneGraph.AddChild("world", NewSceneGraphNode(NewModelObject("front", grid, false), "front"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, 5)))
+	sceneGraph.AddChild("world", NewSceneGraphNode(NewEmptyObject("pivot"), "pivot"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, 10)))
+	sceneGraph.AddChild("pivot", NewSceneGraphNode(NewModelObject("back", grid, false), "back"), basics.NewTransform(2, basics.NewIdentityQuaternion(), basics.NewVector3(-5, -5, 0)))
+	return sceneGraph
+}
+
+func TestBVH_Intersect(t *testing.T) {
+	sceneGraph := bvhTestScene()
+	bvh := NewBVH(sceneGraph)
+	assert.Equal(t, 400, bvh.TriangleCount())
+
+	hit, ok := bvh.Intersect(basics.NewVector3(2.25, 3.5, 0), basics.Forward(), 0, 100)
+	assert.True(t, ok)
+	assert.Equal(t, sceneGraph.GetNode("front"), hit.Node)
+	assert.Equal(t, (3*10+2)*2, hit.Triangle)
+	assert.True(t, hit.Point.Equals(basics.NewVector3(2.25, 3.5, 5)))
+	assert.InDelta(t, 5, float64(hit.Distance), 1e-9)
+	assert.True(t, hit.Barycentric.Equals(basics.NewVector3(0.25, 0.5, 0.25)), "barycentric %v", hit.Barycentric)
+
+	// outside of the front grid, the back grid covers from -5 to 15
+	hit, ok = bvh.Intersect(basics.NewVector3(-2, 12, 0), basics.Forward(), 0, 100)
+	assert.True(t, ok)
+	assert.Equal(t, sceneGraph.GetNode("back"), hit.Node)
+	assert.True(t, hit.Point.Equals(basics.NewVector3(-2, 12, 10)))
+
+	_, ok = bvh.Intersect(basics.NewVector3(2, 3, 0), basics.Forward(), 0, 4)
+	assert.False(t, ok, "beyond the maximum distance")
+	_, ok = bvh.Intersect(basics.NewVector3(2.25, 3.5, 20), basics.Backward(), 0, 100)
+	assert.False(t, ok, "the back of the triangles can't be hit")
+	_, ok = NewBVH(NewSceneGraph()).Intersect(basics.Vector3{}, basics.Forward(), 0, 100)
+	assert.False(t, ok, "empty scene")
+}
+
+func TestBVH_MatchesBruteForce(t *testing.T) {
+	sceneGraph := bvhTestScene()
+	rotation := basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(20, 30, 10), basics.Vector3{})
+	sceneGraph.GetNode("pivot").CumulateBeforeLocalTranform(&rotation)
+	bvh := NewBVH(sceneGraph)
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		origin := basics.NewVector3(basics.Scalar(random.Float64()*20-5), basics.Scalar(random.Float64()*20-5), -1)
+		direction := basics.NewVector3(basics.Scalar(random.Float64()-0.5), basics.Scalar(random.Float64()-0.5), 1)
+		hit, ok := bvh.Intersect(origin, direction, 0, 1000)
+
+		expectedOk := false
+		var expected basics.Scalar = 1000
+		normalized := direction.Normalized()
+		for j := range bvh.triangles {
+			distance, _, _, found := intersectTriangle(&bvh.triangles[j].positions, &origin, &normalized)
+			if found && distance >= 0 && distance <= expected {
+				expected = distance
+				expectedOk = true
+			}
+		}
+		if assert.Equal(t, expectedOk, ok, "ray %d", i) && ok {
+			assert.InDelta(t, float64(expected), float64(hit.Distance), 1e-9, "ray %d", i)
+		}
+	}
+}
+
+func TestBVH_Refit(t *testing.T) {
+	sceneGraph := bvhTestScene()
+	bvh := NewBVH(sceneGraph)
+	assert.False(t, bvh.Refit(), "nothing changed")
+
+	// move the front grid out of the way
+	sceneGraph.GetNode("front").SetLocalTransform(basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(100, 0, 5)))
+	assert.True(t, bvh.Refit())
+	hit, ok := bvh.Intersect(basics.NewVector3(2.25, 3.5, 0), basics.Forward(), 0, 100)
+	assert.True(t, ok)
+	assert.Equal(t, sceneGraph.GetNode("back"), hit.Node)
+
+	// moving a parent moves the triangles of its children
+	sceneGraph.GetNode("pivot").SetLocalTransform(basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, 20)))
+	assert.True(t, bvh.Refit())
+	hit, _ = bvh.Intersect(basics.NewVector3(2.25, 3.5, 0), basics.Forward(), 0, 100)
+	assert.True(t, hit.Point.Equals(basics.NewVector3(2.25, 3.5, 20)))
+
+	// new models rebuild the hierarchy
+	sceneGraph.AddChild("world", NewSceneGraphNode(NewModelObject("new", bvhTestGrid(1), false), "new"), basics.NewTransform(10, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, 1)))
+	assert.True(t, bvh.Refit())
+	assert.Equal(t, 402, bvh.TriangleCount())
+	hit, _ = bvh.Intersect(basics.NewVector3(2.25, 3.5, 0), basics.Forward(), 0, 100)
+	assert.Equal(t, sceneGraph.GetNode("new"), hit.Node)
+}
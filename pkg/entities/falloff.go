@@ -0,0 +1,52 @@
+package entities
+
+import (
+	"fmt"
+	"github.com/tsagae/software3d/pkg/basics"
+)
+
+const (
+	FalloffNone      = "none"      // the intensity does not depend on the distance
+	FalloffLinear    = "linear"    // fades linearly from full intensity at the light to zero at the radius
+	FalloffQuadratic = "quadratic" // inverse square law, half intensity at the radius and never zero
+	FalloffSmooth    = "smooth"    // inverse square law windowed to reach zero at the radius without a visible border
+)
+
+// FalloffPreset A named falloff function, unlike a FalloffFunction it can be saved in scene files
+type FalloffPreset struct {
+	Name   string        // one of the Falloff constants
+	Radius basics.Scalar // distance in world units that scales the falloff, ignored by FalloffNone
+}
+
+// NewFalloffFunction Returns the falloff function of the preset, an error if the name is unknown or the radius is not
+// positive
+func NewFalloffFunction(preset FalloffPreset) (FalloffFunction, error) {
+	if preset.Name == FalloffNone {
+		return func(lightDistance basics.Scalar) basics.Scalar {
+			return 1
+		}, nil
+	}
+	radius := preset.Radius
+	if radius <= 0 {
+		return nil, fmt.Errorf("falloff %q: the radius must be positive, got %v", preset.Name, radius)
+	}
+	switch preset.Name {
+	case FalloffLinear:
+		return func(lightDistance basics.Scalar) basics.Scalar {
+			return basics.Clamp(0, 1, 1-lightDistance/radius)
+		}, nil
+	case FalloffQuadratic:
+		return func(lightDistance basics.Scalar) basics.Scalar {
+			d := lightDistance / radius
+			return 1 / (1 + d*d)
+		}, nil
+	case FalloffSmooth:
+		return func(lightDistance basics.Scalar) basics.Scalar {
+			d := lightDistance / radius
+			window := basics.Clamp(0, 1, 1-d*d*d*d)
+			return window * window / (1 + d*d)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown falloff %q", preset.Name)
+	}
+}
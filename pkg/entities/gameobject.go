@@ -1,6 +1,8 @@
 package entities
 
 import (
+	"errors"
+	"fmt"
 	"github.com/tsagae/software3d/pkg/basics"
 	"github.com/tsagae/software3d/pkg/graphics"
 	"image/color"
@@ -14,24 +16,90 @@ type EmptyObject struct {
 	name string
 }
 
+// ModelObject A renderable mesh. Colors and specular highlights come from the materials of the mesh
 type ModelObject struct {
 	name              string
 	mesh              graphics.Mesh
 	ignoreMeshNormals bool
-	specularExponent  basics.Scalar
-	ignoreSpecular    bool
+	perPixelLighting  bool
+	castShadows       bool
+	receiveShadows    bool
+	shader            graphics.Shader // nil uses the Phong shading of the renderer
+	wireColor         color.RGBA      // color of the edges in the wireframe render modes
+	meshFile          string          // path of the file the mesh was read from, empty if the mesh was built in code
+	edges             []graphics.MeshEdge
+	bounds            *modelBounds // computed the first time they're needed
 }
 
+// modelBounds bounding volumes of the mesh of a model in the space of the model
+type modelBounds struct {
+	box    graphics.AABB
+	sphere graphics.BoundingSphere
+}
+
+const (
+	DefaultCameraFov  = 90 // vertical field of view in degrees
+	DefaultCameraNear = 0.1
+	DefaultCameraFar  = 1000
+)
+
+// CameraObject The point of view of the renderer, looking at +z in its local space
 type CameraObject struct {
-	name string
+	name         string
+	fov          basics.Scalar // vertical field of view in degrees, used by perspective cameras
+	near         basics.Scalar // distance of the near clip plane
+	far          basics.Scalar // distance of the far clip plane
+	orthographic bool
+	orthoHeight  basics.Scalar // height of the view volume, used by orthographic cameras
 }
 
 type FalloffFunction func(lightDistance basics.Scalar) basics.Scalar
 
+const (
+	LightTypePoint       = iota // Emits in every direction from the position of the node
+	LightTypeDirectional        // Parallel rays going along +z of the node, like the sun
+	LightTypeSpot               // A cone along +z of the node, fading from the inner to the outer angle
+	LightTypeHemisphere         // Ambient light, the sky color comes from +y of the node and the ground color from -y
+)
+
+// ShadowSettings How the shadow map of a light is rendered and sampled. Directional lights render an orthographic
+// map of Area x Area world units centered on their node, spot lights a perspective map covering the cone and point
+// lights a cube map
+type ShadowSettings struct {
+	MapSize   int           // side in texels of the shadow map, or of every face of the cube map of point lights
+	Bias      basics.Scalar // depth offset in world units that avoids surfaces shadowing themselves
+	SlopeBias basics.Scalar // depth offset in texels added on the surfaces at grazing angles to the light
+	PCFRadius int           // texels averaged around the sampled one in every direction, 0 disables filtering
+	Area      basics.Scalar // side of the square covered by the map of directional lights
+	Near      basics.Scalar // distance from the light where the map starts
+	Far       basics.Scalar // distance from the light where the map ends, points further away are lit
+}
+
+// DefaultShadowSettings Returns the shadow settings of new lights
+func DefaultShadowSettings() ShadowSettings {
+	return ShadowSettings{
+		MapSize:   512,
+		Bias:      0.02,
+		SlopeBias: 1,
+		PCFRadius: 1,
+		Area:      20,
+		Near:      0.1,
+		Far:       100,
+	}
+}
+
+// LightObject A light of the scene. Only point and spot lights have a position and use the falloff function
 type LightObject struct {
-	name    string
-	color   color.Color
-	falloff FalloffFunction
+	name           string
+	lightType      uint8
+	color          color.Color
+	falloff        FalloffFunction
+	falloffPreset  FalloffPreset // the preset of the falloff function, with an empty name for custom functions
+	innerAngle     basics.Scalar // half angle in degrees of the cone lit with full intensity, used by spot lights
+	outerAngle     basics.Scalar // half angle in degrees where the light of spot lights fades to zero
+	groundColor    color.Color   // used by hemisphere lights
+	castShadows    bool
+	shadowSettings ShadowSettings
 }
 
 func NewEmptyObject(name string) *EmptyObject {
@@ -44,13 +112,15 @@ func (e *EmptyObject) Name() string {
 	return e.name
 }
 
-func NewModelObject(name string, mesh graphics.Mesh, ignoreMeshNormals bool, specularExponent basics.Scalar, ignoreSpecular bool) *ModelObject {
+// NewModelObject Returns a model that casts and receives shadows, with white edges in wireframe
+func NewModelObject(name string, mesh graphics.Mesh, ignoreMeshNormals bool) *ModelObject {
 	return &ModelObject{
 		mesh:              mesh,
 		name:              name,
 		ignoreMeshNormals: ignoreMeshNormals,
-		specularExponent:  specularExponent,
-		ignoreSpecular:    ignoreSpecular,
+		castShadows:       true,
+		receiveShadows:    true,
+		wireColor:         color.RGBA{R: 255, G: 255, B: 255, A: 255},
 	}
 }
 
@@ -66,17 +136,112 @@ func (m *ModelObject) IgnoreMeshNormals() bool {
 	return m.ignoreMeshNormals
 }
 
-func (m *ModelObject) SpecularExponent() basics.Scalar {
-	return m.specularExponent
+// PerPixelLighting Returns true if the lighting of the model is computed for each pixel instead of at the vertices
+func (m *ModelObject) PerPixelLighting() bool {
+	return m.perPixelLighting
+}
+
+// SetPerPixelLighting Enables the lighting of the model for each pixel, regardless of the render mode
+func (m *ModelObject) SetPerPixelLighting(perPixelLighting bool) {
+	m.perPixelLighting = perPixelLighting
+}
+
+// CastShadows Returns true if the model is rendered in the shadow maps of the lights
+func (m *ModelObject) CastShadows() bool {
+	return m.castShadows
+}
+
+func (m *ModelObject) SetCastShadows(castShadows bool) {
+	m.castShadows = castShadows
+}
+
+// ReceiveShadows Returns true if the shadow maps of the lights are tested when lighting the model
+func (m *ModelObject) ReceiveShadows() bool {
+	return m.receiveShadows
+}
+
+func (m *ModelObject) SetReceiveShadows(receiveShadows bool) {
+	m.receiveShadows = receiveShadows
+}
+
+// Shader Returns the shader of the model, nil if the model uses the default Phong shading of the renderer
+func (m *ModelObject) Shader() graphics.Shader {
+	return m.shader
+}
+
+// SetShader Sets the shader used for all the materials of the model, nil restores the default Phong shading
+func (m *ModelObject) SetShader(shader graphics.Shader) {
+	m.shader = shader
+}
+
+// WireColor Returns the color of the edges of the model in the wireframe render modes
+func (m *ModelObject) WireColor() color.RGBA {
+	return m.wireColor
+}
+
+func (m *ModelObject) SetWireColor(wireColor color.RGBA) {
+	m.wireColor = wireColor
+}
+
+// MeshFile Returns the path of the file the mesh was read from, saved in scene files to reference the mesh
+func (m *ModelObject) MeshFile() string {
+	return m.meshFile
+}
+
+func (m *ModelObject) SetMeshFile(meshFile string) {
+	m.meshFile = meshFile
 }
 
-func (m *ModelObject) IgnoreSpecular() bool {
-	return m.ignoreSpecular
+// Edges Returns the edges of the mesh drawn in the wireframe render modes, computed the first time they're needed
+func (m *ModelObject) Edges() []graphics.MeshEdge {
+	if m.edges == nil {
+		m.edges = m.mesh.Edges()
+	}
+	return m.edges
+}
+
+// Bounds Returns the axis aligned box containing the mesh in the space of the model, computed the first time it's needed
+func (m *ModelObject) Bounds() graphics.AABB {
+	return m.modelBounds().box
 }
 
+// BoundingSphere Returns the sphere containing the mesh in the space of the model, computed the first time it's needed
+func (m *ModelObject) BoundingSphere() graphics.BoundingSphere {
+	return m.modelBounds().sphere
+}
+
+func (m *ModelObject) modelBounds() *modelBounds {
+	if m.bounds == nil {
+		m.bounds = &modelBounds{box: m.mesh.Bounds(), sphere: m.mesh.BoundingSphere()}
+	}
+	return m.bounds
+}
+
+// NewCameraObject Returns a perspective camera with the default field of view and clip distances
 func NewCameraObject(name string) *CameraObject {
+	return NewPerspectiveCameraObject(name, DefaultCameraFov, DefaultCameraNear, DefaultCameraFar)
+}
+
+// NewPerspectiveCameraObject fov is the vertical field of view in degrees
+func NewPerspectiveCameraObject(name string, fov basics.Scalar, near basics.Scalar, far basics.Scalar) *CameraObject {
 	return &CameraObject{
-		name: name,
+		name:        name,
+		fov:         fov,
+		near:        near,
+		far:         far,
+		orthoHeight: 2,
+	}
+}
+
+// NewOrthographicCameraObject height is the height of the view volume, the width depends on the aspect ratio
+func NewOrthographicCameraObject(name string, height basics.Scalar, near basics.Scalar, far basics.Scalar) *CameraObject {
+	return &CameraObject{
+		name:         name,
+		fov:          DefaultCameraFov,
+		near:         near,
+		far:          far,
+		orthographic: true,
+		orthoHeight:  height,
 	}
 }
 
@@ -84,11 +249,114 @@ func (c *CameraObject) Name() string {
 	return c.name
 }
 
+// Fov Returns the vertical field of view in degrees
+func (c *CameraObject) Fov() basics.Scalar {
+	return c.fov
+}
+
+// SetFov Sets the vertical field of view in degrees, it must be between 0 and 180 excluded. The value is checked by
+// Validate
+func (c *CameraObject) SetFov(fov basics.Scalar) {
+	c.fov = fov
+}
+
+func (c *CameraObject) Near() basics.Scalar {
+	return c.near
+}
+
+func (c *CameraObject) Far() basics.Scalar {
+	return c.far
+}
+
+// SetClipDistances Sets the distances of the near and far clip planes, far must be greater than near and near must be
+// greater than 0 for perspective cameras. The values are checked by Validate
+func (c *CameraObject) SetClipDistances(near basics.Scalar, far basics.Scalar) {
+	c.near = near
+	c.far = far
+}
+
+// Validate Returns an error if the camera can't project the scene: the field of view of perspective cameras is not
+// between 0 and 180 degrees excluded or their near plane is not in front of the camera, the far plane is not beyond
+// the near plane or the view volume of orthographic cameras has no height
+func (c *CameraObject) Validate() error {
+	if !c.orthographic {
+		if !(c.fov > 0 && c.fov < 180) {
+			return fmt.Errorf("field of view %v is not between 0 and 180 degrees", c.fov)
+		}
+		if !(c.near > 0) {
+			return fmt.Errorf("near distance %v is not greater than 0", c.near)
+		}
+	} else if !(c.orthoHeight > 0) {
+		return fmt.Errorf("orthographic height %v is not greater than 0", c.orthoHeight)
+	}
+	if !(c.far > c.near) {
+		return errors.New("the far distance is not greater than the near distance")
+	}
+	return nil
+}
+
+func (c *CameraObject) Orthographic() bool {
+	return c.orthographic
+}
+
+// SetOrthographic Switches between orthographic and perspective projection
+func (c *CameraObject) SetOrthographic(orthographic bool) {
+	c.orthographic = orthographic
+}
+
+// OrthoHeight Returns the height of the view volume of orthographic cameras
+func (c *CameraObject) OrthoHeight() basics.Scalar {
+	return c.orthoHeight
+}
+
+func (c *CameraObject) SetOrthoHeight(height basics.Scalar) {
+	c.orthoHeight = height
+}
+
+// NewLightObject Returns a point light
 func NewLightObject(name string, lightColor color.Color, lightFallOff FalloffFunction) *LightObject {
 	return &LightObject{
-		name:    name,
-		color:   lightColor,
-		falloff: lightFallOff,
+		name:           name,
+		lightType:      LightTypePoint,
+		shadowSettings: DefaultShadowSettings(),
+		color:          lightColor,
+		falloff:        lightFallOff,
+	}
+}
+
+// NewDirectionalLightObject Returns a light shining along +z of its node, its intensity does not depend on the distance
+func NewDirectionalLightObject(name string, lightColor color.Color) *LightObject {
+	return &LightObject{
+		name:           name,
+		lightType:      LightTypeDirectional,
+		shadowSettings: DefaultShadowSettings(),
+		color:          lightColor,
+	}
+}
+
+// NewSpotLightObject Returns a light shining in a cone along +z of its node. innerAngle and outerAngle are the half
+// angles of the cone in degrees, the intensity fades smoothly between them
+func NewSpotLightObject(name string, lightColor color.Color, lightFallOff FalloffFunction, innerAngle basics.Scalar, outerAngle basics.Scalar) *LightObject {
+	l := &LightObject{
+		name:           name,
+		lightType:      LightTypeSpot,
+		shadowSettings: DefaultShadowSettings(),
+		color:          lightColor,
+		falloff:        lightFallOff,
+	}
+	l.SetConeAngles(innerAngle, outerAngle)
+	return l
+}
+
+// NewHemisphereLightObject Returns an ambient light blending from groundColor on the surfaces facing -y of its node to
+// skyColor on the surfaces facing +y. With the same sky and ground color it's a uniform ambient light
+func NewHemisphereLightObject(name string, skyColor color.Color, groundColor color.Color) *LightObject {
+	return &LightObject{
+		name:           name,
+		lightType:      LightTypeHemisphere,
+		shadowSettings: DefaultShadowSettings(),
+		color:          skyColor,
+		groundColor:    groundColor,
 	}
 }
 
@@ -96,10 +364,76 @@ func (l *LightObject) Name() string {
 	return l.name
 }
 
+// Type Returns one of the LightType constants
+func (l *LightObject) Type() uint8 {
+	return l.lightType
+}
+
+// Color Returns the color of the light, the sky color for hemisphere lights
 func (l *LightObject) Color() color.Color {
 	return l.color
 }
 
+func (l *LightObject) SetColor(lightColor color.Color) {
+	l.color = lightColor
+}
+
+// FallOff Returns the attenuation of the light by the distance, nil for lights that are not attenuated
 func (l *LightObject) FallOff() FalloffFunction {
 	return l.falloff
 }
+
+// FalloffPreset Returns the preset of the falloff function, false if the light is not attenuated or the function was
+// not built from a preset
+func (l *LightObject) FalloffPreset() (FalloffPreset, bool) {
+	return l.falloffPreset, l.falloffPreset.Name != ""
+}
+
+// SetFalloffPreset Replaces the falloff function with the one of the preset, returns an error if the preset is not valid
+func (l *LightObject) SetFalloffPreset(preset FalloffPreset) error {
+	falloff, err := NewFalloffFunction(preset)
+	if err != nil {
+		return err
+	}
+	l.falloff = falloff
+	l.falloffPreset = preset
+	return nil
+}
+
+// ConeAngles Returns the inner and outer half angles in degrees of the cone of spot lights
+func (l *LightObject) ConeAngles() (basics.Scalar, basics.Scalar) {
+	return l.innerAngle, l.outerAngle
+}
+
+// SetConeAngles Sets the half angles in degrees of the cone of spot lights, the inner angle is limited to the outer one
+func (l *LightObject) SetConeAngles(innerAngle basics.Scalar, outerAngle basics.Scalar) {
+	l.outerAngle = basics.Clamp(0, 90, outerAngle)
+	l.innerAngle = basics.Clamp(0, l.outerAngle, innerAngle)
+}
+
+// GroundColor Returns the color of hemisphere lights on the surfaces facing down
+func (l *LightObject) GroundColor() color.Color {
+	return l.groundColor
+}
+
+func (l *LightObject) SetGroundColor(groundColor color.Color) {
+	l.groundColor = groundColor
+}
+
+// CastShadows Returns true if a shadow map is rendered for the light. Hemisphere lights never cast shadows
+func (l *LightObject) CastShadows() bool {
+	return l.castShadows && l.lightType != LightTypeHemisphere
+}
+
+// SetCastShadows Enables the shadows of the light, they are disabled by default
+func (l *LightObject) SetCastShadows(castShadows bool) {
+	l.castShadows = castShadows
+}
+
+func (l *LightObject) ShadowSettings() ShadowSettings {
+	return l.shadowSettings
+}
+
+func (l *LightObject) SetShadowSettings(settings ShadowSettings) {
+	l.shadowSettings = settings
+}
@@ -0,0 +1,1043 @@
+package entities
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"image/color"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+glTF 2.0 importer. glTF is right-handed with the cameras looking at -z, while the renderer is left-handed with the cameras
+looking at +z: the z axis is mirrored on import and the winding of the triangles is reversed, so the assets keep their
+handedness and the cameras and lights of the file point the same way.
+Transforms have a uniform scale only, non-uniform scales of the nodes are baked in their meshes and the children inherit
+the geometric mean of the scale. Skins, morph targets, animations and sparse accessors are not supported
+*/
+
+const (
+	glbMagic     = 0x46546C67 // "glTF"
+	glbChunkJSON = 0x4E4F534A
+	glbChunkBIN  = 0x004E4942
+)
+
+const (
+	gltfModeTriangles     = 4
+	gltfModeTriangleStrip = 5
+	gltfModeTriangleFan   = 6
+)
+
+const (
+	gltfFilterNearest = 9728
+	gltfWrapClamp     = 33071
+)
+
+// gltfMaxZeroAccessorCount Maximum number of elements of an accessor without buffer view, the count of the other
+// accessors is limited by the size of their buffer view
+const gltfMaxZeroAccessorCount = 1 << 24
+
+// gltfComponentSizes Size in bytes of the component types of the accessors
+var gltfComponentSizes = map[int]int{5120: 1, 5121: 1, 5122: 2, 5123: 2, 5125: 4, 5126: 4}
+
+// gltfTypeComponents Number of components of the element types of the accessors
+var gltfTypeComponents = map[string]int{"SCALAR": 1, "VEC2": 2, "VEC3": 3, "VEC4": 4, "MAT2": 4, "MAT3": 9, "MAT4": 16}
+
+// gltfSupportedExtensions Extensions that can be required by the files
+var gltfSupportedExtensions = map[string]bool{"KHR_lights_punctual": true}
+
+type gltfDocument struct {
+	Asset struct {
+		Version string `json:"version"`
+	} `json:"asset"`
+	ExtensionsRequired []string `json:"extensionsRequired"`
+	Scene              *int     `json:"scene"`
+	Scenes             []struct {
+		Nodes []int `json:"nodes"`
+	} `json:"scenes"`
+	Nodes       []gltfNode       `json:"nodes"`
+	Meshes      []gltfMesh       `json:"meshes"`
+	Accessors   []gltfAccessor   `json:"accessors"`
+	BufferViews []gltfBufferView `json:"bufferViews"`
+	Buffers     []gltfBuffer     `json:"buffers"`
+	Materials   []gltfMaterial   `json:"materials"`
+	Textures    []gltfTexture    `json:"textures"`
+	Images      []gltfImage      `json:"images"`
+	Samplers    []gltfSampler    `json:"samplers"`
+	Cameras     []gltfCamera     `json:"cameras"`
+	Extensions  struct {
+		LightsPunctual struct {
+			Lights []gltfLight `json:"lights"`
+		} `json:"KHR_lights_punctual"`
+	} `json:"extensions"`
+}
+
+type gltfNode struct {
+	Name        string             `json:"name"`
+	Children    []int              `json:"children"`
+	Matrix      *[16]basics.Scalar `json:"matrix"` // column major
+	Translation *[3]basics.Scalar  `json:"translation"`
+	Rotation    *[4]basics.Scalar  `json:"rotation"` // x, y, z, w
+	Scale       *[3]basics.Scalar  `json:"scale"`
+	Mesh        *int               `json:"mesh"`
+	Camera      *int               `json:"camera"`
+	Extensions  struct {
+		LightsPunctual *struct {
+			Light int `json:"light"`
+		} `json:"KHR_lights_punctual"`
+	} `json:"extensions"`
+}
+
+type gltfMesh struct {
+	Name       string `json:"name"`
+	Primitives []struct {
+		Attributes map[string]int `json:"attributes"`
+		Indices    *int           `json:"indices"`
+		Material   *int           `json:"material"`
+		Mode       *int           `json:"mode"`
+	} `json:"primitives"`
+}
+
+type gltfAccessor struct {
+	BufferView    *int            `json:"bufferView"`
+	ByteOffset    int             `json:"byteOffset"`
+	ComponentType int             `json:"componentType"`
+	Normalized    bool            `json:"normalized"`
+	Count         int             `json:"count"`
+	Type          string          `json:"type"`
+	Sparse        json.RawMessage `json:"sparse"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	ByteStride int `json:"byteStride"`
+}
+
+type gltfBuffer struct {
+	URI        string `json:"uri"`
+	ByteLength int    `json:"byteLength"`
+}
+
+type gltfTextureInfo struct {
+	Index    int `json:"index"`
+	TexCoord int `json:"texCoord"`
+}
+
+type gltfMaterial struct {
+	Name                 string `json:"name"`
+	PbrMetallicRoughness *struct {
+		BaseColorFactor  *[4]basics.Scalar `json:"baseColorFactor"`
+		BaseColorTexture *gltfTextureInfo  `json:"baseColorTexture"`
+		MetallicFactor   *basics.Scalar    `json:"metallicFactor"`
+		RoughnessFactor  *basics.Scalar    `json:"roughnessFactor"`
+	} `json:"pbrMetallicRoughness"`
+	AlphaMode string `json:"alphaMode"`
+}
+
+type gltfTexture struct {
+	Sampler *int `json:"sampler"`
+	Source  *int `json:"source"`
+}
+
+type gltfImage struct {
+	URI        string `json:"uri"`
+	MimeType   string `json:"mimeType"`
+	BufferView *int   `json:"bufferView"`
+}
+
+type gltfSampler struct {
+	MagFilter int `json:"magFilter"`
+	WrapS     int `json:"wrapS"`
+}
+
+type gltfCamera struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Perspective *struct {
+		Yfov  basics.Scalar  `json:"yfov"` // radians
+		Znear basics.Scalar  `json:"znear"`
+		Zfar  *basics.Scalar `json:"zfar"` // missing for an infinite projection
+	} `json:"perspective"`
+	Orthographic *struct {
+		Ymag  basics.Scalar `json:"ymag"` // half of the height of the view volume
+		Znear basics.Scalar `json:"znear"`
+		Zfar  basics.Scalar `json:"zfar"`
+	} `json:"orthographic"`
+}
+
+type gltfLight struct {
+	Name      string            `json:"name"`
+	Type      string            `json:"type"`
+	Color     *[3]basics.Scalar `json:"color"` // linear
+	Intensity *basics.Scalar    `json:"intensity"`
+	Range     *basics.Scalar    `json:"range"`
+	Spot      *struct {
+		InnerConeAngle *basics.Scalar `json:"innerConeAngle"` // radians
+		OuterConeAngle *basics.Scalar `json:"outerConeAngle"`
+	} `json:"spot"`
+}
+
+// gltfMeshKey A mesh of the file with the non-uniform part of the scale of the node baked in
+type gltfMeshKey struct {
+	mesh  int
+	scale basics.Vector3
+}
+
+// gltfReader Builds the scene graph of a glTF asset, meshes, materials and textures are built once and shared
+type gltfReader struct {
+	dir        string
+	doc        gltfDocument
+	binChunk   []byte // binary chunk of GLB files
+	buffers    [][]byte
+	materials  map[int]graphics.Material
+	textures   map[int]*graphics.Texture
+	meshes     map[gltfMeshKey]graphics.Mesh
+	sceneGraph *SceneGraph
+	visited    []bool
+}
+
+// NewSceneGraphFromGLTF reads a glTF 2.0 asset, either in JSON (.gltf) or binary (.glb) form, and returns a scene graph
+// with the nodes of the default scene as children of the world node. Nodes keep their names, made unique with a numeric
+// suffix, and get a ModelObject, CameraObject or LightObject (KHR_lights_punctual) from their mesh, camera or light,
+// nodes with more than one of them get the others in child nodes. Buffers and images can be embedded as data URIs, in
+// the binary chunk of GLB files or in external files resolved from dir.
+// Materials use the base color of the metallic-roughness model as diffuse color and texture, the roughness and
+// metallic factors become the specular highlights. Point and spot lights without a range fade with the inverse square
+// of the distance, reaching half of their color at the square root of their intensity in candela, the color of
+// directional lights is scaled by their intensity up to 1 lux
+func NewSceneGraphFromGLTF(reader io.Reader, dir string) (*SceneGraph, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	r := gltfReader{
+		dir:        dir,
+		materials:  make(map[int]graphics.Material),
+		textures:   make(map[int]*graphics.Texture),
+		meshes:     make(map[gltfMeshKey]graphics.Mesh),
+		sceneGraph: NewSceneGraph(),
+	}
+	if err := r.read(data); err != nil {
+		return nil, fmt.Errorf("gltf: %w", err)
+	}
+	return r.sceneGraph, nil
+}
+
+// NewSceneGraphFromGLTFFile reads a glTF asset like NewSceneGraphFromGLTF, external files are relative to the
+// directory of the file
+func NewSceneGraphFromGLTFFile(fileName string) (*SceneGraph, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sceneGraph, err := NewSceneGraphFromGLTF(f, filepath.Dir(fileName))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return sceneGraph, nil
+}
+
+func (r *gltfReader) read(data []byte) error {
+	if len(data) >= 4 && binary.LittleEndian.Uint32(data) == glbMagic {
+		var err error
+		if data, err = r.readGLB(data); err != nil {
+			return err
+		}
+	}
+	if err := json.Unmarshal(data, &r.doc); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(r.doc.Asset.Version, "2.") {
+		return fmt.Errorf("unsupported version %q", r.doc.Asset.Version)
+	}
+	for _, extension := range r.doc.ExtensionsRequired {
+		if !gltfSupportedExtensions[extension] {
+			return fmt.Errorf("unsupported required extension %q", extension)
+		}
+	}
+	if err := r.loadBuffers(); err != nil {
+		return err
+	}
+
+	r.visited = make([]bool, len(r.doc.Nodes))
+	for _, root := range r.rootNodes() {
+		if err := r.addNode("world", root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readGLB Returns the JSON chunk of a GLB file and keeps the binary chunk
+func (r *gltfReader) readGLB(data []byte) ([]byte, error) {
+	if len(data) < 12 {
+		return nil, errors.New("truncated GLB header")
+	}
+	if version := binary.LittleEndian.Uint32(data[4:]); version != 2 {
+		return nil, fmt.Errorf("unsupported GLB version %d", version)
+	}
+	length := int(binary.LittleEndian.Uint32(data[8:]))
+	if length > len(data) {
+		return nil, errors.New("truncated GLB file")
+	}
+	var jsonChunk []byte
+	for offset := 12; offset+8 <= length; {
+		chunkLength := int(binary.LittleEndian.Uint32(data[offset:]))
+		chunkType := binary.LittleEndian.Uint32(data[offset+4:])
+		start := offset + 8
+		if chunkLength < 0 || start+chunkLength > length {
+			return nil, errors.New("truncated GLB chunk")
+		}
+		switch {
+		case chunkType == glbChunkJSON && jsonChunk == nil:
+			jsonChunk = data[start : start+chunkLength]
+		case chunkType == glbChunkBIN && r.binChunk == nil:
+			r.binChunk = data[start : start+chunkLength]
+		}
+		// chunks are aligned to 4 bytes
+		offset = start + (chunkLength+3)&^3
+	}
+	if jsonChunk == nil {
+		return nil, errors.New("GLB file without JSON chunk")
+	}
+	return jsonChunk, nil
+}
+
+// readURI Returns the content of a data URI or of a file relative to the directory of the asset
+func (r *gltfReader) readURI(uri string) ([]byte, error) {
+	if strings.HasPrefix(uri, "data:") {
+		comma := strings.IndexByte(uri, ',')
+		if comma < 0 || !strings.HasSuffix(uri[:comma], ";base64") {
+			return nil, errors.New("only base64 data URIs are supported")
+		}
+		return base64.StdEncoding.DecodeString(uri[comma+1:])
+	}
+	return os.ReadFile(r.resolve(uri))
+}
+
+// resolve Returns the path of a relative URI
+func (r *gltfReader) resolve(uri string) string {
+	path, err := url.PathUnescape(uri)
+	if err != nil {
+		path = uri
+	}
+	return filepath.Join(r.dir, filepath.FromSlash(path))
+}
+
+func (r *gltfReader) loadBuffers() error {
+	r.buffers = make([][]byte, len(r.doc.Buffers))
+	for i, buffer := range r.doc.Buffers {
+		var data []byte
+		var err error
+		switch {
+		case buffer.URI != "":
+			data, err = r.readURI(buffer.URI)
+		case i == 0 && r.binChunk != nil:
+			data = r.binChunk
+		default:
+			err = errors.New("no data")
+		}
+		if err != nil {
+			return fmt.Errorf("buffer %d: %w", i, err)
+		}
+		if len(data) < buffer.ByteLength {
+			return fmt.Errorf("buffer %d: %d bytes, expected %d", i, len(data), buffer.ByteLength)
+		}
+		r.buffers[i] = data
+	}
+	return nil
+}
+
+// rootNodes Returns the nodes of the default scene, the nodes without a parent when the asset has no scenes
+func (r *gltfReader) rootNodes() []int {
+	if len(r.doc.Scenes) > 0 {
+		scene := 0
+		if r.doc.Scene != nil && *r.doc.Scene >= 0 && *r.doc.Scene < len(r.doc.Scenes) {
+			scene = *r.doc.Scene
+		}
+		return r.doc.Scenes[scene].Nodes
+	}
+	isChild := make([]bool, len(r.doc.Nodes))
+	for _, node := range r.doc.Nodes {
+		for _, child := range node.Children {
+			if child >= 0 && child < len(isChild) {
+				isChild[child] = true
+			}
+		}
+	}
+	var roots []int
+	for i := range r.doc.Nodes {
+		if !isChild[i] {
+			roots = append(roots, i)
+		}
+	}
+	return roots
+}
+
+/* Nodes */
+
+// uniqueName Returns the name, or a default name if it's empty, with a numeric suffix if it's used by another node
+func (r *gltfReader) uniqueName(name string, defaultName string) string {
+	if name == "" {
+		name = defaultName
+	}
+	unique := name
+	for i := 2; r.sceneGraph.GetNode(unique) != nil; i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	return unique
+}
+
+func (r *gltfReader) addNode(parentName string, index int) error {
+	if index < 0 || index >= len(r.doc.Nodes) {
+		return fmt.Errorf("node %d does not exist", index)
+	}
+	if r.visited[index] {
+		return fmt.Errorf("node %d has more than one parent", index)
+	}
+	r.visited[index] = true
+	node := &r.doc.Nodes[index]
+	name := r.uniqueName(node.Name, fmt.Sprintf("node%d", index))
+
+	t, meshScale := node.transform()
+	var objects []GameObject
+	if node.Mesh != nil {
+		model, err := r.model(*node.Mesh, meshScale, name)
+		if err != nil {
+			return fmt.Errorf("node %q: %w", name, err)
+		}
+		objects = append(objects, model)
+	}
+	if node.Camera != nil {
+		camera, err := r.camera(*node.Camera, name)
+		if err != nil {
+			return fmt.Errorf("node %q: %w", name, err)
+		}
+		objects = append(objects, camera)
+	}
+	if node.Extensions.LightsPunctual != nil {
+		light, err := r.light(node.Extensions.LightsPunctual.Light, name)
+		if err != nil {
+			return fmt.Errorf("node %q: %w", name, err)
+		}
+		objects = append(objects, light)
+	}
+	if len(objects) == 0 {
+		objects = append(objects, NewEmptyObject(name))
+	}
+
+	if err := r.sceneGraph.AddChild(parentName, NewSceneGraphNode(objects[0], name), t); err != nil {
+		return fmt.Errorf("node %q: %w", name, err)
+	}
+	// the other objects don't inherit the non-uniform scale of the node, that only applies to its mesh
+	for _, object := range objects[1:] {
+		childName := r.uniqueName(name+"_"+object.Name(), "")
+		if err := r.sceneGraph.AddChild(name, NewSceneGraphNode(object, childName), basics.NewZeroTransform()); err != nil {
+			return err
+		}
+	}
+	for _, child := range node.Children {
+		if err := r.addNode(name, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transform Returns the transform of the node converted to the space of the renderer, with the geometric mean of its
+// scale, and the scale left to bake in the mesh
+func (node *gltfNode) transform() (basics.Transform, basics.Vector3) {
+	translation := basics.Vector3{}
+	rotation := basics.NewIdentityQuaternion()
+	scale := basics.NewVector3(1, 1, 1)
+	if node.Matrix != nil {
+		translation, rotation, scale = decomposeGLTFMatrix(node.Matrix)
+	} else {
+		if node.Translation != nil {
+			translation = basics.NewVector3(node.Translation[0], node.Translation[1], node.Translation[2])
+		}
+		if node.Rotation != nil {
+			rotation = basics.NewQuaternionFromScalars(node.Rotation[0], node.Rotation[1], node.Rotation[2], node.Rotation[3])
+			if !rotation.IsZero() {
+				rotation.ThisNormalize()
+			}
+		}
+		if node.Scale != nil {
+			scale = basics.NewVector3(node.Scale[0], node.Scale[1], node.Scale[2])
+		}
+	}
+
+	// mirroring z negates the z of the translation and the x and y of the axis of the rotation
+	translation.Z = -translation.Z
+	rotation.Im.X, rotation.Im.Y = -rotation.Im.X, -rotation.Im.Y
+
+	uniform := basics.Scalar(math.Cbrt(math.Abs(float64(scale.X * scale.Y * scale.Z))))
+	meshScale := basics.NewVector3(1, 1, 1)
+	if uniform != 0 {
+		meshScale = scale.Div(uniform)
+	}
+	return basics.NewTransform(uniform, rotation, translation), meshScale
+}
+
+// decomposeGLTFMatrix Returns the translation, rotation and scale of a column major affine matrix. A negative
+// determinant is returned as a negative scale on x
+func decomposeGLTFMatrix(m *[16]basics.Scalar) (basics.Vector3, basics.Quaternion, basics.Vector3) {
+	translation := basics.NewVector3(m[12], m[13], m[14])
+	columns := [3]basics.Vector3{
+		basics.NewVector3(m[0], m[1], m[2]),
+		basics.NewVector3(m[4], m[5], m[6]),
+		basics.NewVector3(m[8], m[9], m[10]),
+	}
+	scale := basics.NewVector3(columns[0].Length(), columns[1].Length(), columns[2].Length())
+	if columns[0].Dot(columns[1].Cross(columns[2])) < 0 {
+		scale.X = -scale.X
+	}
+	// r[i][j] is the row i and column j of the rotation
+	var r [3][3]basics.Scalar
+	for j, s := range [3]basics.Scalar{scale.X, scale.Y, scale.Z} {
+		if s == 0 {
+			r[j][j] = 1
+			continue
+		}
+		c := columns[j].Div(s)
+		r[0][j], r[1][j], r[2][j] = c.X, c.Y, c.Z
+	}
+
+	var x, y, z, w basics.Scalar
+	trace := r[0][0] + r[1][1] + r[2][2]
+	switch {
+	case trace > 0:
+		s := basics.Sqrt(trace+1) * 2
+		w, x, y, z = s/4, (r[2][1]-r[1][2])/s, (r[0][2]-r[2][0])/s, (r[1][0]-r[0][1])/s
+	case r[0][0] > r[1][1] && r[0][0] > r[2][2]:
+		s := basics.Sqrt(1+r[0][0]-r[1][1]-r[2][2]) * 2
+		w, x, y, z = (r[2][1]-r[1][2])/s, s/4, (r[0][1]+r[1][0])/s, (r[0][2]+r[2][0])/s
+	case r[1][1] > r[2][2]:
+		s := basics.Sqrt(1+r[1][1]-r[0][0]-r[2][2]) * 2
+		w, x, y, z = (r[0][2]-r[2][0])/s, (r[0][1]+r[1][0])/s, s/4, (r[1][2]+r[2][1])/s
+	default:
+		s := basics.Sqrt(1+r[2][2]-r[0][0]-r[1][1]) * 2
+		w, x, y, z = (r[1][0]-r[0][1])/s, (r[0][2]+r[2][0])/s, (r[1][2]+r[2][1])/s, s/4
+	}
+	rotation := basics.NewQuaternionFromScalars(x, y, z, w)
+	rotation.ThisNormalize()
+	return translation, rotation, scale
+}
+
+/* Accessors */
+
+// accessor Returns the elements of the accessor one after the other and the number of components of each element.
+// Normalized integers are mapped to the range 0-1, or -1-1 if signed
+func (r *gltfReader) accessor(index int) ([]basics.Scalar, int, error) {
+	if index < 0 || index >= len(r.doc.Accessors) {
+		return nil, 0, fmt.Errorf("accessor %d does not exist", index)
+	}
+	a := &r.doc.Accessors[index]
+	if a.Sparse != nil {
+		return nil, 0, fmt.Errorf("accessor %d: sparse accessors are not supported", index)
+	}
+	components, ok := gltfTypeComponents[a.Type]
+	if !ok {
+		return nil, 0, fmt.Errorf("accessor %d: unknown type %q", index, a.Type)
+	}
+	size, ok := gltfComponentSizes[a.ComponentType]
+	if !ok {
+		return nil, 0, fmt.Errorf("accessor %d: unknown component type %d", index, a.ComponentType)
+	}
+	if a.Count < 0 {
+		return nil, 0, fmt.Errorf("accessor %d: negative count", index)
+	}
+	if a.BufferView == nil {
+		// accessors without buffer view are zeros
+		if a.Count > gltfMaxZeroAccessorCount {
+			return nil, 0, fmt.Errorf("accessor %d: count %d without buffer view is too large", index, a.Count)
+		}
+		return make([]basics.Scalar, a.Count*components), components, nil
+	}
+	data, err := r.bufferView(*a.BufferView)
+	if err != nil {
+		return nil, 0, fmt.Errorf("accessor %d: %w", index, err)
+	}
+	elementSize := components * size
+	stride := r.doc.BufferViews[*a.BufferView].ByteStride
+	if stride == 0 {
+		stride = elementSize
+	}
+	if a.ByteOffset < 0 || stride < elementSize {
+		return nil, 0, fmt.Errorf("accessor %d: invalid byte offset %d or stride %d", index, a.ByteOffset, stride)
+	}
+	// the last element must end inside the view, written so that a large count can't overflow
+	if a.Count > 0 && (a.ByteOffset > len(data)-elementSize || a.Count-1 > (len(data)-elementSize-a.ByteOffset)/stride) {
+		return nil, 0, fmt.Errorf("accessor %d: out of the bounds of the buffer view", index)
+	}
+	values := make([]basics.Scalar, a.Count*components)
+	for i := 0; i < a.Count; i++ {
+		element := data[a.ByteOffset+i*stride:]
+		for c := 0; c < components; c++ {
+			values[i*components+c] = gltfComponent(element[c*size:], a.ComponentType, a.Normalized)
+		}
+	}
+	return values, components, nil
+}
+
+// bufferView Returns the bytes of the buffer view, an error if the view does not exist or is out of the bounds of its
+// buffer
+func (r *gltfReader) bufferView(index int) ([]byte, error) {
+	if index < 0 || index >= len(r.doc.BufferViews) {
+		return nil, fmt.Errorf("buffer view %d does not exist", index)
+	}
+	view := &r.doc.BufferViews[index]
+	if view.Buffer < 0 || view.Buffer >= len(r.buffers) {
+		return nil, fmt.Errorf("buffer view %d: buffer %d does not exist", index, view.Buffer)
+	}
+	buffer := r.buffers[view.Buffer]
+	if view.ByteOffset < 0 || view.ByteLength < 0 || view.ByteOffset > len(buffer) || view.ByteLength > len(buffer)-view.ByteOffset {
+		return nil, fmt.Errorf("buffer view %d: out of the bounds of buffer %d", index, view.Buffer)
+	}
+	return buffer[view.ByteOffset : view.ByteOffset+view.ByteLength], nil
+}
+
+// gltfComponent Decodes a little endian component
+func gltfComponent(data []byte, componentType int, normalized bool) basics.Scalar {
+	var value, maxValue basics.Scalar
+	switch componentType {
+	case 5120:
+		value, maxValue = basics.Scalar(int8(data[0])), 127
+	case 5121:
+		value, maxValue = basics.Scalar(data[0]), 255
+	case 5122:
+		value, maxValue = basics.Scalar(int16(binary.LittleEndian.Uint16(data))), 32767
+	case 5123:
+		value, maxValue = basics.Scalar(binary.LittleEndian.Uint16(data)), 65535
+	case 5125:
+		return basics.Scalar(binary.LittleEndian.Uint32(data))
+	default:
+		return basics.Scalar(math.Float32frombits(binary.LittleEndian.Uint32(data)))
+	}
+	if normalized {
+		return max(value/maxValue, -1)
+	}
+	return value
+}
+
+// attribute Returns the elements of the attribute of a primitive, nil if the primitive does not have it. Returns an
+// error if the number of elements is not count or the elements have less than components components
+func (r *gltfReader) attribute(attributes map[string]int, name string, count int, components int) ([]basics.Scalar, int, error) {
+	index, ok := attributes[name]
+	if !ok {
+		return nil, 0, nil
+	}
+	values, n, err := r.accessor(index)
+	if err != nil {
+		return nil, 0, err
+	}
+	if n < components || len(values) != count*n {
+		return nil, 0, fmt.Errorf("attribute %s: invalid accessor %d", name, index)
+	}
+	return values, n, nil
+}
+
+/* Meshes and materials */
+
+// model Returns a model of the mesh with the scale baked in its vertices
+func (r *gltfReader) model(index int, scale basics.Vector3, nodeName string) (*ModelObject, error) {
+	if index < 0 || index >= len(r.doc.Meshes) {
+		return nil, fmt.Errorf("mesh %d does not exist", index)
+	}
+	key := gltfMeshKey{mesh: index, scale: scale}
+	mesh, ok := r.meshes[key]
+	if !ok {
+		var err error
+		if mesh, err = r.mesh(index, scale); err != nil {
+			return nil, fmt.Errorf("mesh %d: %w", index, err)
+		}
+		r.meshes[key] = mesh
+	}
+	name := r.doc.Meshes[index].Name
+	if name == "" {
+		name = nodeName
+	}
+	return NewModelObject(name, mesh, false), nil
+}
+
+// mesh Builds the triangles of all the primitives of a mesh, with the material of each primitive. Primitives drawing
+// points or lines are skipped
+func (r *gltfReader) mesh(index int, scale basics.Vector3) (graphics.Mesh, error) {
+	var geometry []graphics.VertexAttributes
+	var connectivity []graphics.TriangleConnectivity
+	var materials []graphics.Material
+	var faceMaterials []int
+	materialLookup := make(map[int]int)
+	// the scale mirrors the mesh when it has an odd number of negative components
+	mirrored := scale.X*scale.Y*scale.Z < 0
+	white := basics.NewVector3(65535, 65535, 65535)
+
+	for p, primitive := range r.doc.Meshes[index].Primitives {
+		mode := gltfModeTriangles
+		if primitive.Mode != nil {
+			mode = *primitive.Mode
+		}
+		if mode != gltfModeTriangles && mode != gltfModeTriangleStrip && mode != gltfModeTriangleFan {
+			continue
+		}
+
+		materialIndex := -1
+		if primitive.Material != nil {
+			materialIndex = *primitive.Material
+		}
+		material, texCoord, err := r.material(materialIndex)
+		if err != nil {
+			return graphics.Mesh{}, err
+		}
+		slot, ok := materialLookup[materialIndex]
+		if !ok {
+			slot = len(materials)
+			materialLookup[materialIndex] = slot
+			materials = append(materials, material)
+		}
+
+		positionIndex, ok := primitive.Attributes["POSITION"]
+		if !ok {
+			return graphics.Mesh{}, fmt.Errorf("primitive %d has no positions", p)
+		}
+		positions, n, err := r.accessor(positionIndex)
+		if err != nil {
+			return graphics.Mesh{}, err
+		}
+		if n != 3 {
+			return graphics.Mesh{}, fmt.Errorf("primitive %d: positions must be VEC3", p)
+		}
+		count := len(positions) / 3
+		normals, _, err := r.attribute(primitive.Attributes, "NORMAL", count, 3)
+		if err != nil {
+			return graphics.Mesh{}, err
+		}
+		uvs, uvComponents, err := r.attribute(primitive.Attributes, fmt.Sprintf("TEXCOORD_%d", texCoord), count, 2)
+		if err != nil {
+			return graphics.Mesh{}, err
+		}
+		colors, colorComponents, err := r.attribute(primitive.Attributes, "COLOR_0", count, 3)
+		if err != nil {
+			return graphics.Mesh{}, err
+		}
+
+		vertexPositions := make([]basics.Vector3, count)
+		vertexNormals := make([]basics.Vector3, count)
+		vertexColors := make([]basics.Vector3, count)
+		vertexUVs := make([]basics.Vector3, count)
+		for i := 0; i < count; i++ {
+			// z is mirrored, the texture coordinates start from the top of the image
+			vertexPositions[i] = basics.NewVector3(positions[i*3]*scale.X, positions[i*3+1]*scale.Y, -positions[i*3+2]*scale.Z)
+			if normals != nil {
+				normal := basics.NewVector3(normals[i*3]/scale.X, normals[i*3+1]/scale.Y, -normals[i*3+2]/scale.Z)
+				if !normal.IsZero() {
+					normal = normal.Normalized()
+				}
+				vertexNormals[i] = normal
+			}
+			if uvs != nil {
+				vertexUVs[i] = basics.NewVector3(uvs[i*uvComponents], 1-uvs[i*uvComponents+1], 0)
+			}
+			vertexColors[i] = white
+			if colors != nil {
+				c := colors[i*colorComponents:]
+				vertexColors[i] = basics.NewVector3(linearToSRGB(c[0]), linearToSRGB(c[1]), linearToSRGB(c[2])).Mul(65535)
+			}
+		}
+
+		indices := make([]int, count)
+		for i := range indices {
+			indices[i] = i
+		}
+		if primitive.Indices != nil {
+			values, n, err := r.accessor(*primitive.Indices)
+			if err != nil {
+				return graphics.Mesh{}, err
+			}
+			if n != 1 {
+				return graphics.Mesh{}, fmt.Errorf("primitive %d: indices must be SCALAR", p)
+			}
+			indices = indices[:0]
+			for _, v := range values {
+				if v < 0 || int(v) >= count {
+					return graphics.Mesh{}, fmt.Errorf("primitive %d: index %v out of range", p, v)
+				}
+				indices = append(indices, int(v))
+			}
+		}
+
+		first := len(geometry)
+		if normals != nil {
+			for i := 0; i < count; i++ {
+				geometry = append(geometry, graphics.NewVertexAttributes(vertexPositions[i], vertexColors[i], vertexNormals[i], vertexUVs[i]))
+			}
+		}
+		for _, t := range gltfTriangles(indices, mode) {
+			// the winding is reversed by the mirrored z, and again by a mirroring scale
+			if !mirrored {
+				t[1], t[2] = t[2], t[1]
+			}
+			if normals != nil {
+				connectivity = append(connectivity, graphics.TriangleConnectivity{first + t[0], first + t[1], first + t[2]})
+			} else {
+				// flat shading, every triangle has its own vertices with the normal of the face
+				p0, p1, p2 := vertexPositions[t[0]], vertexPositions[t[1]], vertexPositions[t[2]]
+				normal := p1.Sub(p0).Cross(p2.Sub(p0))
+				if !normal.IsZero() {
+					normal = normal.Normalized()
+				}
+				for _, v := range t {
+					geometry = append(geometry, graphics.NewVertexAttributes(vertexPositions[v], vertexColors[v], normal, vertexUVs[v]))
+				}
+				connectivity = append(connectivity, graphics.TriangleConnectivity{len(geometry) - 3, len(geometry) - 2, len(geometry) - 1})
+			}
+			faceMaterials = append(faceMaterials, slot)
+		}
+	}
+	return graphics.NewMeshWithMaterials(geometry, connectivity, materials, faceMaterials), nil
+}
+
+// gltfTriangles Returns the triangles of the indices drawn with the mode, with the winding of the file
+func gltfTriangles(indices []int, mode int) []graphics.TriangleConnectivity {
+	var triangles []graphics.TriangleConnectivity
+	switch mode {
+	case gltfModeTriangles:
+		for i := 0; i+2 < len(indices); i += 3 {
+			triangles = append(triangles, graphics.TriangleConnectivity{indices[i], indices[i+1], indices[i+2]})
+		}
+	case gltfModeTriangleStrip:
+		for i := 0; i+2 < len(indices); i++ {
+			if i%2 == 0 {
+				triangles = append(triangles, graphics.TriangleConnectivity{indices[i], indices[i+1], indices[i+2]})
+			} else {
+				triangles = append(triangles, graphics.TriangleConnectivity{indices[i+1], indices[i], indices[i+2]})
+			}
+		}
+	case gltfModeTriangleFan:
+		for i := 1; i+1 < len(indices); i++ {
+			triangles = append(triangles, graphics.TriangleConnectivity{indices[0], indices[i], indices[i+1]})
+		}
+	}
+	return triangles
+}
+
+// material Returns the material at the index and the texture coordinates set of its texture, the default material
+// for a negative index
+func (r *gltfReader) material(index int) (graphics.Material, int, error) {
+	if index < 0 {
+		return graphics.NewDefaultMaterial(), 0, nil
+	}
+	if index >= len(r.doc.Materials) {
+		return graphics.Material{}, 0, fmt.Errorf("material %d does not exist", index)
+	}
+	m := &r.doc.Materials[index]
+	texCoord := 0
+	if material, ok := r.materials[index]; ok {
+		if pbr := m.PbrMetallicRoughness; pbr != nil && pbr.BaseColorTexture != nil {
+			texCoord = pbr.BaseColorTexture.TexCoord
+		}
+		return material, texCoord, nil
+	}
+
+	baseColor := [4]basics.Scalar{1, 1, 1, 1}
+	metallic, roughness := basics.Scalar(1), basics.Scalar(1)
+	var texture *graphics.Texture
+	var diffuseMap string
+	if pbr := m.PbrMetallicRoughness; pbr != nil {
+		if pbr.BaseColorFactor != nil {
+			baseColor = *pbr.BaseColorFactor
+		}
+		if pbr.MetallicFactor != nil {
+			metallic = basics.Clamp(0, 1, *pbr.MetallicFactor)
+		}
+		if pbr.RoughnessFactor != nil {
+			roughness = basics.Clamp(0, 1, *pbr.RoughnessFactor)
+		}
+		if pbr.BaseColorTexture != nil {
+			texCoord = pbr.BaseColorTexture.TexCoord
+			var err error
+			if texture, diffuseMap, err = r.texture(pbr.BaseColorTexture.Index); err != nil {
+				return graphics.Material{}, 0, fmt.Errorf("material %d: %w", index, err)
+			}
+		}
+	}
+
+	// the factors are linear while textures and colors of the renderer are sRGB
+	diffuse := basics.NewVector3(linearToSRGB(baseColor[0]), linearToSRGB(baseColor[1]), linearToSRGB(baseColor[2]))
+	// the reflectance of metals is their base color, 4% for the other materials, rough surfaces have dim and wide
+	// highlights
+	dielectric := basics.NewVector3(0.04, 0.04, 0.04)
+	specular := basics.LerpVector3(&dielectric, &diffuse, metallic).Mul(1 - roughness)
+	alpha := roughness * roughness
+	exponent := basics.Clamp(1, 1000, 2/max(alpha*alpha, 1e-6)-2)
+
+	name := m.Name
+	if name == "" {
+		name = fmt.Sprintf("material%d", index)
+	}
+	material := graphics.NewMaterial(name, diffuse.Mul(65535), specular.Mul(65535), exponent)
+	if m.AlphaMode == "BLEND" {
+		material.Opacity = basics.Clamp(0, 1, baseColor[3])
+	}
+	material.DiffuseTexture = texture
+	material.DiffuseMap = diffuseMap
+	r.materials[index] = material
+	return material, texCoord, nil
+}
+
+// texture Returns the texture at the index and the path of its image, empty if the image is not in a file
+func (r *gltfReader) texture(index int) (*graphics.Texture, string, error) {
+	if index < 0 || index >= len(r.doc.Textures) {
+		return nil, "", fmt.Errorf("texture %d does not exist", index)
+	}
+	t := &r.doc.Textures[index]
+	if t.Source == nil || *t.Source < 0 || *t.Source >= len(r.doc.Images) {
+		return nil, "", fmt.Errorf("texture %d has no image", index)
+	}
+	image := &r.doc.Images[*t.Source]
+	path := ""
+	if image.URI != "" && !strings.HasPrefix(image.URI, "data:") {
+		path = r.resolve(image.URI)
+	}
+	if texture, ok := r.textures[index]; ok {
+		return texture, path, nil
+	}
+
+	var data []byte
+	var err error
+	switch {
+	case image.URI != "":
+		data, err = r.readURI(image.URI)
+	case image.BufferView != nil:
+		data, err = r.bufferView(*image.BufferView)
+	default:
+		err = errors.New("no data")
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("image %d: %w", *t.Source, err)
+	}
+	texture, err := graphics.NewTextureFromReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("image %d: %w", *t.Source, err)
+	}
+	if t.Sampler != nil && *t.Sampler >= 0 && *t.Sampler < len(r.doc.Samplers) {
+		sampler := &r.doc.Samplers[*t.Sampler]
+		if sampler.MagFilter == gltfFilterNearest {
+			texture.Filter = graphics.TextureFilterNearest
+		}
+		if sampler.WrapS == gltfWrapClamp {
+			texture.Wrap = graphics.TextureWrapClamp
+		}
+	}
+	r.textures[index] = texture
+	return texture, path, nil
+}
+
+// linearToSRGB Converts a linear color component in the range 0-1 to sRGB
+func linearToSRGB(c basics.Scalar) basics.Scalar {
+	c = basics.Clamp(0, 1, c)
+	if c <= 0.0031308 {
+		return c * 12.92
+	}
+	return 1.055*basics.Pow(c, 1/2.4) - 0.055
+}
+
+/* Cameras and lights */
+
+func (r *gltfReader) camera(index int, nodeName string) (*CameraObject, error) {
+	if index < 0 || index >= len(r.doc.Cameras) {
+		return nil, fmt.Errorf("camera %d does not exist", index)
+	}
+	c := &r.doc.Cameras[index]
+	name := c.Name
+	if name == "" {
+		name = nodeName
+	}
+	switch {
+	case c.Type == "perspective" && c.Perspective != nil:
+		near := c.Perspective.Znear
+		if near <= 0 {
+			near = DefaultCameraNear
+		}
+		far := basics.Scalar(DefaultCameraFar)
+		if c.Perspective.Zfar != nil {
+			far = *c.Perspective.Zfar
+		}
+		return NewPerspectiveCameraObject(name, basics.RadToDeg(c.Perspective.Yfov), near, far), nil
+	case c.Type == "orthographic" && c.Orthographic != nil:
+		return NewOrthographicCameraObject(name, 2*c.Orthographic.Ymag, c.Orthographic.Znear, c.Orthographic.Zfar), nil
+	default:
+		return nil, fmt.Errorf("camera %d: unknown type %q", index, c.Type)
+	}
+}
+
+func (r *gltfReader) light(index int, nodeName string) (*LightObject, error) {
+	lights := r.doc.Extensions.LightsPunctual.Lights
+	if index < 0 || index >= len(lights) {
+		return nil, fmt.Errorf("light %d does not exist", index)
+	}
+	l := &lights[index]
+	name := l.Name
+	if name == "" {
+		name = nodeName
+	}
+	linear := [3]basics.Scalar{1, 1, 1}
+	if l.Color != nil {
+		linear = *l.Color
+	}
+	intensity := basics.Scalar(1)
+	if l.Intensity != nil {
+		intensity = max(*l.Intensity, 0)
+	}
+	lightColor := func(scale basics.Scalar) color.RGBA {
+		component := func(c basics.Scalar) uint8 {
+			return uint8(basics.Round(linearToSRGB(c*scale) * 255))
+		}
+		return color.RGBA{R: component(linear[0]), G: component(linear[1]), B: component(linear[2]), A: 255}
+	}
+
+	var light *LightObject
+	switch l.Type {
+	case "directional":
+		return NewDirectionalLightObject(name, lightColor(min(intensity, 1))), nil
+	case "point":
+		light = NewLightObject(name, lightColor(1), nil)
+	case "spot":
+		inner, outer := basics.Scalar(0), basics.Scalar(math.Pi/4)
+		if l.Spot != nil && l.Spot.InnerConeAngle != nil {
+			inner = *l.Spot.InnerConeAngle
+		}
+		if l.Spot != nil && l.Spot.OuterConeAngle != nil {
+			outer = *l.Spot.OuterConeAngle
+		}
+		light = NewSpotLightObject(name, lightColor(1), nil, basics.RadToDeg(inner), basics.RadToDeg(outer))
+	default:
+		return nil, fmt.Errorf("light %d: unknown type %q", index, l.Type)
+	}
+
+	preset := FalloffPreset{Name: FalloffQuadratic, Radius: basics.Sqrt(intensity)}
+	if l.Range != nil && *l.Range > 0 {
+		preset = FalloffPreset{Name: FalloffSmooth, Radius: *l.Range}
+	}
+	if preset.Radius <= 0 {
+		light.SetColor(lightColor(0))
+		preset = FalloffPreset{Name: FalloffNone}
+	}
+	if err := light.SetFalloffPreset(preset); err != nil {
+		return nil, fmt.Errorf("light %d: %w", index, err)
+	}
+	return light, nil
+}
@@ -0,0 +1,285 @@
+package entities
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// gltfTestAsset Returns the JSON of a glTF asset and its binary buffer: a textured unit quad in the xy plane facing +z
+// under a rotated root node, with a non-uniform scale, a camera with a spot light and a triangle without normals
+func gltfTestAsset() (map[string]any, []byte) {
+	var bin bytes.Buffer
+	write := func(values ...any) {
+		for _, v := range values {
+			binary.Write(&bin, binary.LittleEndian, v)
+		}
+	}
+	// 0: positions, 48 bytes
+	write(float32(0), float32(0), float32(0), float32(1), float32(0), float32(0), float32(1), float32(1), float32(0), float32(0), float32(1), float32(0))
+	// 48: normals, 48 bytes
+	for i := 0; i < 4; i++ {
+		write(float32(0), float32(0), float32(1))
+	}
+	// 96: texture coordinates, 32 bytes
+	write(float32(0), float32(0), float32(1), float32(0), float32(1), float32(1), float32(0), float32(1))
+	// 128: indices, 12 bytes
+	write(uint16(0), uint16(1), uint16(2), uint16(0), uint16(2), uint16(3))
+
+	asset := map[string]any{
+		"asset":          map[string]any{"version": "2.0"},
+		"extensionsUsed": []string{"KHR_lights_punctual"},
+		"scene":          0,
+		"scenes":         []any{map[string]any{"nodes": []int{0}}},
+		"nodes": []any{
+			map[string]any{"name": "root", "translation": []float64{1, 2, 3}, "rotation": []float64{0, math.Sqrt2 / 2, 0, math.Sqrt2 / 2}, "children": []int{1, 2, 3}},
+			map[string]any{"name": "quad", "mesh": 0, "scale": []float64{2, 1, 1}},
+			map[string]any{"name": "eye", "camera": 0, "extensions": map[string]any{"KHR_lights_punctual": map[string]any{"light": 0}}},
+			map[string]any{"mesh": 1},
+		},
+		"meshes": []any{
+			map[string]any{"name": "quadMesh", "primitives": []any{map[string]any{
+				"attributes": map[string]int{"POSITION": 0, "NORMAL": 1, "TEXCOORD_0": 2},
+				"indices":    3,
+				"material":   0,
+			}}},
+			map[string]any{"primitives": []any{map[string]any{"attributes": map[string]int{"POSITION": 0}}}},
+		},
+		"accessors": []any{
+			map[string]any{"bufferView": 0, "componentType": 5126, "count": 4, "type": "VEC3"},
+			map[string]any{"bufferView": 0, "byteOffset": 48, "componentType": 5126, "count": 4, "type": "VEC3"},
+			map[string]any{"bufferView": 0, "byteOffset": 96, "componentType": 5126, "count": 4, "type": "VEC2"},
+			map[string]any{"bufferView": 1, "componentType": 5123, "count": 6, "type": "SCALAR"},
+		},
+		"bufferViews": []any{
+			map[string]any{"buffer": 0, "byteLength": 128},
+			map[string]any{"buffer": 0, "byteOffset": 128, "byteLength": 12},
+		},
+		"buffers": []any{map[string]any{"byteLength": bin.Len()}},
+		"materials": []any{map[string]any{
+			"name": "orange",
+			"pbrMetallicRoughness": map[string]any{
+				"baseColorFactor": []float64{1, 0.2140, 0, 1},
+				"metallicFactor":  0,
+				"roughnessFactor": 0.5,
+			},
+		}},
+		"cameras": []any{map[string]any{"type": "perspective", "perspective": map[string]any{"yfov": 1, "znear": 0.5, "zfar": 100}}},
+		"extensions": map[string]any{"KHR_lights_punctual": map[string]any{"lights": []any{
+			map[string]any{"name": "torch", "type": "spot", "intensity": 4, "spot": map[string]any{"innerConeAngle": math.Pi / 12, "outerConeAngle": math.Pi / 6}},
+		}}},
+	}
+	return asset, bin.Bytes()
+}
+
+// glb Returns the asset in the binary format with the buffer in the binary chunk
+func glb(asset map[string]any, bin []byte) []byte {
+	jsonChunk, _ := json.Marshal(asset)
+	for len(jsonChunk)%4 != 0 {
+		jsonChunk = append(jsonChunk, ' ')
+	}
+	for len(bin)%4 != 0 {
+		bin = append(bin, 0)
+	}
+	var out bytes.Buffer
+	binary.Write(&out, binary.LittleEndian, []uint32{glbMagic, 2, uint32(12 + 8 + len(jsonChunk) + 8 + len(bin))})
+	binary.Write(&out, binary.LittleEndian, []uint32{uint32(len(jsonChunk)), glbChunkJSON})
+	out.Write(jsonChunk)
+	binary.Write(&out, binary.LittleEndian, []uint32{uint32(len(bin)), glbChunkBIN})
+	out.Write(bin)
+	return out.Bytes()
+}
+
+func TestNewSceneGraphFromGLTF(t *testing.T) {
+	asset, bin := gltfTestAsset()
+	dir := t.TempDir()
+
+	// the same asset with the buffer in a GLB chunk, in an external file and in a data URI
+	glbFile := filepath.Join(dir, "asset.glb")
+	assert.NoError(t, os.WriteFile(glbFile, glb(asset, bin), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "asset data.bin"), bin, 0o644))
+	asset["buffers"] = []any{map[string]any{"byteLength": len(bin), "uri": "asset%20data.bin"}}
+	external, _ := json.Marshal(asset)
+	externalFile := filepath.Join(dir, "asset.gltf")
+	assert.NoError(t, os.WriteFile(externalFile, external, 0o644))
+	asset["buffers"] = []any{map[string]any{"byteLength": len(bin), "uri": "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(bin)}}
+	embedded, _ := json.Marshal(asset)
+
+	fromGLB, err := NewSceneGraphFromGLTFFile(glbFile)
+	assert.NoError(t, err)
+	fromExternal, err := NewSceneGraphFromGLTFFile(externalFile)
+	assert.NoError(t, err)
+	fromEmbedded, err := NewSceneGraphFromGLTF(bytes.NewReader(embedded), "")
+	assert.NoError(t, err)
+
+	for _, sceneGraph := range []*SceneGraph{fromGLB, fromExternal, fromEmbedded} {
+		assert.Equal(t, "world: worldObj\n\troot: root\n\t\tquad: quadMesh\n\t\teye: eye\n\t\t\teye_torch: torch\n\t\tnode3: node3\n", sceneGraph.String())
+
+		// the x axis of the root is rotated to -z in glTF, +z once mirrored
+		rootT := sceneGraph.GetNode("root").WorldTransform()
+		p := basics.NewVector3(1, 0, 0)
+		rootT.ApplyToPoint(&p)
+		assert.True(t, p.Equals(basics.NewVector3(1, 2, -2)), "%v", p)
+
+		// the uniform part of the scale is in the node, the rest in the mesh
+		quad := sceneGraph.GetNode("quad")
+		cbrt2 := basics.Scalar(math.Cbrt(2))
+		assert.InDelta(t, float64(cbrt2), float64(quad.LocalTransform().Scaling), 1e-9)
+		model := quad.GameObject.(*ModelObject)
+		mesh := model.Mesh()
+		assert.Equal(t, 2, mesh.TriangleCount())
+		corner := mesh.VertexPosition(2)
+		assert.True(t, corner.Equals(basics.NewVector3(2/cbrt2, 1/cbrt2, 0)), "%v", corner)
+
+		// the mirrored normals face -z and the winding agrees with them
+		for i, triangle := range mesh.GetTriangles() {
+			faceNormals := mesh.GetTrianglesWithFaceNormals()[i]
+			for j := 0; j < 3; j++ {
+				assert.True(t, triangle[j].Normal.Equals(basics.NewVector3(0, 0, -1)), "%v", triangle[j].Normal)
+				assert.True(t, faceNormals[j].Normal.Equals(basics.NewVector3(0, 0, -1)), "%v", faceNormals[j].Normal)
+			}
+		}
+		// v goes down in glTF
+		assert.True(t, mesh.GetTriangles()[0][0].UV.Equals(basics.NewVector3(0, 1, 0)))
+
+		material := mesh.Materials()[0]
+		assert.Equal(t, "orange", material.Name)
+		assert.InDelta(t, 65535, float64(material.Diffuse.X), 1)
+		assert.InDelta(t, 32768, float64(material.Diffuse.Y), 200)
+		assert.InDelta(t, 0, float64(material.Diffuse.Z), 1)
+		assert.True(t, material.HasSpecular())
+
+		camera := sceneGraph.GetNode("eye").GameObject.(*CameraObject)
+		assert.InDelta(t, 180/math.Pi, float64(camera.Fov()), 1e-9)
+		assert.Equal(t, basics.Scalar(0.5), camera.Near())
+		assert.Equal(t, basics.Scalar(100), camera.Far())
+
+		light := sceneGraph.GetNode("eye_torch").GameObject.(*LightObject)
+		assert.Equal(t, uint8(LightTypeSpot), light.Type())
+		inner, outer := light.ConeAngles()
+		assert.InDelta(t, 15, float64(inner), 1e-9)
+		assert.InDelta(t, 30, float64(outer), 1e-9)
+		preset, ok := light.FalloffPreset()
+		assert.True(t, ok)
+		assert.Equal(t, FalloffPreset{Name: FalloffQuadratic, Radius: 2}, preset)
+		assert.Equal(t, color.RGBA{R: 255, G: 255, B: 255, A: 255}, light.Color())
+
+		// without normals the triangles are flat shaded
+		flat := sceneGraph.GetNode("node3").GameObject.(*ModelObject).Mesh()
+		assert.Equal(t, "default", flat.Materials()[0].Name)
+		for _, triangle := range flat.GetTriangles() {
+			assert.True(t, triangle[0].Normal.Equals(basics.NewVector3(0, 0, -1)), "%v", triangle[0].Normal)
+		}
+	}
+}
+
+func TestNewSceneGraphFromGLTF_MatrixAndTexture(t *testing.T) {
+	asset, bin := gltfTestAsset()
+	asset["buffers"] = []any{map[string]any{"byteLength": len(bin), "uri": "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(bin)}}
+	// the same transform of the root as a matrix: rotation of 90 degrees around y, then translation
+	root := asset["nodes"].([]any)[0].(map[string]any)
+	delete(root, "translation")
+	delete(root, "rotation")
+	root["matrix"] = []float64{0, 0, -1, 0, 0, 1, 0, 0, 1, 0, 0, 0, 1, 2, 3, 1}
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	var encoded bytes.Buffer
+	assert.NoError(t, png.Encode(&encoded, img))
+	asset["images"] = []any{map[string]any{"uri": "data:image/png;base64," + base64.StdEncoding.EncodeToString(encoded.Bytes())}}
+	asset["samplers"] = []any{map[string]any{"magFilter": 9728, "wrapS": 33071}}
+	asset["textures"] = []any{map[string]any{"source": 0, "sampler": 0}}
+	pbr := asset["materials"].([]any)[0].(map[string]any)["pbrMetallicRoughness"].(map[string]any)
+	pbr["baseColorTexture"] = map[string]any{"index": 0}
+	data, _ := json.Marshal(asset)
+
+	sceneGraph, err := NewSceneGraphFromGLTF(bytes.NewReader(data), "")
+	assert.NoError(t, err)
+	rootT := sceneGraph.GetNode("root").WorldTransform()
+	p := basics.NewVector3(1, 0, 0)
+	rootT.ApplyToPoint(&p)
+	assert.True(t, p.Equals(basics.NewVector3(1, 2, -2)), "%v", p)
+	assert.InDelta(t, 1, float64(rootT.Scaling), 1e-9)
+
+	mesh := sceneGraph.GetNode("quad").GameObject.(*ModelObject).Mesh()
+	texture := mesh.Materials()[0].DiffuseTexture
+	assert.NotNil(t, texture)
+	assert.Equal(t, uint8(graphics.TextureFilterNearest), texture.Filter)
+	assert.Equal(t, uint8(graphics.TextureWrapClamp), texture.Wrap)
+	// the top left texel is at the glTF texture coordinates 0, 0
+	uv := mesh.GetTriangles()[0][0].UV
+	assert.Equal(t, basics.NewVector3(65535, 0, 0), texture.Sample(uv.X+0.1, uv.Y-0.1))
+}
+
+func TestNewSceneGraphFromGLTF_Errors(t *testing.T) {
+	for name, edit := range map[string]func(asset map[string]any){
+		"unsupported required extension": func(asset map[string]any) {
+			asset["extensionsRequired"] = []string{"KHR_draco_mesh_compression"}
+		},
+		"unsupported version": func(asset map[string]any) {
+			asset["asset"] = map[string]any{"version": "1.0"}
+		},
+		"sparse accessors are not supported": func(asset map[string]any) {
+			asset["accessors"].([]any)[0].(map[string]any)["sparse"] = map[string]any{"count": 1}
+		},
+		"out of the bounds": func(asset map[string]any) {
+			asset["accessors"].([]any)[0].(map[string]any)["count"] = 100
+		},
+		"more than one parent": func(asset map[string]any) {
+			asset["nodes"].([]any)[1].(map[string]any)["children"] = []int{0}
+		},
+		"mesh 5 does not exist": func(asset map[string]any) {
+			asset["nodes"].([]any)[1].(map[string]any)["mesh"] = 5
+		},
+	} {
+		asset, bin := gltfTestAsset()
+		edit(asset)
+		_, err := NewSceneGraphFromGLTF(bytes.NewReader(glb(asset, bin)), "")
+		assert.ErrorContains(t, err, name)
+	}
+}
+
+func TestNewSceneGraphFromGLTF_MalformedAccessors(t *testing.T) {
+	accessor := func(asset map[string]any) map[string]any { return asset["accessors"].([]any)[0].(map[string]any) }
+	view := func(asset map[string]any) map[string]any { return asset["bufferViews"].([]any)[0].(map[string]any) }
+	for _, test := range []struct {
+		err  string
+		edit func(asset map[string]any)
+	}{
+		{"negative count", func(asset map[string]any) { accessor(asset)["count"] = -1 }},
+		{"out of the bounds of the buffer view", func(asset map[string]any) { accessor(asset)["count"] = math.MaxInt64 / 2 }},
+		{"invalid byte offset -12", func(asset map[string]any) { accessor(asset)["byteOffset"] = -12 }},
+		{"out of the bounds of the buffer view", func(asset map[string]any) { accessor(asset)["byteOffset"] = math.MaxInt64 }},
+		{"stride 4", func(asset map[string]any) { view(asset)["byteStride"] = 4 }},
+		{"without buffer view is too large", func(asset map[string]any) {
+			delete(accessor(asset), "bufferView")
+			accessor(asset)["count"] = math.MaxInt64 / 2
+		}},
+		{"buffer view 0: out of the bounds of buffer 0", func(asset map[string]any) { view(asset)["byteOffset"] = -4 }},
+		{"buffer view 0: out of the bounds of buffer 0", func(asset map[string]any) { view(asset)["byteLength"] = math.MaxInt64 }},
+		{"buffer view 7 does not exist", func(asset map[string]any) { accessor(asset)["bufferView"] = 7 }},
+	} {
+		asset, bin := gltfTestAsset()
+		test.edit(asset)
+		_, err := NewSceneGraphFromGLTF(bytes.NewReader(glb(asset, bin)), "")
+		assert.ErrorContains(t, err, test.err)
+	}
+}
+
+func TestGLTFTriangles(t *testing.T) {
+	indices := []int{0, 1, 2, 3, 4}
+	assert.Equal(t, []graphics.TriangleConnectivity{{0, 1, 2}, {2, 1, 3}, {2, 3, 4}}, gltfTriangles(indices, gltfModeTriangleStrip))
+	assert.Equal(t, []graphics.TriangleConnectivity{{0, 1, 2}, {0, 2, 3}, {0, 3, 4}}, gltfTriangles(indices, gltfModeTriangleFan))
+	assert.Equal(t, []graphics.TriangleConnectivity{{0, 1, 2}}, gltfTriangles(indices, gltfModeTriangles))
+}
@@ -0,0 +1,626 @@
+package entities
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+/*
+Scene files describe a scene graph in JSON. The nodes in "nodes" are children of the world node, every node has the
+transform to its parent and exactly one of "empty", "model", "camera" or "light". Colors are 0-255, angles in degrees.
+
+	{
+	  "materials": {
+	    "red": {"diffuse": [180, 25, 25], "specular": [255, 255, 255], "specularExponent": 600}
+	  },
+	  "nodes": [
+	    {"name": "camera", "translation": [0, 1, -3], "euler": [-20, 0, 0], "camera": {"fov": 90}},
+	    {"name": "cube", "scale": 2, "rotation": [0, 0, 0, 1], "model": {"mesh": "cube.obj", "material": "red"},
+	     "children": [
+	       {"name": "light", "translation": [0, 5, 0],
+	        "light": {"type": "point", "color": [150, 150, 150, 255], "falloff": {"preset": "linear", "radius": 50}}}
+	     ]}
+	  ]
+	}
+
+The rotation is a quaternion [x, y, z, w], "euler" gives it as [yaw, pitch, roll] instead. Paths of meshes and textures
+are relative to the directory of the scene file, meshes can be Wavefront obj, STL (.stl) or PLY (.ply) files. Shaders
+are not part of the format, models use the default shading
+*/
+
+type sceneFile struct {
+	Materials map[string]*materialJSON `json:"materials,omitempty"`
+	Nodes     []*nodeJSON              `json:"nodes"`
+}
+
+type nodeJSON struct {
+	Name        string            `json:"name"`
+	Scale       *basics.Scalar    `json:"scale,omitempty"`
+	Rotation    *[4]basics.Scalar `json:"rotation,omitempty"`
+	Euler       *[3]basics.Scalar `json:"euler,omitempty"`
+	Translation *[3]basics.Scalar `json:"translation,omitempty"`
+	Empty       *emptyJSON        `json:"empty,omitempty"`
+	Model       *modelJSON        `json:"model,omitempty"`
+	Camera      *cameraJSON       `json:"camera,omitempty"`
+	Light       *lightJSON        `json:"light,omitempty"`
+	Children    []*nodeJSON       `json:"children,omitempty"`
+}
+
+// emptyJSON The objects have a name only when it's different from the name of the node
+type emptyJSON struct {
+	Name string `json:"name,omitempty"`
+}
+
+type modelJSON struct {
+	Name              string    `json:"name,omitempty"`
+	Mesh              string    `json:"mesh"`
+	Material          string    `json:"material,omitempty"` // default material of the faces without one in the mesh file
+	IgnoreMeshNormals bool      `json:"ignoreMeshNormals,omitempty"`
+	PerPixelLighting  bool      `json:"perPixelLighting,omitempty"`
+	CastShadows       *bool     `json:"castShadows,omitempty"`
+	ReceiveShadows    *bool     `json:"receiveShadows,omitempty"`
+	WireColor         *[4]uint8 `json:"wireColor,omitempty"`
+}
+
+type materialJSON struct {
+	Ambient          *[3]basics.Scalar `json:"ambient,omitempty"` // the diffuse color when missing
+	Diffuse          [3]basics.Scalar  `json:"diffuse"`
+	Specular         [3]basics.Scalar  `json:"specular"`
+	SpecularExponent basics.Scalar     `json:"specularExponent"`
+	Opacity          *basics.Scalar    `json:"opacity,omitempty"`
+	BlendMode        string            `json:"blendMode,omitempty"`
+	DiffuseMap       string            `json:"diffuseMap,omitempty"`
+}
+
+type cameraJSON struct {
+	Name         string        `json:"name,omitempty"`
+	Fov          basics.Scalar `json:"fov,omitempty"`
+	Near         basics.Scalar `json:"near,omitempty"`
+	Far          basics.Scalar `json:"far,omitempty"`
+	Orthographic bool          `json:"orthographic,omitempty"`
+	OrthoHeight  basics.Scalar `json:"orthoHeight,omitempty"`
+}
+
+type lightJSON struct {
+	Name        string        `json:"name,omitempty"`
+	Type        string        `json:"type"`
+	Color       [4]uint8      `json:"color"`
+	GroundColor *[4]uint8     `json:"groundColor,omitempty"`
+	Falloff     *falloffJSON  `json:"falloff,omitempty"`
+	InnerAngle  basics.Scalar `json:"innerAngle,omitempty"`
+	OuterAngle  basics.Scalar `json:"outerAngle,omitempty"`
+	CastShadows bool          `json:"castShadows,omitempty"`
+	Shadows     *shadowsJSON  `json:"shadows,omitempty"`
+}
+
+type falloffJSON struct {
+	Preset string        `json:"preset"`
+	Radius basics.Scalar `json:"radius,omitempty"`
+}
+
+type shadowsJSON struct {
+	MapSize   int           `json:"mapSize"`
+	Bias      basics.Scalar `json:"bias"`
+	SlopeBias basics.Scalar `json:"slopeBias"`
+	PCFRadius int           `json:"pcfRadius"`
+	Area      basics.Scalar `json:"area"`
+	Near      basics.Scalar `json:"near"`
+	Far       basics.Scalar `json:"far"`
+}
+
+var lightTypeNames = map[uint8]string{
+	LightTypePoint:       "point",
+	LightTypeDirectional: "directional",
+	LightTypeSpot:        "spot",
+	LightTypeHemisphere:  "hemisphere",
+}
+
+var blendModeNames = map[uint8]string{
+	graphics.BlendModeAlpha:    "alpha",
+	graphics.BlendModeAdditive: "additive",
+	graphics.BlendModeMultiply: "multiply",
+}
+
+/* Loader */
+
+// sceneReader Builds the scene graph of a scene file, meshes and textures are read once and shared by the models
+type sceneReader struct {
+	dir        string
+	file       *sceneFile
+	sceneGraph *SceneGraph
+	materials  map[string]graphics.Material
+	meshes     map[[2]string]graphics.Mesh // by path and material name
+}
+
+// NewSceneGraphFromReader reads a scene graph from a scene file in JSON. Relative paths of meshes and textures are
+// resolved from dir, an empty dir uses the working directory. Returns an error if a field is unknown, a node has no
+// name or a name is used twice, or a mesh or texture can't be loaded
+func NewSceneGraphFromReader(reader io.Reader, dir string) (*SceneGraph, error) {
+	var file sceneFile
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("scene: %w", err)
+	}
+	r := sceneReader{
+		dir:        dir,
+		file:       &file,
+		sceneGraph: NewSceneGraph(),
+		materials:  make(map[string]graphics.Material),
+		meshes:     make(map[[2]string]graphics.Mesh),
+	}
+	for _, node := range file.Nodes {
+		if err := r.addNode("world", node); err != nil {
+			return nil, err
+		}
+	}
+	return r.sceneGraph, nil
+}
+
+// NewSceneGraphFromFile reads a scene file like NewSceneGraphFromReader, paths are relative to the directory of the file
+func NewSceneGraphFromFile(fileName string) (*SceneGraph, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sceneGraph, err := NewSceneGraphFromReader(f, filepath.Dir(fileName))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return sceneGraph, nil
+}
+
+func (r *sceneReader) addNode(parentName string, node *nodeJSON) error {
+	if node.Name == "" {
+		return fmt.Errorf("scene: a child of %q has no name", parentName)
+	}
+	gameObject, err := r.gameObject(node)
+	if err != nil {
+		return fmt.Errorf("scene: node %q: %w", node.Name, err)
+	}
+	if err := r.sceneGraph.AddChild(parentName, NewSceneGraphNode(gameObject, node.Name), node.transform()); err != nil {
+		return fmt.Errorf("scene: node %q: %w", node.Name, err)
+	}
+	for _, child := range node.Children {
+		if err := r.addNode(node.Name, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transform Returns the transform of the node, missing fields are the identity
+func (node *nodeJSON) transform() basics.Transform {
+	t := basics.NewZeroTransform()
+	if node.Scale != nil {
+		t.Scaling = *node.Scale
+	}
+	if node.Rotation != nil {
+		t.Rotation = basics.NewQuaternionFromScalars(node.Rotation[0], node.Rotation[1], node.Rotation[2], node.Rotation[3])
+		t.Rotation.ThisNormalize()
+	} else if node.Euler != nil {
+		t.Rotation = basics.NewQuaternionFromEulerAngles(node.Euler[0], node.Euler[1], node.Euler[2])
+	}
+	if node.Translation != nil {
+		t.Translation = basics.NewVector3(node.Translation[0], node.Translation[1], node.Translation[2])
+	}
+	return t
+}
+
+// objectName Returns the name of the object, the name of the node if it's not given
+func objectName(name string, node *nodeJSON) string {
+	if name == "" {
+		return node.Name
+	}
+	return name
+}
+
+func (r *sceneReader) gameObject(node *nodeJSON) (GameObject, error) {
+	var gameObject GameObject
+	var err error
+	objects := 0
+	if node.Empty != nil {
+		objects++
+		gameObject = NewEmptyObject(objectName(node.Empty.Name, node))
+	}
+	if node.Model != nil {
+		objects++
+		gameObject, err = r.model(node.Model, objectName(node.Model.Name, node))
+	}
+	if node.Camera != nil {
+		objects++
+		gameObject, err = newCameraFromJSON(node.Camera, objectName(node.Camera.Name, node))
+	}
+	if node.Light != nil {
+		objects++
+		gameObject, err = newLightFromJSON(node.Light, objectName(node.Light.Name, node))
+	}
+	if objects != 1 {
+		return nil, errors.New("a node must have exactly one of empty, model, camera or light")
+	}
+	return gameObject, err
+}
+
+// resolve Returns the path relative to the directory of the scene file
+func (r *sceneReader) resolve(path string) string {
+	path = filepath.FromSlash(path)
+	if filepath.IsAbs(path) || r.dir == "" {
+		return path
+	}
+	return filepath.Join(r.dir, path)
+}
+
+func (r *sceneReader) model(model *modelJSON, name string) (*ModelObject, error) {
+	if model.Mesh == "" {
+		return nil, errors.New("the model has no mesh")
+	}
+	material, err := r.material(model.Material)
+	if err != nil {
+		return nil, err
+	}
+	path := r.resolve(model.Mesh)
+	key := [2]string{path, model.Material}
+	mesh, ok := r.meshes[key]
+	if !ok {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".stl":
+			mesh, err = graphics.NewMeshFromSTLFile(path, material)
+		case ".ply":
+			mesh, err = graphics.NewMeshFromPLYFile(path, material)
+		default:
+			mesh, err = graphics.NewMeshFromFile(path, material)
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.meshes[key] = mesh
+	}
+
+	m := NewModelObject(name, mesh, model.IgnoreMeshNormals)
+	m.SetMeshFile(path)
+	m.SetPerPixelLighting(model.PerPixelLighting)
+	if model.CastShadows != nil {
+		m.SetCastShadows(*model.CastShadows)
+	}
+	if model.ReceiveShadows != nil {
+		m.SetReceiveShadows(*model.ReceiveShadows)
+	}
+	if model.WireColor != nil {
+		m.SetWireColor(rgbaFromJSON(*model.WireColor))
+	}
+	return m, nil
+}
+
+// material Returns the material declared in the scene file with the name, the default material for an empty name
+func (r *sceneReader) material(name string) (graphics.Material, error) {
+	if name == "" {
+		return graphics.NewDefaultMaterial(), nil
+	}
+	if material, ok := r.materials[name]; ok {
+		return material, nil
+	}
+	m, ok := r.file.Materials[name]
+	if !ok || m == nil {
+		return graphics.Material{}, fmt.Errorf("unknown material %q", name)
+	}
+	material := graphics.NewMaterial(name, colorFromJSON(m.Diffuse), colorFromJSON(m.Specular), m.SpecularExponent)
+	if m.Ambient != nil {
+		material.Ambient = colorFromJSON(*m.Ambient)
+	}
+	if m.Opacity != nil {
+		material.Opacity = basics.Clamp(0, 1, *m.Opacity)
+	}
+	if m.BlendMode != "" {
+		blendMode, ok := lookupName(blendModeNames, m.BlendMode)
+		if !ok {
+			return graphics.Material{}, fmt.Errorf("material %q: unknown blend mode %q", name, m.BlendMode)
+		}
+		material.BlendMode = blendMode
+	}
+	if m.DiffuseMap != "" {
+		material.DiffuseMap = r.resolve(m.DiffuseMap)
+		texture, err := graphics.NewTextureFromFile(material.DiffuseMap)
+		if err != nil {
+			return graphics.Material{}, fmt.Errorf("material %q: %w", name, err)
+		}
+		material.DiffuseTexture = texture
+	}
+	r.materials[name] = material
+	return material, nil
+}
+
+// newCameraFromJSON Returns the camera, missing values are replaced by the defaults. Returns an error if the camera is
+// not valid
+func newCameraFromJSON(camera *cameraJSON, name string) (*CameraObject, error) {
+	orDefault := func(value basics.Scalar, defaultValue basics.Scalar) basics.Scalar {
+		if value == 0 {
+			return defaultValue
+		}
+		return value
+	}
+	c := NewPerspectiveCameraObject(name, orDefault(camera.Fov, DefaultCameraFov), orDefault(camera.Near, DefaultCameraNear), orDefault(camera.Far, DefaultCameraFar))
+	c.SetOrthographic(camera.Orthographic)
+	c.SetOrthoHeight(orDefault(camera.OrthoHeight, c.OrthoHeight()))
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("camera %q: %w", name, err)
+	}
+	return c, nil
+}
+
+func newLightFromJSON(light *lightJSON, name string) (*LightObject, error) {
+	lightType, ok := lookupName(lightTypeNames, light.Type)
+	if !ok {
+		return nil, fmt.Errorf("unknown light type %q", light.Type)
+	}
+	l := &LightObject{
+		name:           name,
+		lightType:      lightType,
+		color:          rgbaFromJSON(light.Color),
+		castShadows:    light.CastShadows,
+		shadowSettings: DefaultShadowSettings(),
+	}
+	if light.GroundColor != nil {
+		l.groundColor = rgbaFromJSON(*light.GroundColor)
+	} else if lightType == LightTypeHemisphere {
+		l.groundColor = l.color
+	}
+	if lightType == LightTypeSpot {
+		l.SetConeAngles(light.InnerAngle, light.OuterAngle)
+	}
+	if light.Falloff != nil {
+		if err := l.SetFalloffPreset(FalloffPreset{Name: light.Falloff.Preset, Radius: light.Falloff.Radius}); err != nil {
+			return nil, err
+		}
+	}
+	if s := light.Shadows; s != nil {
+		l.shadowSettings = ShadowSettings{MapSize: s.MapSize, Bias: s.Bias, SlopeBias: s.SlopeBias, PCFRadius: s.PCFRadius, Area: s.Area, Near: s.Near, Far: s.Far}
+	}
+	return l, nil
+}
+
+/* Saver */
+
+// sceneWriter Builds the scene file of a scene graph, the materials of the models are collected by name
+type sceneWriter struct {
+	dir  string
+	file sceneFile
+}
+
+// WriteJSON writes the scene graph as a scene file in JSON, readable by NewSceneGraphFromReader. Paths of meshes and
+// textures are written relative to dir when possible, an empty dir writes them unchanged. The children of a node are
+// written in the order returned by Children. Returns an error if a game object can't be described by the format: models
+// without a mesh file, lights with a falloff function not built from a preset and objects of other types
+func (sceneGraph *SceneGraph) WriteJSON(w io.Writer, dir string) error {
+	s := sceneWriter{dir: dir, file: sceneFile{Materials: make(map[string]*materialJSON)}}
+	for _, child := range sceneGraph.root.childNodes {
+		node, err := s.node(child)
+		if err != nil {
+			return err
+		}
+		s.file.Nodes = append(s.file.Nodes, node)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(&s.file)
+}
+
+// SaveFile writes the scene graph to a scene file, paths are written relative to the directory of the file
+func (sceneGraph *SceneGraph) SaveFile(fileName string) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	err = sceneGraph.WriteJSON(f, filepath.Dir(fileName))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (s *sceneWriter) node(node *SceneGraphNode) (*nodeJSON, error) {
+	n := &nodeJSON{Name: node.nodeName}
+	t := node.toParentTransform
+	if t.Scaling != 1 {
+		n.Scale = &t.Scaling
+	}
+	if identity := basics.NewIdentityQuaternion(); !t.Rotation.Equals(&identity) {
+		n.Rotation = &[4]basics.Scalar{t.Rotation.Im.X, t.Rotation.Im.Y, t.Rotation.Im.Z, t.Rotation.Re}
+	}
+	if !t.Translation.IsZero() {
+		n.Translation = &[3]basics.Scalar{t.Translation.X, t.Translation.Y, t.Translation.Z}
+	}
+
+	var err error
+	nameIfDifferent := func(name string) string {
+		if name == node.nodeName {
+			return ""
+		}
+		return name
+	}
+	switch object := node.GameObject.(type) {
+	case *EmptyObject:
+		n.Empty = &emptyJSON{Name: nameIfDifferent(object.Name())}
+	case *ModelObject:
+		n.Model, err = s.model(object)
+		if n.Model != nil {
+			n.Model.Name = nameIfDifferent(object.Name())
+		}
+	case *CameraObject:
+		n.Camera = &cameraJSON{
+			Name:         nameIfDifferent(object.Name()),
+			Fov:          object.fov,
+			Near:         object.near,
+			Far:          object.far,
+			Orthographic: object.orthographic,
+			OrthoHeight:  object.orthoHeight,
+		}
+	case *LightObject:
+		n.Light, err = lightToJSON(object)
+		if n.Light != nil {
+			n.Light.Name = nameIfDifferent(object.Name())
+		}
+	default:
+		err = fmt.Errorf("game objects of type %T can't be saved", node.GameObject)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scene: node %q: %w", node.nodeName, err)
+	}
+
+	for _, child := range node.childNodes {
+		c, err := s.node(child)
+		if err != nil {
+			return nil, err
+		}
+		n.Children = append(n.Children, c)
+	}
+	return n, nil
+}
+
+// relative Returns the path relative to the directory of the scene file, or the path itself if it can't be made relative
+func (s *sceneWriter) relative(path string) string {
+	if s.dir == "" {
+		return filepath.ToSlash(path)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	absDir, err := filepath.Abs(s.dir)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (s *sceneWriter) model(m *ModelObject) (*modelJSON, error) {
+	if m.meshFile == "" {
+		return nil, errors.New("the mesh of the model was not read from a file")
+	}
+	model := &modelJSON{
+		Mesh:              s.relative(m.meshFile),
+		IgnoreMeshNormals: m.ignoreMeshNormals,
+		PerPixelLighting:  m.perPixelLighting,
+	}
+	if !m.castShadows {
+		model.CastShadows = &m.castShadows
+	}
+	if !m.receiveShadows {
+		model.ReceiveShadows = &m.receiveShadows
+	}
+	if m.wireColor != (color.RGBA{R: 255, G: 255, B: 255, A: 255}) {
+		model.WireColor = &[4]uint8{m.wireColor.R, m.wireColor.G, m.wireColor.B, m.wireColor.A}
+	}
+	if materials := m.mesh.Materials(); len(materials) > 0 {
+		model.Material = s.material(&materials[0])
+	}
+	return model, nil
+}
+
+// material Adds the material to the scene file and returns its name. Different materials with the same name are saved
+// with a numeric suffix
+func (s *sceneWriter) material(material *graphics.Material) string {
+	m := &materialJSON{
+		Diffuse:          colorToJSON(material.Diffuse),
+		Specular:         colorToJSON(material.Specular),
+		SpecularExponent: material.SpecularExponent,
+	}
+	if material.Ambient != material.Diffuse {
+		ambient := colorToJSON(material.Ambient)
+		m.Ambient = &ambient
+	}
+	if material.Opacity != 1 {
+		opacity := material.Opacity
+		m.Opacity = &opacity
+	}
+	if material.BlendMode != graphics.BlendModeAlpha {
+		m.BlendMode = blendModeNames[material.BlendMode]
+	}
+	if material.DiffuseMap != "" {
+		m.DiffuseMap = s.relative(material.DiffuseMap)
+	}
+
+	baseName := material.Name
+	if baseName == "" {
+		baseName = "material"
+	}
+	name := baseName
+	for i := 2; ; i++ {
+		existing, ok := s.file.Materials[name]
+		if !ok {
+			s.file.Materials[name] = m
+			return name
+		}
+		if reflect.DeepEqual(existing, m) {
+			return name
+		}
+		name = fmt.Sprintf("%s_%d", baseName, i)
+	}
+}
+
+func lightToJSON(l *LightObject) (*lightJSON, error) {
+	light := &lightJSON{
+		Type:        lightTypeNames[l.lightType],
+		Color:       rgbaToJSON(l.color),
+		CastShadows: l.castShadows,
+	}
+	if l.lightType == LightTypeHemisphere && l.groundColor != nil {
+		groundColor := rgbaToJSON(l.groundColor)
+		light.GroundColor = &groundColor
+	}
+	if l.lightType == LightTypeSpot {
+		light.InnerAngle, light.OuterAngle = l.innerAngle, l.outerAngle
+	}
+	if preset, ok := l.FalloffPreset(); ok {
+		light.Falloff = &falloffJSON{Preset: preset.Name, Radius: preset.Radius}
+	} else if l.falloff != nil {
+		return nil, errors.New("the falloff function of the light is not a preset")
+	}
+	if s := l.shadowSettings; s != DefaultShadowSettings() {
+		light.Shadows = &shadowsJSON{MapSize: s.MapSize, Bias: s.Bias, SlopeBias: s.SlopeBias, PCFRadius: s.PCFRadius, Area: s.Area, Near: s.Near, Far: s.Far}
+	}
+	return light, nil
+}
+
+/* Conversions */
+
+// colorFromJSON Converts a 0-255 color to the 0-65535 range of the materials
+func colorFromJSON(c [3]basics.Scalar) basics.Vector3 {
+	return basics.NewVector3(c[0], c[1], c[2]).Mul(257)
+}
+
+func colorToJSON(v basics.Vector3) [3]basics.Scalar {
+	return [3]basics.Scalar{v.X / 257, v.Y / 257, v.Z / 257}
+}
+
+func rgbaFromJSON(c [4]uint8) color.RGBA {
+	return color.RGBA{R: c[0], G: c[1], B: c[2], A: c[3]}
+}
+
+func rgbaToJSON(c color.Color) [4]uint8 {
+	rgba := color.RGBAModel.Convert(c).(color.RGBA)
+	return [4]uint8{rgba.R, rgba.G, rgba.B, rgba.A}
+}
+
+// lookupName Returns the constant with the name in a map of names of constants
+func lookupName(names map[uint8]string, name string) (uint8, bool) {
+	for value, n := range names {
+		if n == name {
+			return value, true
+		}
+	}
+	return 0, false
+}
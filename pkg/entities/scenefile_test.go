@@ -0,0 +1,154 @@
+package entities
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"image/color"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSceneGraph_NewSceneGraphFromFile(t *testing.T) {
+	sceneGraph, err := NewSceneGraphFromFile("../../scenes/sample.json")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, len(sceneGraph.ListNodes()))
+
+	camera := sceneGraph.GetNode("camera")
+	assert.Equal(t, "mainCamera", camera.GameObject.Name())
+	cameraT := camera.LocalTransform()
+	expected := basics.NewQuaternionFromEulerAngles(-20, 0, 0)
+	assert.True(t, cameraT.Rotation.Equals(&expected))
+	assert.Equal(t, basics.NewVector3(1.5, 1, -3), cameraT.Translation)
+	assert.Equal(t, basics.Scalar(DefaultCameraFov), camera.GameObject.(*CameraObject).Fov())
+
+	cube := sceneGraph.GetNode("cube").GameObject.(*ModelObject)
+	assert.Equal(t, "cubeObj", cube.Name())
+	assert.True(t, cube.IgnoreMeshNormals())
+	assert.Equal(t, filepath.Join("../../scenes", "../meshes/cube.obj"), cube.MeshFile())
+	mesh := cube.Mesh()
+	assert.Equal(t, basics.Vector3FromColor(color.RGBA{R: 180, G: 25, B: 25, A: 255}), mesh.Materials()[0].Diffuse)
+	assert.Equal(t, basics.Scalar(5), sceneGraph.GetNode("plane").LocalTransform().Scaling)
+
+	light := sceneGraph.GetNode("light1").GameObject.(*LightObject)
+	preset, ok := light.FalloffPreset()
+	assert.True(t, ok)
+	assert.Equal(t, FalloffPreset{Name: FalloffLinear, Radius: 50}, preset)
+	assert.InDelta(t, 0.5, float64(light.FallOff()(25)), 1e-9)
+	ambient := sceneGraph.GetNode("ambient").GameObject.(*LightObject)
+	assert.Equal(t, uint8(LightTypeHemisphere), ambient.Type())
+	assert.Equal(t, color.RGBA{R: 30, G: 30, B: 30, A: 255}, ambient.GroundColor())
+}
+
+func TestSceneGraph_WriteJSON(t *testing.T) {
+	// a scene built in code is saved and read back
+	mesh, err := graphics.NewMeshFromFile("../../meshes/cube.obj", graphics.NewMaterial("red", basics.NewVector3(65535, 0, 0), basics.Vector3{}, 10))
+	assert.NoError(t, err)
+	model := NewModelObject("cubeObj", mesh, false)
+	model.SetMeshFile("../../meshes/cube.obj")
+	model.SetCastShadows(false)
+	model.SetWireColor(color.RGBA{G: 255, A: 255})
+	camera := NewOrthographicCameraObject("camera", 4, 1, 50)
+	spot := NewSpotLightObject("spot", color.RGBA{R: 200, G: 100, B: 50, A: 255}, nil, 10, 30)
+	assert.NoError(t, spot.SetFalloffPreset(FalloffPreset{Name: FalloffSmooth, Radius: 20}))
+	spot.SetCastShadows(true)
+	shadows := DefaultShadowSettings()
+	shadows.MapSize = 1024
+	spot.SetShadowSettings(shadows)
+
+	sceneGraph := NewSceneGraph()
+	assert.NoError(t, sceneGraph.AddChild("world", NewSceneGraphNode(camera, "camera"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, -10))))
+	assert.NoError(t, sceneGraph.AddChild("world", NewSceneGraphNode(NewEmptyObject("pivot"), "pivot"), basics.NewTransform(2, basics.NewQuaternionFromEulerAngles(30, 10, 5), basics.NewVector3(1, 2, 3))))
+	assert.NoError(t, sceneGraph.AddChild("pivot", NewSceneGraphNode(model, "cube"), basics.NewTransform(0.5, basics.NewIdentityQuaternion(), basics.NewVector3(0, 1, 0))))
+	assert.NoError(t, sceneGraph.AddChild("pivot", NewSceneGraphNode(spot, "spot"), basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(0, 90, 0), basics.NewVector3(0, 5, 0))))
+
+	var buffer bytes.Buffer
+	assert.NoError(t, sceneGraph.WriteJSON(&buffer, "."))
+	loaded, err := NewSceneGraphFromReader(bytes.NewReader(buffer.Bytes()), ".")
+	assert.NoError(t, err)
+	assert.Equal(t, sceneGraph.String(), loaded.String())
+
+	for _, name := range sceneGraph.ListNodes() {
+		expected, actual := sceneGraph.GetNode(name).WorldTransform(), loaded.GetNode(name).WorldTransform()
+		assert.InDeltaf(t, float64(expected.Scaling), float64(actual.Scaling), 1e-9, "node %s", name)
+		assert.Truef(t, expected.Rotation.Equals(&actual.Rotation), "node %s", name)
+		assert.Truef(t, expected.Translation.Equals(actual.Translation), "node %s", name)
+	}
+
+	loadedModel := loaded.GetNode("cube").GameObject.(*ModelObject)
+	assert.False(t, loadedModel.CastShadows())
+	assert.True(t, loadedModel.ReceiveShadows())
+	assert.Equal(t, color.RGBA{G: 255, A: 255}, loadedModel.WireColor())
+	loadedMesh := loadedModel.Mesh()
+	assert.Equal(t, mesh.Materials()[0], loadedMesh.Materials()[0])
+	assert.Equal(t, mesh.TriangleCount(), loadedMesh.TriangleCount())
+
+	loadedCamera := loaded.GetNode("camera").GameObject.(*CameraObject)
+	assert.Equal(t, *camera, *loadedCamera)
+
+	loadedSpot := loaded.GetNode("spot").GameObject.(*LightObject)
+	assert.Equal(t, uint8(LightTypeSpot), loadedSpot.Type())
+	inner, outer := loadedSpot.ConeAngles()
+	assert.Equal(t, basics.Scalar(10), inner)
+	assert.Equal(t, basics.Scalar(30), outer)
+	assert.True(t, loadedSpot.CastShadows())
+	assert.Equal(t, shadows, loadedSpot.ShadowSettings())
+	assert.Equal(t, spot.FallOff()(12), loadedSpot.FallOff()(12))
+
+	// saving again gives the same file
+	var again bytes.Buffer
+	assert.NoError(t, loaded.WriteJSON(&again, "."))
+	assert.Equal(t, buffer.String(), again.String())
+}
+
+func TestSceneGraph_WriteJSONErrors(t *testing.T) {
+	sceneGraph := NewSceneGraph()
+	light := NewLightObject("light", color.White, func(lightDistance basics.Scalar) basics.Scalar { return 1 })
+	assert.NoError(t, sceneGraph.AddChild("world", NewSceneGraphNode(light, "light"), basics.NewZeroTransform()))
+	var buffer bytes.Buffer
+	assert.ErrorContains(t, sceneGraph.WriteJSON(&buffer, ""), "falloff")
+
+	sceneGraph = NewSceneGraph()
+	assert.NoError(t, sceneGraph.AddChild("world", NewSceneGraphNode(NewModelObject("model", graphics.NewEmpyMesh(), false), "model"), basics.NewZeroTransform()))
+	assert.ErrorContains(t, sceneGraph.WriteJSON(&buffer, ""), "mesh")
+}
+
+func TestNewSceneGraphFromReader_Errors(t *testing.T) {
+	for _, test := range []struct {
+		scene string
+		err   string
+	}{
+		{`{"nodes": [{"name": "a", "empty": {}, "colour": 1}]}`, "unknown field"},
+		{`{"nodes": [{"empty": {}}]}`, "no name"},
+		{`{"nodes": [{"name": "a", "empty": {}}, {"name": "a", "empty": {}}]}`, "same name"},
+		{`{"nodes": [{"name": "a"}]}`, "exactly one"},
+		{`{"nodes": [{"name": "a", "empty": {}, "camera": {}}]}`, "exactly one"},
+		{`{"nodes": [{"name": "a", "light": {"type": "area", "color": [1, 1, 1, 255]}}]}`, "light type"},
+		{`{"nodes": [{"name": "a", "light": {"type": "point", "color": [1, 1, 1, 255], "falloff": {"preset": "cubic", "radius": 1}}}]}`, "unknown falloff"},
+		{`{"nodes": [{"name": "a", "light": {"type": "point", "color": [1, 1, 1, 255], "falloff": {"preset": "linear"}}}]}`, "radius"},
+		{`{"nodes": [{"name": "a", "model": {"mesh": "cube.obj", "material": "missing"}}]}`, "unknown material"},
+		{`{"nodes": [{"name": "a", "camera": {"fov": 180}}]}`, "field of view"},
+		{`{"nodes": [{"name": "a", "camera": {"near": -1}}]}`, "near distance"},
+		{`{"nodes": [{"name": "a", "camera": {"near": 10, "far": 5}}]}`, "far distance"},
+		{`{"nodes": [{"name": "a", "camera": {"orthographic": true, "orthoHeight": -2}}]}`, "orthographic height"},
+	} {
+		_, err := NewSceneGraphFromReader(strings.NewReader(test.scene), "")
+		assert.ErrorContainsf(t, err, test.err, "%s", test.scene)
+	}
+}
+
+func TestNewFalloffFunction(t *testing.T) {
+	for _, name := range []string{FalloffNone, FalloffLinear, FalloffQuadratic, FalloffSmooth} {
+		falloff, err := NewFalloffFunction(FalloffPreset{Name: name, Radius: 10})
+		assert.NoError(t, err)
+		assert.Equalf(t, basics.Scalar(1), falloff(0), "%s at the light", name)
+		assert.Truef(t, falloff(5) <= falloff(2), "%s decreases with the distance", name)
+	}
+	quadratic, _ := NewFalloffFunction(FalloffPreset{Name: FalloffQuadratic, Radius: 10})
+	assert.InDelta(t, 0.5, float64(quadratic(10)), 1e-9)
+	smooth, _ := NewFalloffFunction(FalloffPreset{Name: FalloffSmooth, Radius: 10})
+	assert.Equal(t, basics.Scalar(0), smooth(10))
+	assert.Equal(t, basics.Scalar(0), smooth(20))
+}
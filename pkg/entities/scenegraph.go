@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"slices"
 	"strings"
 )
 
@@ -16,12 +18,21 @@ type SceneGraph struct {
 type SceneGraphNode struct {
 	nodeName          string
 	parentNode        *SceneGraphNode
-	childNodes        []*SceneGraphNode //children are not ordered and the order may change at runtime
+	childNodes        []*SceneGraphNode // in the order they were added
 	toParentTransform basics.Transform
 	GameObject        GameObject
-	//caching world transform and a bool to refresh it ?
+	worldTransform    basics.Transform // cache of WorldTransform, valid when worldDirty is false
+	worldDirty        bool             // when a node is dirty all of its descendants are dirty too
 }
 
+var (
+	ErrNodeNotFound = errors.New("the node does not exist")
+	ErrNodeExists   = errors.New("a node with the same name already exists")
+	ErrRootNode     = errors.New("the operation is not allowed on the root node")
+	ErrNodeAttached = errors.New("the node already has a parent")
+	ErrCycle        = errors.New("the new parent is the node or one of its descendants")
+)
+
 func NewSceneGraph() *SceneGraph {
 	worldNode := newWorldNode()
 	nodes := make(map[string]*SceneGraphNode)
@@ -33,41 +44,112 @@ func NewSceneGraph() *SceneGraph {
 	return &sceneGraph
 }
 
-// AddChild Adds a child provided the name of the parent. Returns an error if a node with the same name already exists or the parent node does not exist
+// AddChild Adds a child provided the name of the parent, the descendants of the child are added with it. Returns an
+// error if the parent node does not exist, the child already has a parent or a node with the same name as the child
+// or one of its descendants already exists
 func (sceneGraph *SceneGraph) AddChild(parentName string, childNode *SceneGraphNode, toParentTransform basics.Transform) error {
-	if _, ok := sceneGraph.nodes[childNode.nodeName]; ok {
-		//node already exists
-		return errors.New("a node with the same name already exists")
+	parentNode, ok := sceneGraph.nodes[parentName]
+	if !ok {
+		return fmt.Errorf("parent %s: %w", parentName, ErrNodeNotFound)
+	}
+	if childNode.parentNode != nil || childNode == sceneGraph.root {
+		return fmt.Errorf("%s: %w", childNode.nodeName, ErrNodeAttached)
+	}
+	subtree := childNode.subtree()
+	names := make(map[string]bool, len(subtree))
+	for _, node := range subtree {
+		if _, ok := sceneGraph.nodes[node.nodeName]; ok || names[node.nodeName] {
+			return fmt.Errorf("%s: %w", node.nodeName, ErrNodeExists)
+		}
+		names[node.nodeName] = true
 	}
 
-	if parentNode, ok := sceneGraph.nodes[parentName]; ok {
-		//parent node found
-		childNode.toParentTransform = toParentTransform
-		childNode.parentNode = parentNode
-		parentNode.childNodes = append(parentNode.childNodes, childNode)
-		sceneGraph.nodes[childNode.nodeName] = childNode
-	} else {
-		return errors.New("the parent node does not exist")
+	childNode.toParentTransform = toParentTransform
+	childNode.parentNode = parentNode
+	childNode.invalidateWorldTransform()
+	parentNode.childNodes = append(parentNode.childNodes, childNode)
+	for _, node := range subtree {
+		sceneGraph.nodes[node.nodeName] = node
 	}
 	return nil
 }
 
-// RemoveChild Removes a node and all of its children
-func (sceneGraph *SceneGraph) RemoveChild(nodeName string) {
-	nodeToDelete, ok := sceneGraph.nodes[nodeName]
-	if ok {
-		delete(sceneGraph.nodes, nodeName)
-		children := nodeToDelete.parentNode.childNodes
-		for i := 0; i < len(children); i++ {
-			if children[i] == nodeToDelete {
-				//swap with the last element and remove from slice
-				children[i], children[len(children)-1] = children[len(children)-1], children[i]
-				nodeToDelete.parentNode.childNodes = children[:len(children)-1]
-				nodeToDelete.parentNode = nil
-				return
-			}
+// RemoveChild Removes a node and all of its descendants from the scene graph, their names can be used again. The
+// removed node keeps its children and can be added back with AddChild. Returns an error if the node does not exist or
+// is the root
+func (sceneGraph *SceneGraph) RemoveChild(nodeName string) error {
+	nodeToDelete, err := sceneGraph.nonRootNode(nodeName)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodeToDelete.subtree() {
+		delete(sceneGraph.nodes, node.nodeName)
+	}
+	nodeToDelete.detach()
+	return nil
+}
+
+// Reparent Moves a node with its descendants under newParentName, as the last child. With keepWorldTransform the
+// local transform of the node is changed so that it stays in the same place in world space, otherwise the local
+// transform is kept and the node moves with its new parent. Returns an error if one of the nodes does not exist, the
+// node is the root or the new parent is the node itself or one of its descendants
+func (sceneGraph *SceneGraph) Reparent(nodeName string, newParentName string, keepWorldTransform bool) error {
+	node, err := sceneGraph.nonRootNode(nodeName)
+	if err != nil {
+		return err
+	}
+	newParent, ok := sceneGraph.nodes[newParentName]
+	if !ok {
+		return fmt.Errorf("parent %s: %w", newParentName, ErrNodeNotFound)
+	}
+	for ancestor := newParent; ancestor != nil; ancestor = ancestor.parentNode {
+		if ancestor == node {
+			return fmt.Errorf("%s under %s: %w", nodeName, newParentName, ErrCycle)
 		}
 	}
+
+	worldT := node.WorldTransform()
+	node.detach()
+	node.parentNode = newParent
+	newParent.childNodes = append(newParent.childNodes, node)
+	if keepWorldTransform {
+		parentWorldT := newParent.WorldTransform()
+		parentWorldT.ThisInvert()
+		node.toParentTransform = worldT.Cumulate(&parentWorldT)
+	}
+	node.invalidateWorldTransform()
+	return nil
+}
+
+// Rename Changes the name of a node. Returns an error if the node does not exist, is the root or a node called newName
+// already exists
+func (sceneGraph *SceneGraph) Rename(nodeName string, newName string) error {
+	node, err := sceneGraph.nonRootNode(nodeName)
+	if err != nil {
+		return err
+	}
+	if newName == nodeName {
+		return nil
+	}
+	if _, ok := sceneGraph.nodes[newName]; ok {
+		return fmt.Errorf("%s: %w", newName, ErrNodeExists)
+	}
+	delete(sceneGraph.nodes, nodeName)
+	node.nodeName = newName
+	sceneGraph.nodes[newName] = node
+	return nil
+}
+
+// nonRootNode Returns the node called nodeName, an error if it does not exist or is the root
+func (sceneGraph *SceneGraph) nonRootNode(nodeName string) (*SceneGraphNode, error) {
+	node, ok := sceneGraph.nodes[nodeName]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", nodeName, ErrNodeNotFound)
+	}
+	if node == sceneGraph.root {
+		return nil, fmt.Errorf("%s: %w", nodeName, ErrRootNode)
+	}
+	return node, nil
 }
 
 // ListNodes Unordered list of node names
@@ -108,6 +190,7 @@ func NewSceneGraphNode(gameObject GameObject, nodeName string) *SceneGraphNode {
 		childNodes:        make([]*SceneGraphNode, 0),
 		toParentTransform: basics.NewZeroTransform(),
 		GameObject:        gameObject,
+		worldDirty:        true,
 	}
 }
 
@@ -129,30 +212,83 @@ func (node *SceneGraphNode) Children() []*SceneGraphNode {
 	return dst
 }
 
+// LocalTransform Returns the transform from the space of the node to the space of its parent
+func (node *SceneGraphNode) LocalTransform() basics.Transform {
+	return node.toParentTransform
+}
+
+func (node *SceneGraphNode) SetLocalTransform(t basics.Transform) {
+	node.toParentTransform = t
+	node.invalidateWorldTransform()
+}
+
 func (node *SceneGraphNode) CumulateWorldTransform(t *basics.Transform) {
 	worldT := node.WorldTransform()
 	worldT.ThisCumulate(t)
+	if node.parentNode == nil {
+		node.SetLocalTransform(worldT)
+		return
+	}
 	parentWorldT := node.parentNode.WorldTransform()
 	parentWorldT.ThisInvert()
-	node.toParentTransform = worldT.Cumulate(&parentWorldT)
+	node.SetLocalTransform(worldT.Cumulate(&parentWorldT))
 }
 
 func (node *SceneGraphNode) CumulateBeforeLocalTranform(t *basics.Transform) {
-	node.toParentTransform = t.Cumulate(&node.toParentTransform)
+	node.SetLocalTransform(t.Cumulate(&node.toParentTransform))
 }
 
 func (node *SceneGraphNode) CumulateLocalTransform(t *basics.Transform) {
 	node.toParentTransform.ThisCumulate(t)
+	node.invalidateWorldTransform()
 }
 
+// WorldTransform Returns the transform from the space of the node to world space. The result is cached until the
+// local transform of the node or of one of its ancestors changes
 func (node *SceneGraphNode) WorldTransform() basics.Transform {
-	tempNode := node
-	worldT := basics.NewZeroTransform()
-	for tempNode != nil {
-		worldT.ThisCumulate(&tempNode.toParentTransform)
-		tempNode = tempNode.parentNode
+	if !node.worldDirty {
+		return node.worldTransform
+	}
+	// the ancestors are refreshed first, starting from the closest one that is not dirty
+	dirty := []*SceneGraphNode{node}
+	for parent := node.parentNode; parent != nil && parent.worldDirty; parent = parent.parentNode {
+		dirty = append(dirty, parent)
+	}
+	for i := len(dirty) - 1; i >= 0; i-- {
+		n := dirty[i]
+		n.worldTransform = n.toParentTransform
+		if n.parentNode != nil {
+			n.worldTransform.ThisCumulate(&n.parentNode.worldTransform)
+		}
+		n.worldDirty = false
+	}
+	return node.worldTransform
+}
+
+// invalidateWorldTransform marks the cached world transform of the node and of all of its descendants as dirty. The
+// descendants of a dirty node are already dirty, so the walk stops there
+func (node *SceneGraphNode) invalidateWorldTransform() {
+	stack := []*SceneGraphNode{node}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n.worldDirty {
+			continue
+		}
+		n.worldDirty = true
+		stack = append(stack, n.childNodes...)
 	}
-	return worldT
+}
+
+// WorldBounds Returns the axis aligned box containing the mesh of the node in world space, false if the node does not
+// hold a ModelObject
+func (node *SceneGraphNode) WorldBounds() (graphics.AABB, bool) {
+	model, ok := node.GameObject.(*ModelObject)
+	if !ok {
+		return graphics.AABB{}, false
+	}
+	worldT := node.WorldTransform()
+	return model.Bounds().Transformed(&worldT), true
 }
 
 func (node *SceneGraphNode) SetViewRotation(yaw basics.Scalar, pitch basics.Scalar) {
@@ -161,6 +297,7 @@ func (node *SceneGraphNode) SetViewRotation(yaw basics.Scalar, pitch basics.Scal
 	newRotation := basics.NewQuaternionFromEulerAngles(yaw, pitch, 0)
 	//fmt.Println("newRotation", newRotation)
 	node.toParentTransform.Rotation = newRotation
+	node.invalidateWorldTransform()
 }
 
 func (node *SceneGraphNode) Orientation() basics.Matrix3 {
@@ -172,6 +309,28 @@ func (node *SceneGraphNode) Orientation() basics.Matrix3 {
 	return matrix3
 }
 
+// subtree Returns the node and all of its descendants, parents before their children
+func (node *SceneGraphNode) subtree() []*SceneGraphNode {
+	nodes := []*SceneGraphNode{node}
+	for i := 0; i < len(nodes); i++ {
+		nodes = append(nodes, nodes[i].childNodes...)
+	}
+	return nodes
+}
+
+// detach removes the node from the children of its parent, the order of the other children is kept
+func (node *SceneGraphNode) detach() {
+	parent := node.parentNode
+	if parent == nil {
+		return
+	}
+	if i := slices.Index(parent.childNodes, node); i >= 0 {
+		parent.childNodes = slices.Delete(parent.childNodes, i, i+1)
+	}
+	node.parentNode = nil
+	node.invalidateWorldTransform()
+}
+
 func (node *SceneGraphNode) rescursiveToString(depth int) string {
 	var sb strings.Builder
 	sb.WriteString(strings.Repeat("\t", depth))
@@ -1,8 +1,11 @@
 package entities
 
 import (
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"strconv"
 	"testing"
 )
 
@@ -24,3 +27,230 @@ func TestSceneGraph_String(t *testing.T) {
 
 	assert.Equal(t, "world: worldObj\n\tcube: cubeObj\n\t\tsecondCube: cubeObj\n", sceneGraph.String())
 }
+
+func TestSceneGraphNode_WorldBounds(t *testing.T) {
+	mesh := graphics.NewMesh([]graphics.VertexAttributes{
+		graphics.NewVertexAttributes(basics.NewVector3(0, 0, 0), basics.Vector3{}, basics.Vector3{}, basics.Vector3{}),
+		graphics.NewVertexAttributes(basics.NewVector3(1, 0, 0), basics.Vector3{}, basics.Vector3{}, basics.Vector3{}),
+		graphics.NewVertexAttributes(basics.NewVector3(0, 1, 0), basics.Vector3{}, basics.Vector3{}, basics.Vector3{}),
+	}, []graphics.TriangleConnectivity{{0, 1, 2}})
+	model := NewModelObject("triangle", mesh, false)
+	assert.Equal(t, graphics.NewAABBFromPoints(basics.NewVector3(0, 0, 0), basics.NewVector3(1, 1, 0)), model.Bounds())
+
+	sceneGraph := NewSceneGraph()
+	sceneGraph.AddChild("world", NewSceneGraphNode(NewEmptyObject("parent"), "parent"), basics.NewTransform(2, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, 5)))
+	sceneGraph.AddChild("parent", NewSceneGraphNode(model, "triangle"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(1, 0, 0)))
+
+	bounds, ok := sceneGraph.GetNode("triangle").WorldBounds()
+	assert.True(t, ok)
+	assert.True(t, bounds.Min.Equals(basics.NewVector3(2, 0, 5)), "min %v", bounds.Min)
+	assert.True(t, bounds.Max.Equals(basics.NewVector3(4, 2, 5)), "max %v", bounds.Max)
+
+	_, ok = sceneGraph.GetNode("parent").WorldBounds()
+	assert.False(t, ok, "the node does not hold a model")
+}
+
+// childNames Returns the names of the children of the node in order
+func childNames(node *SceneGraphNode) []string {
+	var names []string
+	for _, child := range node.Children() {
+		names = append(names, child.Name())
+	}
+	return names
+}
+
+// newTestTree Returns a scene graph with world -> a -> (b -> c, d, e)
+func newTestTree() *SceneGraph {
+	sceneGraph := NewSceneGraph()
+	sceneGraph.AddChild("world", NewSceneGraphNode(NewEmptyObject("a"), "a"), basics.NewTransform(2, basics.NewIdentityQuaternion(), basics.NewVector3(1, 0, 0)))
+	sceneGraph.AddChild("a", NewSceneGraphNode(NewEmptyObject("b"), "b"), basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(0.5, 0, 0), basics.NewVector3(0, 1, 0)))
+	sceneGraph.AddChild("b", NewSceneGraphNode(NewEmptyObject("c"), "c"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, 1)))
+	sceneGraph.AddChild("a", NewSceneGraphNode(NewEmptyObject("d"), "d"), basics.NewZeroTransform())
+	sceneGraph.AddChild("a", NewSceneGraphNode(NewEmptyObject("e"), "e"), basics.NewZeroTransform())
+	return sceneGraph
+}
+
+func TestSceneGraph_AddChild(t *testing.T) {
+	sceneGraph := newTestTree()
+	err := sceneGraph.AddChild("missing", NewSceneGraphNode(NewEmptyObject("f"), "f"), basics.NewZeroTransform())
+	assert.True(t, errors.Is(err, ErrNodeNotFound), "missing parent: %v", err)
+	err = sceneGraph.AddChild("world", NewSceneGraphNode(NewEmptyObject("c"), "c"), basics.NewZeroTransform())
+	assert.True(t, errors.Is(err, ErrNodeExists), "duplicate name: %v", err)
+	err = sceneGraph.AddChild("c", sceneGraph.GetNode("a"), basics.NewZeroTransform())
+	assert.True(t, errors.Is(err, ErrNodeAttached), "node already in the graph: %v", err)
+	err = sceneGraph.AddChild("c", sceneGraph.GetRoot(), basics.NewZeroTransform())
+	assert.True(t, errors.Is(err, ErrNodeAttached), "root: %v", err)
+	assert.Equal(t, []string{"b", "d", "e"}, childNames(sceneGraph.GetNode("a")))
+}
+
+func TestSceneGraph_RemoveChild(t *testing.T) {
+	sceneGraph := newTestTree()
+	b := sceneGraph.GetNode("b")
+	assert.Nil(t, sceneGraph.RemoveChild("b"))
+	assert.Nil(t, sceneGraph.GetNode("b"))
+	assert.Nil(t, sceneGraph.GetNode("c"), "descendants are unregistered")
+	assert.Nil(t, b.Parent())
+	assert.Equal(t, []string{"d", "e"}, childNames(sceneGraph.GetNode("a")), "the order of the children is kept")
+	assert.ElementsMatch(t, []string{"world", "a", "d", "e"}, sceneGraph.ListNodes())
+
+	assert.True(t, errors.Is(sceneGraph.RemoveChild("b"), ErrNodeNotFound))
+	assert.True(t, errors.Is(sceneGraph.RemoveChild("world"), ErrRootNode))
+
+	// the removed subtree can be added back with its descendants
+	assert.Nil(t, sceneGraph.AddChild("d", b, b.LocalTransform()))
+	assert.Equal(t, b, sceneGraph.GetNode("b"))
+	assert.Equal(t, b.Children()[0], sceneGraph.GetNode("c"))
+
+	sceneGraph.RemoveChild("b")
+	assert.Nil(t, sceneGraph.AddChild("world", NewSceneGraphNode(NewEmptyObject("c"), "c"), basics.NewZeroTransform()), "names of removed nodes are free")
+	assert.True(t, errors.Is(sceneGraph.AddChild("world", b, basics.NewZeroTransform()), ErrNodeExists), "a descendant name is taken")
+	assert.Nil(t, sceneGraph.GetNode("b"), "nothing is added when a name is taken")
+}
+
+func TestSceneGraph_Reparent(t *testing.T) {
+	sceneGraph := newTestTree()
+	b, c, e := sceneGraph.GetNode("b"), sceneGraph.GetNode("c"), sceneGraph.GetNode("e")
+	cWorldT := c.WorldTransform()
+
+	assert.Nil(t, sceneGraph.Reparent("b", "e", true))
+	assert.Equal(t, e, b.Parent())
+	assert.Equal(t, []string{"d", "e"}, childNames(sceneGraph.GetNode("a")))
+	assert.Equal(t, []string{"b"}, childNames(e))
+	assertWorldTransform(t, cWorldT, c.WorldTransform(), "keepWorldTransform")
+
+	local := b.LocalTransform()
+	assert.Nil(t, sceneGraph.Reparent("b", "world", false))
+	assert.Equal(t, local, b.LocalTransform())
+	assertWorldTransform(t, local, b.WorldTransform(), "the local transform is kept")
+	assertWorldTransform(t, walkWorldTransform(c), c.WorldTransform(), "descendants move with the node")
+	assert.Equal(t, []string{"a", "b"}, childNames(sceneGraph.GetRoot()))
+
+	assert.True(t, errors.Is(sceneGraph.Reparent("b", "c", false), ErrCycle), "under a descendant")
+	assert.True(t, errors.Is(sceneGraph.Reparent("b", "b", false), ErrCycle), "under itself")
+	assert.True(t, errors.Is(sceneGraph.Reparent("world", "a", false), ErrRootNode))
+	assert.True(t, errors.Is(sceneGraph.Reparent("missing", "a", false), ErrNodeNotFound))
+	assert.True(t, errors.Is(sceneGraph.Reparent("b", "missing", false), ErrNodeNotFound))
+	assert.Equal(t, sceneGraph.GetRoot(), b.Parent(), "failed operations change nothing")
+}
+
+func TestSceneGraph_Rename(t *testing.T) {
+	sceneGraph := newTestTree()
+	c := sceneGraph.GetNode("c")
+	assert.Nil(t, sceneGraph.Rename("c", "renamed"))
+	assert.Equal(t, "renamed", c.Name())
+	assert.Equal(t, c, sceneGraph.GetNode("renamed"))
+	assert.Nil(t, sceneGraph.GetNode("c"))
+	assert.Nil(t, sceneGraph.AddChild("world", NewSceneGraphNode(NewEmptyObject("c"), "c"), basics.NewZeroTransform()), "the old name is free")
+
+	assert.True(t, errors.Is(sceneGraph.Rename("renamed", "a"), ErrNodeExists))
+	assert.True(t, errors.Is(sceneGraph.Rename("missing", "f"), ErrNodeNotFound))
+	assert.True(t, errors.Is(sceneGraph.Rename("world", "root"), ErrRootNode))
+	assert.Nil(t, sceneGraph.Rename("renamed", "renamed"))
+}
+
+// walkWorldTransform Returns the world transform of the node without the cache, walking to the root
+func walkWorldTransform(node *SceneGraphNode) basics.Transform {
+	worldT := basics.NewZeroTransform()
+	for ; node != nil; node = node.parentNode {
+		worldT.ThisCumulate(&node.toParentTransform)
+	}
+	return worldT
+}
+
+func assertWorldTransform(t *testing.T, expected basics.Transform, actual basics.Transform, name string) {
+	t.Helper()
+	assert.InDelta(t, float64(expected.Scaling), float64(actual.Scaling), 1e-9, name)
+	assert.True(t, expected.Rotation.Equals(&actual.Rotation), "%s rotation %v, expected %v", name, actual.Rotation, expected.Rotation)
+	assert.True(t, expected.Translation.Equals(actual.Translation), "%s translation %v, expected %v", name, actual.Translation, expected.Translation)
+}
+
+func TestSceneGraphNode_WorldTransformCache(t *testing.T) {
+	sceneGraph := NewSceneGraph()
+	step := basics.NewTransform(2, basics.NewQuaternionFromEulerAngles(0.3, 0.1, 0), basics.NewVector3(1, 0, 0))
+	sceneGraph.AddChild("world", NewSceneGraphNode(NewEmptyObject("a"), "a"), step)
+	sceneGraph.AddChild("a", NewSceneGraphNode(NewEmptyObject("b"), "b"), step)
+	sceneGraph.AddChild("b", NewSceneGraphNode(NewEmptyObject("c"), "c"), step)
+	sceneGraph.AddChild("a", NewSceneGraphNode(NewEmptyObject("d"), "d"), step)
+	a, b, c, d := sceneGraph.GetNode("a"), sceneGraph.GetNode("b"), sceneGraph.GetNode("c"), sceneGraph.GetNode("d")
+
+	check := func(when string) {
+		for _, node := range []*SceneGraphNode{a, b, c, d} {
+			assertWorldTransform(t, walkWorldTransform(node), node.WorldTransform(), when+" "+node.Name())
+		}
+	}
+	check("initial")
+	assert.False(t, c.worldDirty, "the world transform is cached")
+
+	move := basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 3, 0))
+	b.CumulateLocalTransform(&move)
+	assert.False(t, a.worldDirty, "ancestors are not invalidated")
+	assert.False(t, d.worldDirty, "siblings are not invalidated")
+	assert.True(t, b.worldDirty)
+	assert.True(t, c.worldDirty, "descendants are invalidated")
+	check("CumulateLocalTransform")
+
+	a.SetLocalTransform(basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, -4)))
+	check("SetLocalTransform")
+	a.CumulateBeforeLocalTranform(&step)
+	check("CumulateBeforeLocalTranform")
+	c.CumulateWorldTransform(&move)
+	check("CumulateWorldTransform")
+	d.SetViewRotation(0.5, 0.2)
+	check("SetViewRotation")
+
+	sceneGraph.RemoveChild("b")
+	assertWorldTransform(t, walkWorldTransform(c), c.WorldTransform(), "removed c")
+	assertWorldTransform(t, b.LocalTransform(), b.WorldTransform(), "a removed node is its own root")
+}
+
+// benchmarkWorldTransforms builds a scene graph and measures the world transforms of all the nodes, like a frame of
+// the renderer, with the cache and with the walk to the root. With moveRoot the root child moves before every frame
+// so all the cached transforms are recomputed
+func benchmarkWorldTransforms(b *testing.B, sceneGraph *SceneGraph, moveRoot bool) {
+	nodes := modelNodes(sceneGraph)
+	move := basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0.01, 0, 0))
+	top := sceneGraph.GetRoot().childNodes[0]
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if moveRoot {
+				top.CumulateLocalTransform(&move)
+			}
+			for _, node := range nodes {
+				node.WorldTransform()
+			}
+		}
+	})
+	b.Run("walk", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if moveRoot {
+				top.CumulateLocalTransform(&move)
+			}
+			for _, node := range nodes {
+				walkWorldTransform(node)
+			}
+		}
+	})
+}
+
+// benchmarkSceneGraph Returns a scene graph of count model nodes where every node has children nodes
+func benchmarkSceneGraph(count int, children int) *SceneGraph {
+	sceneGraph := NewSceneGraph()
+	model := NewModelObject("model", graphics.NewEmpyMesh(), false)
+	t := basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(0.01, 0, 0), basics.NewVector3(0, 0, 1))
+	sceneGraph.AddChild("world", NewSceneGraphNode(model, "0"), t)
+	for i := 1; i < count; i++ {
+		sceneGraph.AddChild(strconv.Itoa((i-1)/children), NewSceneGraphNode(model, strconv.Itoa(i)), t)
+	}
+	return sceneGraph
+}
+
+func BenchmarkSceneGraphNode_WorldTransform(b *testing.B) {
+	for _, moveRoot := range []bool{false, true} {
+		b.Run("deep/moveRoot="+strconv.FormatBool(moveRoot), func(b *testing.B) {
+			benchmarkWorldTransforms(b, benchmarkSceneGraph(1000, 1), moveRoot)
+		})
+		b.Run("wide/moveRoot="+strconv.FormatBool(moveRoot), func(b *testing.B) {
+			benchmarkWorldTransforms(b, benchmarkSceneGraph(1000, 8), moveRoot)
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package graphics
+
+import (
+	"github.com/tsagae/software3d/pkg/basics"
+	"math"
+)
+
+// AABB Axis aligned bounding box. An empty box has Min greater than Max
+type AABB struct {
+	Min basics.Vector3
+	Max basics.Vector3
+}
+
+// BoundingSphere Sphere containing all the vertices of a mesh
+type BoundingSphere struct {
+	Center basics.Vector3
+	Radius basics.Scalar
+}
+
+// OBB Oriented bounding box, Axes are orthonormal and HalfExtents are the half sizes of the box along them
+type OBB struct {
+	Center      basics.Vector3
+	Axes        [3]basics.Vector3
+	HalfExtents basics.Vector3
+}
+
+// PlaneSide The position of a bounding volume relative to a plane
+type PlaneSide uint8
+
+const (
+	PlaneSideBehind     PlaneSide = iota // the volume is entirely behind the plane
+	PlaneSideFront                       // the volume is entirely in front of the plane
+	PlaneSideIntersects                  // the plane crosses the volume
+)
+
+/* AABB */
+
+// NewEmptyAABB Returns a box that contains nothing, points are added with ThisExtend
+func NewEmptyAABB() AABB {
+	inf := basics.Scalar(math.Inf(1))
+	return AABB{Min: basics.NewVector3(inf, inf, inf), Max: basics.NewVector3(-inf, -inf, -inf)}
+}
+
+// NewAABBFromPoints Returns the smallest box containing the points
+func NewAABBFromPoints(points ...basics.Vector3) AABB {
+	box := NewEmptyAABB()
+	for _, p := range points {
+		box.ThisExtend(p)
+	}
+	return box
+}
+
+// ThisExtend grows the box to contain p
+func (b *AABB) ThisExtend(p basics.Vector3) {
+	b.Min = basics.NewVector3(min(b.Min.X, p.X), min(b.Min.Y, p.Y), min(b.Min.Z, p.Z))
+	b.Max = basics.NewVector3(max(b.Max.X, p.X), max(b.Max.Y, p.Y), max(b.Max.Z, p.Z))
+}
+
+// ThisUnion grows the box to contain other
+func (b *AABB) ThisUnion(other AABB) {
+	if other.IsEmpty() {
+		return
+	}
+	b.ThisExtend(other.Min)
+	b.ThisExtend(other.Max)
+}
+
+// IsEmpty Returns true if the box contains no points
+func (b AABB) IsEmpty() bool {
+	return b.Min.X > b.Max.X || b.Min.Y > b.Max.Y || b.Min.Z > b.Max.Z
+}
+
+// Center Returns the center of the box
+func (b AABB) Center() basics.Vector3 {
+	return b.Min.Add(b.Max).Div(2)
+}
+
+// HalfExtents Returns the half sizes of the box along the axes
+func (b AABB) HalfExtents() basics.Vector3 {
+	return b.Max.Sub(b.Min).Div(2)
+}
+
+// Corners Returns the 8 corners of the box
+func (b AABB) Corners() [8]basics.Vector3 {
+	var corners [8]basics.Vector3
+	for i := range corners {
+		corners[i] = b.Min
+		if i&1 != 0 {
+			corners[i].X = b.Max.X
+		}
+		if i&2 != 0 {
+			corners[i].Y = b.Max.Y
+		}
+		if i&4 != 0 {
+			corners[i].Z = b.Max.Z
+		}
+	}
+	return corners
+}
+
+// Contains Returns true if p is inside the box or on its surface
+func (b AABB) Contains(p basics.Vector3) bool {
+	return p.X >= b.Min.X && p.X <= b.Max.X && p.Y >= b.Min.Y && p.Y <= b.Max.Y && p.Z >= b.Min.Z && p.Z <= b.Max.Z
+}
+
+// Transformed Returns the axis aligned box containing the box transformed by t
+func (b AABB) Transformed(t *basics.Transform) AABB {
+	if b.IsEmpty() {
+		return b
+	}
+	result := NewEmptyAABB()
+	for _, corner := range b.Corners() {
+		t.ApplyToPoint(&corner)
+		result.ThisExtend(corner)
+	}
+	return result
+}
+
+// OBB Returns the box transformed by t as an oriented box, transforms have a uniform scaling so the result is exact
+func (b AABB) OBB(t *basics.Transform) OBB {
+	center := b.Center()
+	t.ApplyToPoint(&center)
+	return OBB{
+		Center:      center,
+		Axes:        [3]basics.Vector3{t.Rotation.Rotated(basics.Right()), t.Rotation.Rotated(basics.Up()), t.Rotation.Rotated(basics.Forward())},
+		HalfExtents: b.HalfExtents().Mul(basics.Abs(t.Scaling)),
+	}
+}
+
+// TestPlane Returns the side of the plane the box is on
+func (b AABB) TestPlane(plane *basics.Plane) PlaneSide {
+	halfExtents := b.HalfExtents()
+	radius := basics.Abs(plane.Normal.X)*halfExtents.X + basics.Abs(plane.Normal.Y)*halfExtents.Y + basics.Abs(plane.Normal.Z)*halfExtents.Z
+	return planeSide(b.Center().Sub(plane.Point).Dot(plane.Normal), radius)
+}
+
+/* Bounding sphere */
+
+// Transformed Returns the sphere transformed by t
+func (s BoundingSphere) Transformed(t *basics.Transform) BoundingSphere {
+	center := s.Center
+	t.ApplyToPoint(&center)
+	return BoundingSphere{Center: center, Radius: s.Radius * basics.Abs(t.Scaling)}
+}
+
+// TestPlane Returns the side of the plane the sphere is on
+func (s BoundingSphere) TestPlane(plane *basics.Plane) PlaneSide {
+	return planeSide(s.Center.Sub(plane.Point).Dot(plane.Normal), s.Radius)
+}
+
+/* OBB */
+
+// TestPlane Returns the side of the plane the box is on
+func (o OBB) TestPlane(plane *basics.Plane) PlaneSide {
+	// radius of the projection of the box on the normal of the plane
+	radius := basics.Abs(o.Axes[0].Dot(plane.Normal))*o.HalfExtents.X +
+		basics.Abs(o.Axes[1].Dot(plane.Normal))*o.HalfExtents.Y +
+		basics.Abs(o.Axes[2].Dot(plane.Normal))*o.HalfExtents.Z
+	return planeSide(o.Center.Sub(plane.Point).Dot(plane.Normal), radius)
+}
+
+func planeSide(distance basics.Scalar, radius basics.Scalar) PlaneSide {
+	if distance < -radius {
+		return PlaneSideBehind
+	}
+	if distance > radius {
+		return PlaneSideFront
+	}
+	return PlaneSideIntersects
+}
+
+/* Mesh bounds */
+
+// Bounds Returns the axis aligned box containing the vertices used by the triangles of the mesh, empty if the mesh
+// has no triangles
+func (m *Mesh) Bounds() AABB {
+	box := NewEmptyAABB()
+	for _, triangle := range m.connectivity {
+		for _, index := range triangle {
+			box.ThisExtend(m.geometry[index].position)
+		}
+	}
+	return box
+}
+
+// BoundingSphere Returns a sphere centered in the bounding box containing the vertices used by the triangles of the
+// mesh, it's not the smallest sphere but it's close for most meshes
+func (m *Mesh) BoundingSphere() BoundingSphere {
+	box := m.Bounds()
+	if box.IsEmpty() {
+		return BoundingSphere{}
+	}
+	var radius basics.Scalar
+	center := box.Center()
+	for _, triangle := range m.connectivity {
+		for _, index := range triangle {
+			radius = max(radius, m.geometry[index].position.Sub(center).Length())
+		}
+	}
+	return BoundingSphere{Center: center, Radius: radius}
+}
@@ -0,0 +1,69 @@
+package graphics
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"testing"
+)
+
+func TestMesh_Bounds(t *testing.T) {
+	cube := newTestCube()
+	box := cube.Bounds()
+	assert.Equal(t, AABB{Min: basics.NewVector3(0, 0, 0), Max: basics.NewVector3(1, 1, 1)}, box)
+	assert.True(t, box.Center().Equals(basics.NewVector3(0.5, 0.5, 0.5)))
+	assert.True(t, box.Contains(basics.NewVector3(1, 0.5, 0)))
+	assert.False(t, box.Contains(basics.NewVector3(1.1, 0.5, 0)))
+
+	sphere := cube.BoundingSphere()
+	assert.True(t, sphere.Center.Equals(basics.NewVector3(0.5, 0.5, 0.5)))
+	assert.InDelta(t, float64(basics.Sqrt(3)/2), float64(sphere.Radius), 1e-9)
+
+	empty := NewEmpyMesh()
+	assert.True(t, empty.Bounds().IsEmpty())
+	assert.Equal(t, BoundingSphere{}, empty.BoundingSphere())
+}
+
+func TestAABB_Transformed(t *testing.T) {
+	box := NewAABBFromPoints(basics.NewVector3(-1, -1, -1), basics.NewVector3(1, 1, 1))
+	transform := basics.NewTransform(2, basics.NewQuaternionFromAngleAndAxis(45, basics.Up()), basics.NewVector3(10, 0, 0))
+
+	transformed := box.Transformed(&transform)
+	diagonal := 2 * basics.Sqrt(2)
+	assert.True(t, transformed.Min.Equals(basics.NewVector3(10-diagonal, -2, -diagonal)), "min %v", transformed.Min)
+	assert.True(t, transformed.Max.Equals(basics.NewVector3(10+diagonal, 2, diagonal)), "max %v", transformed.Max)
+
+	obb := box.OBB(&transform)
+	assert.True(t, obb.Center.Equals(basics.NewVector3(10, 0, 0)))
+	assert.True(t, obb.HalfExtents.Equals(basics.NewVector3(2, 2, 2)))
+	assert.True(t, obb.Axes[1].Equals(basics.Up()))
+
+	sphere := BoundingSphere{Radius: 1}.Transformed(&transform)
+	assert.True(t, sphere.Center.Equals(basics.NewVector3(10, 0, 0)))
+	assert.InDelta(t, 2, float64(sphere.Radius), 1e-9)
+}
+
+func TestBoundingVolumes_TestPlane(t *testing.T) {
+	transform := basics.NewTransform(1, basics.NewQuaternionFromAngleAndAxis(45, basics.Up()), basics.Vector3{})
+	obb := NewAABBFromPoints(basics.NewVector3(-1, -1, -1), basics.NewVector3(1, 1, 1)).OBB(&transform)
+	normal := basics.Right()
+	tests := []struct {
+		x      basics.Scalar
+		box    PlaneSide
+		obb    PlaneSide
+		sphere PlaneSide
+	}{
+		{-2, PlaneSideFront, PlaneSideFront, PlaneSideFront},
+		{-1.2, PlaneSideFront, PlaneSideIntersects, PlaneSideIntersects}, // the rotated box reaches sqrt(2)
+		{0, PlaneSideIntersects, PlaneSideIntersects, PlaneSideIntersects},
+		{1.2, PlaneSideBehind, PlaneSideIntersects, PlaneSideIntersects},
+		{1.5, PlaneSideBehind, PlaneSideBehind, PlaneSideIntersects},
+		{2, PlaneSideBehind, PlaneSideBehind, PlaneSideBehind},
+	}
+	for _, test := range tests {
+		plane := basics.NewPlaneFromPointNormal(&basics.Vector3{X: test.x}, &normal)
+		box := NewAABBFromPoints(basics.NewVector3(-1, -1, -1), basics.NewVector3(1, 1, 1))
+		assert.Equal(t, test.box, box.TestPlane(&plane), "box, plane at %v", test.x)
+		assert.Equal(t, test.obb, obb.TestPlane(&plane), "obb, plane at %v", test.x)
+		assert.Equal(t, test.sphere, BoundingSphere{Radius: basics.Sqrt(3)}.TestPlane(&plane), "sphere, plane at %v", test.x)
+	}
+}
@@ -1,6 +1,7 @@
 package graphics
 
 import (
+	"image"
 	"image/color"
 )
 
@@ -10,23 +11,42 @@ type RGB struct {
 	B uint8
 }
 
+// ImageBuffer The colors of the rendered image. Multisample buffers store samples colors per pixel, Get and Set access
+// the first one and they must be resolved into a buffer with one sample to be displayed or encoded
 type ImageBuffer struct {
 	innerImage []RGB
 	width      int
 	height     int
+	samples    int
 }
 
 func NewImageBuffer(width int, height int) ImageBuffer {
+	return NewMultisampleImageBuffer(width, height, 1)
+}
+
+// NewMultisampleImageBuffer Returns an image buffer with samples colors for every pixel
+func NewMultisampleImageBuffer(width int, height int, samples int) ImageBuffer {
 	return ImageBuffer{
-		make([]RGB, width*height),
+		make([]RGB, width*height*samples),
 		width,
 		height,
+		samples,
 	}
 }
 
 // Get gets the color of the buffer at x, y with 255 alpha. There is no check for out of bounds values for efficiency reasons
 func (iBuf *ImageBuffer) Get(x int, y int) color.RGBA {
-	rgbColor := iBuf.innerImage[iBuf.width*y+x]
+	return iBuf.GetSample(x, y, 0)
+}
+
+// Set sets the color of the buffer at x, y with the value c. There is no check for out of bounds values for efficiency reasons
+func (iBuf *ImageBuffer) Set(x int, y int, c color.RGBA) {
+	iBuf.SetSample(x, y, 0, c)
+}
+
+// GetSample Returns the color of the sample of the pixel at x, y with 255 alpha
+func (iBuf *ImageBuffer) GetSample(x int, y int, sample int) color.RGBA {
+	rgbColor := iBuf.innerImage[(iBuf.width*y+x)*iBuf.samples+sample]
 	return color.RGBA{
 		R: rgbColor.R,
 		G: rgbColor.G,
@@ -35,16 +55,85 @@ func (iBuf *ImageBuffer) Get(x int, y int) color.RGBA {
 	}
 }
 
-// Set sets the color of the buffer at x, y with the value c. There is no check for out of bounds values for efficiency reasons
-func (iBuf *ImageBuffer) Set(x int, y int, c color.RGBA) {
+// SetSample Sets the color of the sample of the pixel at x, y
+func (iBuf *ImageBuffer) SetSample(x int, y int, sample int, c color.RGBA) {
 	//iBuf.innerImage[iBuf.width*y+x] = *(*RGB)(unsafe.Pointer(&c)) // it looks like this is not more efficient
-	iBuf.innerImage[iBuf.width*y+x] = RGB{
+	iBuf.innerImage[(iBuf.width*y+x)*iBuf.samples+sample] = RGB{
 		R: c.R,
 		G: c.G,
 		B: c.B,
 	}
 }
 
+// Blend combines the color c with the color of the buffer at x, y using the blend mode, c.A is the opacity. There is no
+// check for out of bounds values for efficiency reasons
+func (iBuf *ImageBuffer) Blend(x int, y int, c color.RGBA, blendMode uint8) {
+	iBuf.BlendSample(x, y, 0, c, blendMode)
+}
+
+// BlendSample Combines the color c with the sample of the pixel at x, y like Blend
+func (iBuf *ImageBuffer) BlendSample(x int, y int, sample int, c color.RGBA, blendMode uint8) {
+	dst := &iBuf.innerImage[(iBuf.width*y+x)*iBuf.samples+sample]
+	a := uint16(c.A)
+	switch blendMode {
+	case BlendModeAdditive:
+		dst.R = uint8(min(255, uint16(dst.R)+(uint16(c.R)*a+127)/255))
+		dst.G = uint8(min(255, uint16(dst.G)+(uint16(c.G)*a+127)/255))
+		dst.B = uint8(min(255, uint16(dst.B)+(uint16(c.B)*a+127)/255))
+	case BlendModeMultiply:
+		// the pixel is multiplied by the color lerped towards white by the transparency
+		dst.R = uint8((uint32(dst.R)*(255*255-(255-uint32(c.R))*uint32(a)) + 255*255/2) / (255 * 255))
+		dst.G = uint8((uint32(dst.G)*(255*255-(255-uint32(c.G))*uint32(a)) + 255*255/2) / (255 * 255))
+		dst.B = uint8((uint32(dst.B)*(255*255-(255-uint32(c.B))*uint32(a)) + 255*255/2) / (255 * 255))
+	default:
+		dst.R = uint8((uint16(c.R)*a + uint16(dst.R)*(255-a) + 127) / 255)
+		dst.G = uint8((uint16(c.G)*a + uint16(dst.G)*(255-a) + 127) / 255)
+		dst.B = uint8((uint16(c.B)*a + uint16(dst.B)*(255-a) + 127) / 255)
+	}
+}
+
+// Samples Returns the number of colors of every pixel
+func (iBuf *ImageBuffer) Samples() int {
+	return iBuf.samples
+}
+
+// Resolve Sets the pixels of the rectangle from minX, minY (included) to maxX, maxY (excluded) to the average of the
+// samples of the same pixels of multisample, that must have the same size
+func (iBuf *ImageBuffer) Resolve(multisample *ImageBuffer, minX int, minY int, maxX int, maxY int) {
+	samples := uint32(multisample.samples)
+	for y := minY; y < maxY; y++ {
+		for x := minX; x < maxX; x++ {
+			first := (multisample.width*y + x) * multisample.samples
+			var r, g, b uint32
+			for _, c := range multisample.innerImage[first : first+multisample.samples] {
+				r += uint32(c.R)
+				g += uint32(c.G)
+				b += uint32(c.B)
+			}
+			iBuf.innerImage[(iBuf.width*y+x)*iBuf.samples] = RGB{
+				R: uint8((r + samples/2) / samples),
+				G: uint8((g + samples/2) / samples),
+				B: uint8((b + samples/2) / samples),
+			}
+		}
+	}
+}
+
+// CopyToSamples Sets all the samples of the pixels of multisample in the rectangle from minX, minY (included) to maxX,
+// maxY (excluded) to the colors of the same pixels of the buffer, that must have the same size
+func (iBuf *ImageBuffer) CopyToSamples(multisample *ImageBuffer, minX int, minY int, maxX int, maxY int) {
+	for y := minY; y < maxY; y++ {
+		for x := minX; x < maxX; x++ {
+			c := iBuf.innerImage[(iBuf.width*y+x)*iBuf.samples]
+			first := (multisample.width*y + x) * multisample.samples
+			samples := multisample.innerImage[first : first+multisample.samples]
+			for i := range samples {
+				samples[i] = c
+			}
+		}
+	}
+}
+
 func (iBuf *ImageBuffer) Width() int {
 	return iBuf.width
 }
@@ -63,3 +152,19 @@ func (iBuf *ImageBuffer) Clear() {
 func (iBuf *ImageBuffer) GetImage() []RGB {
 	return iBuf.innerImage
 }
+
+// ToRGBA Returns a copy of the buffer, with one sample per pixel, as an image.RGBA with 255 alpha. Row 0 of the buffer is the bottom of the screen, so rows are flipped
+func (iBuf *ImageBuffer) ToRGBA() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, iBuf.width, iBuf.height))
+	for y := 0; y < iBuf.height; y++ {
+		row := iBuf.innerImage[y*iBuf.width : (y+1)*iBuf.width]
+		pix := img.Pix[(iBuf.height-1-y)*img.Stride:]
+		for x, c := range row {
+			pix[x*4] = c.R
+			pix[x*4+1] = c.G
+			pix[x*4+2] = c.B
+			pix[x*4+3] = 255
+		}
+	}
+	return img
+}
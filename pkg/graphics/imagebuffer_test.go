@@ -19,6 +19,46 @@ func TestImageBuffer(t *testing.T) {
 	assert.Equal(t, color.RGBA{A: 255}, img.Get(5, 9), "Clear does not clear the buffer")
 }
 
+func TestImageBuffer_Blend(t *testing.T) {
+	img := NewImageBuffer(1, 1)
+	blend := func(dst color.RGBA, c color.RGBA, blendMode uint8) color.RGBA {
+		img.Set(0, 0, dst)
+		img.Blend(0, 0, c, blendMode)
+		return img.Get(0, 0)
+	}
+	grey := color.RGBA{R: 100, G: 100, B: 100, A: 255}
+	assert.Equal(t, color.RGBA{R: 178, G: 50, B: 50, A: 255}, blend(grey, color.RGBA{R: 255, A: 128}, BlendModeAlpha))
+	assert.Equal(t, color.RGBA{R: 255, A: 255}, blend(grey, color.RGBA{R: 255, A: 255}, BlendModeAlpha), "opaque")
+	assert.Equal(t, grey, blend(grey, color.RGBA{R: 255}, BlendModeAlpha), "fully transparent")
+
+	assert.Equal(t, color.RGBA{R: 200, G: 150, B: 100, A: 255}, blend(grey, color.RGBA{R: 200, G: 100, A: 127}, BlendModeAdditive))
+	assert.Equal(t, color.RGBA{R: 255, G: 255, B: 255, A: 255}, blend(color.RGBA{R: 200, G: 200, B: 200}, color.RGBA{R: 255, G: 255, B: 255, A: 255}, BlendModeAdditive), "saturated")
+
+	assert.Equal(t, color.RGBA{R: 100, G: 50, B: 0, A: 255}, blend(grey, color.RGBA{R: 255, G: 127, A: 255}, BlendModeMultiply))
+	assert.Equal(t, color.RGBA{R: 100, G: 50, B: 50, A: 255}, blend(grey, color.RGBA{R: 255, A: 128}, BlendModeMultiply), "half way to white")
+}
+
+func TestImageBuffer_Multisample(t *testing.T) {
+	img := NewImageBuffer(3, 2)
+	img.Set(1, 1, color.RGBA{R: 100, G: 20, B: 255, A: 255})
+	samples := NewMultisampleImageBuffer(3, 2, 4)
+	assert.Equal(t, 4, samples.Samples())
+
+	img.CopyToSamples(&samples, 0, 0, 3, 2)
+	for s := 0; s < 4; s++ {
+		assert.Equal(t, color.RGBA{R: 100, G: 20, B: 255, A: 255}, samples.GetSample(1, 1, s), "sample %d", s)
+	}
+
+	samples.SetSample(1, 1, 0, color.RGBA{R: 255, A: 255})
+	samples.SetSample(1, 1, 1, color.RGBA{R: 255, A: 255})
+	samples.BlendSample(1, 1, 2, color.RGBA{G: 255, A: 255}, BlendModeAdditive)
+	samples.SetSample(0, 0, 3, color.RGBA{B: 255, A: 255})
+	img.Resolve(&samples, 1, 0, 3, 2)
+	// (255 + 255 + 100 + 100) / 4, (0 + 0 + 255 + 20) / 4, (0 + 0 + 255 + 255) / 4
+	assert.Equal(t, color.RGBA{R: 178, G: 69, B: 128, A: 255}, img.Get(1, 1))
+	assert.Equal(t, color.RGBA{A: 255}, img.Get(0, 0), "pixels outside the region are not resolved")
+}
+
 func BenchmarkImageBuffer_Clear(b *testing.B) {
 	imageBuffer := NewImageBuffer(800, 600)
 	fmt.Println("---------------Benchmark start---------------")
@@ -0,0 +1,35 @@
+package graphics
+
+import (
+	"bufio"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// WritePNG encodes the buffer as a PNG image
+func (iBuf *ImageBuffer) WritePNG(w io.Writer) error {
+	return png.Encode(w, iBuf.ToRGBA())
+}
+
+// WriteJPEG encodes the buffer as a JPEG image, quality goes from 1 to 100
+func (iBuf *ImageBuffer) WriteJPEG(w io.Writer, quality int) error {
+	return jpeg.Encode(w, iBuf.ToRGBA(), &jpeg.Options{Quality: quality})
+}
+
+// WritePPM encodes the buffer as a binary (P6) PPM image, top row first
+func (iBuf *ImageBuffer) WritePPM(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bw, "P6\n%d %d\n255\n", iBuf.width, iBuf.height); err != nil {
+		return err
+	}
+	for y := iBuf.height - 1; y >= 0; y-- {
+		for _, c := range iBuf.innerImage[y*iBuf.width : (y+1)*iBuf.width] {
+			if _, err := bw.Write([]byte{c.R, c.G, c.B}); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
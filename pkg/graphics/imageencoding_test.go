@@ -0,0 +1,29 @@
+package graphics
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestImageBuffer_WritePPM(t *testing.T) {
+	img := NewImageBuffer(1, 2)
+	img.Set(0, 1, color.RGBA{R: 1, G: 2, B: 3, A: 255})
+
+	var buf bytes.Buffer
+	assert.Nil(t, img.WritePPM(&buf))
+	assert.Equal(t, append([]byte("P6\n1 2\n255\n"), 1, 2, 3, 0, 0, 0), buf.Bytes(), "the top row should be written first")
+}
+
+func TestImageBuffer_WritePNG(t *testing.T) {
+	img := NewImageBuffer(3, 2)
+	img.Set(2, 1, color.RGBA{R: 10, G: 20, B: 30, A: 255})
+
+	var buf bytes.Buffer
+	assert.Nil(t, img.WritePNG(&buf))
+	decoded, err := png.Decode(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, color.RGBA{R: 10, G: 20, B: 30, A: 255}, color.RGBAModel.Convert(decoded.At(2, 0)), "rows should be flipped")
+}
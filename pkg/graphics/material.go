@@ -0,0 +1,177 @@
+package graphics
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/tsagae/software3d/pkg/basics"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	BlendModeAlpha    = iota // the color covers the pixel by its opacity
+	BlendModeAdditive        // the color scaled by the opacity is added to the pixel, for glows and fire
+	BlendModeMultiply        // the pixel is multiplied by the color, blended by the opacity, for tinted glass
+)
+
+// Material Surface properties of the faces of a mesh. Colors are in the range 0-65535 and are multiplied per component
+// by the vertex colors, that act as a tint
+type Material struct {
+	Name             string
+	Ambient          basics.Vector3 // Ka
+	Diffuse          basics.Vector3 // Kd
+	Specular         basics.Vector3 // Ks, zero disables the specular highlights
+	SpecularExponent basics.Scalar  // Ns
+	Opacity          basics.Scalar  // d, 1 is fully opaque
+	BlendMode        uint8          // how the color is combined with the pixels behind, used by transparent materials
+	DiffuseMap       string         // map_Kd, path of the diffuse texture
+	DiffuseTexture   *Texture       // multiplied by the diffuse and ambient colors, nil if the material is not textured
+}
+
+// MtlParseError Error returned when a line of a Wavefront material library can't be parsed
+type MtlParseError struct {
+	Line int
+	Err  error
+}
+
+func (e *MtlParseError) Error() string {
+	return fmt.Sprintf("mtl: line %d: %v", e.Line, e.Err)
+}
+
+func (e *MtlParseError) Unwrap() error {
+	return e.Err
+}
+
+/* Constructors */
+
+// NewMaterial Returns an opaque material with the ambient color equal to the diffuse color
+func NewMaterial(name string, diffuse basics.Vector3, specular basics.Vector3, specularExponent basics.Scalar) Material {
+	return Material{
+		Name:             name,
+		Ambient:          diffuse,
+		Diffuse:          diffuse,
+		Specular:         specular,
+		SpecularExponent: specularExponent,
+		Opacity:          1,
+	}
+}
+
+// NewDefaultMaterial Returns an opaque white material without specular highlights
+func NewDefaultMaterial() Material {
+	white := basics.NewVector3(65535, 65535, 65535)
+	return NewMaterial("default", white, basics.Vector3{}, 1)
+}
+
+// IsTransparent Returns true if the faces of the material are blended with the pixels behind them
+func (m *Material) IsTransparent() bool {
+	return m.Opacity < 1 || m.BlendMode != BlendModeAlpha
+}
+
+// HasSpecular Returns true if the material has specular highlights
+func (m *Material) HasSpecular() bool {
+	return !m.Specular.IsZero()
+}
+
+/* Material library reader */
+
+// NewMaterialsFromReader reads a Wavefront material library (mtl). Supported statements are newmtl, Ka, Kd, Ks, Ns, d, Tr
+// and map_Kd, the others are ignored. When Ka is not specified the ambient color is the diffuse color
+func NewMaterialsFromReader(reader io.Reader) ([]Material, error) {
+	materials := make([]Material, 0)
+	var current *Material
+	ambientSet := false
+
+	closeMaterial := func() {
+		if current != nil && !ambientSet {
+			current.Ambient = current.Diffuse
+		}
+	}
+
+	scanner := bufio.NewScanner(reader)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		args := fields[1:]
+		if fields[0] == "newmtl" {
+			if len(args) == 0 {
+				return materials, &MtlParseError{Line: line, Err: fmt.Errorf("material without a name")}
+			}
+			closeMaterial()
+			materials = append(materials, NewMaterial(strings.Join(args, " "), basics.Vector3{}, basics.Vector3{}, 1))
+			current = &materials[len(materials)-1]
+			ambientSet = false
+			continue
+		}
+		if current == nil {
+			switch fields[0] {
+			case "Ka", "Kd", "Ks", "Ns", "d", "Tr", "map_Kd":
+				return materials, &MtlParseError{Line: line, Err: fmt.Errorf("%s before newmtl", fields[0])}
+			}
+			continue
+		}
+
+		var err error
+		switch fields[0] {
+		case "Ka":
+			current.Ambient, err = parseMtlColor(args)
+			ambientSet = true
+		case "Kd":
+			current.Diffuse, err = parseMtlColor(args)
+		case "Ks":
+			current.Specular, err = parseMtlColor(args)
+		case "Ns":
+			current.SpecularExponent, err = parseMtlScalar(args)
+		case "d":
+			current.Opacity, err = parseMtlScalar(args)
+		case "Tr":
+			var transparency basics.Scalar
+			transparency, err = parseMtlScalar(args)
+			current.Opacity = 1 - transparency
+		case "map_Kd":
+			if len(args) == 0 {
+				err = fmt.Errorf("map_Kd without a file name")
+			} else {
+				// options (e.g. -s 1 1 1) are not supported, the file name is the last argument
+				current.DiffuseMap = args[len(args)-1]
+			}
+		}
+		if err != nil {
+			return materials, &MtlParseError{Line: line, Err: err}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return materials, &MtlParseError{Line: line, Err: err}
+	}
+	closeMaterial()
+	return materials, nil
+}
+
+// parseMtlColor parses "r g b" in the range 0-1, a single value is used for all the components
+func parseMtlColor(args []string) (basics.Vector3, error) {
+	if len(args) > 0 && (args[0] == "spectral" || args[0] == "xyz") {
+		return basics.Vector3{}, fmt.Errorf("%s colors are not supported", args[0])
+	}
+	if len(args) == 1 {
+		value, err := parseMtlScalar(args)
+		return basics.NewVector3(value, value, value).Mul(65535), err
+	}
+	color, err := parseScalars(args, 3, 3)
+	return color.Mul(65535), err
+}
+
+func parseMtlScalar(args []string) (basics.Scalar, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("expected 1 value, found %d", len(args))
+	}
+	value, err := strconv.ParseFloat(args[0], 64)
+	return basics.Scalar(value), err
+}
@@ -0,0 +1,132 @@
+package graphics
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testMtl = `
+# two materials
+newmtl red
+Kd 1 0 0
+Ks 0.5 0.5 0.5
+Ns 30
+d 0.5
+
+newmtl textured
+Ka 0.1 0.1 0.1
+Kd 1 1 1
+map_Kd textures/checker.png
+`
+
+func TestNewMaterialsFromReader(t *testing.T) {
+	materials, err := NewMaterialsFromReader(strings.NewReader(testMtl))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(materials))
+
+	red := materials[0]
+	assert.Equal(t, "red", red.Name)
+	assert.True(t, red.Diffuse.Equals(basics.NewVector3(65535, 0, 0)))
+	assert.True(t, red.Ambient.Equals(red.Diffuse), "ambient should default to the diffuse color")
+	assert.True(t, red.Specular.Equals(basics.NewVector3(32767.5, 32767.5, 32767.5)))
+	assert.Equal(t, basics.Scalar(30), red.SpecularExponent)
+	assert.Equal(t, basics.Scalar(0.5), red.Opacity)
+
+	textured := materials[1]
+	assert.True(t, textured.Ambient.Equals(basics.NewVector3(6553.5, 6553.5, 6553.5)))
+	assert.False(t, textured.HasSpecular())
+	assert.Equal(t, basics.Scalar(1), textured.Opacity)
+	assert.Equal(t, "textures/checker.png", textured.DiffuseMap)
+}
+
+func TestNewMaterialsFromReader_Errors(t *testing.T) {
+	_, err := NewMaterialsFromReader(strings.NewReader("newmtl a\nKd 1 0\n"))
+	var parseError *MtlParseError
+	assert.True(t, errors.As(err, &parseError))
+	assert.Equal(t, 2, parseError.Line)
+
+	_, err = NewMaterialsFromReader(strings.NewReader("Kd 1 1 1\n"))
+	assert.True(t, errors.As(err, &parseError))
+	assert.Equal(t, 1, parseError.Line)
+}
+
+func TestNewMeshFromFile_Materials(t *testing.T) {
+	dir := t.TempDir()
+	objText := `
+mtllib materials.mtl
+v 0 0 0
+v 1 0 0
+v 0 1 0
+v 1 1 0
+f 1 2 3
+usemtl red
+f 2 4 3
+usemtl textured
+f 1 2 4
+`
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "mesh.obj"), []byte(objText), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "materials.mtl"), []byte(testMtl), 0o644))
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "textures"), 0o755))
+	writeCheckerPNG(t, filepath.Join(dir, "textures/checker.png"))
+
+	mesh, err := NewMeshFromFile(filepath.Join(dir, "mesh.obj"), NewDefaultMaterial())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(mesh.Materials()))
+	assert.Equal(t, "default", mesh.FaceMaterial(0).Name)
+	assert.Equal(t, "red", mesh.FaceMaterial(1).Name)
+	assert.Equal(t, "textured", mesh.FaceMaterial(2).Name)
+	assert.Equal(t, filepath.Join(dir, "textures/checker.png"), mesh.FaceMaterial(2).DiffuseMap)
+	if assert.NotNil(t, mesh.FaceMaterial(2).DiffuseTexture) {
+		assert.Equal(t, 2, mesh.FaceMaterial(2).DiffuseTexture.Width())
+	}
+	assert.Nil(t, mesh.FaceMaterial(1).DiffuseTexture)
+
+	iterator := mesh.Iterator()
+	names := make([]string, 0)
+	for iterator.HasNext() {
+		iterator.Next()
+		names = append(names, iterator.Material().Name)
+	}
+	assert.Equal(t, []string{"default", "red", "textured"}, names)
+
+	// unknown materials are an error once a library is loaded
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "bad.obj"), []byte("mtllib materials.mtl\nusemtl blue\n"), 0o644))
+	_, err = NewMeshFromFile(filepath.Join(dir, "bad.obj"), NewDefaultMaterial())
+	var parseError *ObjParseError
+	assert.True(t, errors.As(err, &parseError))
+	assert.Equal(t, 2, parseError.Line)
+
+	// texture paths are relative to the library, not to the obj file
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "materials"), 0o755))
+	writeCheckerPNG(t, filepath.Join(dir, "materials/tex.png"))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "materials/sub.mtl"), []byte("newmtl sub\nmap_Kd tex.png\n"), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "sub.obj"), []byte("mtllib materials/sub.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nusemtl sub\nf 1 2 3\n"), 0o644))
+	mesh, err = NewMeshFromFile(filepath.Join(dir, "sub.obj"), NewDefaultMaterial())
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "materials/tex.png"), mesh.FaceMaterial(0).DiffuseMap)
+	assert.NotNil(t, mesh.FaceMaterial(0).DiffuseTexture)
+}
+
+func TestMesh_FaceMaterialDefault(t *testing.T) {
+	mesh := NewMesh([]VertexAttributes{{}, {}, {}}, []TriangleConnectivity{{0, 1, 2}})
+	assert.Equal(t, NewDefaultMaterial(), *mesh.FaceMaterial(0))
+
+	red := NewMaterial("red", basics.NewVector3(65535, 0, 0), basics.Vector3{}, 1)
+	mesh.SetMaterial(red)
+	assert.Equal(t, red, *mesh.FaceMaterial(0))
+}
+
+func TestMaterial_IsTransparent(t *testing.T) {
+	m := NewDefaultMaterial()
+	assert.False(t, m.IsTransparent())
+	m.Opacity = 0.5
+	assert.True(t, m.IsTransparent())
+	m.Opacity = 1
+	m.BlendMode = BlendModeAdditive
+	assert.True(t, m.IsTransparent(), "additive materials are blended even when opaque")
+}
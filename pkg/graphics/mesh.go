@@ -1,12 +1,7 @@
 package graphics
 
 import (
-	"bufio"
 	"github.com/tsagae/software3d/pkg/basics"
-	"io"
-	"regexp"
-	"strconv"
-	"strings"
 )
 
 type MeshIterator struct {
@@ -16,26 +11,176 @@ type MeshIterator struct {
 
 type VertexAttributes struct {
 	position basics.Vector3
-	color    basics.Vector3 //Range 0-65535
+	color    basics.Vector3 //Range 0-65535, tint multiplied by the material colors
 	normal   basics.Vector3
+	uv       basics.Vector3 //Texture coordinates, z is unused
 }
 
 type TriangleConnectivity [3]int
 
+// MeshGroup A named range of consecutive triangles of the mesh (obj "o" and "g" statements)
+type MeshGroup struct {
+	Name          string
+	FirstTriangle int
+	TriangleCount int
+}
+
+// MeshEdge An edge of the mesh between the vertices at V0 and V1, indices in the geometry, shared by the triangles in
+// Faces. Faces[1] is -1 for the edges on the border of the mesh, edges shared by more than two triangles keep the first two
+type MeshEdge struct {
+	V0    int
+	V1    int
+	Faces [2]int
+}
+
+// IsBorder Returns true if the edge belongs to a single triangle
+func (e *MeshEdge) IsBorder() bool {
+	return e.Faces[1] < 0
+}
+
 // The mesh winding order is assumed to be counterclockwise
 type Mesh struct {
-	geometry     []VertexAttributes
-	connectivity []TriangleConnectivity
+	geometry      []VertexAttributes
+	connectivity  []TriangleConnectivity
+	groups        []MeshGroup
+	materials     []Material
+	faceMaterials []int // index in materials for each triangle, nil if all the triangles use the first material
 }
 
+var defaultMaterial = NewDefaultMaterial()
+
 /* Constructors */
 
+// NewVertexAttributes color is in the range 0-65535, the z of uv is unused
+func NewVertexAttributes(position basics.Vector3, color basics.Vector3, normal basics.Vector3, uv basics.Vector3) VertexAttributes {
+	return VertexAttributes{position: position, color: color, normal: normal, uv: uv}
+}
+
 func NewMesh(geometry []VertexAttributes, connectivity []TriangleConnectivity) Mesh {
-	return Mesh{geometry, connectivity} //should copy the slices
+	return Mesh{geometry: geometry, connectivity: connectivity} //should copy the slices
+}
+
+// NewMeshWithMaterials faceMaterials contains the index in materials of the material of each triangle
+func NewMeshWithMaterials(geometry []VertexAttributes, connectivity []TriangleConnectivity, materials []Material, faceMaterials []int) Mesh {
+	return Mesh{geometry: geometry, connectivity: connectivity, materials: materials, faceMaterials: faceMaterials}
 }
 
 func NewEmpyMesh() Mesh {
-	return Mesh{nil, nil}
+	return Mesh{}
+}
+
+// Materials Returns the materials used by the mesh
+func (m *Mesh) Materials() []Material {
+	return m.materials
+}
+
+// FaceMaterial Returns the material of the triangle at index i. Meshes without materials use a white material
+func (m *Mesh) FaceMaterial(i int) *Material {
+	if len(m.materials) == 0 {
+		return &defaultMaterial
+	}
+	if m.faceMaterials == nil {
+		return &m.materials[0]
+	}
+	return &m.materials[m.faceMaterials[i]]
+}
+
+// SetMaterial Replaces all the materials of the mesh with a single material
+func (m *Mesh) SetMaterial(material Material) {
+	m.materials = []Material{material}
+	m.faceMaterials = nil
+}
+
+// Groups Returns the named groups of triangles of the mesh
+func (m *Mesh) Groups() []MeshGroup {
+	return m.groups
+}
+
+// TriangleCount Returns the number of triangles in the mesh
+func (m *Mesh) TriangleCount() int {
+	return len(m.connectivity)
+}
+
+// VertexCount Returns the number of vertices in the geometry of the mesh
+func (m *Mesh) VertexCount() int {
+	return len(m.geometry)
+}
+
+// VertexPosition Returns the position of the vertex at index i of the geometry
+func (m *Mesh) VertexPosition(i int) basics.Vector3 {
+	return m.geometry[i].position
+}
+
+// Face Returns the indices in the geometry of the vertices of the triangle at index i
+func (m *Mesh) Face(i int) TriangleConnectivity {
+	return m.connectivity[i]
+}
+
+// Edges Returns the edges of the triangles, each edge shared by several triangles is returned once. Vertices with the same
+// position are welded, so the edges between faces with different normals or texture coordinates are not repeated.
+// Edges are in the order of the triangles
+func (m *Mesh) Edges() []MeshEdge {
+	// welded[i] is the first vertex of the geometry with the position of the vertex i
+	welded := make([]int, len(m.geometry))
+	firstVertex := make(map[basics.Vector3]int, len(m.geometry))
+	for i := range m.geometry {
+		first, ok := firstVertex[m.geometry[i].position]
+		if !ok {
+			first = i
+			firstVertex[m.geometry[i].position] = i
+		}
+		welded[i] = first
+	}
+
+	edges := make([]MeshEdge, 0, len(m.connectivity)*3/2)
+	lookup := make(map[[2]int]int, len(m.connectivity)*3/2)
+	for face, triangle := range m.connectivity {
+		for j := 0; j < 3; j++ {
+			v0, v1 := welded[triangle[j]], welded[triangle[(j+1)%3]]
+			if v0 == v1 {
+				continue // degenerate triangle
+			}
+			key := [2]int{min(v0, v1), max(v0, v1)}
+			if i, ok := lookup[key]; ok {
+				if edges[i].Faces[1] < 0 {
+					edges[i].Faces[1] = face
+				}
+				continue
+			}
+			lookup[key] = len(edges)
+			edges = append(edges, MeshEdge{V0: v0, V1: v1, Faces: [2]int{face, -1}})
+		}
+	}
+	return edges
+}
+
+// computeSmoothNormals sets the normals of the vertices to the normalized sum of the normals of the faces around them,
+// only for the vertices where keep is false. A nil keep sets all the normals
+func computeSmoothNormals(geometry []VertexAttributes, connectivity []TriangleConnectivity, keep []bool) {
+	computed := func(i int) bool {
+		return keep == nil || !keep[i]
+	}
+	for i := range geometry {
+		if computed(i) {
+			geometry[i].normal = basics.Vector3{}
+		}
+	}
+	for _, c := range connectivity {
+		faceNormal := computeNormalFromVertices(geometry[c[0]].position, geometry[c[1]].position, geometry[c[2]].position)
+		if faceNormal.X.IsNaN() { // degenerate face
+			continue
+		}
+		for _, index := range c {
+			if computed(index) {
+				basics.ThisAdd(&geometry[index].normal, faceNormal)
+			}
+		}
+	}
+	for i := range geometry {
+		if computed(i) && !geometry[i].normal.IsZero() {
+			basics.ThisNormalize(&geometry[i].normal)
+		}
+	}
 }
 
 func (m *Mesh) GetTriangles() []Triangle {
@@ -49,27 +194,37 @@ func (m *Mesh) GetTrianglesWithFaceNormals() []Triangle {
 
 func (m *Mesh) getTrianglesWithNormals() []Triangle {
 	triangles := make([]Triangle, len(m.connectivity))
-	for i, v := range m.connectivity {
-		triangles[i] = NewTriangleWithNormals(
-			[3]basics.Vector3{m.geometry[v[0]].position, m.geometry[v[1]].position, m.geometry[v[2]].position},
-			[3]basics.Vector3{m.geometry[v[0]].color, m.geometry[v[1]].color, m.geometry[v[2]].color},
-			[3]basics.Vector3{m.geometry[v[0]].normal, m.geometry[v[1]].normal, m.geometry[v[2]].normal},
-		)
+	for i := range m.connectivity {
+		triangles[i] = m.triangle(i, false)
 	}
 	return triangles
 }
 
 func (m *Mesh) getTrianglesWithoutNormals() []Triangle {
 	triangles := make([]Triangle, len(m.connectivity))
-	for i, v := range m.connectivity {
-		triangles[i] = NewTriangle(
-			[3]basics.Vector3{m.geometry[v[0]].position, m.geometry[v[1]].position, m.geometry[v[2]].position},
-			[3]basics.Vector3{m.geometry[v[0]].color, m.geometry[v[1]].color, m.geometry[v[2]].color},
-		)
+	for i := range m.connectivity {
+		triangles[i] = m.triangle(i, true)
 	}
 	return triangles
 }
 
+// triangle Returns the triangle at index i, with the normals of the face if faceNormals is true
+func (m *Mesh) triangle(i int, faceNormals bool) Triangle {
+	v := m.connectivity[i]
+	positions := [3]basics.Vector3{m.geometry[v[0]].position, m.geometry[v[1]].position, m.geometry[v[2]].position}
+	colors := [3]basics.Vector3{m.geometry[v[0]].color, m.geometry[v[1]].color, m.geometry[v[2]].color}
+	var t Triangle
+	if faceNormals {
+		t = NewTriangle(positions, colors)
+	} else {
+		t = NewTriangleWithNormals(positions, colors, [3]basics.Vector3{m.geometry[v[0]].normal, m.geometry[v[1]].normal, m.geometry[v[2]].normal})
+	}
+	for j := 0; j < 3; j++ {
+		t[j].UV = m.geometry[v[j]].uv
+	}
+	return t
+}
+
 /* Mesh Iterator */
 
 func (m *Mesh) Iterator() MeshIterator {
@@ -81,184 +236,24 @@ func (m *Mesh) Iterator() MeshIterator {
 
 // Next Returns the next triangle in the geometry. Undefined behavior when called after HasNext has returned false
 func (m *MeshIterator) Next() Triangle {
-	mesh := m.mesh
-	connectivityItem := mesh.connectivity[m.index]
-	tri := NewTriangleWithNormals(
-		[3]basics.Vector3{mesh.geometry[connectivityItem[0]].position, mesh.geometry[connectivityItem[1]].position, mesh.geometry[connectivityItem[2]].position},
-		[3]basics.Vector3{mesh.geometry[connectivityItem[0]].color, mesh.geometry[connectivityItem[1]].color, mesh.geometry[connectivityItem[2]].color},
-		[3]basics.Vector3{mesh.geometry[connectivityItem[0]].normal, mesh.geometry[connectivityItem[1]].normal, mesh.geometry[connectivityItem[2]].normal},
-	)
+	tri := m.mesh.triangle(m.index, false)
 	m.index++
 	return tri
 }
 
 // NextWithFaceNormals Returns the next triangle in the geometry, ignores the mesh normals and uses the normals of the faces. Undefined behavior when called after HasNext has returned false.
 func (m *MeshIterator) NextWithFaceNormals() Triangle {
-	mesh := m.mesh
-	connectivityItem := mesh.connectivity[m.index]
-	tri := NewTriangle(
-		[3]basics.Vector3{mesh.geometry[connectivityItem[0]].position, mesh.geometry[connectivityItem[1]].position, mesh.geometry[connectivityItem[2]].position},
-		[3]basics.Vector3{mesh.geometry[connectivityItem[0]].color, mesh.geometry[connectivityItem[1]].color, mesh.geometry[connectivityItem[2]].color},
-	)
+	tri := m.mesh.triangle(m.index, true)
 	m.index++
 	return tri
 }
 
+// Material Returns the material of the last triangle returned by Next or NextWithFaceNormals
+func (m *MeshIterator) Material() *Material {
+	return m.mesh.FaceMaterial(m.index - 1)
+}
+
 // HasNext Returns true if the iterator can return at least another triangle
 func (m *MeshIterator) HasNext() bool {
 	return m.index < len(m.mesh.connectivity)
 }
-
-/* Mesh reader */
-
-// NewMeshFromReader reads a mesh in obj format
-func NewMeshFromReader(reader io.Reader, color basics.Vector3) (Mesh, error) {
-	/*TODO: should make it more reliable by throwing the appropriate error when scanning incorrect lines
-	for example:
-	#8 vertices, 12 faces
-	v -1.00000000 -1.00000000 -1.00000000
-	vn -0.57735027 -0.57735027 0.57735027
-	should throw some kind of format error on the second line since he should be reading 7 more vertices and not a normal
-	*/
-	var line string
-	var nVertices, nFaces int
-	mesh := NewEmpyMesh()
-
-	scanner := bufio.NewScanner(reader)
-
-	for scanner.Scan() {
-		match, err := regexp.MatchString("\\d.*(vertices).*\\d.*faces", scanner.Text())
-		if err != nil {
-			return mesh, err
-		}
-		if match {
-			break
-		}
-	}
-
-	// Get vertices and faces length
-	line = scanner.Text()
-	splittedLine := strings.Split(line, ",")
-
-	verticesString := splittedLine[0][1:]
-	facesString := splittedLine[1][1:]
-
-	nVertices, err := getNumberOfElements(verticesString)
-	if err != nil {
-		return mesh, err
-	}
-
-	nFaces, err = getNumberOfElements(facesString)
-	if err != nil {
-		return mesh, err
-	}
-
-	mesh.geometry = make([]VertexAttributes, nVertices)
-	mesh.connectivity = make([]TriangleConnectivity, nFaces)
-
-	//fmt.Printf("nVertices: %d nFaces: %d\n", nVertices, nFaces)
-
-	// Get vertices
-	for i := 0; i < nVertices; i++ {
-		if !scanner.Scan() {
-			return mesh, scanner.Err()
-		}
-
-		vertex, err := getVectorFromLine(scanner.Text())
-		if err != nil {
-			return mesh, err
-		}
-		mesh.geometry[i].position = vertex
-		mesh.geometry[i].color = color //hardcoded vertex color
-	}
-
-	// Get normals
-	for i := 0; i < nVertices; i++ {
-		if !scanner.Scan() {
-			return mesh, scanner.Err()
-		}
-
-		vertex, err := getVectorFromLine(scanner.Text())
-		if err != nil {
-			return mesh, err
-		}
-		//vertex.ThisNormalize() // normalization for normals, shouldn't be needed
-		mesh.geometry[i].normal = vertex
-	}
-
-	var currentLine string
-	for scanner.Scan() {
-		currentLine = scanner.Text()
-		match, err := regexp.MatchString("f( (\\d+//\\d+))+", currentLine)
-		if err != nil {
-			return mesh, err
-		}
-		if match {
-			break
-		}
-	}
-
-	connectivity, err := getConnectivityFromLine(currentLine)
-	if err != nil {
-		return mesh, err
-	}
-	mesh.connectivity[0] = connectivity
-	// Get connectivity
-	for i := 1; i < nFaces; i++ {
-		if !scanner.Scan() {
-			return mesh, scanner.Err()
-		}
-		connectivity, err := getConnectivityFromLine(scanner.Text())
-		if err != nil {
-			return mesh, err
-		}
-		mesh.connectivity[i] = connectivity
-	}
-
-	return mesh, nil
-}
-
-func getConnectivityFromLine(line string) (TriangleConnectivity, error) {
-	// f 1//1 5//5 2//2
-	splittedLine := strings.Split(line, " ")[1:]
-	var connectivity TriangleConnectivity
-
-	for i := 0; i < 3; i++ {
-		temp := splittedLine[i]
-		temp = strings.Split(temp, "//")[0]
-		val, err := strconv.Atoi(temp)
-		val--
-		if err != nil {
-			return connectivity, err
-		}
-		connectivity[i] = val
-
-	}
-	return connectivity, nil
-}
-
-func getVectorFromLine(line string) (basics.Vector3, error) {
-	//v -1.00000000 -1.00000000 -1.00000000
-	splittedLine := strings.Split(line, " ")[1:]
-	vector := basics.Vector3{}
-	var coords [3]basics.Scalar
-
-	for i := 0; i < 3; i++ {
-		temp, err := strconv.ParseFloat(splittedLine[i], 64)
-		if err != nil {
-			return vector, err
-		}
-		coords[i] = basics.Scalar(temp)
-	}
-	vector.X = coords[0]
-	vector.Y = coords[1]
-	vector.Z = coords[2]
-	return vector, nil
-}
-
-func getNumberOfElements(line string) (int, error) {
-	//8 vertices
-	//12 faces
-	splittedLine := strings.Split(line, " ")
-	return strconv.Atoi(splittedLine[0])
-}
@@ -3,7 +3,6 @@ package graphics
 import (
 	"github.com/stretchr/testify/assert"
 	"github.com/tsagae/software3d/pkg/basics"
-	"image/color"
 	"strings"
 	"testing"
 )
@@ -11,11 +10,11 @@ import (
 func TestMeshIterator(t *testing.T) {
 	mesh := Mesh{
 		geometry: []VertexAttributes{
-			{basics.NewVector3(-1.0, -1.0, -1.0), basics.NewVector3(0, 0, 0), basics.NewVector3(-0.57735027, -0.57735027, -0.57735027)},
-			{basics.NewVector3(-1.0, -1.0, 1.0), basics.NewVector3(0, 0, 0), basics.NewVector3(-0.57735027, -0.57735027, 0.57735027)},
-			{basics.NewVector3(-1.0, 1.0, -1.0), basics.NewVector3(0, 0, 0), basics.NewVector3(-0.57735027, 0.57735027, -0.57735027)},
-			{basics.NewVector3(-1.0, 1.0, 1.0), basics.NewVector3(0, 0, 0), basics.NewVector3(-0.57735027, 0.57735027, 0.57735027)},
-			{basics.NewVector3(1.0, -1.0, -1.0), basics.NewVector3(0, 0, 0), basics.NewVector3(0.57735027, -0.57735027, -0.57735027)},
+			{basics.NewVector3(-1.0, -1.0, -1.0), basics.NewVector3(0, 0, 0), basics.NewVector3(-0.57735027, -0.57735027, -0.57735027), basics.Vector3{}},
+			{basics.NewVector3(-1.0, -1.0, 1.0), basics.NewVector3(0, 0, 0), basics.NewVector3(-0.57735027, -0.57735027, 0.57735027), basics.Vector3{}},
+			{basics.NewVector3(-1.0, 1.0, -1.0), basics.NewVector3(0, 0, 0), basics.NewVector3(-0.57735027, 0.57735027, -0.57735027), basics.Vector3{}},
+			{basics.NewVector3(-1.0, 1.0, 1.0), basics.NewVector3(0, 0, 0), basics.NewVector3(-0.57735027, 0.57735027, 0.57735027), basics.Vector3{}},
+			{basics.NewVector3(1.0, -1.0, -1.0), basics.NewVector3(0, 0, 0), basics.NewVector3(0.57735027, -0.57735027, -0.57735027), basics.Vector3{}},
 		},
 		connectivity: []TriangleConnectivity{
 			{0, 4, 1},
@@ -37,16 +36,18 @@ func TestMeshIterator(t *testing.T) {
 func TestNewMeshFromReader(t *testing.T) {
 	mesh := Mesh{
 		geometry: []VertexAttributes{
-			{basics.NewVector3(-1.0, -1.0, -1.0), basics.NewVector3(0, 0, 0), basics.NewVector3(-0.57735027, -0.57735027, -0.57735027)},
-			{basics.NewVector3(-1.0, -1.0, 1.0), basics.NewVector3(0, 0, 0), basics.NewVector3(-0.57735027, -0.57735027, 0.57735027)},
-			{basics.NewVector3(-1.0, 1.0, -1.0), basics.NewVector3(0, 0, 0), basics.NewVector3(-0.57735027, 0.57735027, -0.57735027)},
-			{basics.NewVector3(-1.0, 1.0, 1.0), basics.NewVector3(0, 0, 0), basics.NewVector3(-0.57735027, 0.57735027, 0.57735027)},
-			{basics.NewVector3(1.0, -1.0, -1.0), basics.NewVector3(0, 0, 0), basics.NewVector3(0.57735027, -0.57735027, -0.57735027)},
+			{basics.NewVector3(-1.0, -1.0, -1.0), basics.NewVector3(65535, 65535, 65535), basics.NewVector3(-0.57735027, -0.57735027, -0.57735027), basics.Vector3{}},
+			{basics.NewVector3(-1.0, -1.0, 1.0), basics.NewVector3(65535, 65535, 65535), basics.NewVector3(-0.57735027, -0.57735027, 0.57735027), basics.Vector3{}},
+			{basics.NewVector3(-1.0, 1.0, -1.0), basics.NewVector3(65535, 65535, 65535), basics.NewVector3(-0.57735027, 0.57735027, -0.57735027), basics.Vector3{}},
+			{basics.NewVector3(-1.0, 1.0, 1.0), basics.NewVector3(65535, 65535, 65535), basics.NewVector3(0, 0, 0), basics.Vector3{}}, // not used by any face, normals come from the faces
+			{basics.NewVector3(1.0, -1.0, -1.0), basics.NewVector3(65535, 65535, 65535), basics.NewVector3(0.57735027, -0.57735027, -0.57735027), basics.Vector3{}},
 		},
 		connectivity: []TriangleConnectivity{
 			{0, 4, 1},
 			{1, 2, 0},
 		},
+		groups:    []MeshGroup{{Name: "Cube1_default", FirstTriangle: 0, TriangleCount: 2}},
+		materials: []Material{NewDefaultMaterial()},
 	}
 	meshText := `
 # Exported from Wings 3D 2.2.9
@@ -69,14 +70,39 @@ s 1
 f 1//1 5//5 2//2
 f 2//2 3//3 1//1
 `
-	meshFromReader, err := NewMeshFromReader(strings.NewReader(meshText),
-		basics.Vector3FromColor(color.RGBA{
-			R: 0,
-			G: 0,
-			B: 0,
-			A: 0,
-		}))
+	meshFromReader, err := NewMeshFromReader(strings.NewReader(meshText), NewDefaultMaterial())
 
 	assert.Nil(t, err, "Error while reading mesh")
 	assert.Equal(t, mesh, meshFromReader, "Mesh from reader is not corrent")
 }
+
+func TestMesh_Edges(t *testing.T) {
+	// two triangles sharing the diagonal of a quad, the vertex 4 has the same position of the vertex 2 with another normal
+	mesh := NewMesh([]VertexAttributes{
+		{position: basics.NewVector3(0, 0, 0)},
+		{position: basics.NewVector3(1, 0, 0)},
+		{position: basics.NewVector3(1, 1, 0)},
+		{position: basics.NewVector3(0, 1, 0)},
+		{position: basics.NewVector3(1, 1, 0), normal: basics.Forward()},
+	}, []TriangleConnectivity{{0, 1, 2}, {0, 4, 3}})
+	edges := mesh.Edges()
+	assert.Equal(t, []MeshEdge{
+		{V0: 0, V1: 1, Faces: [2]int{0, -1}},
+		{V0: 1, V1: 2, Faces: [2]int{0, -1}},
+		{V0: 2, V1: 0, Faces: [2]int{0, 1}},
+		{V0: 2, V1: 3, Faces: [2]int{1, -1}},
+		{V0: 3, V1: 0, Faces: [2]int{1, -1}},
+	}, edges)
+	assert.True(t, edges[0].IsBorder())
+	assert.False(t, edges[2].IsBorder())
+
+	cube, err := NewMeshFromFile("../../meshes/cube.obj", NewDefaultMaterial())
+	if assert.NoError(t, err) {
+		edges := cube.Edges()
+		// 12 sides and a diagonal on each of the 6 faces, the cube is closed
+		assert.Equal(t, 18, len(edges))
+		for _, e := range edges {
+			assert.False(t, e.IsBorder())
+		}
+	}
+}
@@ -0,0 +1,471 @@
+package graphics
+
+import (
+	"github.com/tsagae/software3d/pkg/basics"
+	"slices"
+)
+
+// The functions in this file modify the mesh they are called on. The slices of the mesh are copied before any change,
+// so copies of the mesh made before the call, like the ones held by other models, are not affected
+
+// NormalsReport Changes made by ComputeSmoothNormals and ComputeFlatNormals
+type NormalsReport struct {
+	UpdatedVertices int // vertices of the triangles whose normal has been set
+	SplitVertices   int // vertices added because the triangles sharing a vertex needed different normals
+}
+
+// WeldReport Changes made by Weld
+type WeldReport struct {
+	MergedVertices int // vertices removed because they matched a previous vertex
+}
+
+// DegenerateReport Changes made by RemoveDegenerateTriangles
+type DegenerateReport struct {
+	RemovedTriangles []int // indices of the removed triangles before the removal
+}
+
+// TopologyReport Problems found by CheckTopology and changes made by FixTopology. Edges are pairs of vertex indices
+// in the geometry, vertices with the same position are considered the same vertex like in Edges
+type TopologyReport struct {
+	NonManifoldEdges  [][2]int // edges shared by more than two triangles or by the two sides of a double sided triangle
+	InconsistentEdges [][2]int // edges shared by two triangles that traverse them in the same direction
+	FlippedTriangles  []int    // triangles reversed by FixTopology, indices after the removal of the duplicates
+	RemovedTriangles  []int    // duplicate triangles removed by FixTopology, indices before the removal
+}
+
+// IsClean Returns true if the report contains no problems
+func (r TopologyReport) IsClean() bool {
+	return len(r.NonManifoldEdges) == 0 && len(r.InconsistentEdges) == 0
+}
+
+// ComputeSmoothNormals Replaces the normals of the mesh with the average of the normals of the faces around each
+// vertex. Faces are averaged only with the neighbours whose normal differs less than creaseAngle degrees, so edges
+// sharper than the crease angle stay sharp and their vertices are split. Vertices with the same position are
+// considered shared even if they are different vertices in the geometry
+func (m *Mesh) ComputeSmoothNormals(creaseAngle basics.Scalar) NormalsReport {
+	faceNormals := m.faceNormals()
+	incident := make(map[basics.Vector3][]int) // triangles around each position
+	for i, triangle := range m.connectivity {
+		for _, index := range triangle {
+			position := m.geometry[index].position
+			if faces := incident[position]; len(faces) == 0 || faces[len(faces)-1] != i {
+				incident[position] = append(faces, i)
+			}
+		}
+	}
+	minCos := basics.Cos(basics.DegToRad(creaseAngle))
+	cornerNormals := make([][3]basics.Vector3, len(m.connectivity))
+	for i, triangle := range m.connectivity {
+		faceNormal := faceNormals[i]
+		degenerate := faceNormal.X.IsNaN()
+		for j, index := range triangle {
+			var normal basics.Vector3
+			for _, face := range incident[m.geometry[index].position] {
+				other := faceNormals[face]
+				if other.X.IsNaN() {
+					continue
+				}
+				// degenerate faces have no normal to compare with and take the average of all their neighbours
+				if degenerate || face == i || faceNormal.Dot(other) >= minCos-1e-9 {
+					basics.ThisAdd(&normal, other)
+				}
+			}
+			if !normal.IsZero() {
+				basics.ThisNormalize(&normal)
+			}
+			cornerNormals[i][j] = normal
+		}
+	}
+	return m.setCornerNormals(cornerNormals)
+}
+
+// ComputeFlatNormals Replaces the normals of the mesh with the normals of the faces, vertices shared by faces with
+// different normals are split. Degenerate faces get a zero normal
+func (m *Mesh) ComputeFlatNormals() NormalsReport {
+	faceNormals := m.faceNormals()
+	cornerNormals := make([][3]basics.Vector3, len(m.connectivity))
+	for i, normal := range faceNormals {
+		if normal.X.IsNaN() {
+			normal = basics.Vector3{}
+		}
+		cornerNormals[i] = [3]basics.Vector3{normal, normal, normal}
+	}
+	return m.setCornerNormals(cornerNormals)
+}
+
+// faceNormals Returns the normal of each triangle, NaN for degenerate triangles
+func (m *Mesh) faceNormals() []basics.Vector3 {
+	normals := make([]basics.Vector3, len(m.connectivity))
+	for i, c := range m.connectivity {
+		normals[i] = computeNormalFromVertices(m.geometry[c[0]].position, m.geometry[c[1]].position, m.geometry[c[2]].position)
+	}
+	return normals
+}
+
+// setCornerNormals sets the normal of each corner of the triangles. A vertex used by corners with different normals
+// is duplicated, corners with equal normals share the same copy
+func (m *Mesh) setCornerNormals(cornerNormals [][3]basics.Vector3) NormalsReport {
+	m.geometry = slices.Clone(m.geometry)
+	m.connectivity = slices.Clone(m.connectivity)
+	var report NormalsReport
+	assigned := make([]bool, len(m.geometry))
+	copies := make(map[int][]int) // vertices added for each original vertex
+	for i := range m.connectivity {
+		for j, index := range m.connectivity[i] {
+			normal := cornerNormals[i][j]
+			if !assigned[index] {
+				assigned[index] = true
+				m.geometry[index].normal = normal
+				report.UpdatedVertices++
+				continue
+			}
+			if m.geometry[index].normal.Equals(normal) {
+				continue
+			}
+			split := -1
+			for _, c := range copies[index] {
+				if m.geometry[c].normal.Equals(normal) {
+					split = c
+					break
+				}
+			}
+			if split < 0 {
+				split = len(m.geometry)
+				vertex := m.geometry[index]
+				vertex.normal = normal
+				m.geometry = append(m.geometry, vertex)
+				copies[index] = append(copies[index], split)
+				report.SplitVertices++
+			}
+			m.connectivity[i][j] = split
+		}
+	}
+	return report
+}
+
+// Weld Merges the vertices whose attributes are all within epsilon of a previous vertex: position, normal, texture
+// coordinates and color (compared in the 0-1 range). The triangles use the first of the merged vertices and the
+// others are removed from the geometry. Triangles that become degenerate are kept, see RemoveDegenerateTriangles
+func (m *Mesh) Weld(epsilon basics.Scalar) WeldReport {
+	cellSize := epsilon
+	if cellSize <= 0 {
+		cellSize = 1e-9
+	}
+	cellOf := func(p basics.Vector3) [3]int64 {
+		return [3]int64{int64(basics.Floor(p.X / cellSize)), int64(basics.Floor(p.Y / cellSize)), int64(basics.Floor(p.Z / cellSize))}
+	}
+
+	// remap[i] is the index of the vertex i in the welded geometry
+	remap := make([]int, len(m.geometry))
+	geometry := make([]VertexAttributes, 0, len(m.geometry))
+	grid := make(map[[3]int64][]int) // indices in the welded geometry of the vertices in each cell
+	for i, vertex := range m.geometry {
+		cell := cellOf(vertex.position)
+		found := -1
+	search:
+		for dx := int64(-1); dx <= 1; dx++ {
+			for dy := int64(-1); dy <= 1; dy++ {
+				for dz := int64(-1); dz <= 1; dz++ {
+					for _, candidate := range grid[[3]int64{cell[0] + dx, cell[1] + dy, cell[2] + dz}] {
+						if verticesWithin(&geometry[candidate], &vertex, epsilon) {
+							found = candidate
+							break search
+						}
+					}
+				}
+			}
+		}
+		if found < 0 {
+			found = len(geometry)
+			geometry = append(geometry, vertex)
+			grid[cell] = append(grid[cell], found)
+		}
+		remap[i] = found
+	}
+
+	report := WeldReport{MergedVertices: len(m.geometry) - len(geometry)}
+	connectivity := make([]TriangleConnectivity, len(m.connectivity))
+	for i, triangle := range m.connectivity {
+		for j, index := range triangle {
+			connectivity[i][j] = remap[index]
+		}
+	}
+	m.geometry = geometry
+	m.connectivity = connectivity
+	return report
+}
+
+// verticesWithin Returns true if all the attributes of a and b differ at most by epsilon
+func verticesWithin(a *VertexAttributes, b *VertexAttributes, epsilon basics.Scalar) bool {
+	within := func(u basics.Vector3, v basics.Vector3, scale basics.Scalar) bool {
+		return basics.Abs(u.X-v.X) <= epsilon*scale && basics.Abs(u.Y-v.Y) <= epsilon*scale && basics.Abs(u.Z-v.Z) <= epsilon*scale
+	}
+	return within(a.position, b.position, 1) && within(a.normal, b.normal, 1) && within(a.uv, b.uv, 1) &&
+		within(a.color, b.color, 65535)
+}
+
+// RemoveDegenerateTriangles Removes the triangles that use the same vertex more than once, or whose vertices have the
+// same position, or whose area is not greater than minArea. Materials and groups are updated, the geometry is unchanged
+func (m *Mesh) RemoveDegenerateTriangles(minArea basics.Scalar) DegenerateReport {
+	remove := make([]bool, len(m.connectivity))
+	for i, c := range m.connectivity {
+		if c[0] == c[1] || c[1] == c[2] || c[0] == c[2] {
+			remove[i] = true
+			continue
+		}
+		p0, p1, p2 := m.geometry[c[0]].position, m.geometry[c[1]].position, m.geometry[c[2]].position
+		area := p1.Sub(p0).Cross(p2.Sub(p0)).Length() / 2
+		remove[i] = area <= minArea || p0 == p1 || p1 == p2 || p0 == p2
+	}
+	return DegenerateReport{RemovedTriangles: m.removeTriangles(remove)}
+}
+
+// removeTriangles removes the triangles marked in remove, keeping the materials and the groups of the others.
+// Returns the indices of the removed triangles
+func (m *Mesh) removeTriangles(remove []bool) []int {
+	var removed []int
+	// kept[i] is the number of triangles kept before the triangle i
+	kept := make([]int, len(m.connectivity)+1)
+	connectivity := make([]TriangleConnectivity, 0, len(m.connectivity))
+	var faceMaterials []int
+	if m.faceMaterials != nil {
+		faceMaterials = make([]int, 0, len(m.faceMaterials))
+	}
+	for i, triangle := range m.connectivity {
+		kept[i+1] = kept[i]
+		if remove[i] {
+			removed = append(removed, i)
+			continue
+		}
+		kept[i+1]++
+		connectivity = append(connectivity, triangle)
+		if m.faceMaterials != nil {
+			faceMaterials = append(faceMaterials, m.faceMaterials[i])
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+
+	var groups []MeshGroup
+	for _, group := range m.groups {
+		first, end := kept[group.FirstTriangle], kept[group.FirstTriangle+group.TriangleCount]
+		if end > first {
+			groups = append(groups, MeshGroup{Name: group.Name, FirstTriangle: first, TriangleCount: end - first})
+		}
+	}
+	m.connectivity = connectivity
+	m.faceMaterials = faceMaterials
+	m.groups = groups
+	return removed
+}
+
+// meshEdgeUse a triangle using an edge, forward is true if the triangle traverses the edge from the smaller vertex
+type meshEdgeUse struct {
+	face    int
+	forward bool
+}
+
+// edgeUses Returns the triangles using each edge, with the vertices welded by position, and the edges in the order
+// of the triangles
+func (m *Mesh) edgeUses() (map[[2]int][]meshEdgeUse, [][2]int) {
+	welded := make([]int, len(m.geometry))
+	firstVertex := make(map[basics.Vector3]int, len(m.geometry))
+	for i := range m.geometry {
+		first, ok := firstVertex[m.geometry[i].position]
+		if !ok {
+			first = i
+			firstVertex[m.geometry[i].position] = i
+		}
+		welded[i] = first
+	}
+	uses := make(map[[2]int][]meshEdgeUse, len(m.connectivity)*3/2)
+	var order [][2]int
+	for face, triangle := range m.connectivity {
+		for j := 0; j < 3; j++ {
+			v0, v1 := welded[triangle[j]], welded[triangle[(j+1)%3]]
+			if v0 == v1 {
+				continue
+			}
+			key := [2]int{min(v0, v1), max(v0, v1)}
+			if _, ok := uses[key]; !ok {
+				order = append(order, key)
+			}
+			uses[key] = append(uses[key], meshEdgeUse{face: face, forward: v0 < v1})
+		}
+	}
+	return uses, order
+}
+
+// triangleKey Returns the positions of the vertices of the triangle starting from the smallest one, so that the same
+// triangle has the same key whatever its first vertex. With reversed the vertices are in the opposite winding
+func (m *Mesh) triangleKey(face int, reversed bool) [3]basics.Vector3 {
+	c := m.connectivity[face]
+	key := [3]basics.Vector3{m.geometry[c[0]].position, m.geometry[c[1]].position, m.geometry[c[2]].position}
+	if reversed {
+		key[1], key[2] = key[2], key[1]
+	}
+	smallest := key
+	for i := 1; i < 3; i++ {
+		rotated := [3]basics.Vector3{key[i], key[(i+1)%3], key[(i+2)%3]}
+		if slices.CompareFunc(rotated[:], smallest[:], compareVector3) < 0 {
+			smallest = rotated
+		}
+	}
+	return smallest
+}
+
+// doubleSided Returns true for the triangles that have a copy with the opposite winding, the two sides of a double
+// sided face
+func (m *Mesh) doubleSided() []bool {
+	keys := make(map[[3]basics.Vector3]bool, len(m.connectivity))
+	for i := range m.connectivity {
+		keys[m.triangleKey(i, false)] = true
+	}
+	result := make([]bool, len(m.connectivity))
+	for i := range m.connectivity {
+		reversed := m.triangleKey(i, true)
+		result[i] = keys[reversed] && reversed != m.triangleKey(i, false)
+	}
+	return result
+}
+
+// CheckTopology Returns the non-manifold edges and the edges where the winding of the two triangles is inconsistent.
+// The edges of double sided triangles are non-manifold, the two sides share all their edges. The mesh is not modified
+func (m *Mesh) CheckTopology() TopologyReport {
+	var report TopologyReport
+	uses, order := m.edgeUses()
+	doubleSided := m.doubleSided()
+	for _, edge := range order {
+		edgeUses := uses[edge]
+		if len(edgeUses) > 2 || (len(edgeUses) == 2 && doubleSided[edgeUses[0].face]) {
+			report.NonManifoldEdges = append(report.NonManifoldEdges, edge)
+		} else if len(edgeUses) == 2 && edgeUses[0].forward == edgeUses[1].forward {
+			report.InconsistentEdges = append(report.InconsistentEdges, edge)
+		}
+	}
+	return report
+}
+
+// FixTopology Removes the duplicate triangles (the same vertex positions with the same winding), the most common cause
+// of non-manifold edges, then reverses triangles so that the winding is consistent across the manifold edges. Double
+// sided triangles, copies with the opposite winding, are kept and their edges are reported as non-manifold. Each
+// connected part is oriented to have a positive volume when it's closed, otherwise to keep the winding of most of its
+// triangles. The report contains the inconsistent edges found before the fix and the non-manifold edges that remain.
+// Normals are not changed, they can be recomputed with ComputeSmoothNormals or ComputeFlatNormals
+func (m *Mesh) FixTopology() TopologyReport {
+	var report TopologyReport
+	report.InconsistentEdges = m.CheckTopology().InconsistentEdges
+
+	remove := make([]bool, len(m.connectivity))
+	seen := make(map[[3]basics.Vector3]bool, len(m.connectivity))
+	for i := range m.connectivity {
+		key := m.triangleKey(i, false)
+		remove[i] = seen[key]
+		seen[key] = true
+	}
+	m.connectivity = slices.Clone(m.connectivity)
+	report.RemovedTriangles = m.removeTriangles(remove)
+
+	uses, order := m.edgeUses()
+	doubleSided := m.doubleSided()
+	// neighbours of each triangle through the manifold edges, sameDirection is true when the winding is inconsistent
+	type neighbour struct {
+		face          int
+		sameDirection bool
+	}
+	neighbours := make([][]neighbour, len(m.connectivity))
+	border := make([]bool, len(m.connectivity))
+	for _, edge := range order {
+		edgeUses := uses[edge]
+		switch {
+		case len(edgeUses) == 1:
+			border[edgeUses[0].face] = true
+		case len(edgeUses) == 2 && !doubleSided[edgeUses[0].face]:
+			a, b := edgeUses[0], edgeUses[1]
+			same := a.forward == b.forward
+			neighbours[a.face] = append(neighbours[a.face], neighbour{b.face, same})
+			neighbours[b.face] = append(neighbours[b.face], neighbour{a.face, same})
+		default:
+			report.NonManifoldEdges = append(report.NonManifoldEdges, edge)
+			for _, use := range edgeUses {
+				border[use.face] = true
+			}
+		}
+	}
+
+	// flip[i] is true if the triangle i must be reversed relative to the first triangle of its part
+	flip := make([]bool, len(m.connectivity))
+	visited := make([]bool, len(m.connectivity))
+	for start := range m.connectivity {
+		if visited[start] {
+			continue
+		}
+		visited[start] = true
+		part := []int{start}
+		closed := true
+		for k := 0; k < len(part); k++ {
+			face := part[k]
+			closed = closed && !border[face]
+			for _, n := range neighbours[face] {
+				if !visited[n.face] {
+					visited[n.face] = true
+					flip[n.face] = flip[face] != n.sameDirection
+					part = append(part, n.face)
+				}
+			}
+		}
+
+		reverse := false
+		if closed {
+			var volume basics.Scalar
+			for _, face := range part {
+				c := m.connectivity[face]
+				p0, p1, p2 := m.geometry[c[0]].position, m.geometry[c[1]].position, m.geometry[c[2]].position
+				signed := p0.Dot(p1.Cross(p2))
+				if flip[face] {
+					signed = -signed
+				}
+				volume += signed
+			}
+			reverse = volume < 0
+		} else {
+			flipped := 0
+			for _, face := range part {
+				if flip[face] {
+					flipped++
+				}
+			}
+			reverse = flipped*2 > len(part)
+		}
+		for _, face := range part {
+			if flip[face] != reverse {
+				m.connectivity[face][1], m.connectivity[face][2] = m.connectivity[face][2], m.connectivity[face][1]
+				report.FlippedTriangles = append(report.FlippedTriangles, face)
+			}
+		}
+	}
+	slices.Sort(report.FlippedTriangles)
+	return report
+}
+
+func compareVector3(a basics.Vector3, b basics.Vector3) int {
+	switch {
+	case a.X != b.X:
+		return compareScalar(a.X, b.X)
+	case a.Y != b.Y:
+		return compareScalar(a.Y, b.Y)
+	default:
+		return compareScalar(a.Z, b.Z)
+	}
+}
+
+func compareScalar(a basics.Scalar, b basics.Scalar) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
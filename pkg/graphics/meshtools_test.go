@@ -0,0 +1,190 @@
+package graphics
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newTestCube Returns a closed unit cube with the vertices shared by the faces and outward facing triangles
+func newTestCube() Mesh {
+	meshText := `
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+v 0 0 1
+v 1 0 1
+v 1 1 1
+v 0 1 1
+f 1 3 2
+f 1 4 3
+f 5 6 7
+f 5 7 8
+f 1 2 6
+f 1 6 5
+f 4 8 7
+f 4 7 3
+f 1 5 8
+f 1 8 4
+f 2 3 7
+f 2 7 6
+`
+	mesh, err := NewMeshFromReader(strings.NewReader(meshText), NewDefaultMaterial())
+	if err != nil {
+		panic(err)
+	}
+	return mesh
+}
+
+func TestMesh_ComputeSmoothNormals(t *testing.T) {
+	cube := newTestCube()
+	assert.True(t, cube.CheckTopology().IsClean())
+
+	smooth := cube
+	report := smooth.ComputeSmoothNormals(30)
+	assert.Equal(t, NormalsReport{UpdatedVertices: 8, SplitVertices: 16}, report, "every corner of the cube has 3 normals")
+	assert.Equal(t, 24, smooth.VertexCount())
+	assert.Equal(t, 8, cube.VertexCount(), "copies of the mesh must not change")
+	for _, triangle := range smooth.GetTriangles() {
+		surface := triangle.GetSurfaceNormal()
+		for _, vertex := range triangle {
+			assert.Truef(t, vertex.Normal.Equals(surface), "normal %v, face %v", vertex.Normal, surface)
+		}
+	}
+
+	smooth = cube
+	report = smooth.ComputeSmoothNormals(100)
+	assert.Equal(t, NormalsReport{UpdatedVertices: 8}, report)
+	normal := smooth.GetTriangles()[0][0].Normal
+	assert.Truef(t, normal.Equals(basics.NewVector3(-1, -1, -1).Normalized()), "corner normal %v", normal)
+}
+
+func TestMesh_ComputeFlatNormals(t *testing.T) {
+	mesh := newTestCube()
+	report := mesh.ComputeFlatNormals()
+	assert.Equal(t, 8, report.UpdatedVertices)
+	// the two triangles of a face share the vertices of the diagonal
+	assert.Equal(t, 24-8, report.SplitVertices)
+	for _, triangle := range mesh.GetTriangles() {
+		for _, vertex := range triangle {
+			assert.True(t, vertex.Normal.Equals(triangle.GetSurfaceNormal()))
+		}
+	}
+}
+
+func TestMesh_Weld(t *testing.T) {
+	mesh, err := NewMeshFromSTLReader(strings.NewReader(stlQuad), NewDefaultMaterial())
+	assert.Nil(t, err)
+	// unweld the quad and move a copy of a vertex slightly
+	geometry := []VertexAttributes{mesh.geometry[0], mesh.geometry[1], mesh.geometry[2], mesh.geometry[0], mesh.geometry[2], mesh.geometry[3]}
+	geometry[4].position.X += 1e-4
+	mesh.geometry = geometry
+	mesh.connectivity = []TriangleConnectivity{{0, 1, 2}, {3, 4, 5}}
+
+	unchanged := mesh
+	assert.Equal(t, WeldReport{MergedVertices: 1}, unchanged.Weld(0))
+	assert.Equal(t, 5, unchanged.VertexCount())
+
+	report := mesh.Weld(1e-3)
+	assert.Equal(t, WeldReport{MergedVertices: 2}, report)
+	assert.Equal(t, 4, mesh.VertexCount())
+	assert.Equal(t, TriangleConnectivity{0, 2, 3}, mesh.Face(1))
+
+	// different texture coordinates keep the vertices apart
+	mesh.geometry[3].uv = basics.NewVector3(1, 1, 0)
+	mesh.geometry = append(mesh.geometry, mesh.geometry[3])
+	mesh.geometry[4].uv = basics.Vector3{}
+	mesh.connectivity = append(mesh.connectivity, TriangleConnectivity{0, 2, 4})
+	assert.Equal(t, WeldReport{}, mesh.Weld(1e-3))
+}
+
+func TestMesh_RemoveDegenerateTriangles(t *testing.T) {
+	meshText := `
+v 0 0 0
+v 1 0 0
+v 0 1 0
+v 2 0 0
+v 0 0 0
+g first
+f 1 2 3
+f 1 2 4
+g second
+f 1 1 3
+f 1 3 5
+f 2 3 1
+usemtl other
+f 1 2 3
+`
+	mesh, err := NewMeshFromReader(strings.NewReader(meshText), NewDefaultMaterial())
+	assert.Nil(t, err)
+	mesh.faceMaterials = []int{0, 0, 0, 0, 0, 1}
+	mesh.materials = append(mesh.materials, NewDefaultMaterial())
+	mesh.materials[1].Name = "other"
+
+	report := mesh.RemoveDegenerateTriangles(0)
+	assert.Equal(t, []int{1, 2, 3}, report.RemovedTriangles)
+	assert.Equal(t, 3, mesh.TriangleCount())
+	assert.Equal(t, []MeshGroup{{Name: "first", FirstTriangle: 0, TriangleCount: 1}, {Name: "second", FirstTriangle: 1, TriangleCount: 2}}, mesh.Groups())
+	assert.Equal(t, "other", mesh.FaceMaterial(2).Name)
+
+	report = mesh.RemoveDegenerateTriangles(1)
+	assert.Equal(t, []int{0, 1, 2}, report.RemovedTriangles, "triangles with area 0.5")
+	assert.Equal(t, 0, mesh.TriangleCount())
+}
+
+func TestMesh_FixTopology(t *testing.T) {
+	mesh := newTestCube()
+	// reverse two triangles and duplicate a third one starting from another vertex
+	mesh.connectivity[0][1], mesh.connectivity[0][2] = mesh.connectivity[0][2], mesh.connectivity[0][1]
+	mesh.connectivity[5][1], mesh.connectivity[5][2] = mesh.connectivity[5][2], mesh.connectivity[5][1]
+	duplicate := mesh.connectivity[7]
+	duplicate[0], duplicate[1], duplicate[2] = duplicate[1], duplicate[2], duplicate[0]
+	mesh.connectivity = append(mesh.connectivity, duplicate)
+
+	check := mesh.CheckTopology()
+	assert.Len(t, check.NonManifoldEdges, 3)
+	assert.NotEmpty(t, check.InconsistentEdges)
+	assert.Empty(t, check.FlippedTriangles)
+
+	report := mesh.FixTopology()
+	assert.Equal(t, []int{12}, report.RemovedTriangles)
+	assert.Equal(t, []int{0, 5}, report.FlippedTriangles)
+	assert.Empty(t, report.NonManifoldEdges)
+	assert.Equal(t, check.InconsistentEdges, report.InconsistentEdges)
+	assert.True(t, mesh.CheckTopology().IsClean())
+	assert.Equal(t, newTestCube().connectivity[0], mesh.Face(0), "the winding is reversed, not rotated")
+
+	// a closed mesh turned inside out is reoriented outwards
+	inverted := newTestCube()
+	for i := range inverted.connectivity {
+		inverted.connectivity[i][1], inverted.connectivity[i][2] = inverted.connectivity[i][2], inverted.connectivity[i][1]
+	}
+	report = inverted.FixTopology()
+	assert.Len(t, report.FlippedTriangles, 12)
+	assert.Equal(t, newTestCube().connectivity, inverted.connectivity)
+}
+
+func TestMesh_FixTopologyDoubleSided(t *testing.T) {
+	// the quad is made of two triangles, each with a copy facing the other way
+	f, err := os.Open("../../meshes/quad.obj")
+	assert.Nil(t, err)
+	mesh, err := NewMeshFromReader(f, NewDefaultMaterial())
+	f.Close()
+	assert.Nil(t, err)
+	faces := slices.Clone(mesh.connectivity)
+
+	check := mesh.CheckTopology()
+	assert.Len(t, check.NonManifoldEdges, 5, "the 4 sides and the diagonal")
+	assert.Empty(t, check.InconsistentEdges)
+
+	report := mesh.FixTopology()
+	assert.Empty(t, report.RemovedTriangles)
+	assert.Empty(t, report.FlippedTriangles)
+	assert.ElementsMatch(t, check.NonManifoldEdges, report.NonManifoldEdges)
+	assert.Equal(t, 4, mesh.TriangleCount(), "both sides are kept")
+	assert.Equal(t, faces, mesh.connectivity)
+}
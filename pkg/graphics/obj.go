@@ -0,0 +1,374 @@
+package graphics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/tsagae/software3d/pkg/basics"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ObjParseError Error returned when a line of a Wavefront obj file can't be parsed
+type ObjParseError struct {
+	Line int
+	Err  error
+}
+
+func (e *ObjParseError) Error() string {
+	return fmt.Sprintf("obj: line %d: %v", e.Line, e.Err)
+}
+
+func (e *ObjParseError) Unwrap() error {
+	return e.Err
+}
+
+const defaultGroupName = "default"
+
+// objVertexKey indices of the position, texture coordinate and normal referenced by a face vertex, -1 when missing
+type objVertexKey struct {
+	position int
+	texCoord int
+	normal   int
+}
+
+type objReader struct {
+	positions []basics.Vector3
+	colors    []basics.Vector3
+	texCoords []basics.Vector3
+	normals   []basics.Vector3
+
+	mesh         Mesh
+	claimed      []bool // claimed[i] is true if mesh.geometry[i] has been used by a face
+	vertexLookup map[objVertexKey]int
+	hasNormal    []bool // hasNormal[i] is true if the normal of mesh.geometry[i] comes from the file
+	group        string
+
+	openFile        func(name string) (io.ReadCloser, error) // opens material libraries, nil if they can't be loaded
+	library         map[string]Material                      // materials declared in the loaded libraries
+	materialLookup  map[string]int                           // index in mesh.materials of the materials in use
+	currentMaterial int
+}
+
+/* Mesh reader */
+
+// NewMeshFromReader reads a mesh in Wavefront obj format. Vertices, texture coordinates and normals can be declared in
+// any order, faces can use the "v", "v/vt", "v//vn" and "v/vt/vn" forms with positive or negative (relative) indices.
+// Faces with more than 3 vertices are triangulated as a fan. When a vertex has no normal in the file a smooth normal is
+// computed from the faces that share it. Material libraries can't be opened from a reader, so all the faces use
+// defaultMaterial, use NewMeshFromFile to load them
+func NewMeshFromReader(reader io.Reader, defaultMaterial Material) (Mesh, error) {
+	return readObj(reader, defaultMaterial, nil)
+}
+
+// NewMeshFromFile reads a mesh in Wavefront obj format like NewMeshFromReader. Material libraries (mtllib) are resolved
+// relative to the directory of the file and texture paths relative to the directory of their library, diffuse textures
+// are loaded and shared by the materials that use the same file. Faces before the first usemtl use defaultMaterial
+func NewMeshFromFile(fileName string, defaultMaterial Material) (Mesh, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return Mesh{}, err
+	}
+	defer f.Close()
+	dir := filepath.Dir(fileName)
+	mesh, err := readObj(f, defaultMaterial, func(name string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(dir, name))
+	})
+	if err != nil {
+		return mesh, fmt.Errorf("%s: %w", fileName, err)
+	}
+	textures := make(map[string]*Texture)
+	for i := range mesh.materials {
+		material := &mesh.materials[i]
+		if material.DiffuseMap == "" || material.DiffuseTexture != nil {
+			continue
+		}
+		if !filepath.IsAbs(material.DiffuseMap) {
+			material.DiffuseMap = filepath.Join(dir, material.DiffuseMap)
+		}
+		texture, ok := textures[material.DiffuseMap]
+		if !ok {
+			if texture, err = NewTextureFromFile(material.DiffuseMap); err != nil {
+				return mesh, fmt.Errorf("%s: material %q: %w", fileName, material.Name, err)
+			}
+			textures[material.DiffuseMap] = texture
+		}
+		material.DiffuseTexture = texture
+	}
+	return mesh, nil
+}
+
+func readObj(reader io.Reader, defaultMaterial Material, openFile func(name string) (io.ReadCloser, error)) (Mesh, error) {
+	r := objReader{
+		vertexLookup:   make(map[objVertexKey]int),
+		group:          defaultGroupName,
+		openFile:       openFile,
+		library:        make(map[string]Material),
+		materialLookup: make(map[string]int),
+	}
+	r.mesh.materials = []Material{defaultMaterial}
+	scanner := bufio.NewScanner(reader)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if err := r.parseLine(scanner.Text()); err != nil {
+			return r.mesh, &ObjParseError{Line: line, Err: err}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return r.mesh, &ObjParseError{Line: line, Err: err}
+	}
+	r.computeMissingNormals()
+	if len(r.mesh.materials) == 1 {
+		r.mesh.faceMaterials = nil
+	}
+	return r.mesh, nil
+}
+
+func (r *objReader) parseLine(line string) error {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	args := fields[1:]
+	switch fields[0] {
+	case "v":
+		return r.parseVertex(args)
+	case "vt":
+		texCoord, err := parseScalars(args, 1, 3)
+		if err != nil {
+			return err
+		}
+		r.texCoords = append(r.texCoords, texCoord)
+	case "vn":
+		normal, err := parseScalars(args, 3, 3)
+		if err != nil {
+			return err
+		}
+		r.normals = append(r.normals, normal)
+	case "f":
+		return r.parseFace(args)
+	case "o", "g":
+		if len(args) == 0 {
+			r.group = defaultGroupName
+		} else {
+			r.group = strings.Join(args, " ")
+		}
+	case "mtllib":
+		return r.loadMaterialLibraries(args)
+	case "usemtl":
+		return r.useMaterial(strings.Join(args, " "))
+	}
+	// other statements (s, l, p, ...) are ignored
+	return nil
+}
+
+func (r *objReader) loadMaterialLibraries(names []string) error {
+	if r.openFile == nil {
+		return nil
+	}
+	for _, name := range names {
+		f, err := r.openFile(name)
+		if err != nil {
+			return err
+		}
+		materials, err := NewMaterialsFromReader(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		// texture paths are relative to the directory of the library
+		for _, material := range materials {
+			if material.DiffuseMap != "" && !filepath.IsAbs(material.DiffuseMap) {
+				material.DiffuseMap = filepath.Join(filepath.Dir(name), material.DiffuseMap)
+			}
+			r.library[material.Name] = material
+		}
+	}
+	return nil
+}
+
+// useMaterial sets the material of the next faces. Unknown materials are an error only if a library has been loaded,
+// otherwise the default material is used
+func (r *objReader) useMaterial(name string) error {
+	if index, ok := r.materialLookup[name]; ok {
+		r.currentMaterial = index
+		return nil
+	}
+	material, ok := r.library[name]
+	if !ok {
+		if len(r.library) != 0 {
+			return fmt.Errorf("material %q not found", name)
+		}
+		r.currentMaterial = 0
+		return nil
+	}
+	r.mesh.materials = append(r.mesh.materials, material)
+	r.currentMaterial = len(r.mesh.materials) - 1
+	r.materialLookup[name] = r.currentMaterial
+	return nil
+}
+
+// parseVertex reads "v x y z [w]" or "v x y z r g b" where the color components are in the range 0-1. Vertices without a color are white
+func (r *objReader) parseVertex(args []string) error {
+	if len(args) != 3 && len(args) != 4 && len(args) != 6 {
+		return fmt.Errorf("vertex with %d components", len(args))
+	}
+	values := make([]basics.Scalar, len(args))
+	for i, arg := range args {
+		value, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return err
+		}
+		values[i] = basics.Scalar(value)
+	}
+	position := basics.NewVector3(values[0], values[1], values[2])
+	vertexColor := basics.NewVector3(65535, 65535, 65535)
+	if len(values) == 6 {
+		vertexColor = basics.NewVector3(values[3], values[4], values[5]).Mul(65535)
+	}
+	r.positions = append(r.positions, position)
+	r.colors = append(r.colors, vertexColor)
+
+	// every position gets a slot in the geometry with the same index, it's split only if faces use it with different attributes
+	r.mesh.geometry = append(r.mesh.geometry, VertexAttributes{position: position, color: vertexColor})
+	r.claimed = append(r.claimed, false)
+	r.hasNormal = append(r.hasNormal, false)
+	return nil
+}
+
+func (r *objReader) parseFace(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("face with %d vertices", len(args))
+	}
+	indices := make([]int, len(args))
+	for i, arg := range args {
+		key, err := r.parseFaceVertex(arg)
+		if err != nil {
+			return err
+		}
+		indices[i] = r.geometryIndex(key)
+	}
+	for i := 1; i < len(indices)-1; i++ {
+		r.addTriangle(TriangleConnectivity{indices[0], indices[i], indices[i+1]})
+	}
+	return nil
+}
+
+// parseFaceVertex parses "v", "v/vt", "v//vn" or "v/vt/vn"
+func (r *objReader) parseFaceVertex(arg string) (objVertexKey, error) {
+	key := objVertexKey{-1, -1, -1}
+	parts := strings.Split(arg, "/")
+	if len(parts) > 3 || parts[0] == "" {
+		return key, fmt.Errorf("invalid face vertex %q", arg)
+	}
+	var err error
+	if key.position, err = resolveIndex(parts[0], len(r.positions)); err != nil {
+		return key, err
+	}
+	if len(parts) > 1 && parts[1] != "" {
+		if key.texCoord, err = resolveIndex(parts[1], len(r.texCoords)); err != nil {
+			return key, err
+		}
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		if key.normal, err = resolveIndex(parts[2], len(r.normals)); err != nil {
+			return key, err
+		}
+	}
+	return key, nil
+}
+
+// geometryIndex Returns the index in the geometry of the vertex with the given attributes, adding it if needed
+func (r *objReader) geometryIndex(key objVertexKey) int {
+	if index, ok := r.vertexLookup[key]; ok {
+		return index
+	}
+	index := key.position
+	if r.claimed[index] {
+		index = len(r.mesh.geometry)
+		r.mesh.geometry = append(r.mesh.geometry, VertexAttributes{position: r.positions[key.position], color: r.colors[key.position]})
+		r.claimed = append(r.claimed, false)
+		r.hasNormal = append(r.hasNormal, false)
+	}
+	r.claimed[index] = true
+	if key.texCoord >= 0 {
+		r.mesh.geometry[index].uv = r.texCoords[key.texCoord]
+	}
+	if key.normal >= 0 {
+		r.mesh.geometry[index].normal = r.normals[key.normal]
+		r.hasNormal[index] = true
+	}
+	r.vertexLookup[key] = index
+	return index
+}
+
+func (r *objReader) addTriangle(connectivity TriangleConnectivity) {
+	groups := r.mesh.groups
+	if len(groups) == 0 || groups[len(groups)-1].Name != r.group {
+		r.mesh.groups = append(groups, MeshGroup{Name: r.group, FirstTriangle: len(r.mesh.connectivity)})
+	}
+	r.mesh.groups[len(r.mesh.groups)-1].TriangleCount++
+	r.mesh.connectivity = append(r.mesh.connectivity, connectivity)
+	r.mesh.faceMaterials = append(r.mesh.faceMaterials, r.currentMaterial)
+}
+
+// computeMissingNormals sets the normals that were not in the file to the normalized sum of the normals of the faces around the vertex
+func (r *objReader) computeMissingNormals() {
+	missing := false
+	for i, claimed := range r.claimed {
+		if claimed && !r.hasNormal[i] {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		return
+	}
+	computeSmoothNormals(r.mesh.geometry, r.mesh.connectivity, r.hasNormal)
+}
+
+// resolveIndex converts a 1 based obj index, or a negative index relative to the end of the list, to a 0 based index
+func resolveIndex(value string, count int) (int, error) {
+	index, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case index > 0:
+		index--
+	case index < 0:
+		index += count
+	default:
+		return 0, errors.New("index 0 is not valid")
+	}
+	if index < 0 || index >= count {
+		return 0, fmt.Errorf("index %s out of range, %d elements declared", value, count)
+	}
+	return index, nil
+}
+
+// parseScalars parses between minCount and maxCount scalars into a vector, missing components are 0
+func parseScalars(args []string, minCount int, maxCount int) (basics.Vector3, error) {
+	var values [3]basics.Scalar
+	if len(args) < minCount || len(args) > maxCount {
+		if minCount == maxCount {
+			return basics.Vector3{}, fmt.Errorf("expected %d values, found %d", minCount, len(args))
+		}
+		return basics.Vector3{}, fmt.Errorf("expected between %d and %d values, found %d", minCount, maxCount, len(args))
+	}
+	for i, arg := range args {
+		value, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return basics.Vector3{}, err
+		}
+		values[i] = basics.Scalar(value)
+	}
+	return basics.NewVector3(values[0], values[1], values[2]), nil
+}
@@ -0,0 +1,122 @@
+package graphics
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNewMeshFromReader_FaceForms(t *testing.T) {
+	meshText := `
+# normals and texture coordinates declared before the vertices
+vn 0 0 1
+vt 0 0
+vt 1 0
+v 0 0 0
+v 1 0 0 # trailing comment
+v 0 1 0
+
+f 1 2 3
+f 1/1 2/2 3/1
+f 1//1 2//1 3//1
+f 1/1/1 2/2/1 3/1/1
+`
+	mesh, err := NewMeshFromReader(strings.NewReader(meshText), NewDefaultMaterial())
+	assert.Nil(t, err)
+	assert.Equal(t, 4, mesh.TriangleCount())
+	triangles := mesh.GetTriangles()
+	for _, triangle := range triangles {
+		assert.True(t, triangle[0].Position.Equals(basics.NewVector3(0, 0, 0)))
+		assert.True(t, triangle[1].Position.Equals(basics.NewVector3(1, 0, 0)))
+		assert.True(t, triangle[2].Position.Equals(basics.NewVector3(0, 1, 0)))
+	}
+	// normals computed from the face must match the one in the file
+	for i := 0; i < 3; i++ {
+		assert.Truef(t, triangles[0][i].Normal.Equals(basics.Forward()), "computed normal %v", triangles[0][i].Normal)
+		assert.True(t, triangles[2][i].Normal.Equals(basics.Forward()))
+	}
+	assert.True(t, triangles[1][1].UV.Equals(basics.NewVector3(1, 0, 0)))
+	assert.True(t, triangles[3][2].UV.Equals(basics.NewVector3(0, 0, 0)))
+}
+
+func TestNewMeshFromReader_NegativeIndicesAndPolygons(t *testing.T) {
+	meshText := `
+o Quad
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+f -4 -3 -2 -1
+g second
+v 0 0 1
+v 1 0 1
+v 1 1 1
+v 0 1 1
+v 0.5 1.5 1
+f -5 -4 -3 -1 -2
+`
+	mesh, err := NewMeshFromReader(strings.NewReader(meshText), NewDefaultMaterial())
+	assert.Nil(t, err)
+	assert.Equal(t, []TriangleConnectivity{{0, 1, 2}, {0, 2, 3}, {4, 5, 6}, {4, 6, 8}, {4, 8, 7}}, mesh.connectivity)
+	assert.Equal(t, []MeshGroup{
+		{Name: "Quad", FirstTriangle: 0, TriangleCount: 2},
+		{Name: "second", FirstTriangle: 2, TriangleCount: 3},
+	}, mesh.Groups())
+}
+
+func TestNewMeshFromReader_SplitsVertices(t *testing.T) {
+	// the same position used with two different normals must produce two vertices
+	meshText := `
+v 0 0 0
+v 1 0 0
+v 0 1 0
+v 0 0 1
+vn 0 0 -1
+vn -1 0 0
+f 1//1 2//1 3//1
+f 1//2 3//2 4//2
+`
+	mesh, err := NewMeshFromReader(strings.NewReader(meshText), NewDefaultMaterial())
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(mesh.geometry))
+	assert.Equal(t, []TriangleConnectivity{{0, 1, 2}, {4, 5, 3}}, mesh.connectivity)
+	assert.True(t, mesh.geometry[0].normal.Equals(basics.Backward()))
+	assert.True(t, mesh.geometry[4].normal.Equals(basics.Left()))
+	assert.True(t, mesh.geometry[4].position.Equals(mesh.geometry[0].position))
+}
+
+func TestNewMeshFromReader_Errors(t *testing.T) {
+	tests := []struct {
+		text string
+		line int
+	}{
+		{"v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 4\n", 4},
+		{"v 0 0 0\nv 1 0 0\n\nf 1 2\n", 4},
+		{"v 0 0\n", 1},
+		{"# comment\nvn 0 a 1\n", 2},
+		{"v 0 0 0\nv 1 0 0\nv 0 1 0\nf 0 1 2\n", 4},
+		{"v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1//1 2//1 3//1\n", 4},
+		{"v 0 0 0\nv 1 0 0\nv 0 1 0\nf -4 -3 -2\n", 4},
+	}
+	for _, test := range tests {
+		_, err := NewMeshFromReader(strings.NewReader(test.text), NewDefaultMaterial())
+		var parseError *ObjParseError
+		if assert.Truef(t, errors.As(err, &parseError), "expected an ObjParseError for %q, got %v", test.text, err) {
+			assert.Equal(t, test.line, parseError.Line, test.text)
+		}
+	}
+}
+
+func TestNewMeshFromReader_BundledMeshes(t *testing.T) {
+	for _, name := range []string{"cube", "sphere", "torus", "lowpolyplane", "quad", "tri"} {
+		f, err := os.Open("../../meshes/" + name + ".obj")
+		assert.Nil(t, err)
+		mesh, err := NewMeshFromReader(f, NewDefaultMaterial())
+		f.Close()
+		assert.Nilf(t, err, "reading %s", name)
+		assert.NotZerof(t, mesh.TriangleCount(), "no triangles in %s", name)
+	}
+}
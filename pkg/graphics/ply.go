@@ -0,0 +1,551 @@
+package graphics
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/tsagae/software3d/pkg/basics"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// PLYParseError Error returned when a line of the header or of the ASCII body of a PLY file can't be parsed
+type PLYParseError struct {
+	Line int
+	Err  error
+}
+
+func (e *PLYParseError) Error() string {
+	return fmt.Sprintf("ply: line %d: %v", e.Line, e.Err)
+}
+
+func (e *PLYParseError) Unwrap() error {
+	return e.Err
+}
+
+type plyFormat int
+
+const (
+	plyASCII plyFormat = iota
+	plyBinaryLittleEndian
+	plyBinaryBigEndian
+)
+
+// plyType scalar type of a property
+type plyType int
+
+const (
+	plyNone plyType = iota // the count type of scalar properties
+	plyInt8
+	plyUint8
+	plyInt16
+	plyUint16
+	plyInt32
+	plyUint32
+	plyFloat32
+	plyFloat64
+)
+
+// plyTypes PLY type names, including the sized aliases
+var plyTypes = map[string]plyType{
+	"char": plyInt8, "int8": plyInt8, "uchar": plyUint8, "uint8": plyUint8,
+	"short": plyInt16, "int16": plyInt16, "ushort": plyUint16, "uint16": plyUint16,
+	"int": plyInt32, "int32": plyInt32, "uint": plyUint32, "uint32": plyUint32,
+	"float": plyFloat32, "float32": plyFloat32, "double": plyFloat64, "float64": plyFloat64,
+}
+
+// size Returns the size in bytes of the type in binary files
+func (t plyType) size() int {
+	switch t {
+	case plyInt8, plyUint8:
+		return 1
+	case plyInt16, plyUint16:
+		return 2
+	case plyInt32, plyUint32, plyFloat32:
+		return 4
+	default:
+		return 8
+	}
+}
+
+// plyProperty a scalar property, or a list when countType is not plyNone
+type plyProperty struct {
+	name      string
+	valueType plyType
+	countType plyType
+}
+
+type plyElement struct {
+	name       string
+	count      int
+	properties []plyProperty
+}
+
+type plyHeader struct {
+	format   plyFormat
+	elements []plyElement
+}
+
+/* Mesh reader */
+
+// NewMeshFromPLYReader reads a mesh in ASCII or binary PLY format. Vertices can have positions (x, y, z), normals
+// (nx, ny, nz), colors (red, green, blue, 8 bit integers or floats between 0 and 1) and texture coordinates (s, t or
+// u, v). Faces are read from the vertex_indices (or vertex_index) list and polygons are triangulated as a fan, other
+// elements and properties are skipped. When the vertices have no normals smooth normals are computed from the faces.
+// All the faces use material
+func NewMeshFromPLYReader(reader io.Reader, material Material) (Mesh, error) {
+	br := bufio.NewReader(reader)
+	header, line, err := readPLYHeader(br)
+	if err != nil {
+		return Mesh{}, err
+	}
+	r := plyReader{header: header, reader: br, line: line}
+	if err := r.readBody(); err != nil {
+		return Mesh{}, err
+	}
+	if !r.hasNormals {
+		computeSmoothNormals(r.geometry, r.connectivity, nil)
+	}
+	mesh := NewMesh(r.geometry, r.connectivity)
+	mesh.SetMaterial(material)
+	return mesh, nil
+}
+
+// NewMeshFromPLYFile reads a mesh in ASCII or binary PLY format like NewMeshFromPLYReader
+func NewMeshFromPLYFile(fileName string, material Material) (Mesh, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return Mesh{}, err
+	}
+	defer f.Close()
+	mesh, err := NewMeshFromPLYReader(f, material)
+	if err != nil {
+		return mesh, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return mesh, nil
+}
+
+// readPLYHeader reads the header up to end_header, returns the number of lines read
+func readPLYHeader(reader *bufio.Reader) (plyHeader, int, error) {
+	var header plyHeader
+	line := 0
+	hasFormat := false
+	for {
+		text, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || text == "") {
+			if err == io.EOF {
+				err = errors.New("missing end_header")
+			}
+			return header, line, &PLYParseError{Line: line + 1, Err: err}
+		}
+		line++
+		fields := strings.Fields(text)
+		if line == 1 {
+			if len(fields) != 1 || fields[0] != "ply" {
+				return header, line, &PLYParseError{Line: line, Err: errors.New("not a PLY file")}
+			}
+			continue
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "comment", "obj_info":
+		case "format":
+			err = header.parseFormat(fields[1:])
+			hasFormat = err == nil
+		case "element":
+			err = header.parseElement(fields[1:])
+		case "property":
+			err = header.parseProperty(fields[1:])
+		case "end_header":
+			if !hasFormat {
+				err = errors.New("missing format")
+			}
+			if err != nil {
+				return header, line, &PLYParseError{Line: line, Err: err}
+			}
+			return header, line, nil
+		default:
+			err = fmt.Errorf("unknown keyword %q", fields[0])
+		}
+		if err != nil {
+			return header, line, &PLYParseError{Line: line, Err: err}
+		}
+	}
+}
+
+func (h *plyHeader) parseFormat(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("expected 2 values, found %d", len(args))
+	}
+	if args[1] != "1.0" {
+		return fmt.Errorf("unsupported version %q", args[1])
+	}
+	switch args[0] {
+	case "ascii":
+		h.format = plyASCII
+	case "binary_little_endian":
+		h.format = plyBinaryLittleEndian
+	case "binary_big_endian":
+		h.format = plyBinaryBigEndian
+	default:
+		return fmt.Errorf("unknown format %q", args[0])
+	}
+	return nil
+}
+
+func (h *plyHeader) parseElement(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("expected 2 values, found %d", len(args))
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil {
+		return err
+	}
+	if count < 0 {
+		return fmt.Errorf("negative count %d", count)
+	}
+	h.elements = append(h.elements, plyElement{name: args[0], count: count})
+	return nil
+}
+
+func (h *plyHeader) parseProperty(args []string) error {
+	if len(h.elements) == 0 {
+		return errors.New("property before the first element")
+	}
+	var property plyProperty
+	var ok bool
+	if len(args) == 4 && args[0] == "list" {
+		if property.countType, ok = plyTypes[args[1]]; !ok {
+			return fmt.Errorf("unknown type %q", args[1])
+		}
+		if property.countType == plyFloat32 || property.countType == plyFloat64 {
+			return fmt.Errorf("list count type %q is not an integer", args[1])
+		}
+		args = args[2:]
+	} else if len(args) != 2 {
+		return fmt.Errorf("expected 2 values, found %d", len(args))
+	}
+	if property.valueType, ok = plyTypes[args[0]]; !ok {
+		return fmt.Errorf("unknown type %q", args[0])
+	}
+	property.name = args[1]
+	element := &h.elements[len(h.elements)-1]
+	element.properties = append(element.properties, property)
+	return nil
+}
+
+type plyReader struct {
+	header plyHeader
+	reader *bufio.Reader
+	line   int      // last line read, only for ASCII files
+	fields []string // values left on the current line of an ASCII file
+
+	geometry     []VertexAttributes
+	connectivity []TriangleConnectivity
+	hasNormals   bool
+}
+
+// readBody reads all the elements in the order of the header, only vertex and face are kept
+func (r *plyReader) readBody() error {
+	for _, element := range r.header.elements {
+		for i := 0; i < element.count; i++ {
+			if err := r.readElement(&element); err != nil {
+				if r.header.format == plyASCII {
+					return &PLYParseError{Line: r.line, Err: err}
+				}
+				return fmt.Errorf("ply: %s %d: %w", element.name, i, err)
+			}
+		}
+	}
+	for _, triangle := range r.connectivity {
+		for _, index := range triangle {
+			if index < 0 || index >= len(r.geometry) {
+				return fmt.Errorf("ply: vertex index %d out of range", index)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *plyReader) readElement(element *plyElement) error {
+	if r.header.format == plyASCII {
+		if err := r.nextLine(); err != nil {
+			return err
+		}
+	}
+	switch element.name {
+	case "vertex":
+		if err := r.readVertex(element); err != nil {
+			return err
+		}
+	case "face":
+		if err := r.readFace(element); err != nil {
+			return err
+		}
+	default:
+		for _, property := range element.properties {
+			if _, err := r.readProperty(property); err != nil {
+				return err
+			}
+		}
+	}
+	if r.header.format == plyASCII && len(r.fields) > 0 {
+		return fmt.Errorf("expected %d properties, found more values", len(element.properties))
+	}
+	return nil
+}
+
+func (r *plyReader) readVertex(element *plyElement) error {
+	vertex := VertexAttributes{color: basics.NewVector3(65535, 65535, 65535)}
+	for _, property := range element.properties {
+		values, err := r.readProperty(property)
+		if err != nil {
+			return err
+		}
+		if property.countType != plyNone {
+			continue
+		}
+		value := values[0]
+		switch property.name {
+		case "x":
+			vertex.position.X = value
+		case "y":
+			vertex.position.Y = value
+		case "z":
+			vertex.position.Z = value
+		case "nx":
+			vertex.normal.X = value
+		case "ny":
+			vertex.normal.Y = value
+		case "nz":
+			vertex.normal.Z = value
+		case "red", "r":
+			vertex.color.X = plyColorComponent(value, property.valueType)
+		case "green", "g":
+			vertex.color.Y = plyColorComponent(value, property.valueType)
+		case "blue", "b":
+			vertex.color.Z = plyColorComponent(value, property.valueType)
+		case "s", "u", "texture_u", "texture_s":
+			vertex.uv.X = value
+		case "t", "v", "texture_v", "texture_t":
+			vertex.uv.Y = value
+		}
+		if property.name == "nx" || property.name == "ny" || property.name == "nz" {
+			r.hasNormals = true
+		}
+	}
+	r.geometry = append(r.geometry, vertex)
+	return nil
+}
+
+// plyColorComponent converts a color component to the range 0-65535, integers use the full range of their type and
+// floats go from 0 to 1
+func plyColorComponent(value basics.Scalar, valueType plyType) basics.Scalar {
+	switch valueType {
+	case plyUint8:
+		return value * 257
+	case plyUint16:
+		return value
+	case plyFloat32, plyFloat64:
+		return basics.Clamp(0, 65535, value*65535)
+	default:
+		return basics.Clamp(0, 65535, value)
+	}
+}
+
+func (r *plyReader) readFace(element *plyElement) error {
+	for _, property := range element.properties {
+		values, err := r.readProperty(property)
+		if err != nil {
+			return err
+		}
+		if property.countType == plyNone || (property.name != "vertex_indices" && property.name != "vertex_index") {
+			continue
+		}
+		if len(values) < 3 {
+			return fmt.Errorf("face with %d vertices", len(values))
+		}
+		for i := 2; i < len(values); i++ {
+			r.connectivity = append(r.connectivity, TriangleConnectivity{int(values[0]), int(values[i-1]), int(values[i])})
+		}
+	}
+	return nil
+}
+
+// readProperty Returns the value of a scalar property or the values of a list
+func (r *plyReader) readProperty(property plyProperty) ([]basics.Scalar, error) {
+	if property.countType == plyNone {
+		value, err := r.readValue(property.valueType)
+		if err != nil {
+			return nil, err
+		}
+		return []basics.Scalar{value}, nil
+	}
+	count, err := r.readValue(property.countType)
+	if err != nil {
+		return nil, err
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("negative list length %v", count)
+	}
+	// the list grows while reading so that a corrupted count fails at the end of the file instead of allocating it
+	values := make([]basics.Scalar, 0, min(int(count), 16))
+	for i := 0; i < int(count); i++ {
+		value, err := r.readValue(property.valueType)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (r *plyReader) readValue(valueType plyType) (basics.Scalar, error) {
+	if r.header.format == plyASCII {
+		if len(r.fields) == 0 {
+			return 0, errors.New("missing values")
+		}
+		field := r.fields[0]
+		r.fields = r.fields[1:]
+		value, err := strconv.ParseFloat(field, 64)
+		return basics.Scalar(value), err
+	}
+
+	var buf [8]byte
+	if _, err := io.ReadFull(r.reader, buf[:valueType.size()]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if r.header.format == plyBinaryBigEndian {
+		order = binary.BigEndian
+	}
+	switch valueType {
+	case plyInt8:
+		return basics.Scalar(int8(buf[0])), nil
+	case plyUint8:
+		return basics.Scalar(buf[0]), nil
+	case plyInt16:
+		return basics.Scalar(int16(order.Uint16(buf[:]))), nil
+	case plyUint16:
+		return basics.Scalar(order.Uint16(buf[:])), nil
+	case plyInt32:
+		return basics.Scalar(int32(order.Uint32(buf[:]))), nil
+	case plyUint32:
+		return basics.Scalar(order.Uint32(buf[:])), nil
+	case plyFloat32:
+		return basics.Scalar(math.Float32frombits(order.Uint32(buf[:]))), nil
+	default:
+		return basics.Scalar(math.Float64frombits(order.Uint64(buf[:]))), nil
+	}
+}
+
+// nextLine reads the next non empty line of an ASCII body
+func (r *plyReader) nextLine() error {
+	for {
+		text, err := r.reader.ReadString('\n')
+		if err != nil && (err != io.EOF || text == "") {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			r.line++
+			return err
+		}
+		r.line++
+		if r.fields = strings.Fields(text); len(r.fields) > 0 {
+			return nil
+		}
+	}
+}
+
+/* Mesh writers */
+
+// plyWriterHeader the properties written by WriteASCIIPLY and WriteBinaryPLY
+const plyWriterHeader = `element vertex %d
+property float x
+property float y
+property float z
+property float nx
+property float ny
+property float nz
+property uchar red
+property uchar green
+property uchar blue
+property float s
+property float t
+element face %d
+property list uchar int vertex_indices
+end_header
+`
+
+// WriteASCIIPLY encodes the mesh in ASCII PLY format with positions, normals, 8 bit colors and texture coordinates
+// of the vertices. Materials are not exported
+func (m *Mesh) WriteASCIIPLY(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bw, "ply\nformat ascii 1.0\ncomment written by software3d\n"+plyWriterHeader, len(m.geometry), len(m.connectivity)); err != nil {
+		return err
+	}
+	for _, vertex := range m.geometry {
+		color := plyColor(vertex.color)
+		_, err := fmt.Fprintf(bw, "%s %s %d %d %d %s %s\n", formatSTLVector(vertex.position), formatSTLVector(vertex.normal),
+			color[0], color[1], color[2],
+			strconv.FormatFloat(float64(vertex.uv.X), 'g', -1, 32), strconv.FormatFloat(float64(vertex.uv.Y), 'g', -1, 32))
+		if err != nil {
+			return err
+		}
+	}
+	for _, triangle := range m.connectivity {
+		if _, err := fmt.Fprintf(bw, "3 %d %d %d\n", triangle[0], triangle[1], triangle[2]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteBinaryPLY encodes the mesh in little endian binary PLY format with the same properties as WriteASCIIPLY
+func (m *Mesh) WriteBinaryPLY(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bw, "ply\nformat binary_little_endian 1.0\ncomment written by software3d\n"+plyWriterHeader, len(m.geometry), len(m.connectivity)); err != nil {
+		return err
+	}
+	var record [35]byte // 8 floats and 3 bytes
+	for _, vertex := range m.geometry {
+		putSTLVector(record[0:], vertex.position)
+		putSTLVector(record[12:], vertex.normal)
+		color := plyColor(vertex.color)
+		copy(record[24:], color[:])
+		binary.LittleEndian.PutUint32(record[27:], math.Float32bits(float32(vertex.uv.X)))
+		binary.LittleEndian.PutUint32(record[31:], math.Float32bits(float32(vertex.uv.Y)))
+		if _, err := bw.Write(record[:]); err != nil {
+			return err
+		}
+	}
+	var face [13]byte
+	face[0] = 3
+	for _, triangle := range m.connectivity {
+		for j, index := range triangle {
+			binary.LittleEndian.PutUint32(face[1+j*4:], uint32(index))
+		}
+		if _, err := bw.Write(face[:]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// plyColor converts a color in the range 0-65535 to 8 bits
+func plyColor(color basics.Vector3) [3]byte {
+	return [3]byte{
+		uint8(basics.Clamp(0, 255, color.X/257+0.5)),
+		uint8(basics.Clamp(0, 255, color.Y/257+0.5)),
+		uint8(basics.Clamp(0, 255, color.Z/257+0.5)),
+	}
+}
@@ -0,0 +1,139 @@
+package graphics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"math"
+	"strings"
+	"testing"
+)
+
+const plyQuad = `ply
+format ascii 1.0
+comment a colored quad
+element vertex 4
+property float x
+property float y
+property float z
+property uchar red
+property uchar green
+property uchar blue
+property uchar alpha
+element face 1
+property list uchar int vertex_indices
+element edge 1
+property int vertex1
+property int vertex2
+end_header
+0 0 0 255 0 0 255
+1 0 0 0 255 0 255
+1 1 0 0 0 255 255
+0 1 0 255 255 255 255
+4 0 1 2 3
+0 2
+`
+
+func TestNewMeshFromPLYReader_ASCII(t *testing.T) {
+	mesh, err := NewMeshFromPLYReader(strings.NewReader(plyQuad), NewDefaultMaterial())
+	assert.Nil(t, err)
+	assert.Equal(t, 4, mesh.VertexCount())
+	assert.Equal(t, 2, mesh.TriangleCount(), "the quad must be triangulated")
+	assert.Equal(t, TriangleConnectivity{0, 2, 3}, mesh.Face(1))
+	triangles := mesh.GetTriangles()
+	assert.True(t, triangles[0][0].Color.Equals(basics.NewVector3(65535, 0, 0)))
+	assert.True(t, triangles[0][1].Color.Equals(basics.NewVector3(0, 65535, 0)))
+	assert.True(t, triangles[1][2].Color.Equals(basics.NewVector3(65535, 65535, 65535)))
+	for _, triangle := range triangles {
+		for _, vertex := range triangle {
+			assert.Truef(t, vertex.Normal.Equals(basics.Forward()), "computed normal %v", vertex.Normal)
+		}
+	}
+}
+
+func TestNewMeshFromPLYReader_BinaryBigEndian(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("ply\nformat binary_big_endian 1.0\nelement vertex 3\nproperty double x\nproperty double y\n" +
+		"property double z\nproperty float nx\nproperty float ny\nproperty float nz\nproperty float red\n" +
+		"property float green\nproperty float blue\nproperty float u\nproperty float v\n" +
+		"element face 1\nproperty uchar flags\nproperty list ushort uint vertex_index\nend_header\n")
+	vertices := [][3]float64{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}}
+	for i, position := range vertices {
+		_ = binary.Write(&buf, binary.BigEndian, position)
+		_ = binary.Write(&buf, binary.BigEndian, []float32{0, 1, 0, 0.5, 0.25, 1, float32(position[0]), float32(i) / 2})
+	}
+	buf.WriteByte(7)
+	_ = binary.Write(&buf, binary.BigEndian, []uint16{3})
+	_ = binary.Write(&buf, binary.BigEndian, []uint32{0, 1, 2})
+
+	mesh, err := NewMeshFromPLYReader(&buf, NewDefaultMaterial())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, mesh.VertexCount())
+	assert.Equal(t, 1, mesh.TriangleCount())
+	triangle := mesh.GetTriangles()[0]
+	assert.True(t, triangle[1].Position.Equals(basics.NewVector3(1, 0, 0)))
+	assert.True(t, triangle[1].Normal.Equals(basics.Up()), "normals in the file must be kept")
+	assert.True(t, triangle[1].Color.Equals(basics.NewVector3(32767.5, 16383.75, 65535)))
+	assert.True(t, triangle[2].UV.Equals(basics.NewVector3(0, 1, 0)))
+	assert.True(t, triangle[1].UV.Equals(basics.NewVector3(1, 0.5, 0)))
+}
+
+func TestMesh_WritePLY(t *testing.T) {
+	original, err := NewMeshFromPLYReader(strings.NewReader(plyQuad), NewDefaultMaterial())
+	assert.Nil(t, err)
+	original.geometry[2].uv = basics.NewVector3(0.5, 0.25, 0)
+
+	writers := map[string]func(mesh *Mesh, buf *bytes.Buffer) error{
+		"ascii":  func(mesh *Mesh, buf *bytes.Buffer) error { return mesh.WriteASCIIPLY(buf) },
+		"binary": func(mesh *Mesh, buf *bytes.Buffer) error { return mesh.WriteBinaryPLY(buf) },
+	}
+	for name, write := range writers {
+		var buf bytes.Buffer
+		assert.Nil(t, write(&original, &buf), name)
+		mesh, err := NewMeshFromPLYReader(&buf, NewDefaultMaterial())
+		if assert.Nil(t, err, name) {
+			assert.Equal(t, original.connectivity, mesh.connectivity, name)
+			assert.Equal(t, original.GetTriangles(), mesh.GetTriangles(), name)
+		}
+	}
+}
+
+func TestNewMeshFromPLYReader_Errors(t *testing.T) {
+	header := "ply\nformat ascii 1.0\nelement vertex 3\nproperty float x\nproperty float y\nproperty float z\n" +
+		"element face 1\nproperty list uchar int vertex_indices\nend_header\n"
+	tests := []struct {
+		name     string
+		meshText string
+		line     int
+	}{
+		{"not ply", "solid a\n", 1},
+		{"unknown format", "ply\nformat text 1.0\nend_header\n", 2},
+		{"missing format", "ply\nelement vertex 0\nend_header\n", 3},
+		{"unknown type", "ply\nformat ascii 1.0\nelement vertex 1\nproperty half x\nend_header\n", 4},
+		{"missing end_header", "ply\nformat ascii 1.0\n", 3},
+		{"bad value", header + "0 0 0\n1 0 0\n0 x 0\n3 0 1 2\n", 12},
+		{"missing values", header + "0 0 0\n1 0\n", 11},
+		{"extra values", header + "0 0 0 0\n", 10},
+		{"short face", header + "0 0 0\n1 0 0\n0 1 0\n2 0 1\n", 13},
+		{"truncated", header + "0 0 0\n1 0 0\n", 12},
+	}
+	for _, test := range tests {
+		_, err := NewMeshFromPLYReader(strings.NewReader(test.meshText), NewDefaultMaterial())
+		var parseError *PLYParseError
+		if assert.Truef(t, errors.As(err, &parseError), "%s: %v", test.name, err) {
+			assert.Equal(t, test.line, parseError.Line, test.name)
+		}
+	}
+
+	_, err := NewMeshFromPLYReader(strings.NewReader(header+"0 0 0\n1 0 0\n0 1 0\n3 0 1 3\n"), NewDefaultMaterial())
+	assert.ErrorContains(t, err, "out of range")
+
+	binaryHeader := strings.Replace(header, "ascii", "binary_little_endian", 1)
+	var buf bytes.Buffer
+	buf.WriteString(binaryHeader)
+	_ = binary.Write(&buf, binary.LittleEndian, []float32{0, 0, 0, 1, 0, 0, math.MaxFloat32})
+	_, err = NewMeshFromPLYReader(&buf, NewDefaultMaterial())
+	assert.ErrorContains(t, err, "vertex 2")
+}
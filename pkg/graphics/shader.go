@@ -0,0 +1,27 @@
+package graphics
+
+import "github.com/tsagae/software3d/pkg/basics"
+
+// Shader The programmable stages of the rendering of a model. Positions, normals and directions are in the view space
+// of the camera, colors are in the range 0-65535
+type Shader interface {
+	// Vertex Runs on the vertices of the triangles clipped to the view volume, before the projection. It can set the
+	// attributes interpolated for the fragments, like a lit color, or move the vertex within the view volume
+	Vertex(vertex *Vertex, context ShaderContext)
+	// Fragment Returns the color of a pixel from the vertex attributes interpolated with perspective correction. When
+	// discard is true the pixel and its depth are left untouched
+	Fragment(fragment *Vertex, context ShaderContext) (color basics.Vector3, discard bool)
+}
+
+// ShaderContext The state of the renderer available to the shaders while drawing a triangle
+type ShaderContext interface {
+	// Material Returns the material of the triangle
+	Material() *Material
+	// Lit Returns the color of a point lit by the lights of the scene with the material of the triangle. tint is
+	// multiplied by the ambient and diffuse colors, viewDirection goes from the camera to the point
+	Lit(position *basics.Vector3, normal *basics.Vector3, tint *basics.Vector3, viewDirection *basics.Vector3) basics.Vector3
+	// ViewDirection Returns the direction from the camera to the point
+	ViewDirection(position *basics.Vector3) basics.Vector3
+	// DepthRange Returns the distances of the near and far clip planes of the camera
+	DepthRange() (basics.Scalar, basics.Scalar)
+}
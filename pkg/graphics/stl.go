@@ -0,0 +1,262 @@
+package graphics
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/tsagae/software3d/pkg/basics"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// STLParseError Error returned when a line of an ASCII STL file can't be parsed
+type STLParseError struct {
+	Line int
+	Err  error
+}
+
+func (e *STLParseError) Error() string {
+	return fmt.Sprintf("stl: line %d: %v", e.Line, e.Err)
+}
+
+func (e *STLParseError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	stlHeaderSize   = 80
+	stlTriangleSize = 50 // normal, 3 vertices and the attribute byte count
+)
+
+// stlWelder builds the geometry of a mesh from triangle soups, vertices with the same position are merged
+type stlWelder struct {
+	geometry     []VertexAttributes
+	connectivity []TriangleConnectivity
+	lookup       map[basics.Vector3]int
+}
+
+func (w *stlWelder) addTriangle(vertices [3]basics.Vector3) {
+	var triangle TriangleConnectivity
+	for i, position := range vertices {
+		index, ok := w.lookup[position]
+		if !ok {
+			index = len(w.geometry)
+			w.lookup[position] = index
+			w.geometry = append(w.geometry, VertexAttributes{position: position, color: basics.NewVector3(65535, 65535, 65535)})
+		}
+		triangle[i] = index
+	}
+	w.connectivity = append(w.connectivity, triangle)
+}
+
+func (w *stlWelder) mesh(material Material) Mesh {
+	computeSmoothNormals(w.geometry, w.connectivity, nil)
+	mesh := NewMesh(w.geometry, w.connectivity)
+	mesh.SetMaterial(material)
+	return mesh
+}
+
+/* Mesh reader */
+
+// NewMeshFromSTLReader reads a mesh in ASCII or binary STL format, the format is detected from the content. STL files
+// are triangle soups: vertices with the same position are welded and smooth normals are computed from the faces, the
+// normals in the file are ignored. All the faces use material
+func NewMeshFromSTLReader(reader io.Reader, material Material) (Mesh, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return Mesh{}, fmt.Errorf("stl: %w", err)
+	}
+	welder := stlWelder{lookup: make(map[basics.Vector3]int)}
+	if isBinarySTL(data) {
+		readBinarySTL(data, &welder)
+	} else if bytes.HasPrefix(bytes.TrimSpace(data), []byte("solid")) {
+		if err := readASCIISTL(data, &welder); err != nil {
+			return Mesh{}, err
+		}
+	} else {
+		return Mesh{}, errors.New("stl: not an ASCII or binary STL file")
+	}
+	return welder.mesh(material), nil
+}
+
+// NewMeshFromSTLFile reads a mesh in ASCII or binary STL format like NewMeshFromSTLReader
+func NewMeshFromSTLFile(fileName string, material Material) (Mesh, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return Mesh{}, err
+	}
+	defer f.Close()
+	mesh, err := NewMeshFromSTLReader(f, material)
+	if err != nil {
+		return mesh, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return mesh, nil
+}
+
+// isBinarySTL Returns true if the size of data matches the triangle count in the binary header. ASCII files can't be
+// recognized from the "solid" keyword alone because many binary exporters start the header with it
+func isBinarySTL(data []byte) bool {
+	if len(data) < stlHeaderSize+4 {
+		return false
+	}
+	count := binary.LittleEndian.Uint32(data[stlHeaderSize:])
+	return uint64(len(data)) == stlHeaderSize+4+uint64(count)*stlTriangleSize
+}
+
+func readBinarySTL(data []byte, welder *stlWelder) {
+	count := int(binary.LittleEndian.Uint32(data[stlHeaderSize:]))
+	data = data[stlHeaderSize+4:]
+	for i := 0; i < count; i++ {
+		record := data[i*stlTriangleSize:]
+		var vertices [3]basics.Vector3
+		for j := range vertices {
+			vertices[j] = readSTLVector(record[12+j*12:])
+		}
+		welder.addTriangle(vertices)
+	}
+}
+
+func readSTLVector(data []byte) basics.Vector3 {
+	return basics.NewVector3(
+		basics.Scalar(math.Float32frombits(binary.LittleEndian.Uint32(data[0:]))),
+		basics.Scalar(math.Float32frombits(binary.LittleEndian.Uint32(data[4:]))),
+		basics.Scalar(math.Float32frombits(binary.LittleEndian.Uint32(data[8:]))),
+	)
+}
+
+// readASCIISTL reads the facets of an ASCII file, every "outer loop" must contain exactly 3 vertices
+func readASCIISTL(data []byte, welder *stlWelder) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	var vertices []basics.Vector3
+	inLoop := false
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var err error
+		switch fields[0] {
+		case "solid", "endsolid", "facet", "endfacet":
+			// the facet normal is recomputed from the vertices
+		case "outer":
+			if inLoop {
+				err = errors.New("nested loop")
+			}
+			inLoop = true
+			vertices = vertices[:0]
+		case "vertex":
+			if !inLoop {
+				err = errors.New("vertex outside of a loop")
+				break
+			}
+			var position basics.Vector3
+			if position, err = parseScalars(fields[1:], 3, 3); err == nil {
+				vertices = append(vertices, position)
+			}
+		case "endloop":
+			if !inLoop {
+				err = errors.New("endloop without a loop")
+			} else if len(vertices) != 3 {
+				err = fmt.Errorf("expected 3 vertices in the loop, found %d", len(vertices))
+			} else {
+				welder.addTriangle([3]basics.Vector3{vertices[0], vertices[1], vertices[2]})
+			}
+			inLoop = false
+		default:
+			err = fmt.Errorf("unknown keyword %q", fields[0])
+		}
+		if err != nil {
+			return &STLParseError{Line: line, Err: err}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return &STLParseError{Line: line, Err: err}
+	}
+	if inLoop {
+		return &STLParseError{Line: line, Err: errors.New("unterminated loop")}
+	}
+	return nil
+}
+
+/* Mesh writers */
+
+// WriteBinarySTL encodes the triangles of the mesh in binary STL format with the normals of the faces. Colors,
+// texture coordinates and materials are not exported
+func (m *Mesh) WriteBinarySTL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var header [stlHeaderSize + 4]byte
+	copy(header[:], "binary STL written by software3d")
+	binary.LittleEndian.PutUint32(header[stlHeaderSize:], uint32(len(m.connectivity)))
+	if _, err := bw.Write(header[:]); err != nil {
+		return err
+	}
+	var record [stlTriangleSize]byte
+	for i := range m.connectivity {
+		normal, vertices := m.stlFacet(i)
+		putSTLVector(record[0:], normal)
+		for j, vertex := range vertices {
+			putSTLVector(record[12+j*12:], vertex)
+		}
+		if _, err := bw.Write(record[:]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteASCIISTL encodes the triangles of the mesh in ASCII STL format as a solid called name, with the normals of the
+// faces. Colors, texture coordinates and materials are not exported
+func (m *Mesh) WriteASCIISTL(w io.Writer, name string) error {
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bw, "solid %s\n", name); err != nil {
+		return err
+	}
+	for i := range m.connectivity {
+		normal, vertices := m.stlFacet(i)
+		if _, err := fmt.Fprintf(bw, "facet normal %s\nouter loop\n", formatSTLVector(normal)); err != nil {
+			return err
+		}
+		for _, vertex := range vertices {
+			if _, err := fmt.Fprintf(bw, "vertex %s\n", formatSTLVector(vertex)); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprint(bw, "endloop\nendfacet\n"); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(bw, "endsolid %s\n", name); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// stlFacet Returns the normal and the vertices of the triangle at index i, degenerate triangles have a zero normal
+func (m *Mesh) stlFacet(i int) (basics.Vector3, [3]basics.Vector3) {
+	c := m.connectivity[i]
+	vertices := [3]basics.Vector3{m.geometry[c[0]].position, m.geometry[c[1]].position, m.geometry[c[2]].position}
+	normal := computeNormalFromVertices(vertices[0], vertices[1], vertices[2])
+	if normal.X.IsNaN() {
+		normal = basics.Vector3{}
+	}
+	return normal, vertices
+}
+
+func putSTLVector(data []byte, v basics.Vector3) {
+	binary.LittleEndian.PutUint32(data[0:], math.Float32bits(float32(v.X)))
+	binary.LittleEndian.PutUint32(data[4:], math.Float32bits(float32(v.Y)))
+	binary.LittleEndian.PutUint32(data[8:], math.Float32bits(float32(v.Z)))
+}
+
+func formatSTLVector(v basics.Vector3) string {
+	return strconv.FormatFloat(float64(v.X), 'g', -1, 32) + " " +
+		strconv.FormatFloat(float64(v.Y), 'g', -1, 32) + " " +
+		strconv.FormatFloat(float64(v.Z), 'g', -1, 32)
+}
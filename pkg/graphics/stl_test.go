@@ -0,0 +1,125 @@
+package graphics
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"strings"
+	"testing"
+)
+
+// stlQuad two triangles sharing an edge, with the vertices of the edge repeated like in every STL file
+const stlQuad = `solid quad
+  facet normal 0 0 1
+    outer loop
+      vertex 0 0 0
+      vertex 1 0 0
+      vertex 1 1 0
+    endloop
+  endfacet
+  facet normal 0 0 1
+    outer loop
+      vertex 0 0 0
+      vertex 1 1 0
+      vertex 0 1 0
+    endloop
+  endfacet
+endsolid quad
+`
+
+func TestNewMeshFromSTLReader_ASCII(t *testing.T) {
+	material := NewMaterial("stl", basics.NewVector3(100, 200, 300), basics.Vector3{}, 1)
+	mesh, err := NewMeshFromSTLReader(strings.NewReader(stlQuad), material)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, mesh.TriangleCount())
+	assert.Equal(t, 4, mesh.VertexCount(), "duplicate vertices must be welded")
+	assert.Equal(t, TriangleConnectivity{0, 2, 3}, mesh.Face(1))
+	assert.Equal(t, "stl", mesh.FaceMaterial(1).Name)
+	for _, triangle := range mesh.GetTriangles() {
+		for _, vertex := range triangle {
+			assert.Truef(t, vertex.Normal.Equals(basics.Forward()), "normal %v", vertex.Normal)
+			assert.True(t, vertex.Color.Equals(basics.NewVector3(65535, 65535, 65535)))
+		}
+	}
+}
+
+func TestNewMeshFromSTLReader_SmoothNormals(t *testing.T) {
+	// two faces of a cube sharing the edge from (1,0,0) to (1,1,0)
+	meshText := `solid corner
+facet normal 0 0 0
+outer loop
+vertex 0 0 0
+vertex 1 1 0
+vertex 1 0 0
+endloop
+endfacet
+facet normal 0 0 0
+outer loop
+vertex 1 0 0
+vertex 1 1 0
+vertex 1 0 1
+endloop
+endfacet
+endsolid corner
+`
+	mesh, err := NewMeshFromSTLReader(strings.NewReader(meshText), NewDefaultMaterial())
+	assert.Nil(t, err)
+	assert.Equal(t, 4, mesh.VertexCount())
+	triangles := mesh.GetTriangles()
+	expected := basics.NewVector3(1, 0, -1).Normalized()
+	assert.Truef(t, triangles[0][1].Normal.Equals(expected), "shared vertex normal %v", triangles[0][1].Normal)
+	assert.True(t, triangles[0][0].Normal.Equals(basics.Backward()))
+	assert.True(t, triangles[1][2].Normal.Equals(basics.Right()))
+}
+
+func TestMesh_WriteBinarySTL(t *testing.T) {
+	original, err := NewMeshFromSTLReader(strings.NewReader(stlQuad), NewDefaultMaterial())
+	assert.Nil(t, err)
+	var buf bytes.Buffer
+	assert.Nil(t, original.WriteBinarySTL(&buf))
+	assert.Equal(t, 84+2*50, buf.Len())
+	assert.True(t, isBinarySTL(buf.Bytes()))
+
+	mesh, err := NewMeshFromSTLReader(&buf, NewDefaultMaterial())
+	assert.Nil(t, err)
+	assert.Equal(t, original.VertexCount(), mesh.VertexCount())
+	assert.Equal(t, original.GetTriangles(), mesh.GetTriangles())
+}
+
+func TestMesh_WriteASCIISTL(t *testing.T) {
+	original, err := NewMeshFromSTLReader(strings.NewReader(stlQuad), NewDefaultMaterial())
+	assert.Nil(t, err)
+	var buf bytes.Buffer
+	assert.Nil(t, original.WriteASCIISTL(&buf, "quad"))
+	assert.True(t, strings.HasPrefix(buf.String(), "solid quad\nfacet normal 0 0 1\nouter loop\nvertex 0 0 0\n"))
+	assert.True(t, strings.HasSuffix(buf.String(), "endloop\nendfacet\nendsolid quad\n"))
+
+	mesh, err := NewMeshFromSTLReader(&buf, NewDefaultMaterial())
+	assert.Nil(t, err)
+	assert.Equal(t, original.GetTriangles(), mesh.GetTriangles())
+}
+
+func TestNewMeshFromSTLReader_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		meshText string
+		line     int
+	}{
+		{"two vertices", "solid a\nfacet normal 0 0 1\nouter loop\nvertex 0 0 0\nvertex 1 0 0\nendloop\n", 6},
+		{"vertex outside loop", "solid a\nvertex 0 0 0\n", 2},
+		{"bad vertex", "solid a\nouter loop\nvertex 0 x 0\n", 3},
+		{"unknown keyword", "solid a\nfacet normal 0 0 1\npolygon\n", 3},
+		{"unterminated", "solid a\nouter loop\nvertex 0 0 0\n", 3},
+	}
+	for _, test := range tests {
+		_, err := NewMeshFromSTLReader(strings.NewReader(test.meshText), NewDefaultMaterial())
+		var parseError *STLParseError
+		if assert.Truef(t, errors.As(err, &parseError), "%s: %v", test.name, err) {
+			assert.Equal(t, test.line, parseError.Line, test.name)
+		}
+	}
+
+	_, err := NewMeshFromSTLReader(bytes.NewReader(make([]byte, 100)), NewDefaultMaterial())
+	assert.NotNil(t, err, "binary file with a wrong size")
+}
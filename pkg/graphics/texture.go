@@ -0,0 +1,121 @@
+package graphics
+
+import (
+	"github.com/tsagae/software3d/pkg/basics"
+	"image"
+	_ "image/jpeg" // register the decoders used by NewTextureFromReader
+	_ "image/png"
+	"io"
+	"os"
+)
+
+const (
+	TextureFilterNearest = iota
+	TextureFilterBilinear
+)
+
+const (
+	TextureWrapRepeat = iota
+	TextureWrapClamp
+)
+
+// Texture An image sampled with texture coordinates in the range 0-1, (0, 0) is the bottom left corner of the image.
+// Texels are stored like vertex colors in the range 0-65535
+type Texture struct {
+	width  int
+	height int
+	texels []basics.Vector3
+	Filter uint8
+	Wrap   uint8
+}
+
+/* Constructors */
+
+// NewTexture texels are stored row by row starting from the top of the image
+func NewTexture(width int, height int, texels []basics.Vector3) *Texture {
+	return &Texture{
+		width:  width,
+		height: height,
+		texels: texels,
+		Filter: TextureFilterBilinear,
+		Wrap:   TextureWrapRepeat,
+	}
+}
+
+func NewTextureFromImage(img image.Image) *Texture {
+	bounds := img.Bounds()
+	texels := make([]basics.Vector3, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			texels = append(texels, basics.Vector3FromColor(img.At(x, y)))
+		}
+	}
+	return NewTexture(bounds.Dx(), bounds.Dy(), texels)
+}
+
+// NewTextureFromReader decodes a PNG or JPEG image
+func NewTextureFromReader(reader io.Reader) (*Texture, error) {
+	img, _, err := image.Decode(reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewTextureFromImage(img), nil
+}
+
+func NewTextureFromFile(fileName string) (*Texture, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewTextureFromReader(f)
+}
+
+func (t *Texture) Width() int {
+	return t.width
+}
+
+func (t *Texture) Height() int {
+	return t.height
+}
+
+// Texel Returns the texel at x, y where y = 0 is the top row. Coordinates outside the texture are wrapped
+func (t *Texture) Texel(x int, y int) basics.Vector3 {
+	return t.texels[t.wrap(y, t.height)*t.width+t.wrap(x, t.width)]
+}
+
+// Sample Returns the color of the texture at the texture coordinates u, v using the filter and wrap mode of the texture
+func (t *Texture) Sample(u basics.Scalar, v basics.Scalar) basics.Vector3 {
+	// v goes up while the rows go down
+	x := u * basics.Scalar(t.width)
+	y := (1 - v) * basics.Scalar(t.height)
+	if t.Filter == TextureFilterNearest {
+		return t.Texel(int(basics.Floor(x)), int(basics.Floor(y)))
+	}
+
+	// texel centers are at half integer coordinates
+	x -= 0.5
+	y -= 0.5
+	x0 := basics.Floor(x)
+	y0 := basics.Floor(y)
+	fx := x - x0
+	fy := y - y0
+	ix := int(x0)
+	iy := int(y0)
+	topLeft, topRight := t.Texel(ix, iy), t.Texel(ix+1, iy)
+	bottomLeft, bottomRight := t.Texel(ix, iy+1), t.Texel(ix+1, iy+1)
+	top := basics.LerpVector3(&topLeft, &topRight, fx)
+	bottom := basics.LerpVector3(&bottomLeft, &bottomRight, fx)
+	return basics.LerpVector3(&top, &bottom, fy)
+}
+
+func (t *Texture) wrap(i int, size int) int {
+	if t.Wrap == TextureWrapClamp {
+		return min(max(i, 0), size-1)
+	}
+	i %= size
+	if i < 0 {
+		i += size
+	}
+	return i
+}
@@ -0,0 +1,85 @@
+package graphics
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"testing"
+)
+
+var (
+	black = basics.Vector3{}
+	white = basics.NewVector3(65535, 65535, 65535)
+)
+
+// newCheckerTexture 2x2 texture with white texels in the top left and bottom right corners
+func newCheckerTexture() *Texture {
+	return NewTexture(2, 2, []basics.Vector3{white, black, black, white})
+}
+
+func writeCheckerPNG(t *testing.T, fileName string) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.White)
+	img.Set(1, 0, color.Black)
+	img.Set(0, 1, color.Black)
+	img.Set(1, 1, color.White)
+	f, err := os.Create(fileName)
+	assert.Nil(t, err)
+	defer f.Close()
+	assert.Nil(t, png.Encode(f, img))
+}
+
+func TestTexture_SampleNearest(t *testing.T) {
+	texture := newCheckerTexture()
+	texture.Filter = TextureFilterNearest
+	assert.True(t, texture.Sample(0.25, 0.75).Equals(white), "top left")
+	assert.True(t, texture.Sample(0.75, 0.75).Equals(black), "top right")
+	assert.True(t, texture.Sample(0.25, 0.25).Equals(black), "bottom left")
+	assert.True(t, texture.Sample(0.75, 0.25).Equals(white), "bottom right")
+}
+
+func TestTexture_SampleBilinear(t *testing.T) {
+	texture := newCheckerTexture()
+	assert.True(t, texture.Sample(0.25, 0.75).Equals(white), "texel centers are not filtered")
+	assert.True(t, texture.Sample(0.5, 0.75).Equals(white.Mul(0.5)))
+	assert.True(t, texture.Sample(0.5, 0.5).Equals(white.Mul(0.5)))
+	quarter := texture.Sample(0.375, 0.75)
+	assert.Truef(t, quarter.Equals(white.Mul(0.75)), "got %v", quarter)
+}
+
+func TestTexture_Wrap(t *testing.T) {
+	texture := newCheckerTexture()
+	texture.Filter = TextureFilterNearest
+	assert.True(t, texture.Sample(1.25, 0.75).Equals(white))
+	assert.True(t, texture.Sample(-0.25, 0.75).Equals(black))
+	assert.True(t, texture.Sample(0.25, -0.75).Equals(black))
+
+	texture.Wrap = TextureWrapClamp
+	assert.True(t, texture.Sample(1.25, 0.75).Equals(black))
+	assert.True(t, texture.Sample(-0.25, 0.75).Equals(white))
+	assert.True(t, texture.Sample(0.25, -0.75).Equals(black))
+
+	// with repeat the texels at the border are filtered with the ones on the other side
+	texture.Filter = TextureFilterBilinear
+	texture.Wrap = TextureWrapRepeat
+	assert.True(t, texture.Sample(0, 0.75).Equals(white.Mul(0.5)))
+	texture.Wrap = TextureWrapClamp
+	assert.True(t, texture.Sample(0, 0.75).Equals(white))
+}
+
+func TestNewTextureFromFile(t *testing.T) {
+	fileName := t.TempDir() + "/checker.png"
+	writeCheckerPNG(t, fileName)
+	texture, err := NewTextureFromFile(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, texture.Width())
+	assert.Equal(t, 2, texture.Height())
+	assert.True(t, texture.Texel(0, 0).Equals(white))
+	assert.True(t, texture.Texel(1, 0).Equals(black))
+
+	_, err = NewTextureFromFile(t.TempDir() + "/missing.png")
+	assert.NotNil(t, err)
+}
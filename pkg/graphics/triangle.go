@@ -12,18 +12,18 @@ type Triangle [3]Vertex
 func NewTriangle(vertices [3]basics.Vector3, colors [3]basics.Vector3) Triangle {
 	normal := computeNormalFromVertices(vertices[0], vertices[1], vertices[2])
 	return [3]Vertex{
-		{vertices[0], colors[0], normal},
-		{vertices[1], colors[1], normal},
-		{vertices[2], colors[2], normal},
+		{Position: vertices[0], Color: colors[0], Normal: normal},
+		{Position: vertices[1], Color: colors[1], Normal: normal},
+		{Position: vertices[2], Color: colors[2], Normal: normal},
 	}
 }
 
 // NewTriangleWithNormals Orientation of vertices is clockwise
 func NewTriangleWithNormals(vertices [3]basics.Vector3, colors [3]basics.Vector3, normals [3]basics.Vector3) Triangle {
 	return [3]Vertex{
-		{vertices[0], colors[0], normals[0]},
-		{vertices[1], colors[1], normals[1]},
-		{vertices[2], colors[2], normals[2]},
+		{Position: vertices[0], Color: colors[0], Normal: normals[0]},
+		{Position: vertices[1], Color: colors[1], Normal: normals[1]},
+		{Position: vertices[2], Color: colors[2], Normal: normals[2]},
 	}
 }
 
@@ -68,9 +68,10 @@ func (t *Triangle) InterpolatePosition(w1, w2, w3 basics.Scalar) basics.Vector3
 
 func (t *Triangle) InterpolateVertexProps(w1, w2, w3 basics.Scalar) Vertex {
 	return Vertex{
-		basics.Interpolate3(&t[0].Position, &t[1].Position, &t[2].Position, w1, w2, w3),
-		basics.Interpolate3(&t[0].Color, &t[1].Color, &t[2].Color, w1, w2, w3),
-		basics.Interpolate3(&t[0].Normal, &t[1].Normal, &t[2].Normal, w1, w2, w3),
+		Position: basics.Interpolate3(&t[0].Position, &t[1].Position, &t[2].Position, w1, w2, w3),
+		Color:    basics.Interpolate3(&t[0].Color, &t[1].Color, &t[2].Color, w1, w2, w3),
+		Normal:   basics.Interpolate3(&t[0].Normal, &t[1].Normal, &t[2].Normal, w1, w2, w3),
+		UV:       basics.Interpolate3(&t[0].UV, &t[1].UV, &t[2].UV, w1, w2, w3),
 	}
 }
 
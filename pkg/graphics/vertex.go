@@ -6,4 +6,5 @@ type Vertex struct {
 	Position basics.Vector3
 	Color    basics.Vector3
 	Normal   basics.Vector3
+	UV       basics.Vector3 // texture coordinates, z is unused
 }
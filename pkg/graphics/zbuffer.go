@@ -5,22 +5,45 @@ import (
 	"math"
 )
 
+// ZBuffer The depth of the closest surface drawn on every pixel. Multisample buffers store samples depth values per
+// pixel, Get and Set access the first one
 type ZBuffer struct {
-	buffer []basics.Scalar
-	width  int
-	height int
+	buffer  []basics.Scalar
+	width   int
+	height  int
+	samples int
 }
 
 func NewZBuffer(width int, height int) ZBuffer {
-	return ZBuffer{make([]basics.Scalar, width*height), width, height}
+	return NewMultisampleZBuffer(width, height, 1)
+}
+
+// NewMultisampleZBuffer Returns a depth buffer with samples depth values for every pixel
+func NewMultisampleZBuffer(width int, height int, samples int) ZBuffer {
+	return ZBuffer{make([]basics.Scalar, width*height*samples), width, height, samples}
 }
 
 func (z *ZBuffer) Set(x int, y int, val basics.Scalar) {
-	z.buffer[y*z.width+x] = val
+	z.buffer[(y*z.width+x)*z.samples] = val
 }
 
 func (z *ZBuffer) Get(x int, y int) basics.Scalar {
-	return z.buffer[y*z.width+x]
+	return z.buffer[(y*z.width+x)*z.samples]
+}
+
+// SetSample Sets the depth of the sample of the pixel at x, y
+func (z *ZBuffer) SetSample(x int, y int, sample int, val basics.Scalar) {
+	z.buffer[(y*z.width+x)*z.samples+sample] = val
+}
+
+// GetSample Returns the depth of the sample of the pixel at x, y
+func (z *ZBuffer) GetSample(x int, y int, sample int) basics.Scalar {
+	return z.buffer[(y*z.width+x)*z.samples+sample]
+}
+
+// Samples Returns the number of depth values of every pixel
+func (z *ZBuffer) Samples() int {
+	return z.samples
 }
 
 func (z *ZBuffer) GetWidth() int {
@@ -39,3 +62,14 @@ func (z *ZBuffer) Clear() {
 		zBuf[i] = inf
 	}
 }
+
+// ClearRegion Clears the rectangle from minX, minY (included) to maxX, maxY (excluded)
+func (z *ZBuffer) ClearRegion(minX int, minY int, maxX int, maxY int) {
+	inf := basics.Scalar(math.Inf(+1))
+	for y := minY; y < maxY; y++ {
+		row := z.buffer[(y*z.width+minX)*z.samples : (y*z.width+maxX)*z.samples]
+		for i := range row {
+			row[i] = inf
+		}
+	}
+}
@@ -22,6 +22,40 @@ func TestZBuffer(t *testing.T) {
 	assert.Equal(t, inf, zBuf.Get(5, 9), "Clear does not clear the buffer")
 }
 
+func TestZBuffer_ClearRegion(t *testing.T) {
+	zBuf := NewZBuffer(10, 10)
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			zBuf.Set(x, y, 1)
+		}
+	}
+	zBuf.ClearRegion(2, 3, 5, 7)
+	inf := basics.Scalar(math.Inf(+1))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			inside := x >= 2 && x < 5 && y >= 3 && y < 7
+			assert.Equalf(t, inside, zBuf.Get(x, y) == inf, "pixel %d, %d", x, y)
+		}
+	}
+}
+
+func TestZBuffer_Multisample(t *testing.T) {
+	zBuf := NewMultisampleZBuffer(4, 4, 4)
+	assert.Equal(t, 4, zBuf.Samples())
+	zBuf.Clear()
+	zBuf.SetSample(1, 2, 3, 5)
+	zBuf.SetSample(2, 2, 0, 7)
+	assert.Equal(t, basics.Scalar(5), zBuf.GetSample(1, 2, 3))
+	assert.Equal(t, basics.Scalar(7), zBuf.Get(2, 2), "Get reads the first sample")
+	inf := basics.Scalar(math.Inf(+1))
+	assert.Equal(t, inf, zBuf.GetSample(1, 2, 2), "the other samples are untouched")
+	assert.Equal(t, inf, zBuf.GetSample(2, 2, 1))
+
+	zBuf.ClearRegion(1, 2, 2, 3)
+	assert.Equal(t, inf, zBuf.GetSample(1, 2, 3), "ClearRegion clears every sample")
+	assert.Equal(t, basics.Scalar(7), zBuf.Get(2, 2))
+}
+
 func BenchmarkZBuffer_Clear(b *testing.B) {
 	zBuf := NewZBuffer(800, 600)
 	fmt.Println("---------------Benchmark start---------------")
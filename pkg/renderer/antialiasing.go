@@ -0,0 +1,74 @@
+package renderer
+
+import (
+	"github.com/tsagae/software3d/pkg/graphics"
+)
+
+const (
+	AntialiasingNone  = iota // One sample per pixel
+	AntialiasingMSAA2        // 2 coverage and depth samples per pixel, shaded once per pixel
+	AntialiasingMSAA4        // 4 samples per pixel
+	AntialiasingMSAA8        // 8 samples per pixel
+	AntialiasingFXAA         // Post-process blurring the edges found in the rendered image
+)
+
+// samplePatterns The positions of the samples of a pixel for each number of samples, in 1/16 of a pixel from the center
+// of the square between the point sampled without multisampling and the next one right and up, so the samples cover
+// the screen from the border. They are the standard patterns of Direct3D, no two samples share a row or a column so
+// edges close to horizontal or vertical get as many coverage levels as samples
+var samplePatterns = map[int][][2]int64{
+	2: {{4, 4}, {-4, -4}},
+	4: {{-2, -6}, {6, -2}, {-6, 2}, {2, 6}},
+	8: {{1, -3}, {-1, 3}, {5, 1}, {-3, -5}, {-5, 5}, {-7, -1}, {3, 7}, {7, -7}},
+}
+
+// sampleMargin Returns how many pixels the samples of a pixel reach outside of the point sampled without multisampling,
+// the bounding boxes of the triangles are grown by this amount
+func sampleMargin(samples int) int {
+	if samples > 1 {
+		return 1
+	}
+	return 0
+}
+
+// SetAntialiasing Sets how the edges are smoothed, one of the Antialiasing constants. MSAA keeps a color and a depth
+// for every sample and averages them in the image buffer at the end of every viewport, FXAA filters the image buffer
+// after drawing a viewport. Panics if the mode is not valid
+func (r *RasterRenderer) SetAntialiasing(antialiasing uint8) {
+	samples := 1
+	switch antialiasing {
+	case AntialiasingNone, AntialiasingFXAA:
+	case AntialiasingMSAA2:
+		samples = 2
+	case AntialiasingMSAA4:
+		samples = 4
+	case AntialiasingMSAA8:
+		samples = 8
+	default:
+		panic("invalid antialiasing mode")
+	}
+	r.parameters.antialiasing = antialiasing
+	if samples == r.zBuffer.Samples() {
+		return
+	}
+	r.zBuffer = graphics.NewMultisampleZBuffer(r.parameters.winWidth, r.parameters.winHeight, samples)
+	r.zBuffer.Clear()
+	if samples > 1 {
+		r.sampleBuffer = graphics.NewMultisampleImageBuffer(r.parameters.winWidth, r.parameters.winHeight, samples)
+	} else {
+		r.sampleBuffer = graphics.ImageBuffer{}
+	}
+}
+
+// Antialiasing Returns the antialiasing mode of the renderer
+func (r *RasterRenderer) Antialiasing() uint8 {
+	return r.parameters.antialiasing
+}
+
+// colorTarget Returns the buffer the triangles are drawn into, the multisample buffer when MSAA is enabled
+func (r *RasterRenderer) colorTarget() *graphics.ImageBuffer {
+	if r.zBuffer.Samples() > 1 {
+		return &r.sampleBuffer
+	}
+	return &r.imageBuffer
+}
@@ -0,0 +1,160 @@
+package renderer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/entities"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// antialiasingTestScene An unlit white quad on a black background, rotated so that its edges are slanted
+func antialiasingTestScene() *entities.SceneGraph {
+	sceneGraph := entities.NewSceneGraph()
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewCameraObject("camera"), "camera"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, -20)))
+	white, err := graphics.NewMeshFromReader(strings.NewReader(goldenTexturedQuad), graphics.NewMaterial("white", basics.NewVector3(65535, 65535, 65535), basics.Vector3{}, 1))
+	if err != nil {
+		panic(err)
+	}
+	quad := entities.NewModelObject("quad", white, false)
+	quad.SetShader(&UnlitShader{})
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(quad, "quad"), basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(0, -90, 20), basics.Vector3{}))
+	return sceneGraph
+}
+
+// greyLevels Returns the grey levels of the image, failing if a pixel is not grey
+func greyLevels(t *testing.T, imageBuffer *graphics.ImageBuffer) map[uint8]int {
+	levels := make(map[uint8]int)
+	for y := 0; y < imageBuffer.Height(); y++ {
+		for x := 0; x < imageBuffer.Width(); x++ {
+			c := imageBuffer.Get(x, y)
+			if c.R != c.G || c.G != c.B {
+				t.Fatalf("pixel %d, %d is not grey: %v", x, y, c)
+			}
+			levels[c.R]++
+		}
+	}
+	return levels
+}
+
+// coverageLevels Returns how many of the samples of the pixels are covered by the white quad, failing if the grey of a
+// pixel is not a fraction of white with the number of samples as denominator
+func coverageLevels(t *testing.T, imageBuffer *graphics.ImageBuffer, samples int) map[int]bool {
+	coverages := make(map[int]bool)
+	for grey := range greyLevels(t, imageBuffer) {
+		covered := int(basics.Round(basics.Scalar(grey) * basics.Scalar(samples) / 255))
+		// the interpolated white can be 254
+		assert.InDeltaf(t, float64(covered)*255/float64(samples), float64(grey), 1.5, "grey %d with %d samples", grey, samples)
+		coverages[covered] = true
+	}
+	return coverages
+}
+
+func TestRasterRenderer_MSAA(t *testing.T) {
+	sceneGraph := antialiasingTestScene()
+	r := NewRasterRenderer(sceneGraph.GetNode("camera"), 40, 30)
+	aliased := renderRGBA(t, r, sceneGraph).Pix
+	assert.Equal(t, map[int]bool{0: true, 1: true}, coverageLevels(t, &r.imageBuffer, 1), "without antialiasing a pixel is either covered or not")
+
+	for _, mode := range []struct {
+		antialiasing uint8
+		samples      int
+	}{{AntialiasingMSAA2, 2}, {AntialiasingMSAA4, 4}, {AntialiasingMSAA8, 8}} {
+		r.SetAntialiasing(mode.antialiasing)
+		assert.Equal(t, mode.samples, r.zBuffer.Samples())
+		r.imageBuffer.Clear()
+		renderRGBA(t, r, sceneGraph)
+		coverages := coverageLevels(t, &r.imageBuffer, mode.samples)
+		assert.Truef(t, len(coverages) > 2, "%d samples: %v", mode.samples, coverages)
+		assertColor(t, color.RGBA{R: 255, G: 255, B: 255, A: 255}, r.imageBuffer.Get(20, 15), "the inside is shaded as without antialiasing")
+		assert.Equal(t, color.RGBA{A: 255}, r.imageBuffer.Get(0, 0))
+	}
+
+	r.SetAntialiasing(AntialiasingNone)
+	r.imageBuffer.Clear()
+	assert.Equal(t, aliased, renderRGBA(t, r, sceneGraph).Pix, "disabling MSAA renders as before")
+}
+
+func TestRasterRenderer_MSAADepth(t *testing.T) {
+	// the white quad in front of a blue one covering the screen, the samples of the border pixels take the color of the
+	// closest quad so the pixels are mixed from white and blue, never from the black background
+	sceneGraph := antialiasingTestScene()
+	blue, err := graphics.NewMeshFromReader(strings.NewReader(goldenTexturedQuad), graphics.NewMaterial("blue", basics.NewVector3(0, 0, 65535), basics.Vector3{}, 1))
+	if err != nil {
+		panic(err)
+	}
+	back := entities.NewModelObject("back", blue, false)
+	back.SetShader(&UnlitShader{})
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(back, "back"), basics.NewTransform(10, basics.NewQuaternionFromEulerAngles(0, -90, 0), basics.NewVector3(0, 0, 1)))
+	r := NewRasterRenderer(sceneGraph.GetNode("camera"), 40, 30)
+	r.SetAntialiasing(AntialiasingMSAA4)
+	renderRGBA(t, r, sceneGraph)
+	mixed := 0
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			c := r.imageBuffer.Get(x, y)
+			assert.InDeltaf(t, 255, c.B, 1, "pixel %d, %d: %v", x, y, c)
+			assert.Equalf(t, c.R, c.G, "pixel %d, %d: %v", x, y, c)
+			if c.R > 1 && c.R < 254 {
+				mixed++
+			}
+		}
+	}
+	assert.True(t, mixed > 0, "no pixel on the edge")
+}
+
+func TestRasterRenderer_SetAntialiasing(t *testing.T) {
+	r := NewRasterRenderer(nil, 4, 4)
+	assert.Equal(t, uint8(AntialiasingNone), r.Antialiasing())
+	r.SetAntialiasing(AntialiasingFXAA)
+	assert.Equal(t, uint8(AntialiasingFXAA), r.Antialiasing())
+	assert.Equal(t, 1, r.zBuffer.Samples(), "FXAA does not need samples")
+	assert.Panics(t, func() { r.SetAntialiasing(AntialiasingFXAA + 1) })
+}
+
+func TestFXAA(t *testing.T) {
+	// white below the line y = x / 3, black above it
+	imageBuffer := graphics.NewImageBuffer(30, 12)
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 30; x++ {
+			if y < x/3 {
+				imageBuffer.Set(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+			}
+		}
+	}
+	original := graphics.NewImageBuffer(30, 12)
+	imageBuffer.CopyToSamples(&original, 0, 0, 30, 12)
+	fxaa(&imageBuffer, 0, 0, 30, 12)
+
+	levels := greyLevels(t, &imageBuffer)
+	assert.True(t, len(levels) > 4, "the staircase is not smoothed: %v", levels)
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 30; x++ {
+			// far from the edge nothing changes
+			if y < x/3-1 || y > x/3+1 {
+				assert.Equalf(t, original.Get(x, y), imageBuffer.Get(x, y), "pixel %d, %d", x, y)
+			}
+		}
+	}
+
+	// a flat image is left untouched
+	flat := graphics.NewImageBuffer(8, 8)
+	fxaa(&flat, 0, 0, 8, 8)
+	assert.Equal(t, map[uint8]int{0: 64}, greyLevels(t, &flat))
+}
+
+func TestRasterRenderer_FXAAViewport(t *testing.T) {
+	// the filter reads and writes only the pixels of the viewport
+	sceneGraph := antialiasingTestScene()
+	r := NewRasterRenderer(sceneGraph.GetNode("camera"), 40, 30)
+	r.SetAntialiasing(AntialiasingFXAA)
+	r.imageBuffer.Set(0, 0, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	viewport := NewViewport(sceneGraph.GetNode("camera"), 20, 0, 20, 30)
+	_, err := r.RenderViewports(sceneGraph, []Viewport{viewport})
+	assert.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 255, G: 255, B: 255, A: 255}, r.imageBuffer.Get(0, 0))
+	assert.Equal(t, color.RGBA{A: 255}, r.imageBuffer.Get(1, 0))
+	assert.True(t, len(greyLevels(t, &r.imageBuffer)) > 2, "the edges in the viewport are not smoothed")
+}
@@ -157,3 +157,17 @@ func ClipTriangleAgainstPlanes(triangle *graphics.Triangle, planes []basics.Plan
 	}
 	return outTriangles
 }
+
+// ClipSegmentAgainstPlanes returns the start and end points of the part of the segment in front of all the planes and
+// false if there is none
+func ClipSegmentAgainstPlanes(p0, p1 *basics.Vector3, planes []basics.Plane) (basics.Vector3, basics.Vector3, bool) {
+	start, end := *p0, *p1
+	for i := range planes {
+		var inside bool
+		start, end, inside = ClipSegment(&start, &end, &planes[i])
+		if !inside {
+			return basics.Vector3{}, basics.Vector3{}, false
+		}
+	}
+	return start, end, true
+}
@@ -0,0 +1,83 @@
+package renderer
+
+import (
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/graphics"
+)
+
+// CullingStats Models tested against the view frustum by the last call to RenderSceneGraph or RenderViewports, summed
+// over the viewports
+type CullingStats struct {
+	Models       int // models tested
+	Culled       int // models outside of the view frustum, none of their triangles is produced
+	Inside       int // models entirely inside the view frustum, their triangles are not clipped
+	Intersecting int // models crossing the view frustum, their triangles are clipped only against the planes they cross
+}
+
+// SetFrustumCulling Enables or disables the test of the bounding volumes of the models against the view frustum, it's
+// enabled by default. When disabled every triangle is clipped against all the planes of the frustum
+func (r *RasterRenderer) SetFrustumCulling(enabled bool) {
+	r.parameters.frustumCulling = enabled
+}
+
+// FrustumCulling Returns true if the models are tested against the view frustum before producing their triangles
+func (r *RasterRenderer) FrustumCulling() bool {
+	return r.parameters.frustumCulling
+}
+
+// CullingStats Returns the results of the frustum culling of the last frame, all zeros if culling is disabled
+func (r *RasterRenderer) CullingStats() CullingStats {
+	return r.cullingStats
+}
+
+// cullItems Returns the items visible from the camera with the planes of the view frustum their triangles must be
+// clipped against. The bounding sphere is tested first, the oriented box only when the sphere crosses a plane
+func (r *RasterRenderer) cullItems(items []renderItem) []renderItem {
+	planes := r.parameters.viewFrustumSides
+	if !r.parameters.frustumCulling {
+		for i := range items {
+			items[i].clipPlanes = planes
+		}
+		return items
+	}
+
+	visible := make([]renderItem, 0, len(items))
+	for _, item := range items {
+		r.cullingStats.Models++
+		box := item.modelObject.Bounds()
+		if box.IsEmpty() {
+			r.cullingStats.Culled++
+			continue
+		}
+		sphere := item.modelObject.BoundingSphere()
+		sphere = sphere.Transformed(&item.completeTransform)
+		obb := box.OBB(&item.completeTransform)
+		culled := false
+		var crossed []basics.Plane
+		for i := range planes {
+			side := sphere.TestPlane(&planes[i])
+			if side == graphics.PlaneSideIntersects {
+				side = obb.TestPlane(&planes[i])
+			}
+			if side == graphics.PlaneSideBehind {
+				culled = true
+				break
+			}
+			if side == graphics.PlaneSideIntersects {
+				crossed = append(crossed, planes[i])
+			}
+		}
+		switch {
+		case culled:
+			r.cullingStats.Culled++
+			continue
+		case len(crossed) == 0:
+			r.cullingStats.Inside++
+		default:
+			r.cullingStats.Intersecting++
+		}
+		item.clipPlanes = crossed
+		visible = append(visible, item)
+	}
+	return visible
+}
@@ -0,0 +1,68 @@
+package renderer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/entities"
+	"testing"
+)
+
+// cullingTestScene A camera at the origin looking at +z and cubes in front of it, behind it, crossing the left side of
+// the view and beyond the far plane
+func cullingTestScene() *entities.SceneGraph {
+	sceneGraph := entities.NewSceneGraph()
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewCameraObject("camera"), "camera"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.Vector3{}))
+	cube := loadMeshes()["cube"]
+	positions := map[string]basics.Vector3{
+		"inside":   basics.NewVector3(0, 0, 5),
+		"behind":   basics.NewVector3(0, 0, -5),
+		"crossing": basics.NewVector3(-5, 0, 5),
+		"far":      basics.NewVector3(0, 0, 2000),
+	}
+	for name, position := range positions {
+		sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewModelObject(name, cube, false), name), basics.NewTransform(1, basics.NewIdentityQuaternion(), position))
+	}
+	goldenLights(sceneGraph)
+	return sceneGraph
+}
+
+func TestRasterRenderer_FrustumCulling(t *testing.T) {
+	sceneGraph := cullingTestScene()
+	r := NewRasterRenderer(sceneGraph.GetNode("camera"), 80, 60)
+	assert.True(t, r.FrustumCulling())
+	culled := renderRGBA(t, r, sceneGraph).Pix
+	assert.Equal(t, CullingStats{Models: 4, Culled: 2, Inside: 1, Intersecting: 1}, r.CullingStats())
+
+	// the statistics are reset every frame
+	renderRGBA(t, r, sceneGraph)
+	assert.Equal(t, 4, r.CullingStats().Models)
+
+	unculled := NewRasterRenderer(sceneGraph.GetNode("camera"), 80, 60)
+	unculled.SetFrustumCulling(false)
+	assert.Equal(t, culled, renderRGBA(t, unculled, sceneGraph).Pix, "culling must not change the image")
+	assert.Equal(t, CullingStats{}, unculled.CullingStats())
+}
+
+func TestRasterRenderer_FrustumCullingViewports(t *testing.T) {
+	sceneGraph := cullingTestScene()
+	camera := sceneGraph.GetNode("camera")
+	r := NewRasterRenderer(camera, 80, 60)
+	_, err := r.RenderViewports(sceneGraph, []Viewport{NewViewport(camera, 0, 0, 40, 60), NewViewport(camera, 40, 0, 40, 60)})
+	assert.Nil(t, err)
+	stats := r.CullingStats()
+	assert.Equal(t, 8, stats.Models, "the statistics are summed over the viewports")
+	assert.Equal(t, 6, stats.Culled, "the narrower viewports don't see the crossing cube")
+}
+
+func TestRasterRenderer_FrustumCullingSampleScene(t *testing.T) {
+	sceneGraph := SampleScene()
+	for _, mode := range []uint8{RendermodeNormal, RendermodeShadedWireframe} {
+		r := NewRasterRenderer(sceneGraph.GetNode("camera"), 160, 120)
+		r.SetRenderMode(mode)
+		culled := renderRGBA(t, r, sceneGraph).Pix
+		unculled := NewRasterRenderer(sceneGraph.GetNode("camera"), 160, 120)
+		unculled.SetRenderMode(mode)
+		unculled.SetFrustumCulling(false)
+		assert.Equal(t, renderRGBA(t, unculled, sceneGraph).Pix, culled, "render mode %d", mode)
+	}
+}
@@ -0,0 +1,132 @@
+package renderer
+
+import (
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"image/color"
+)
+
+const (
+	fxaaEdgeThreshold    = 0.125  // minimum contrast of an edge relative to the brightest pixel around it
+	fxaaEdgeThresholdMin = 0.0312 // minimum contrast of an edge, darker contrasts are noise
+	fxaaSubpixelQuality  = 0.75   // how much the pixels thinner than an edge are blurred
+)
+
+// fxaaSteps The pixels moved along an edge at each step of the search of its ends, growing so long edges end quickly
+var fxaaSteps = [...]int{1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 8}
+
+// fxaaImage The colors and the brightness of a rectangle of the image buffer, read while the buffer is filtered
+type fxaaImage struct {
+	width  int
+	height int
+	colors []color.RGBA
+	luma   []basics.Scalar
+}
+
+// at Returns the index of the pixel at x, y relative to the rectangle, the coordinates are clamped to the rectangle
+func (img *fxaaImage) at(x int, y int) int {
+	return min(max(y, 0), img.height-1)*img.width + min(max(x, 0), img.width-1)
+}
+
+// fxaa Smooths the edges in the rectangle of the image buffer from minX, minY (included) to maxX, maxY (excluded), the
+// pixels outside of the rectangle are not read.
+// Edges are found from the contrast of the brightness of a pixel with its neighbours, the direction of the edge is
+// followed on both sides until the contrast drops and the pixel is blended with its neighbour across the edge by how
+// close it's to the nearest end, so staircases become gradients. Pixels much brighter or darker than all the
+// neighbours are blended too
+func fxaa(imageBuffer *graphics.ImageBuffer, minX int, minY int, maxX int, maxY int) {
+	img := fxaaImage{width: maxX - minX, height: maxY - minY}
+	img.colors = make([]color.RGBA, img.width*img.height)
+	img.luma = make([]basics.Scalar, img.width*img.height)
+	for y := 0; y < img.height; y++ {
+		for x := 0; x < img.width; x++ {
+			c := imageBuffer.Get(minX+x, minY+y)
+			img.colors[y*img.width+x] = c
+			img.luma[y*img.width+x] = (0.299*basics.Scalar(c.R) + 0.587*basics.Scalar(c.G) + 0.114*basics.Scalar(c.B)) / 255
+		}
+	}
+
+	for y := 0; y < img.height; y++ {
+		for x := 0; x < img.width; x++ {
+			if c, ok := img.filter(x, y); ok {
+				imageBuffer.Set(minX+x, minY+y, c)
+			}
+		}
+	}
+}
+
+// filter Returns the smoothed color of the pixel at x, y of the rectangle, false if the pixel is not on an edge
+func (img *fxaaImage) filter(x int, y int) (color.RGBA, bool) {
+	luma := img.luma
+	m := luma[img.at(x, y)]
+	n, s := luma[img.at(x, y+1)], luma[img.at(x, y-1)]
+	e, w := luma[img.at(x+1, y)], luma[img.at(x-1, y)]
+	lumaMax := max(m, n, s, e, w)
+	lumaRange := lumaMax - min(m, n, s, e, w)
+	if lumaRange < max(fxaaEdgeThresholdMin, lumaMax*fxaaEdgeThreshold) {
+		return color.RGBA{}, false
+	}
+	ne, nw := luma[img.at(x+1, y+1)], luma[img.at(x-1, y+1)]
+	se, sw := luma[img.at(x+1, y-1)], luma[img.at(x-1, y-1)]
+
+	// an edge is horizontal when the brightness changes more going up and down than going left and right
+	horizontal := basics.Abs(nw+sw-2*w)+2*basics.Abs(n+s-2*m)+basics.Abs(ne+se-2*e) >=
+		basics.Abs(nw+ne-2*n)+2*basics.Abs(w+e-2*m)+basics.Abs(sw+se-2*s)
+	// across is the direction of the neighbour on the other side of the edge, along the direction of the edge
+	acrossX, acrossY, alongX, alongY := 0, 1, 1, 0
+	lumaNegative, lumaPositive := s, n
+	if !horizontal {
+		acrossX, acrossY, alongX, alongY = 1, 0, 0, 1
+		lumaNegative, lumaPositive = w, e
+	}
+	gradientNegative, gradientPositive := lumaNegative-m, lumaPositive-m
+	lumaAcross := lumaPositive
+	if basics.Abs(gradientNegative) >= basics.Abs(gradientPositive) {
+		acrossX, acrossY = -acrossX, -acrossY
+		lumaAcross = lumaNegative
+	}
+	gradient := max(basics.Abs(gradientNegative), basics.Abs(gradientPositive)) / 4
+	lumaEdge := (m + lumaAcross) / 2
+
+	// walks along the edge, between the pixel and its neighbour across, until the brightness differs from the edge
+	// more than a quarter of the gradient
+	endDistance := func(direction int) (int, basics.Scalar) {
+		distance := 0
+		var delta basics.Scalar
+		for _, step := range fxaaSteps {
+			distance += step
+			px, py := x+direction*distance*alongX, y+direction*distance*alongY
+			delta = (luma[img.at(px, py)]+luma[img.at(px+acrossX, py+acrossY)])/2 - lumaEdge
+			if basics.Abs(delta) >= gradient {
+				break
+			}
+		}
+		return distance, delta
+	}
+	distanceNegative, deltaNegative := endDistance(-1)
+	distancePositive, deltaPositive := endDistance(1)
+
+	// the pixels close to the end of the edge the staircase comes from are blended the most
+	distance, deltaEnd := distanceNegative, deltaNegative
+	if distancePositive < distanceNegative {
+		distance, deltaEnd = distancePositive, deltaPositive
+	}
+	var offset basics.Scalar
+	if (deltaEnd < 0) != (m < lumaEdge) {
+		offset = 0.5 - basics.Scalar(distance)/basics.Scalar(distanceNegative+distancePositive)
+	}
+
+	lumaAverage := (2*(n+s+e+w) + ne + nw + se + sw) / 12
+	subpixel := basics.Clamp(0, 1, basics.Abs(lumaAverage-m)/lumaRange)
+	subpixel = (3 - 2*subpixel) * subpixel * subpixel
+	offset = max(offset, subpixel*subpixel*fxaaSubpixelQuality)
+	if offset <= 0 {
+		return color.RGBA{}, false
+	}
+
+	c0, c1 := img.colors[img.at(x, y)], img.colors[img.at(x+acrossX, y+acrossY)]
+	lerp := func(a uint8, b uint8) uint8 {
+		return uint8(basics.Round(basics.Scalar(a) + (basics.Scalar(b)-basics.Scalar(a))*offset))
+	}
+	return color.RGBA{R: lerp(c0.R, c1.R), G: lerp(c0.G, c1.G), B: lerp(c0.B, c1.B), A: 255}, true
+}
@@ -0,0 +1,472 @@
+package renderer
+
+import (
+	"flag"
+	"fmt"
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/entities"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Run "go test ./pkg/renderer -run TestGolden -update" to rewrite the reference images after an intended change
+var updateGolden = flag.Bool("update", false, "update the golden images in testdata/golden")
+
+const (
+	goldenDir      = "testdata/golden"
+	goldenFailDir  = "testdata/failures"
+	goldenWidth    = 160
+	goldenHeight   = 120
+	goldenChannelT = 8     // max difference allowed on a single channel
+	goldenPixelT   = 0.002 // max fraction of pixels allowed to exceed the channel tolerance
+)
+
+type goldenScene struct {
+	name       string
+	renderMode uint8
+	build      func() *entities.SceneGraph
+}
+
+var goldenScenes = []goldenScene{
+	{"cube", RendermodeNormal, goldenSingleMeshScene("cube", 1, true)},
+	{"sphere", RendermodeNormal, goldenSingleMeshScene("sphere", 1, false)},
+	{"torus", RendermodeNormal, goldenSingleMeshScene("torus", 1, false)},
+	{"sphere_phong", RendermodePhong, goldenSingleMeshScene("sphere", 1, false)},
+	{"torus_phong", RendermodePhong, goldenSingleMeshScene("torus", 1, false)},
+	{"clipping", RendermodeNormal, goldenClippingScene},
+	{"cube_ortho", RendermodeNormal, withCamera(goldenSingleMeshScene("cube", 1, true), func(c *entities.CameraObject) {
+		c.SetOrthographic(true)
+		c.SetOrthoHeight(4)
+	})},
+	{"sample_fov50", RendermodeNormal, withCamera(SampleScene, func(c *entities.CameraObject) { c.SetFov(50) })},
+	{"sample_far", RendermodeNormal, withCamera(SampleScene, func(c *entities.CameraObject) { c.SetClipDistances(2, 6) })},
+	{"textured", RendermodeNormal, goldenTexturedScene},
+	{"spot_light", RendermodePhong, goldenLightTypesScene(goldenSpotLight)},
+	{"directional_hemisphere", RendermodeNormal, goldenLightTypesScene(goldenDirectionalHemisphereLights)},
+	{"shadow_spot", RendermodePhong, goldenLightTypesScene(withShadows(goldenSpotLight, "spot"))},
+	{"shadow_directional", RendermodePhong, goldenLightTypesScene(withShadows(goldenDirectionalHemisphereLights, "sun"))},
+	{"shadow_point", RendermodePhong, goldenLightTypesScene(goldenShadowPointLight)},
+	{"shaders", RendermodeNormal, goldenShadersScene},
+	{"transparency", RendermodePhong, goldenLightTypesScene(goldenTransparentObjects)},
+	{"sample", RendermodeNormal, SampleScene},
+	{"sample_wireframe", RendermodeWireframe, SampleScene},
+}
+
+func TestGolden(t *testing.T) {
+	for _, scene := range goldenScenes {
+		t.Run(scene.name, func(t *testing.T) {
+			sceneGraph := scene.build()
+			r := NewRasterRenderer(sceneGraph.GetNode("camera"), goldenWidth, goldenHeight)
+			r.SetRenderMode(scene.renderMode)
+			compareGolden(t, scene.name, renderRGBA(t, r, sceneGraph))
+		})
+	}
+}
+
+// TestGolden_PerPixelLightingPerModel enabling per pixel lighting on the model must be the same as the phong render mode
+func TestGolden_PerPixelLightingPerModel(t *testing.T) {
+	sceneGraph := goldenSingleMeshScene("sphere", 1, false)()
+	sceneGraph.GetNode("sphere").GameObject.(*entities.ModelObject).SetPerPixelLighting(true)
+	r := NewRasterRenderer(sceneGraph.GetNode("camera"), goldenWidth, goldenHeight)
+	compareGolden(t, "sphere_phong", renderRGBA(t, r, sceneGraph))
+}
+
+// TestGolden_Antialiasing the edges of the triangles and of the lines smoothed by every antialiasing mode
+func TestGolden_Antialiasing(t *testing.T) {
+	scenes := []struct {
+		name         string
+		renderMode   uint8
+		antialiasing uint8
+		build        func() *entities.SceneGraph
+	}{
+		{"cube_msaa2", RendermodeNormal, AntialiasingMSAA2, goldenSingleMeshScene("cube", 1, true)},
+		{"cube_msaa4", RendermodeNormal, AntialiasingMSAA4, goldenSingleMeshScene("cube", 1, true)},
+		{"cube_msaa8", RendermodeNormal, AntialiasingMSAA8, goldenSingleMeshScene("cube", 1, true)},
+		{"cube_fxaa", RendermodeNormal, AntialiasingFXAA, goldenSingleMeshScene("cube", 1, true)},
+		{"transparency_msaa4", RendermodePhong, AntialiasingMSAA4, goldenLightTypesScene(goldenTransparentObjects)},
+		{"sample_wireframe_fxaa", RendermodeWireframe, AntialiasingFXAA, SampleScene},
+	}
+	for _, scene := range scenes {
+		t.Run(scene.name, func(t *testing.T) {
+			sceneGraph := scene.build()
+			r := NewRasterRenderer(sceneGraph.GetNode("camera"), goldenWidth, goldenHeight)
+			r.SetRenderMode(scene.renderMode)
+			r.SetAntialiasing(scene.antialiasing)
+			compareGolden(t, scene.name, renderRGBA(t, r, sceneGraph))
+		})
+	}
+}
+
+// TestGolden_Wireframe the edges of the sample scene with the wireframe settings and over the shaded models
+func TestGolden_Wireframe(t *testing.T) {
+	scenes := []struct {
+		name       string
+		renderMode uint8
+		settings   WireframeSettings
+	}{
+		{"sample_wireframe_hidden", RendermodeWireframe, WireframeSettings{HiddenLineRemoval: true, Antialiased: true, DepthBias: 0.01}},
+		{"sample_wireframe_culled", RendermodeWireframe, WireframeSettings{CullBackFaces: true, DepthBias: 0.01}},
+		{"sample_shaded_wireframe", RendermodeShadedWireframe, WireframeSettings{Antialiased: true, DepthBias: 0.01}},
+	}
+	for _, scene := range scenes {
+		t.Run(scene.name, func(t *testing.T) {
+			sceneGraph := SampleScene()
+			sceneGraph.GetNode("cube").GameObject.(*entities.ModelObject).SetWireColor(color.RGBA{R: 255, G: 80, B: 80, A: 255})
+			sceneGraph.GetNode("torus").GameObject.(*entities.ModelObject).SetWireColor(color.RGBA{G: 255, B: 255, A: 160})
+			r := NewRasterRenderer(sceneGraph.GetNode("camera"), goldenWidth, goldenHeight)
+			r.SetRenderMode(scene.renderMode)
+			r.SetWireframeSettings(scene.settings)
+			compareGolden(t, scene.name, renderRGBA(t, r, sceneGraph))
+		})
+	}
+}
+
+// TestGolden_Viewports the sample scene seen in perspective next to the top, front and side orthographic views
+func TestGolden_Viewports(t *testing.T) {
+	sceneGraph := goldenViewportsScene()
+	cameras := []*entities.SceneGraphNode{sceneGraph.GetNode("camera"), sceneGraph.GetNode("top"), sceneGraph.GetNode("front"), sceneGraph.GetNode("side")}
+	r := NewRasterRenderer(cameras[0], goldenWidth*2, goldenHeight*2)
+	imageBuffer, err := r.RenderViewports(sceneGraph, GridViewports(cameras, 2, 2, goldenWidth*2, goldenHeight*2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareGolden(t, "viewports", imageBuffer.ToRGBA())
+}
+
+// renderRGBA Renders the scene graph and fails the test if the renderer returns an error
+func renderRGBA(t testing.TB, r *RasterRenderer, sceneGraph *entities.SceneGraph) *image.RGBA {
+	t.Helper()
+	imageBuffer, err := r.RenderSceneGraph(sceneGraph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return imageBuffer.ToRGBA()
+}
+
+// compareGolden compares img with the golden image called name. If the images differ more than the tolerance the
+// rendered image and a diff image are written in testdata/failures
+func compareGolden(t *testing.T, name string, img *image.RGBA) {
+	t.Helper()
+	goldenPath := filepath.Join(goldenDir, name+".png")
+	if *updateGolden {
+		if err := writePNG(goldenPath, img); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	golden, err := readPNG(goldenPath)
+	if err != nil {
+		t.Fatalf("could not read golden image (run with -update to create it): %v", err)
+	}
+	if golden.Bounds() != img.Bounds() {
+		t.Fatalf("golden image size %v does not match rendered size %v", golden.Bounds().Size(), img.Bounds().Size())
+	}
+
+	diff, mismatched := diffImages(golden, img, goldenChannelT)
+	total := img.Bounds().Dx() * img.Bounds().Dy()
+	if float64(mismatched) <= goldenPixelT*float64(total) {
+		return
+	}
+
+	actualPath := filepath.Join(goldenFailDir, name+"_actual.png")
+	diffPath := filepath.Join(goldenFailDir, name+"_diff.png")
+	if err := writePNG(actualPath, img); err != nil {
+		t.Error(err)
+	}
+	if err := writePNG(diffPath, diff); err != nil {
+		t.Error(err)
+	}
+	t.Errorf("%d/%d pixels differ from %s by more than %d, see %s and %s", mismatched, total, goldenPath, goldenChannelT, actualPath, diffPath)
+}
+
+// diffImages Returns an image highlighting the differences between a and b and the number of pixels where at least a
+// channel differs more than tolerance. Pixels over the tolerance are red, smaller differences are shown in gray
+func diffImages(a *image.RGBA, b *image.RGBA, tolerance int) (*image.RGBA, int) {
+	bounds := a.Bounds()
+	diff := image.NewRGBA(bounds)
+	mismatched := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			ca := a.RGBAAt(x, y)
+			cb := b.RGBAAt(x, y)
+			maxDiff := max(absDiff(ca.R, cb.R), absDiff(ca.G, cb.G), absDiff(ca.B, cb.B))
+			if maxDiff > tolerance {
+				mismatched++
+				diff.SetRGBA(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				v := uint8(maxDiff * 255 / max(tolerance, 1))
+				diff.SetRGBA(x, y, color.RGBA{R: v / 2, G: v / 2, B: v / 2, A: 255})
+			}
+		}
+	}
+	return diff, mismatched
+}
+
+func absDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+func readPNG(path string) (*image.RGBA, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba, nil
+	}
+	rgba := image.NewRGBA(img.Bounds())
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			rgba.Set(x, y, img.At(x, y))
+		}
+	}
+	return rgba, nil
+}
+
+func writePNG(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(f, img)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
+
+/* Canonical scenes */
+
+func withSpecularExponent(mesh graphics.Mesh, specularExponent basics.Scalar) graphics.Mesh {
+	material := *mesh.FaceMaterial(0)
+	material.SpecularExponent = specularExponent
+	mesh.SetMaterial(material)
+	return mesh
+}
+
+// withCamera Returns a function that builds the scene and changes the settings of its camera with setup
+func withCamera(build func() *entities.SceneGraph, setup func(camera *entities.CameraObject)) func() *entities.SceneGraph {
+	return func() *entities.SceneGraph {
+		sceneGraph := build()
+		setup(sceneGraph.GetNode("camera").GameObject.(*entities.CameraObject))
+		return sceneGraph
+	}
+}
+
+func goldenLights(sceneGraph *entities.SceneGraph) {
+	simpleFallOff := func(lightDistance basics.Scalar) basics.Scalar {
+		return basics.Clamp(0, 1, 1-(lightDistance/basics.Scalar(50)))
+	}
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewLightObject("light1", color.RGBA{150, 150, 150, 255}, simpleFallOff), "light1"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 5, 0)))
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewLightObject("light2", color.RGBA{80, 150, 20, 255}, simpleFallOff), "light2"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(2, 2, -2)))
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewHemisphereLightObject("ambient", color.RGBA{30, 30, 30, 255}, color.RGBA{30, 30, 30, 255}), "ambient"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.Vector3{}))
+}
+
+// goldenSingleMeshScene A single mesh at the origin seen from slightly above
+func goldenSingleMeshScene(meshName string, scale basics.Scalar, ignoreMeshNormals bool) func() *entities.SceneGraph {
+	return func() *entities.SceneGraph {
+		meshes := loadMeshes()
+		sceneGraph := entities.NewSceneGraph()
+		sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewCameraObject("mainCamera"), "camera"), basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(0, 12, 0), basics.NewVector3(0, 1.2, -4)))
+		model := entities.NewModelObject(meshName, withSpecularExponent(meshes[meshName], 60), ignoreMeshNormals)
+		sceneGraph.AddChild("world", entities.NewSceneGraphNode(model, meshName), basics.NewTransform(scale, basics.NewQuaternionFromEulerAngles(30, 20, 0), basics.Vector3{}))
+		goldenLights(sceneGraph)
+		return sceneGraph
+	}
+}
+
+// goldenClippingScene A large quad crossing the near plane and the sides of the frustum
+func goldenClippingScene() *entities.SceneGraph {
+	meshes := loadMeshes()
+	sceneGraph := entities.NewSceneGraph()
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewCameraObject("mainCamera"), "camera"), basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(20, 10, 0), basics.NewVector3(0, 1, -3)))
+	quadObj := entities.NewModelObject("quad", meshes["quad"], true)
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(quadObj, "quad"), basics.NewTransform(10, basics.NewQuaternionFromEulerAngles(0, 90, 0), basics.NewVector3(0, 0, 3)))
+	cubeObj := entities.NewModelObject("cube", withSpecularExponent(meshes["cube"], 20), true)
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(cubeObj, "cube"), basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(45, 0, 0), basics.NewVector3(1.2, 0.8, -1.2)))
+	goldenLights(sceneGraph)
+	return sceneGraph
+}
+
+// goldenViewportsScene The sample scene with orthographic cameras looking from the top, the front and the side
+func goldenViewportsScene() *entities.SceneGraph {
+	sceneGraph := SampleScene()
+	ortho := func(name string, yaw basics.Scalar, pitch basics.Scalar, position basics.Vector3) {
+		camera := entities.NewOrthographicCameraObject(name, 12, 0.1, 100)
+		sceneGraph.AddChild("world", entities.NewSceneGraphNode(camera, name), basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(yaw, pitch, 0), position))
+	}
+	ortho("top", 0, 90, basics.NewVector3(1, 20, 1))
+	ortho("front", 0, 0, basics.NewVector3(1, 0, -20))
+	ortho("side", 90, 0, basics.NewVector3(-20, 0, 1))
+	return sceneGraph
+}
+
+// goldenLightTypesScene A sphere on a floor lit by the lights added by addLights
+func goldenLightTypesScene(addLights func(sceneGraph *entities.SceneGraph)) func() *entities.SceneGraph {
+	return func() *entities.SceneGraph {
+		floorMaterial := graphics.NewMaterial("floor", basics.NewVector3(50000, 50000, 50000), basics.Vector3{}, 1)
+		floor, err := graphics.NewMeshFromReader(strings.NewReader(goldenTexturedQuad), floorMaterial)
+		if err != nil {
+			panic(err)
+		}
+		sceneGraph := entities.NewSceneGraph()
+		sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewCameraObject("mainCamera"), "camera"), basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(0, 30, 0), basics.NewVector3(0, 2.5, -4)))
+		sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewModelObject("floor", floor, false), "floor"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.Vector3{}))
+		sphereMaterial := graphics.NewMaterial("sphere", basics.NewVector3(55000, 55000, 55000), basics.NewVector3(65535, 65535, 65535), 60)
+		sphere := entities.NewModelObject("sphere", readMeshFromFile("../../meshes/sphere.obj", sphereMaterial), false)
+		sceneGraph.AddChild("world", entities.NewSceneGraphNode(sphere, "sphere"), basics.NewTransform(0.8, basics.NewIdentityQuaternion(), basics.NewVector3(0.6, 0.8, 0.5)))
+		addLights(sceneGraph)
+		return sceneGraph
+	}
+}
+
+// goldenSpotLight A spot light pointing down, the edge of the cone is visible on the floor and on the sphere
+func goldenSpotLight(sceneGraph *entities.SceneGraph) {
+	noFallOff := func(lightDistance basics.Scalar) basics.Scalar {
+		return 1
+	}
+	spot := entities.NewSpotLightObject("spot", color.RGBA{R: 220, G: 200, B: 160, A: 255}, noFallOff, 20, 30)
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(spot, "spot"), basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(0, 90, 0), basics.NewVector3(0, 4, 0)))
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewHemisphereLightObject("ambient", color.RGBA{20, 20, 20, 255}, color.RGBA{20, 20, 20, 255}), "ambient"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.Vector3{}))
+}
+
+// goldenDirectionalHemisphereLights A low sun from the left and a blue sky with a brown ground
+func goldenDirectionalHemisphereLights(sceneGraph *entities.SceneGraph) {
+	sun := entities.NewDirectionalLightObject("sun", color.RGBA{R: 200, G: 180, B: 140, A: 255})
+	// the shadow map is centered on the node, it's placed so that the map is centered on the origin
+	sunRotation := basics.NewQuaternionFromEulerAngles(60, 30, 0)
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(sun, "sun"), basics.NewTransform(1, sunRotation, sunRotation.Rotated(basics.Forward()).Mul(-10)))
+	sky := entities.NewHemisphereLightObject("sky", color.RGBA{R: 40, G: 60, B: 110, A: 255}, color.RGBA{R: 60, G: 40, B: 20, A: 255})
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(sky, "sky"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.Vector3{}))
+}
+
+// withShadows Enables the shadows of the light node called lightName after adding the lights
+func withShadows(addLights func(sceneGraph *entities.SceneGraph), lightName string) func(sceneGraph *entities.SceneGraph) {
+	return func(sceneGraph *entities.SceneGraph) {
+		addLights(sceneGraph)
+		sceneGraph.GetNode(lightName).GameObject.(*entities.LightObject).SetCastShadows(true)
+	}
+}
+
+// goldenShadowPointLight A point light between the sphere and a cube, both cast shadows on the floor in opposite
+// directions so more than one face of the cube map is used
+func goldenShadowPointLight(sceneGraph *entities.SceneGraph) {
+	meshes := loadMeshes()
+	cube := entities.NewModelObject("cube", meshes["cube"], true)
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(cube, "cube"), basics.NewTransform(0.4, basics.NewQuaternionFromEulerAngles(30, 0, 0), basics.NewVector3(-1.4, 0.4, -0.5)))
+	fallOff := func(lightDistance basics.Scalar) basics.Scalar {
+		return basics.Clamp(0, 1, 1-(lightDistance/basics.Scalar(8)))
+	}
+	light := entities.NewLightObject("point", color.RGBA{R: 255, G: 240, B: 220, A: 255}, fallOff)
+	light.SetCastShadows(true)
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(light, "point"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(-0.4, 1.8, 0)))
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewHemisphereLightObject("ambient", color.RGBA{20, 20, 20, 255}, color.RGBA{20, 20, 20, 255}), "ambient"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.Vector3{}))
+}
+
+// goldenShadersScene Four spheres drawn, from left to right, with the toon, normal, depth and unlit shaders
+func goldenShadersScene() *entities.SceneGraph {
+	sceneGraph := entities.NewSceneGraph()
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewCameraObject("mainCamera"), "camera"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, -2.5)))
+	material := graphics.NewMaterial("sphere", basics.NewVector3(60000, 30000, 10000), basics.NewVector3(65535, 65535, 65535), 40)
+	sphere := readMeshFromFile("../../meshes/sphere.obj", material)
+	shaders := []graphics.Shader{NewToonShader(3), &NormalShader{}, &DepthShader{Near: 1.8, Far: 2.6}, &UnlitShader{}}
+	for i, shader := range shaders {
+		model := entities.NewModelObject(fmt.Sprintf("sphere%d", i), sphere, false)
+		model.SetShader(shader)
+		position := basics.NewVector3(-1.8+1.2*basics.Scalar(i), 0, 0)
+		sceneGraph.AddChild("world", entities.NewSceneGraphNode(model, model.Name()), basics.NewTransform(0.55, basics.NewIdentityQuaternion(), position))
+	}
+	light := entities.NewLightObject("light", color.RGBA{R: 255, G: 255, B: 255, A: 255}, nil)
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(light, "light"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(-3, 3, -3)))
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewHemisphereLightObject("ambient", color.RGBA{20, 20, 20, 255}, color.RGBA{20, 20, 20, 255}), "ambient"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.Vector3{}))
+	return sceneGraph
+}
+
+// goldenTransparentObjects A blue glass pane, an additive glowing sphere behind the pane and a yellow multiply pane,
+// lit by the lights of goldenDirectionalHemisphereLights
+func goldenTransparentObjects(sceneGraph *entities.SceneGraph) {
+	goldenDirectionalHemisphereLights(sceneGraph)
+	quad := func(name string, color basics.Vector3, opacity basics.Scalar, blendMode uint8) *entities.ModelObject {
+		material := graphics.NewMaterial(name, color, basics.NewVector3(65535, 65535, 65535), 60)
+		material.Opacity = opacity
+		material.BlendMode = blendMode
+		mesh, err := graphics.NewMeshFromReader(strings.NewReader(goldenTexturedQuad), material)
+		if err != nil {
+			panic(err)
+		}
+		return entities.NewModelObject(name, mesh, false)
+	}
+	// the quads are 2x2 and stand facing the camera
+	faceCamera := basics.NewQuaternionFromEulerAngles(0, -90, 0)
+	glass := quad("glass", basics.NewVector3(20000, 40000, 65535), 0.4, graphics.BlendModeAlpha)
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(glass, "glass"), basics.NewTransform(0.25, faceCamera, basics.NewVector3(-0.6, 1, -0.8)))
+	tint := quad("tint", basics.NewVector3(65535, 55000, 10000), 1, graphics.BlendModeMultiply)
+	tint.SetShader(&UnlitShader{})
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(tint, "tint"), basics.NewTransform(0.2, faceCamera, basics.NewVector3(1.4, 0.8, -0.6)))
+
+	glowMaterial := graphics.NewMaterial("glow", basics.NewVector3(65535, 30000, 5000), basics.Vector3{}, 1)
+	glowMaterial.BlendMode = graphics.BlendModeAdditive
+	glowMaterial.Opacity = 0.7
+	glow := entities.NewModelObject("glow", readMeshFromFile("../../meshes/sphere.obj", glowMaterial), false)
+	glow.SetShader(&UnlitShader{})
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(glow, "glow"), basics.NewTransform(0.4, basics.NewIdentityQuaternion(), basics.NewVector3(-1, 0.4, 0.6)))
+}
+
+// goldenTexturedQuad A floor quad in the xz plane with the texture repeated 4 times on each side
+const goldenTexturedQuad = `
+v -4 0 -4
+v 4 0 -4
+v 4 0 4
+v -4 0 4
+vt 0 0
+vt 4 0
+vt 4 4
+vt 0 4
+vn 0 1 0
+f 1/1/1 4/4/1 3/3/1 2/2/1
+`
+
+// goldenTexturedScene A checkerboard floor seen at a grazing angle, the lines must stay straight with perspective
+// correct interpolation
+func goldenTexturedScene() *entities.SceneGraph {
+	checker := make([]basics.Vector3, 0, 4)
+	for i := 0; i < 4; i++ {
+		value := basics.Scalar(65535 * ((i + i/2) % 2))
+		checker = append(checker, basics.NewVector3(value, value, value))
+	}
+	texture := graphics.NewTexture(2, 2, checker)
+	texture.Filter = graphics.TextureFilterNearest
+	material := graphics.NewMaterial("checker", basics.NewVector3(40000, 40000, 40000), basics.Vector3{}, 1)
+	material.DiffuseTexture = texture
+
+	mesh, err := graphics.NewMeshFromReader(strings.NewReader(goldenTexturedQuad), material)
+	if err != nil {
+		panic(err)
+	}
+	sceneGraph := entities.NewSceneGraph()
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewCameraObject("mainCamera"), "camera"), basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(0, 20, 0), basics.NewVector3(0, 1, -4)))
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewModelObject("floor", mesh, false), "floor"), basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(30, 0, 0), basics.Vector3{}))
+	goldenLights(sceneGraph)
+	return sceneGraph
+}
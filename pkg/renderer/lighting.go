@@ -2,40 +2,105 @@ package renderer
 
 import (
 	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/entities"
 	"github.com/tsagae/software3d/pkg/graphics"
-	"image/color"
 )
 
-// TriangleNormalsPhong Per vertex phong lighting
-func TriangleNormalsPhong(t *graphics.Triangle, viewDirection *basics.Vector3, ambientLightColor *basics.Vector3, specularExponent basics.Scalar, lights []renderLight, specularColor color.Color, ignoreSpecular bool) {
-	specularColorAsVector := basics.Vector3FromColor(specularColor)
+// newRenderLight Returns the light placed in camera space by objectCameraT, the transform of its node
+func newRenderLight(light *entities.LightObject, objectCameraT *basics.Transform) renderLight {
+	l := renderLight{
+		light:     light,
+		transform: *objectCameraT,
+		position:  objectCameraT.Translation,
+		color:     basics.Vector3FromColor(light.Color()),
+	}
+	switch light.Type() {
+	case entities.LightTypeDirectional, entities.LightTypeSpot:
+		l.direction = objectCameraT.Rotation.Rotated(basics.Forward()).Normalized()
+	case entities.LightTypeHemisphere:
+		l.direction = objectCameraT.Rotation.Rotated(basics.Up()).Normalized()
+		if light.GroundColor() != nil {
+			l.groundColor = basics.Vector3FromColor(light.GroundColor())
+		}
+	}
+	innerAngle, outerAngle := light.ConeAngles()
+	l.cosInner = basics.Cos(basics.DegToRad(innerAngle))
+	l.cosOuter = basics.Cos(basics.DegToRad(outerAngle))
+	return l
+}
+
+// incidence Returns the normalized vector from position to the light, the intensity of the light at position given by
+// the distance and the intensity given by the cone of spot lights (1 for the other lights). Shadows are not included
+func (l *renderLight) incidence(position *basics.Vector3) (basics.Vector3, basics.Scalar, basics.Scalar) {
+	if l.light.Type() == entities.LightTypeDirectional {
+		return l.direction.Inverse(), 1, 1
+	}
+	lightVector := l.position.Sub(*position)
+	lightDistance := lightVector.Length()
+	basics.ThisNormalize(&lightVector)
+
+	var fallOff basics.Scalar = 1
+	if f := l.light.FallOff(); f != nil {
+		fallOff = f(lightDistance)
+	}
+	var cone basics.Scalar = 1
+	if l.light.Type() == entities.LightTypeSpot {
+		cone = basics.SmoothStep(l.cosOuter, l.cosInner, -lightVector.Dot(l.direction))
+	}
+	return lightVector, fallOff, cone
+}
+
+// hemisphereColor Returns the ambient light color of a hemisphere light on a surface with the given normal
+func (l *renderLight) hemisphereColor(normal *basics.Vector3) basics.Vector3 {
+	return basics.LerpVector3(&l.groundColor, &l.color, 0.5*(1+normal.Dot(l.direction)))
+}
+
+// TriangleNormalsPhong Per vertex phong lighting. The vertex colors are used as a tint for the material colors
+func TriangleNormalsPhong(t *graphics.Triangle, viewDirection *basics.Vector3, material *graphics.Material, lights []renderLight) {
 	for i := 0; i < 3; i++ {
 		vertex := &t[i]
-		baseColor := vertex.Color
-		vertex.Color = ambientTerm(&baseColor, ambientLightColor)
-		for _, light := range lights {
-			lightVector := light.position.Sub(vertex.Position)
-			lightDistance := lightVector.Length()
-			basics.ThisNormalize(&lightVector)
-
-			lightFallOff := light.light.FallOff()(lightDistance)
-			lightColor := basics.Vector3FromColor(light.light.Color()).Mul(lightFallOff)
-
-			vertex.Color = vertex.Color.Add(diffuseTerm(&vertex.Normal, &lightVector, &baseColor, &lightColor))
-			finalSpecularColor := specularColorAsVector.Mul(lightFallOff)
-			_ = finalSpecularColor
-
-			testLightColor := light.light.Color()
-			testLightColorVector := basics.Vector3FromColor(testLightColor)
-			if !ignoreSpecular {
-				specularTerm := specularTerm(viewDirection, &vertex.Normal, &lightVector, specularExponent, &testLightColorVector, &testLightColorVector)
-				vertex.Color = vertex.Color.Add(specularTerm)
-			}
+		vertex.Color = BlinnPhong(&vertex.Position, &vertex.Normal, &vertex.Color, viewDirection, material, lights)
+	}
+}
+
+// BlinnPhong Returns the color of a point in view space lit by lights, normal must be normalized. tint (range 0-65535)
+// is multiplied by the ambient and diffuse colors of the material. viewDirection goes from the camera to the point.
+// Hemisphere lights only contribute to the ambient term, the other lights to the diffuse and specular terms, scaled by
+// their shadow maps
+func BlinnPhong(position *basics.Vector3, normal *basics.Vector3, tint *basics.Vector3, viewDirection *basics.Vector3, material *graphics.Material, lights []renderLight) basics.Vector3 {
+	scaledTint := tint.Mul(1.0 / 65535.0)
+	baseColor := material.Diffuse.MulComponents(scaledTint)
+	ambientColor := material.Ambient.MulComponents(scaledTint)
+	var color basics.Vector3
+	for i := range lights {
+		light := &lights[i]
+		if light.light.Type() == entities.LightTypeHemisphere {
+			ambientLightColor := light.hemisphereColor(normal)
+			color = color.Add(ambientTerm(&ambientColor, &ambientLightColor))
+			continue
+		}
+
+		lightVector, lightFallOff, cone := light.incidence(position)
+		if cone > 0 && light.shadow != nil {
+			cone *= light.shadow.visibility(position, normal, &lightVector)
+		}
+		if cone <= 0 {
+			continue
+		}
+		lightColor := light.color.Mul(lightFallOff * cone)
+
+		color = color.Add(diffuseTerm(normal, &lightVector, &baseColor, &lightColor))
+
+		if material.HasSpecular() {
+			specularLightColor := light.color.Mul(cone)
+			specularTerm := specularTerm(viewDirection, normal, &lightVector, material.SpecularExponent, &material.Specular, &specularLightColor)
+			color = color.Add(specularTerm)
 		}
-		vertex.Color.X = basics.ClampMax(65535, vertex.Color.X)
-		vertex.Color.Y = basics.ClampMax(65535, vertex.Color.Y)
-		vertex.Color.Z = basics.ClampMax(65535, vertex.Color.Z)
 	}
+	color.X = basics.ClampMax(65535, color.X)
+	color.Y = basics.ClampMax(65535, color.Y)
+	color.Z = basics.ClampMax(65535, color.Z)
+	return color
 }
 
 // PhongLighting LightFallOff goes from 0 to 1 where 0 is the furthest and 1 is the closest
@@ -83,19 +148,13 @@ func ambientTerm(ambientVector *basics.Vector3, ambientLightVector *basics.Vecto
 
 func specularTerm(viewDirection *basics.Vector3, surfaceNormal *basics.Vector3, lightNormal *basics.Vector3, specularExponent basics.Scalar, specularColor *basics.Vector3, lightColor *basics.Vector3) basics.Vector3 {
 	// (surfaceNormal DOT hVersor)^specularExponent * ( (specular color) per component mul (light color) )
-	//iLightN := lightNormal.Inverse()
 	iViewDir := viewDirection.Inverse()
 	hVersor := basics.NLerpVector3(&iViewDir, lightNormal, 0.5)
 	multiplier := basics.ClampMin(0, surfaceNormal.Dot(hVersor))
-	if multiplier >= 0.5 {
-		//fmt.Println("mult != 0")
-	}
-	//finalColor := lightColor.MulComponents(specularColor)
-	finalColor := *lightColor
+	finalColor := lightColor.MulComponents(*specularColor)
+	//rescale back to correct range
+	finalColor = finalColor.Mul(basics.Scalar(1) / basics.Scalar(65535))
 	multiplier = basics.Scalar(basics.Pow(multiplier, specularExponent))
-	if multiplier >= 0.5 {
-		//fmt.Println("mult2 != 0")
-	}
 	finalColor = finalColor.Mul(multiplier)
 	return finalColor
 }
@@ -0,0 +1,77 @@
+package renderer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/entities"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"image/color"
+	"testing"
+)
+
+var lightTestMaterial = graphics.NewMaterial("white", basics.NewVector3(65535, 65535, 65535), basics.Vector3{}, 1)
+
+// lightPoint Returns the color of a point on a surface facing up lit by a light placed in camera space by t
+func lightPoint(light *entities.LightObject, t basics.Transform, position basics.Vector3) basics.Vector3 {
+	up := basics.Up()
+	white := basics.NewVector3(65535, 65535, 65535)
+	forward := basics.Forward()
+	return BlinnPhong(&position, &up, &white, &forward, &lightTestMaterial, []renderLight{newRenderLight(light, &t)})
+}
+
+func TestBlinnPhong_DirectionalLight(t *testing.T) {
+	light := entities.NewDirectionalLightObject("sun", color.RGBA{R: 100, G: 100, B: 100, A: 255})
+	down := basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(0, 90, 0), basics.NewVector3(0, 100, 0))
+	near := lightPoint(light, down, basics.Vector3{})
+	far := lightPoint(light, down, basics.NewVector3(50, -20, 30))
+	assert.True(t, near.Equals(basics.Vector3FromColor(light.Color())), "a surface facing the light gets its full color")
+	assert.True(t, near.Equals(far), "the distance does not change the intensity")
+
+	sideways := basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(90, 0, 0), basics.Vector3{})
+	assert.True(t, lightPoint(light, sideways, basics.Vector3{}).IsZero(), "a light parallel to the surface does not light it")
+}
+
+func TestBlinnPhong_SpotLight(t *testing.T) {
+	light := entities.NewSpotLightObject("spot", color.RGBA{R: 100, G: 100, B: 100, A: 255}, nil, 20, 30)
+	down := basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(0, 90, 0), basics.NewVector3(0, 1, 0))
+	intensity := func(angle basics.Scalar) basics.Scalar {
+		// point on the floor seen from the light at the given angle from the axis of the cone
+		position := basics.NewVector3(basics.Tan(basics.DegToRad(angle)), 0, 0)
+		lit := lightPoint(light, down, position)
+		// remove the cosine of the diffuse term
+		return lit.X / 65535 * 255 / 100 / basics.Cos(basics.DegToRad(angle))
+	}
+	assert.InDelta(t, 1, float64(intensity(0)), 1e-9)
+	assert.InDelta(t, 1, float64(intensity(19)), 1e-9, "inside the inner cone")
+	assert.InDelta(t, 0, float64(intensity(31)), 1e-9, "outside the outer cone")
+	middle := intensity(25)
+	assert.True(t, middle > 0.1 && middle < 0.9, "smooth falloff between the cones")
+	assert.True(t, intensity(22) > middle && middle > intensity(28))
+}
+
+func TestBlinnPhong_HemisphereLight(t *testing.T) {
+	sky := color.RGBA{R: 0, G: 0, B: 200, A: 255}
+	ground := color.RGBA{R: 100, G: 50, B: 0, A: 255}
+	light := entities.NewHemisphereLightObject("sky", sky, ground)
+	lit := func(normal basics.Vector3) basics.Vector3 {
+		white := basics.NewVector3(65535, 65535, 65535)
+		forward := basics.Forward()
+		identity := basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.Vector3{})
+		return BlinnPhong(&basics.Vector3{}, &normal, &white, &forward, &lightTestMaterial, []renderLight{newRenderLight(light, &identity)})
+	}
+	assert.True(t, lit(basics.Up()).Equals(basics.Vector3FromColor(sky)))
+	assert.True(t, lit(basics.Down()).Equals(basics.Vector3FromColor(ground)))
+	skyColor, groundColor := basics.Vector3FromColor(sky), basics.Vector3FromColor(ground)
+	assert.True(t, lit(basics.Right()).Equals(basics.LerpVector3(&groundColor, &skyColor, 0.5)))
+}
+
+func TestLightObject_SetConeAngles(t *testing.T) {
+	light := entities.NewSpotLightObject("spot", color.White, nil, 50, 40)
+	inner, outer := light.ConeAngles()
+	assert.Equal(t, basics.Scalar(40), inner, "the inner angle is limited to the outer one")
+	assert.Equal(t, basics.Scalar(40), outer)
+	light.SetConeAngles(10, 120)
+	inner, outer = light.ConeAngles()
+	assert.Equal(t, basics.Scalar(10), inner)
+	assert.Equal(t, basics.Scalar(90), outer)
+}
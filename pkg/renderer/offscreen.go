@@ -0,0 +1,108 @@
+package renderer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tsagae/software3d/pkg/entities"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ImageFormatPNG = iota
+	ImageFormatJPEG
+	ImageFormatPPM
+)
+
+const jpegQuality = 95
+
+// ImageFormatFromPath Returns the image format matching the extension of path
+func ImageFormatFromPath(path string) (uint8, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return ImageFormatPNG, nil
+	case ".jpg", ".jpeg":
+		return ImageFormatJPEG, nil
+	case ".ppm":
+		return ImageFormatPPM, nil
+	}
+	return 0, fmt.Errorf("unsupported image extension %q", filepath.Ext(path))
+}
+
+// EncodeImageBuffer Writes the image buffer to w in the given format
+func EncodeImageBuffer(w io.Writer, imageBuffer *graphics.ImageBuffer, format uint8) error {
+	switch format {
+	case ImageFormatPNG:
+		return imageBuffer.WritePNG(w)
+	case ImageFormatJPEG:
+		return imageBuffer.WriteJPEG(w, jpegQuality)
+	case ImageFormatPPM:
+		return imageBuffer.WritePPM(w)
+	}
+	return errors.New("invalid image format")
+}
+
+// FramePath Returns the path of a frame given the output path. If outputPath contains a formatting verb (e.g. frame_%03d.png)
+// the frame index is formatted into it, otherwise the index is added before the extension when there is more than one frame
+func FramePath(outputPath string, frame int, frames int) string {
+	if strings.Contains(outputPath, "%") {
+		return fmt.Sprintf(outputPath, frame)
+	}
+	if frames <= 1 {
+		return outputPath
+	}
+	ext := filepath.Ext(outputPath)
+	return fmt.Sprintf("%s_%04d%s", strings.TrimSuffix(outputPath, ext), frame, ext)
+}
+
+// RenderToFiles Renders frames images of the scene graph from camera without a display and writes them to outputPath.
+// The image format is chosen from the extension of outputPath. update, if not nil, is called before rendering every frame
+func RenderToFiles(sceneGraph *entities.SceneGraph, camera *entities.SceneGraphNode, winWidth int, winHeight int, frames int, outputPath string, update func(frame int, sceneGraph *entities.SceneGraph)) error {
+	if winWidth <= 0 || winHeight <= 0 {
+		return fmt.Errorf("invalid resolution %dx%d", winWidth, winHeight)
+	}
+	if frames <= 0 {
+		return fmt.Errorf("invalid number of frames %d", frames)
+	}
+	format, err := ImageFormatFromPath(outputPath)
+	if err != nil {
+		return err
+	}
+
+	r := NewRasterRenderer(camera, winWidth, winHeight)
+	for frame := 0; frame < frames; frame++ {
+		if update != nil {
+			update(frame, sceneGraph)
+		}
+		imageBuffer, err := r.RenderSceneGraph(sceneGraph)
+		if err != nil {
+			return err
+		}
+		err = writeFrame(FramePath(outputPath, frame, frames), imageBuffer, format)
+		imageBuffer.Clear()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFrame(path string, imageBuffer *graphics.ImageBuffer, format uint8) error {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = EncodeImageBuffer(f, imageBuffer, format)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
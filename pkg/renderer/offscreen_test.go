@@ -0,0 +1,36 @@
+package renderer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFramePath(t *testing.T) {
+	assert.Equal(t, "out/frame_007.png", FramePath("out/frame_%03d.png", 7, 10))
+	assert.Equal(t, "render.png", FramePath("render.png", 0, 1))
+	assert.Equal(t, "render_0003.ppm", FramePath("render.ppm", 3, 4))
+}
+
+func TestRenderToFiles(t *testing.T) {
+	sceneGraph := SampleScene()
+	outputPath := filepath.Join(t.TempDir(), "frame_%d.png")
+
+	err := RenderToFiles(sceneGraph, sceneGraph.GetNode("camera"), 80, 60, 2, outputPath, nil)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2; i++ {
+		f, err := os.Open(FramePath(outputPath, i, 2))
+		assert.Nil(t, err)
+		img, err := png.Decode(f)
+		f.Close()
+		assert.Nil(t, err)
+		assert.Equal(t, 80, img.Bounds().Dx())
+		assert.Equal(t, 60, img.Bounds().Dy())
+	}
+
+	err = RenderToFiles(sceneGraph, sceneGraph.GetNode("camera"), 80, 60, 1, filepath.Join(t.TempDir(), "frame.bmp"), nil)
+	assert.NotNil(t, err, "unsupported formats should return an error")
+}
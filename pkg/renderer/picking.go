@@ -0,0 +1,57 @@
+package renderer
+
+import (
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/entities"
+)
+
+// PickResult The triangle of a model under a pixel of the screen
+type PickResult = entities.RayHit
+
+// toViewRay Returns the points on the near and far planes of the camera seen at the screen coordinates x and y, in
+// view space. It's the inverse of toScreen
+func (p *projection) toViewRay(x basics.Scalar, y basics.Scalar, near basics.Scalar, far basics.Scalar) (basics.Vector3, basics.Vector3) {
+	ndcX := (x-p.offsetX)*p.aspectRatio/p.hw - p.aspectRatio
+	ndcY := (y-p.offsetY)/p.hh - 1
+	if p.orthographic {
+		return basics.NewVector3(ndcX/p.scale, ndcY/p.scale, near), basics.NewVector3(ndcX/p.scale, ndcY/p.scale, far)
+	}
+	direction := basics.NewVector3(ndcX/p.scale, ndcY/p.scale, 1)
+	return direction.Mul(near), direction.Mul(far)
+}
+
+// Pick Returns the model and the triangle seen at the pixel (screenX, screenY) of the screen from the camera of the
+// renderer, in the scene graph of the last successful call to RenderSceneGraph or RenderViewports. Like the image
+// buffer, row 0 is the bottom of the screen, window coordinates with the origin at the top must be flipped. The ray
+// goes through the point of the pixel sampled by the rasterizer, from the near plane to the far plane of the camera.
+// Returns false if nothing is hit, no scene graph has been rendered yet or the camera is not valid.
+// The triangles are kept in a bounding volume hierarchy built on the first call, the following calls refit it to the
+// current transforms of the nodes
+func (r *RasterRenderer) Pick(screenX int, screenY int) (PickResult, bool) {
+	camera, err := cameraObjectOf(r.parameters.camera)
+	if err != nil || camera.Validate() != nil || r.pickSceneGraph == nil {
+		return PickResult{}, false
+	}
+	if r.bvh == nil {
+		r.bvh = entities.NewBVH(r.pickSceneGraph)
+	} else {
+		r.bvh.Refit()
+	}
+
+	viewport := NewViewport(r.parameters.camera, 0, 0, r.parameters.winWidth, r.parameters.winHeight)
+	projection := newProjection(camera, &viewport)
+	near, far := projection.toViewRay(basics.Scalar(screenX), basics.Scalar(screenY), camera.Near(), camera.Far())
+	cameraWorldT := r.parameters.camera.WorldTransform()
+	cameraWorldT.ApplyToPoint(&near)
+	cameraWorldT.ApplyToPoint(&far)
+	direction := far.Sub(near)
+	return r.bvh.Intersect(near, direction, 0, direction.Length())
+}
+
+// setPickSceneGraph sets the scene graph used by Pick, the hierarchy of the previous one is discarded
+func (r *RasterRenderer) setPickSceneGraph(sceneGraph *entities.SceneGraph) {
+	if sceneGraph != r.pickSceneGraph {
+		r.pickSceneGraph = sceneGraph
+		r.bvh = nil
+	}
+}
@@ -0,0 +1,55 @@
+package renderer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/entities"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"testing"
+)
+
+func TestRasterRenderer_Pick(t *testing.T) {
+	sceneGraph := cullingTestScene()
+	camera := sceneGraph.GetNode("camera")
+	r := NewRasterRenderer(camera, 80, 60)
+	_, ok := r.Pick(40, 30)
+	assert.False(t, ok, "nothing rendered yet")
+
+	renderRGBA(t, r, sceneGraph)
+	hit, ok := r.Pick(40, 30)
+	assert.True(t, ok)
+	assert.Equal(t, sceneGraph.GetNode("inside"), hit.Node)
+	// the cube at z 5 goes from -1 to 1, its front face is at z 4
+	assert.InDelta(t, 4, float64(hit.Point.Z), 1e-9)
+	assert.InDelta(t, 1, float64(hit.Barycentric.X+hit.Barycentric.Y+hit.Barycentric.Z), 1e-9)
+
+	// the hit point is seen at the point of the pixel sampled by the rasterizer
+	cameraObject, _ := cameraObjectOf(camera)
+	projection := newProjection(cameraObject, &Viewport{Width: 80, Height: 60})
+	screen := projection.toScreen(&hit.Point)
+	assert.InDelta(t, 40.0, float64(screen.X), 1e-6)
+	assert.InDelta(t, 30.0, float64(screen.Y), 1e-6)
+
+	// pixels are picked where a triangle has been drawn
+	cleared := graphics.NewZBuffer(1, 1)
+	cleared.Clear()
+	for y := 0; y < 60; y += 3 {
+		for x := 0; x < 80; x += 3 {
+			_, ok := r.Pick(x, y)
+			assert.Equal(t, r.zBuffer.Get(x, y) != cleared.Get(0, 0), ok, "pixel (%d, %d)", x, y)
+		}
+	}
+
+	// the hierarchy follows the nodes
+	sceneGraph.GetNode("inside").SetLocalTransform(basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, 8)))
+	hit, ok = r.Pick(40, 30)
+	assert.True(t, ok)
+	assert.InDelta(t, 7, float64(hit.Point.Z), 1e-9)
+
+	// a failed render keeps the scene graph of the last successful one
+	_, err := r.RenderSceneGraph(entities.NewSceneGraph())
+	assert.NotNil(t, err, "the camera is not in the scene graph")
+	hit, ok = r.Pick(40, 30)
+	assert.True(t, ok)
+	assert.Equal(t, sceneGraph.GetNode("inside"), hit.Node)
+}
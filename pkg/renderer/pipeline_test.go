@@ -6,7 +6,6 @@ import (
 	"github.com/tsagae/software3d/pkg/entities"
 	"github.com/tsagae/software3d/pkg/graphics"
 	"image/color"
-	"os"
 	"testing"
 	time2 "time"
 )
@@ -15,10 +14,12 @@ func BenchmarkSampleScene(b *testing.B) {
 	sceneGraph := SampleScene()
 	fmt.Println("---------------Benchmark start---------------")
 	fmt.Println("SampleScene: ", sceneGraph.String())
-	var objRenderer = NewRasterRenderer(sceneGraph.GetNode("camera"), 1, 800, 600)
+	var objRenderer = NewRasterRenderer(sceneGraph.GetNode("camera"), 800, 600)
 	b.ResetTimer()
 	time := time2.Now()
-	objRenderer.RenderSceneGraph(sceneGraph)
+	if _, err := objRenderer.RenderSceneGraph(sceneGraph); err != nil {
+		b.Fatal(err)
+	}
 	fmt.Printf("Scene graph: %v\n", time2.Now().Sub(time))
 
 	time = time2.Now()
@@ -28,8 +29,6 @@ func BenchmarkSampleScene(b *testing.B) {
 }
 
 func SampleScene() *entities.SceneGraph {
-	var specularExp basics.Scalar = 600
-
 	sceneGraph := entities.NewSceneGraph()
 
 	meshes := loadMeshes()
@@ -41,17 +40,17 @@ func SampleScene() *entities.SceneGraph {
 	cameraNode := sceneGraph.GetNode("camera")
 	cameraNode.CumulateBeforeLocalTranform(&rotateCameraT)
 
-	quadObj := entities.NewModelObject("quad", meshes["quad"], true, specularExp, true)
+	quadObj := entities.NewModelObject("quad", meshes["quad"], true)
 	sceneGraph.AddChild("world", entities.NewSceneGraphNode(quadObj, "quad"), basics.NewTransform(5, basics.NewQuaternionFromEulerAngles(0, 90, 0), basics.NewVector3(0, 0, 0)))
 
-	planeObj := entities.NewModelObject("planeObj", meshes["plane"], true, specularExp, true)
+	planeObj := entities.NewModelObject("planeObj", meshes["plane"], true)
 
-	cubeObj := entities.NewModelObject("cubeObj", meshes["cube"], true, specularExp, false)
+	cubeObj := entities.NewModelObject("cubeObj", meshes["cube"], true)
 
-	torusObj := entities.NewModelObject("torusObj", meshes["torus"], false, specularExp, false)
+	torusObj := entities.NewModelObject("torusObj", meshes["torus"], false)
 	sceneGraph.AddChild("world", entities.NewSceneGraphNode(torusObj, "torus"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(3, 1, 3)))
 
-	sphereObj := entities.NewModelObject("sphereObj", meshes["sphere"], false, specularExp, false)
+	sphereObj := entities.NewModelObject("sphereObj", meshes["sphere"], false)
 	sceneGraph.AddChild("world", entities.NewSceneGraphNode(cubeObj, "cube"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, 0)))
 	sceneGraph.AddChild("world", entities.NewSceneGraphNode(sphereObj, "sphere"), basics.NewTransform(0.6, basics.NewIdentityQuaternion(), basics.NewVector3(-1, 1, 1)))
 	//sceneGraph.AddChild("world", entities.NewSceneGraphNode(planeObj, "plane2"), basics.NewTransform(2, basics.NewQuaternionFromAngleAndAxis(45, basics.Up()), basics.NewVector3(1, -3, 5)))
@@ -87,37 +86,32 @@ func SampleScene() *entities.SceneGraph {
 
 	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewLightObject("light1", color.RGBA{150, 150, 150, 255}, simpleFallOff), "ligh1"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 5, 0)))
 	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewLightObject("light2", color.RGBA{80, 150, 20, 255}, simpleFallOff), "ligh2"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(2, 2, 2)))
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewHemisphereLightObject("ambient", color.RGBA{30, 30, 30, 255}, color.RGBA{30, 30, 30, 255}), "ambient"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.Vector3{}))
 
 	return sceneGraph
 }
 
 func loadMeshes() map[string]graphics.Mesh {
+	var specularExp basics.Scalar = 600
+	white := basics.Vector3FromColor(color.White)
 
 	meshes := make(map[string]graphics.Mesh)
 
-	meshes["cube"] = readMeshFromFile("../../meshes/cube.obj", color.RGBA{R: 180, G: 25, B: 25, A: 255})
+	meshes["cube"] = readMeshFromFile("../../meshes/cube.obj", graphics.NewMaterial("cube", basics.Vector3FromColor(color.RGBA{R: 180, G: 25, B: 25, A: 255}), white, specularExp))
 
-	meshes["sphere"] = readMeshFromFile("../../meshes/sphere.obj", color.RGBA{B: 180, A: 255})
+	meshes["sphere"] = readMeshFromFile("../../meshes/sphere.obj", graphics.NewMaterial("sphere", basics.Vector3FromColor(color.RGBA{B: 180, A: 255}), white, specularExp))
 
-	meshes["plane"] = readMeshFromFile("../../meshes/lowpolyplane.obj", color.RGBA{R: 70, G: 50, B: 30, A: 255})
+	meshes["plane"] = readMeshFromFile("../../meshes/lowpolyplane.obj", graphics.NewMaterial("plane", basics.Vector3FromColor(color.RGBA{R: 70, G: 50, B: 30, A: 255}), basics.Vector3{}, specularExp))
 
-	meshes["torus"] = readMeshFromFile("../../meshes/torus.obj", color.RGBA{G: 180, A: 255})
+	meshes["torus"] = readMeshFromFile("../../meshes/torus.obj", graphics.NewMaterial("torus", basics.Vector3FromColor(color.RGBA{G: 180, A: 255}), white, specularExp))
 
-	meshes["quad"] = readMeshFromFile("../../meshes/quad.obj", color.RGBA{R: 200, G: 200, B: 30, A: 255})
+	meshes["quad"] = readMeshFromFile("../../meshes/quad.obj", graphics.NewMaterial("quad", basics.Vector3FromColor(color.RGBA{R: 200, G: 200, B: 30, A: 255}), basics.Vector3{}, specularExp))
 
 	return meshes
 }
 
-func readMeshFromFile(fileName string, meshColor color.RGBA) graphics.Mesh {
-	f, err := os.Open(fileName)
-	if err != nil {
-		panic(err)
-	}
-	mesh, err := graphics.NewMeshFromReader(f, basics.Vector3FromColor(meshColor))
-	if err != nil {
-		panic(err)
-	}
-	err = f.Close()
+func readMeshFromFile(fileName string, material graphics.Material) graphics.Mesh {
+	mesh, err := graphics.NewMeshFromFile(fileName, material)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,100 @@
+package renderer
+
+import (
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/entities"
+)
+
+// projection Maps points from the view space of the camera to the screen
+type projection struct {
+	orthographic bool
+	scale        basics.Scalar // 1 / tan(fov / 2) for perspective cameras, 2 / height for orthographic cameras
+	hw           basics.Scalar
+	hh           basics.Scalar
+	aspectRatio  basics.Scalar
+	offsetX      basics.Scalar // bottom left corner of the viewport
+	offsetY      basics.Scalar
+}
+
+// newProjection Returns the projection of the camera on the rectangle of the screen covered by the viewport
+func newProjection(camera *entities.CameraObject, viewport *Viewport) projection {
+	p := projection{
+		orthographic: camera.Orthographic(),
+		hw:           basics.Scalar(viewport.Width) / 2,
+		hh:           basics.Scalar(viewport.Height) / 2,
+		aspectRatio:  viewport.AspectRatio(),
+		offsetX:      basics.Scalar(viewport.X),
+		offsetY:      basics.Scalar(viewport.Y),
+	}
+	if p.orthographic {
+		p.scale = 2 / camera.OrthoHeight()
+	} else {
+		p.scale = 1 / basics.Tan(basics.DegToRad(camera.Fov())/2)
+	}
+	return p
+}
+
+// toScreen Returns the screen coordinates of the point v in x and y. w is the value interpolated linearly on screen to
+// correct the perspective, 1 / depth for perspective cameras and 1 for orthographic ones, z is the depth multiplied by w
+func (p *projection) toScreen(v *basics.Vector3) basics.Vector4 {
+	s := basics.NewVector4(v.X*p.scale, v.Y*p.scale, v.Z, 1)
+	if !p.orthographic {
+		s.X /= v.Z
+		s.Y /= v.Z
+		s.Z = 1
+		s.W = 1 / v.Z
+	}
+	scalePointOnScreen(&s.X, &s.Y, p.hw, p.hh, p.aspectRatio)
+	s.X += p.offsetX
+	s.Y += p.offsetY
+	return s
+}
+
+// viewDirection Returns the direction from the camera to the point v in view space
+func (p *projection) viewDirection(v *basics.Vector3) basics.Vector3 {
+	if p.orthographic {
+		return basics.Forward()
+	}
+	return v.Normalized()
+}
+
+// getViewFrustum Returns the planes delimiting the volume seen by the camera in view space, with the normals pointing
+// inside: bottom, top, right, left, near and far
+func getViewFrustum(camera *entities.CameraObject, aspectRatio basics.Scalar) []basics.Plane {
+	near := basics.Vector3{Z: camera.Near()}
+	far := basics.Vector3{Z: camera.Far()}
+	forward := basics.Forward()
+	backward := basics.Backward()
+	nearPlane := basics.NewPlaneFromPointNormal(&near, &forward)
+	farPlane := basics.NewPlaneFromPointNormal(&far, &backward)
+
+	if camera.Orthographic() {
+		halfHeight := camera.OrthoHeight() / 2
+		halfWidth := halfHeight * aspectRatio
+		up, down, left, right := basics.Up(), basics.Down(), basics.Left(), basics.Right()
+		return []basics.Plane{
+			basics.NewPlaneFromPointNormal(&basics.Vector3{Y: -halfHeight}, &up),   //bottom
+			basics.NewPlaneFromPointNormal(&basics.Vector3{Y: halfHeight}, &down),  //top
+			basics.NewPlaneFromPointNormal(&basics.Vector3{X: halfWidth}, &left),   //right
+			basics.NewPlaneFromPointNormal(&basics.Vector3{X: -halfWidth}, &right), //left
+			nearPlane,
+			farPlane,
+		}
+	}
+
+	// corners of the view plane at distance 1
+	halfHeight := basics.Tan(basics.DegToRad(camera.Fov()) / 2)
+	halfWidth := halfHeight * aspectRatio
+	bottomLeft := basics.Vector3{X: -halfWidth, Y: -halfHeight, Z: 1}
+	bottomRight := basics.Vector3{X: +halfWidth, Y: -halfHeight, Z: 1}
+	topLeft := basics.Vector3{X: -halfWidth, Y: +halfHeight, Z: 1}
+	topRight := basics.Vector3{X: +halfWidth, Y: +halfHeight, Z: 1}
+	return []basics.Plane{
+		basics.NewPlaneFromPoints(&bottomLeft, &basics.Vector3{}, &bottomRight), //bottom
+		basics.NewPlaneFromPoints(&topRight, &basics.Vector3{}, &topLeft),       //top
+		basics.NewPlaneFromPoints(&bottomRight, &basics.Vector3{}, &topRight),   //right
+		basics.NewPlaneFromPoints(&topLeft, &basics.Vector3{}, &bottomLeft),     //left
+		nearPlane,
+		farPlane,
+	}
+}
@@ -0,0 +1,68 @@
+package renderer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/entities"
+	"testing"
+)
+
+// insideFrustum Returns true if the point is in front of all the planes
+func insideFrustum(planes []basics.Plane, point basics.Vector3) bool {
+	for i := range planes {
+		if planes[i].TestPoint(&point) != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGetViewFrustum_Perspective(t *testing.T) {
+	camera := entities.NewPerspectiveCameraObject("camera", 60, 0.5, 10)
+	planes := getViewFrustum(camera, 2)
+	assert.Equal(t, 6, len(planes))
+
+	// tan(30°) ~ 0.577 is the half height of the view plane at distance 1
+	assert.True(t, insideFrustum(planes, basics.NewVector3(0, 0.55, 1)))
+	assert.False(t, insideFrustum(planes, basics.NewVector3(0, 0.6, 1)))
+	assert.True(t, insideFrustum(planes, basics.NewVector3(1.1, 0, 1)))
+	assert.False(t, insideFrustum(planes, basics.NewVector3(1.2, 0, 1)))
+	assert.False(t, insideFrustum(planes, basics.NewVector3(0, 0, 0.4)), "before the near plane")
+	assert.True(t, insideFrustum(planes, basics.NewVector3(0, 0, 9.9)))
+	assert.False(t, insideFrustum(planes, basics.NewVector3(0, 0, 10.1)), "after the far plane")
+}
+
+func TestGetViewFrustum_Orthographic(t *testing.T) {
+	camera := entities.NewOrthographicCameraObject("camera", 4, 0, 10)
+	planes := getViewFrustum(camera, 1.5)
+	assert.True(t, insideFrustum(planes, basics.NewVector3(2.9, 1.9, 9)))
+	assert.False(t, insideFrustum(planes, basics.NewVector3(3.1, 0, 9)))
+	assert.False(t, insideFrustum(planes, basics.NewVector3(0, -2.1, 1)))
+	assert.False(t, insideFrustum(planes, basics.NewVector3(0, 0, -0.1)))
+}
+
+func TestProjection_ToScreen(t *testing.T) {
+	perspective := newProjection(entities.NewPerspectiveCameraObject("camera", 90, 0.1, 100), &Viewport{Width: 200, Height: 100})
+	s := perspective.toScreen(&basics.Vector3{X: 2, Y: -2, Z: 2})
+	assert.True(t, basics.NewVector3(s.X, s.Y, 0).Equals(basics.NewVector3(150, 0, 0)))
+	assert.Equal(t, basics.Scalar(0.5), s.W)
+	assert.Equal(t, basics.Scalar(2), s.Z/s.W, "depth")
+
+	// the depth does not change the position with an orthographic camera
+	ortho := newProjection(entities.NewOrthographicCameraObject("camera", 4, 0.1, 100), &Viewport{Width: 200, Height: 100})
+	for _, z := range []basics.Scalar{1, 50} {
+		s = ortho.toScreen(&basics.Vector3{X: 2, Y: 2, Z: z})
+		assert.True(t, basics.NewVector3(s.X, s.Y, 0).Equals(basics.NewVector3(150, 100, 0)))
+		assert.Equal(t, basics.Scalar(1), s.W)
+		assert.Equal(t, z, s.Z/s.W, "depth")
+	}
+}
+
+func TestProjection_ToScreenViewport(t *testing.T) {
+	camera := entities.NewPerspectiveCameraObject("camera", 90, 0.1, 100)
+	p := newProjection(camera, &Viewport{X: 200, Y: 50, Width: 100, Height: 50})
+	center := p.toScreen(&basics.Vector3{Z: 1})
+	assert.True(t, basics.NewVector3(center.X, center.Y, 0).Equals(basics.NewVector3(250, 75, 0)))
+	topRight := p.toScreen(&basics.Vector3{X: 2, Y: 1, Z: 1})
+	assert.True(t, basics.NewVector3(topRight.X, topRight.Y, 0).Equals(basics.NewVector3(300, 100, 0)))
+}
@@ -0,0 +1,325 @@
+package renderer
+
+import (
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/graphics"
+)
+
+const (
+	subpixelBits    = 8 // vertices are snapped to 1/256 of a pixel, so edge functions are exact
+	subpixelScale   = 1 << subpixelBits
+	rasterBlockSize = 8 // side in pixels of the blocks tested against the edges before the single pixels
+)
+
+// blendState How the pixels of a transparent triangle are combined with the image, nil for opaque triangles
+type blendState struct {
+	mode  uint8
+	alpha uint8 // opacity in the range 0-255
+}
+
+// newBlendState Returns the blend state of the material, nil if it's opaque
+func newBlendState(material *graphics.Material) *blendState {
+	if !material.IsTransparent() {
+		return nil
+	}
+	return &blendState{mode: material.BlendMode, alpha: uint8(basics.Round(basics.Clamp(0, 1, material.Opacity) * 255))}
+}
+
+// edgeFunction Twice the signed area of the triangle formed by an edge and a pixel, positive when the pixel is on the
+// inner side of the edge. Values are in fixed point and are stepped incrementally from a pixel to the next
+type edgeFunction struct {
+	origin int64 // value at the first pixel of the bounding box
+	stepX  int64 // change when moving one pixel right
+	stepY  int64 // change when moving one pixel up
+	bias   int64 // 0 for top and left edges, -1 for the others, so pixels exactly on an edge are drawn by one triangle only
+}
+
+// newEdgeFunction Returns the edge function of the edge from a to b of a counterclockwise triangle, evaluated from
+// the pixel p. All the coordinates are in fixed point
+func newEdgeFunction(ax, ay, bx, by, px, py int64) edgeFunction {
+	dx := bx - ax
+	dy := by - ay
+	e := edgeFunction{
+		origin: dx*(py-ay) - dy*(px-ax),
+		stepX:  -dy * subpixelScale,
+		stepY:  dx * subpixelScale,
+		bias:   -1,
+	}
+	// with counterclockwise winding and y going up, left edges go down and top edges go left
+	if dy < 0 || (dy == 0 && dx < 0) {
+		e.bias = 0
+	}
+	return e
+}
+
+// at Returns the value of the edge function at the pixel that is dx pixels right and dy pixels up from the first one
+func (e *edgeFunction) at(dx int, dy int) int64 {
+	return e.origin + int64(dx)*e.stepX + int64(dy)*e.stepY
+}
+
+func toFixed(s basics.Scalar) int64 {
+	return int64(basics.Round(s * subpixelScale))
+}
+
+// fixedBounds Returns the first and the last pixel, both included, of the bounding box of the vertices in fixed point
+func fixedBounds(x *[3]int64, y *[3]int64) (int, int, int, int) {
+	// shifting right rounds towards minus infinity like floor
+	return int(min(x[0], x[1], x[2]) >> subpixelBits), int(min(y[0], y[1], y[2]) >> subpixelBits),
+		int(max(x[0], x[1], x[2]) >> subpixelBits), int(max(y[0], y[1], y[2]) >> subpixelBits)
+}
+
+// screenBounds Returns the first and the last pixel, both included, that rasterTriangle can draw for the triangle
+func screenBounds(screen *[3]basics.Vector4) (int, int, int, int) {
+	var x, y [3]int64
+	for i := 0; i < 3; i++ {
+		x[i] = toFixed(screen[i].X)
+		y[i] = toFixed(screen[i].Y)
+	}
+	return fixedBounds(&x, &y)
+}
+
+// rasterTriangle t is the triangle in view space, screen contains its vertices projected by projection.toScreen. The
+// attributes are interpolated with perspective correction and passed to fragment to compute the color of each pixel,
+// blend is nil for opaque triangles. Only the pixels from (clipMinX, clipMinY) included to (clipMaxX, clipMaxY)
+// excluded are drawn. With a multisample depth buffer, that must have the same samples as imageBuffer, the coverage
+// and the depth are tested for every sample.
+// Pixels are sampled at integer coordinates and tested with edge functions set up once per triangle, the bounding box
+// is walked in blocks so the blocks outside the triangle are skipped with 4 tests per edge
+func rasterTriangle(t *graphics.Triangle, screen *[3]basics.Vector4, fragment fragmentFunction, blend *blendState, clipMinX int, clipMinY int, clipMaxX int, clipMaxY int, imageBuffer *graphics.ImageBuffer, zBuffer *graphics.ZBuffer) {
+	var x, y [3]int64
+	for i := 0; i < 3; i++ {
+		x[i] = toFixed(screen[i].X)
+		y[i] = toFixed(screen[i].Y)
+	}
+	// Bounding box, samples on the max side are included, they can be on a top edge
+	firstX, firstY, lastX, lastY := fixedBounds(&x, &y)
+	margin := sampleMargin(zBuffer.Samples())
+	startX, startY := max(firstX-margin, clipMinX), max(firstY-margin, clipMinY)
+	endX, endY := min(lastX+1+margin, clipMaxX), min(lastY+1+margin, clipMaxY)
+	if startX >= endX || startY >= endY {
+		return
+	}
+
+	// the edge functions need counterclockwise vertices, order maps them back to the vertices of t
+	order := [3]int{0, 1, 2}
+	area := (x[1]-x[0])*(y[2]-y[0]) - (y[1]-y[0])*(x[2]-x[0])
+	if area == 0 {
+		return // degenerate triangle
+	}
+	if area < 0 {
+		order = [3]int{0, 2, 1}
+		area = -area
+	}
+	originX := int64(startX) * subpixelScale
+	originY := int64(startY) * subpixelScale
+	// edges[i] is opposite to the vertex order[i], so it's proportional to its weight
+	edges := [3]edgeFunction{
+		newEdgeFunction(x[order[1]], y[order[1]], x[order[2]], y[order[2]], originX, originY),
+		newEdgeFunction(x[order[2]], y[order[2]], x[order[0]], y[order[0]], originX, originY),
+		newEdgeFunction(x[order[0]], y[order[0]], x[order[1]], y[order[1]], originX, originY),
+	}
+	invArea := 1 / basics.Scalar(area)
+	if zBuffer.Samples() > 1 {
+		rasterMultisample(t, screen, fragment, blend, &edges, &order, invArea, startX, startY, endX, endY, imageBuffer, zBuffer)
+		return
+	}
+
+	for blockY := startY; blockY < endY; blockY += rasterBlockSize {
+		lastY := min(blockY+rasterBlockSize, endY) - 1
+		for blockX := startX; blockX < endX; blockX += rasterBlockSize {
+			lastX := min(blockX+rasterBlockSize, endX) - 1
+
+			// the edge functions are linear, if an edge is negative at the 4 corners it's negative in the whole block
+			outside := false
+			for i := range edges {
+				e := &edges[i]
+				x0, y0, x1, y1 := blockX-startX, blockY-startY, lastX-startX, lastY-startY
+				if e.at(x0, y0)+e.bias < 0 && e.at(x1, y0)+e.bias < 0 && e.at(x0, y1)+e.bias < 0 && e.at(x1, y1)+e.bias < 0 {
+					outside = true
+					break
+				}
+			}
+			if outside {
+				continue
+			}
+
+			var row [3]int64
+			for i := range edges {
+				row[i] = edges[i].at(blockX-startX, blockY-startY)
+			}
+			for py := blockY; py <= lastY; py++ {
+				e0, e1, e2 := row[0], row[1], row[2]
+				for px := blockX; px <= lastX; px++ {
+					if e0+edges[0].bias >= 0 && e1+edges[1].bias >= 0 && e2+edges[2].bias >= 0 {
+						var w [3]basics.Scalar
+						w[order[0]] = basics.Scalar(e0) * invArea
+						w[order[1]] = basics.Scalar(e1) * invArea
+						w[order[2]] = basics.Scalar(e2) * invArea
+						shadePixel(t, screen, fragment, blend, px, py, w[0], w[1], w[2], imageBuffer, zBuffer)
+					}
+					e0 += edges[0].stepX
+					e1 += edges[1].stepX
+					e2 += edges[2].stepX
+				}
+				row[0] += edges[0].stepY
+				row[1] += edges[1].stepY
+				row[2] += edges[2].stepY
+			}
+		}
+	}
+}
+
+// shadePixel depth tests and draws the pixel at x, y of the triangle with the screen space weights w0, w1, w2. With a
+// nil fragment only the depth is written, discarded pixels don't write the depth. Transparent triangles, with a blend
+// state, are blended with the image and don't write the depth
+func shadePixel(t *graphics.Triangle, screen *[3]basics.Vector4, fragment fragmentFunction, blend *blendState, x int, y int, w0, w1, w2 basics.Scalar, imageBuffer *graphics.ImageBuffer, zBuffer *graphics.ZBuffer) {
+	// w and z are linear in screen space, the attributes are not
+	w := w0*screen[0].W + w1*screen[1].W + w2*screen[2].W
+	z := (w0*screen[0].Z + w1*screen[1].Z + w2*screen[2].Z) / w
+
+	// depth test
+	if zBuffer.Get(x, y) < z { // if the depth buffer has already something closer
+		return
+	}
+
+	if fragment == nil {
+		zBuffer.Set(x, y, z)
+		return
+	}
+
+	pixelColor, discard := shadeFragment(t, screen, fragment, w0, w1, w2)
+	if discard {
+		return
+	}
+
+	if blend != nil {
+		c := pixelColor.ToColor()
+		c.A = blend.alpha
+		imageBuffer.Blend(x, y, c, blend.mode)
+		return
+	}
+	zBuffer.Set(x, y, z)
+	imageBuffer.Set(x, y, pixelColor.ToColor())
+}
+
+// rasterMultisample rasterizes the pixels from startX, startY (included) to endX, endY (excluded) testing the coverage
+// and the depth of every sample of the pattern of the depth buffer. The fragment is shaded once per pixel, at the
+// center of the pattern if it's inside the triangle or at the first covered sample, and its color is written to the
+// samples passing the depth test
+func rasterMultisample(t *graphics.Triangle, screen *[3]basics.Vector4, fragment fragmentFunction, blend *blendState, edges *[3]edgeFunction, order *[3]int, invArea basics.Scalar, startX int, startY int, endX int, endY int, imageBuffer *graphics.ImageBuffer, zBuffer *graphics.ZBuffer) {
+	pattern := samplePatterns[zBuffer.Samples()]
+	// offsets[s][i] is the change of the edge function i from the pixel sample point to the sample s, center is the
+	// change to the center of the pattern
+	offsets := make([][3]int64, len(pattern))
+	var center, maxOffsets [3]int64
+	for i := range edges {
+		// the steps are per pixel and the pattern is in 1/16 of a pixel
+		center[i] = (edges[i].stepX*8 + edges[i].stepY*8) / 16
+		for s, p := range pattern {
+			offsets[s][i] = center[i] + (edges[i].stepX*p[0]+edges[i].stepY*p[1])/16
+			maxOffsets[i] = max(maxOffsets[i], offsets[s][i])
+		}
+	}
+	var depths [8]basics.Scalar
+
+	for blockY := startY; blockY < endY; blockY += rasterBlockSize {
+		lastY := min(blockY+rasterBlockSize, endY) - 1
+		for blockX := startX; blockX < endX; blockX += rasterBlockSize {
+			lastX := min(blockX+rasterBlockSize, endX) - 1
+
+			// same test as rasterTriangle, with the largest offset of the samples towards the inside of each edge
+			outside := false
+			for i := range edges {
+				e := &edges[i]
+				x0, y0, x1, y1 := blockX-startX, blockY-startY, lastX-startX, lastY-startY
+				bias := e.bias + maxOffsets[i]
+				if e.at(x0, y0)+bias < 0 && e.at(x1, y0)+bias < 0 && e.at(x0, y1)+bias < 0 && e.at(x1, y1)+bias < 0 {
+					outside = true
+					break
+				}
+			}
+			if outside {
+				continue
+			}
+
+			for py := blockY; py <= lastY; py++ {
+				for px := blockX; px <= lastX; px++ {
+					e := [3]int64{edges[0].at(px-startX, py-startY), edges[1].at(px-startX, py-startY), edges[2].at(px-startX, py-startY)}
+					// depth test of the covered samples, shading is at the first covered sample unless the center is
+					// covered
+					var covered uint8
+					shadeAt := -1
+					for s := range offsets {
+						o := &offsets[s]
+						e0, e1, e2 := e[0]+o[0], e[1]+o[1], e[2]+o[2]
+						if e0+edges[0].bias < 0 || e1+edges[1].bias < 0 || e2+edges[2].bias < 0 {
+							continue
+						}
+						if shadeAt < 0 {
+							shadeAt = s
+						}
+						var w [3]basics.Scalar
+						w[order[0]] = basics.Scalar(e0) * invArea
+						w[order[1]] = basics.Scalar(e1) * invArea
+						w[order[2]] = basics.Scalar(e2) * invArea
+						z := (w[0]*screen[0].Z + w[1]*screen[1].Z + w[2]*screen[2].Z) / (w[0]*screen[0].W + w[1]*screen[1].W + w[2]*screen[2].W)
+						if zBuffer.GetSample(px, py, s) >= z {
+							covered |= 1 << s
+							depths[s] = z
+						}
+					}
+					if covered == 0 {
+						continue
+					}
+
+					if fragment != nil {
+						o := &center
+						if e[0]+o[0]+edges[0].bias < 0 || e[1]+o[1]+edges[1].bias < 0 || e[2]+o[2]+edges[2].bias < 0 {
+							o = &offsets[shadeAt]
+						}
+						e = [3]int64{e[0] + o[0], e[1] + o[1], e[2] + o[2]}
+						var w [3]basics.Scalar
+						w[order[0]] = basics.Scalar(e[0]) * invArea
+						w[order[1]] = basics.Scalar(e[1]) * invArea
+						w[order[2]] = basics.Scalar(e[2]) * invArea
+						pixelColor, discard := shadeFragment(t, screen, fragment, w[0], w[1], w[2])
+						if discard {
+							continue
+						}
+						c := pixelColor.ToColor()
+						for s := range offsets {
+							if covered&(1<<s) == 0 {
+								continue
+							}
+							if blend != nil {
+								c.A = blend.alpha
+								imageBuffer.BlendSample(px, py, s, c, blend.mode)
+							} else {
+								imageBuffer.SetSample(px, py, s, c)
+							}
+						}
+						if blend != nil {
+							continue
+						}
+					}
+					for s := range offsets {
+						if covered&(1<<s) != 0 {
+							zBuffer.SetSample(px, py, s, depths[s])
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// shadeFragment Returns the color in the range 0-255 of the point of the triangle with the screen space weights w0, w1,
+// w2, or true if the fragment function discards it
+func shadeFragment(t *graphics.Triangle, screen *[3]basics.Vector4, fragment fragmentFunction, w0, w1, w2 basics.Scalar) (basics.Vector3, bool) {
+	// w is linear in screen space, the attributes are not
+	w := w0*screen[0].W + w1*screen[1].W + w2*screen[2].W
+	point := t.InterpolateVertexProps(w0*screen[0].W/w, w1*screen[1].W/w, w2*screen[2].W/w)
+	pixelColor, discard := fragment(&point)
+	// Scaling to uint8 range
+	return pixelColor.Mul(255.0 / 65535.0), discard
+}
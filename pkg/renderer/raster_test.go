@@ -0,0 +1,162 @@
+package renderer
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"math"
+	"testing"
+)
+
+// countingFragment Returns a fragmentFunction that counts the pixels that are drawn
+func countingFragment(count *int) fragmentFunction {
+	return func(fragment *graphics.Vertex) (basics.Vector3, bool) {
+		*count++
+		return basics.NewVector3(65535, 65535, 65535), false
+	}
+}
+
+// screenTriangle Returns a triangle with the same position in view space and on screen, at depth 1
+func screenTriangle(p0, p1, p2 basics.Vector3) (graphics.Triangle, [3]basics.Vector4) {
+	t := graphics.NewTriangle([3]basics.Vector3{p0, p1, p2}, [3]basics.Vector3{})
+	var screen [3]basics.Vector4
+	for i, p := range [3]basics.Vector3{p0, p1, p2} {
+		screen[i] = basics.NewVector4(p.X, p.Y, 1, 1)
+	}
+	return t, screen
+}
+
+func TestRasterTriangle_TopLeftRule(t *testing.T) {
+	center := basics.NewVector3(8, 8, 0)
+	// fans around a center with vertices on the pixel samples and in between, every edge is shared by two triangles
+	fans := map[string][]basics.Vector3{
+		"square": {{X: 2, Y: 2}, {X: 14, Y: 2}, {X: 14, Y: 14}, {X: 2, Y: 14}},
+		"octagon": {{X: 3.5, Y: 1.25}, {X: 12.5, Y: 1.25}, {X: 14.75, Y: 5.5}, {X: 14.75, Y: 10.5}, {X: 12.5, Y: 14.75},
+			{X: 3.5, Y: 14.75}, {X: 1.25, Y: 10.5}, {X: 1.25, Y: 5.5}},
+	}
+	for name, outline := range fans {
+		t.Run(name, func(t *testing.T) {
+			imageBuffer := graphics.NewImageBuffer(16, 16)
+			zBuffer := graphics.NewZBuffer(16, 16)
+			covered := make([]int, 16*16)
+			for i := range outline {
+				zBuffer.Clear()
+				count := 0
+				tri, screen := screenTriangle(center, outline[i], outline[(i+1)%len(outline)])
+				rasterTriangle(&tri, &screen, countingFragment(&count), nil, 0, 0, 16, 16, &imageBuffer, &zBuffer)
+				for p := range covered {
+					if !math.IsInf(float64(zBuffer.Get(p%16, p/16)), 1) {
+						covered[p]++
+					}
+				}
+			}
+			for y := 0; y < 16; y++ {
+				for x := 0; x < 16; x++ {
+					// the samples strictly inside the polygon must be drawn exactly once
+					if inside := x > 3 && x < 13 && y > 3 && y < 13; inside {
+						assert.Equalf(t, 1, covered[y*16+x], "pixel %d, %d", x, y)
+					} else {
+						assert.LessOrEqualf(t, covered[y*16+x], 1, "pixel %d, %d", x, y)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRasterTriangle_MatchesBarycentric(t *testing.T) {
+	// apart from the samples exactly on the edges, the two implementations must draw the same pixels
+	tri, screen := screenTriangle(basics.NewVector3(1.3, 2.7, 0), basics.NewVector3(40.2, 10.1, 0), basics.NewVector3(17.9, 35.6, 0))
+	for _, reversed := range []bool{false, true} {
+		if reversed {
+			tri[1], tri[2] = tri[2], tri[1]
+			screen[1], screen[2] = screen[2], screen[1]
+		}
+		var edgeCount, barycentricCount int
+		imageBuffer := graphics.NewImageBuffer(48, 48)
+		zBuffer := graphics.NewZBuffer(48, 48)
+		zBuffer.Clear()
+		rasterTriangle(&tri, &screen, countingFragment(&edgeCount), nil, 0, 0, 48, 48, &imageBuffer, &zBuffer)
+		zBuffer.Clear()
+		rasterTriangleBarycentric(&tri, &screen, countingFragment(&barycentricCount), nil, 0, 0, 48, 48, &imageBuffer, &zBuffer)
+		assert.NotZero(t, edgeCount)
+		assert.Equal(t, barycentricCount, edgeCount)
+	}
+}
+
+// rasterTriangleBarycentric The previous implementation of rasterTriangle, that solves the barycentric weights of every
+// pixel in the bounding box. Kept as a reference for the benchmarks
+func rasterTriangleBarycentric(t *graphics.Triangle, screen *[3]basics.Vector4, fragment fragmentFunction, blend *blendState, clipMinX int, clipMinY int, clipMaxX int, clipMaxY int, imageBuffer *graphics.ImageBuffer, zBuffer *graphics.ZBuffer) {
+	// Bounding box
+	maxX, minX, maxY, minY := getMaxMin(screen[0], screen[1], screen[2])
+	minX = basics.Clamp(basics.Scalar(clipMinX), basics.Scalar(clipMaxX), basics.Floor(minX))
+	minY = basics.Clamp(basics.Scalar(clipMinY), basics.Scalar(clipMaxY), basics.Floor(minY))
+
+	maxX = basics.Clamp(basics.Scalar(clipMinX), basics.Scalar(clipMaxX), basics.Ceil(maxX))
+	maxY = basics.Clamp(basics.Scalar(clipMinY), basics.Scalar(clipMaxY), basics.Ceil(maxY))
+
+	v0 := basics.NewVector3(screen[0].X, screen[0].Y, 0)
+	v1 := basics.NewVector3(screen[1].X, screen[1].Y, 0)
+	v2 := basics.NewVector3(screen[2].X, screen[2].Y, 0)
+
+	// Test for each pixel in the bounding box from top left to bottom right
+	for y := int(minY); y < int(maxY); y++ {
+		for x := int(minX); x < int(maxX); x++ {
+			target2D := basics.NewVector3(basics.Scalar(x), basics.Scalar(y), 0)
+			// find weights for interpolation
+			w0, w1, w2 := basics.FindWeights2D(&v0, &v1, &v2, &target2D)
+			if w0 < 0 || w1 < 0 || w2 < 0 {
+				continue // point lands outside the triangle
+			}
+			shadePixel(t, screen, fragment, blend, x, y, w0, w1, w2, imageBuffer, zBuffer)
+		}
+	}
+}
+
+// rasterJobsOfMesh Returns the triangles of a golden single mesh scene ready to be rasterized
+func rasterJobsOfMesh(meshName string, width int, height int) []rasterJob {
+	sceneGraph := goldenSingleMeshScene(meshName, 1, false)()
+	camera := sceneGraph.GetNode("camera")
+	r := NewRasterRenderer(camera, width, height)
+	cameraObj, err := cameraObjectOf(camera)
+	if err != nil {
+		panic(err)
+	}
+	viewport := NewViewport(camera, 0, 0, width, height)
+	r.setupCamera(cameraObj, &viewport)
+	inverseCameraT := camera.WorldTransform()
+	inverseCameraT.ThisInvert()
+	items, lights := getAllItemsToRender(sceneGraph, &inverseCameraT)
+	for _, item := range items {
+		r.renderSingleItem(item, lights)
+	}
+	return r.jobs
+}
+
+func BenchmarkRasterTriangle(b *testing.B) {
+	const width, height = 800, 600
+	implementations := []struct {
+		name   string
+		raster func(t *graphics.Triangle, screen *[3]basics.Vector4, fragment fragmentFunction, blend *blendState, clipMinX int, clipMinY int, clipMaxX int, clipMaxY int, imageBuffer *graphics.ImageBuffer, zBuffer *graphics.ZBuffer)
+	}{
+		{"edge", rasterTriangle},
+		{"barycentric", rasterTriangleBarycentric},
+	}
+	for _, meshName := range []string{"cube", "sphere", "torus"} {
+		jobs := rasterJobsOfMesh(meshName, width, height)
+		for _, implementation := range implementations {
+			b.Run(fmt.Sprintf("%s/%s", meshName, implementation.name), func(b *testing.B) {
+				imageBuffer := graphics.NewImageBuffer(width, height)
+				zBuffer := graphics.NewZBuffer(width, height)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					zBuffer.Clear()
+					for j := range jobs {
+						implementation.raster(&jobs[j].triangle, &jobs[j].screen, jobs[j].fragment, jobs[j].blend, 0, 0, width, height, &imageBuffer, &zBuffer)
+					}
+				}
+			})
+		}
+	}
+}
@@ -1,59 +1,105 @@
 package renderer
 
 import (
+	"errors"
+	"fmt"
 	"github.com/tsagae/software3d/pkg/basics"
 	"github.com/tsagae/software3d/pkg/entities"
 	"github.com/tsagae/software3d/pkg/graphics"
+	"runtime"
 )
 
 type RasterRenderer struct {
-	parameters  Parameters
-	zBuffer     graphics.ZBuffer
-	imageBuffer graphics.ImageBuffer
+	parameters      Parameters
+	zBuffer         graphics.ZBuffer
+	imageBuffer     graphics.ImageBuffer
+	sampleBuffer    graphics.ImageBuffer // colors of the samples with MSAA, resolved into imageBuffer
+	jobs            []rasterJob          // triangles of the current frame waiting to be rasterized
+	transparentJobs []rasterJob          // transparent triangles, sorted and rasterized after jobs
+	tiles           []tile
+	shadowMaps      map[*entities.LightObject]*shadowMap // reused between frames
+	wirePositions   []basics.Vector3                     // vertices of the model drawn in wireframe, reused between models
+	cullingStats    CullingStats                         // of the last frame
+	pickSceneGraph  *entities.SceneGraph                 // scene graph of the last frame, used by Pick
+	bvh             *entities.BVH                        // triangles of pickSceneGraph, built by the first Pick
 }
 
-func NewRasterRenderer(camera *entities.SceneGraphNode, planeZ basics.Scalar, winWidth int, winHeight int) *RasterRenderer {
-	inverseCameraT := camera.WorldTransform()
-	inverseCameraT.ThisInvert()
-	return &RasterRenderer{
+var (
+	ErrNoCamera   = errors.New("no camera set")
+	ErrNotACamera = errors.New("the node does not hold a camera object")
+	ErrBadCamera  = errors.New("the camera can't be used for rendering")
+)
+
+// NewRasterRenderer Returns a renderer that renders the scene from camera, a node holding a CameraObject. The camera is
+// validated when rendering, it can be changed with SetCamera
+func NewRasterRenderer(camera *entities.SceneGraphNode, winWidth int, winHeight int) *RasterRenderer {
+	r := &RasterRenderer{
 		parameters: Parameters{
-			camera:                 camera,
-			planeZ:                 planeZ,
-			winWidth:               winWidth,
-			winHeight:              winHeight,
-			aspectRatio:            basics.Scalar(winWidth) / basics.Scalar(winHeight),
-			hw:                     basics.Scalar(winWidth) / 2,
-			hh:                     basics.Scalar(winHeight) / 2,
-			inverseCameraTransform: inverseCameraT,
-			viewFrustumSides:       getViewFrustumSides(basics.Scalar(winWidth) / basics.Scalar(winHeight)),
-			renderMode:             RendermodeNormal,
+			camera:         camera,
+			winWidth:       winWidth,
+			winHeight:      winHeight,
+			renderMode:     RendermodeNormal,
+			workers:        runtime.NumCPU(),
+			tileSize:       defaultTileSize,
+			wireframe:      DefaultWireframeSettings(),
+			frustumCulling: true,
 		},
 		zBuffer:     graphics.NewZBuffer(winWidth, winHeight),
 		imageBuffer: graphics.NewImageBuffer(winWidth, winHeight),
+		tiles:       newTiles(winWidth, winHeight, defaultTileSize),
 	}
+	r.zBuffer.Clear()
+	return r
 }
 
 func (r *RasterRenderer) SetRenderMode(renderMode uint8) {
 	r.parameters.renderMode = renderMode
 }
 
-func (r *RasterRenderer) RenderSceneGraph(sceneGraph *entities.SceneGraph) *graphics.ImageBuffer {
-	inverseCameraT := sceneGraph.GetNode("camera").WorldTransform()
-	inverseCameraT.ThisInvert()
-	itemsToRender, lightsToRender := getAllItemsToRender(sceneGraph, &inverseCameraT)
-
-	for _, item := range itemsToRender {
-		switch r.parameters.renderMode {
-		case RendermodeNormal:
-			r.renderSingleItem(item, lightsToRender)
-		case RendermodeWireframe:
-			r.renderSingleItemWireFrame(item)
-		default:
-			panic("invalid Rendermode")
-		}
+// SetCamera Sets the node the scene is rendered from. Returns an error and keeps the current camera if the node does not
+// hold a CameraObject
+func (r *RasterRenderer) SetCamera(camera *entities.SceneGraphNode) error {
+	if _, err := cameraObjectOf(camera); err != nil {
+		return err
 	}
-	r.zBuffer.Clear()
-	return &r.imageBuffer
+	r.parameters.camera = camera
+	return nil
+}
+
+// Camera Returns the node the scene is rendered from
+func (r *RasterRenderer) Camera() *entities.SceneGraphNode {
+	return r.parameters.camera
+}
+
+// RenderSceneGraph Renders the scene graph from the camera of the renderer on the whole screen. Returns an error if the
+// camera is not set, does not hold a CameraObject or is not part of the scene graph
+func (r *RasterRenderer) RenderSceneGraph(sceneGraph *entities.SceneGraph) (*graphics.ImageBuffer, error) {
+	viewport := NewViewport(r.parameters.camera, 0, 0, r.parameters.winWidth, r.parameters.winHeight)
+	r.cullingStats = CullingStats{}
+	if err := r.renderViewport(sceneGraph, &viewport); err != nil {
+		return nil, err
+	}
+	r.setPickSceneGraph(sceneGraph)
+	return &r.imageBuffer, nil
+}
+
+// setupCamera builds the view frustum and the projection from the settings of the camera and the viewport
+func (r *RasterRenderer) setupCamera(camera *entities.CameraObject, viewport *Viewport) {
+	r.parameters.viewport = *viewport
+	r.parameters.viewFrustumSides = getViewFrustum(camera, viewport.AspectRatio())
+	r.parameters.projection = newProjection(camera, viewport)
+}
+
+// cameraObjectOf Returns the camera object held by the node
+func cameraObjectOf(node *entities.SceneGraphNode) (*entities.CameraObject, error) {
+	if node == nil {
+		return nil, ErrNoCamera
+	}
+	camera, ok := node.GameObject.(*entities.CameraObject)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNotACamera, node.Name())
+	}
+	return camera, nil
 }
 
 func (r *RasterRenderer) renderSingleItem(item renderItem, lights []renderLight) {
@@ -71,13 +117,31 @@ func (r *RasterRenderer) renderSingleItem(item renderItem, lights []renderLight)
 		}
 	}
 
+	shader := item.modelObject.Shader()
+	if shader == nil {
+		shader = gouraudShader
+		if r.parameters.renderMode == RendermodePhong || item.modelObject.PerPixelLighting() {
+			shader = phongShader
+		}
+	}
+	var material *graphics.Material
+	var context *shaderContext
+	var fragment fragmentFunction
+	var blend *blendState
+
 	for iterator.HasNext() {
 		// Translate triangle in view space
 		var t graphics.Triangle
 		t = nextFunc()
+		if m := iterator.Material(); m != material {
+			material = m
+			context = r.newShaderContext(material, lights)
+			fragment = shaderFragment(shader, context)
+			blend = newBlendState(material)
+		}
 		t.ThisApplyTransformation(&item.completeTransform)
 
-		triangles := ClipTriangleAgainstPlanes(&t, r.parameters.viewFrustumSides)
+		triangles := ClipTriangleAgainstPlanes(&t, item.clipPlanes)
 
 		for _, t := range triangles {
 			for _, vertex := range t {
@@ -86,80 +150,29 @@ func (r *RasterRenderer) renderSingleItem(item renderItem, lights []renderLight)
 				}
 			}
 
-			lightTriangle(&t, &item, lights)
+			for i := range t {
+				shader.Vertex(&t[i], context)
+			}
 
-			projectTriangle(&t)
+			screen := projectTriangleOnScreen(&t, &r.parameters.projection)
 
 			// Back face culling
-			triangleNormal := t.GetSurfaceNormal()
-			forward := basics.Forward()
-			if forward.Dot(triangleNormal) > 0 {
+			if isBackFacing(&screen) {
 				continue
 			}
 
-			// Correct scaling for the aspect ratio
-			scaleTriangleOnScreen(&t, r.parameters.hw, r.parameters.hh, r.parameters.aspectRatio)
-
-			rasterTriangle(t, r.parameters.winWidth, r.parameters.winHeight, &r.imageBuffer, &r.zBuffer)
+			r.queueTriangle(&t, &screen, fragment, blend)
 		}
 	}
 }
 
-func (r *RasterRenderer) renderSingleItemWireFrame(item renderItem) {
-	mesh := item.modelObject.Mesh()
-	iterator := mesh.Iterator()
-	var t graphics.Triangle
-	for iterator.HasNext() {
-
-		// Translate triangle in view space
-		t = iterator.Next()
-		t.ThisApplyTransformation(&item.completeTransform)
-
-		triangles := ClipTriangleAgainstPlanes(&t, r.parameters.viewFrustumSides)
-
-		for _, triangle := range triangles {
-
-			for i := 0; i < 3; i++ {
-				p0 := projectPointOnViewPlane(&triangle[i].Position)
-				p1 := projectPointOnViewPlane(&triangle[(i+1)%3].Position)
-				scalePointOnScreen(&p0.X, &p0.Y, r.parameters.hw, r.parameters.hh, r.parameters.aspectRatio)
-				scalePointOnScreen(&p1.X, &p1.Y, r.parameters.hw, r.parameters.hh, r.parameters.aspectRatio)
-				drawLine(&p0, &p1, &r.imageBuffer)
-			}
-		}
-	}
-}
-
-func rasterTriangle(t graphics.Triangle, winWidth int, winHeight int, imageBuffer *graphics.ImageBuffer, zBuffer *graphics.ZBuffer) {
-	// Bounding box
-	maxX, minX, maxY, minY := getMaxMin(t[0].Position, t[1].Position, t[2].Position)
-	minX = basics.Clamp(0, basics.Scalar(winWidth), basics.Floor(minX))
-	minY = basics.Clamp(0, basics.Scalar(winHeight), basics.Floor(minY))
-
-	maxX = basics.Clamp(0, basics.Scalar(winWidth), basics.Ceil(maxX))
-	maxY = basics.Clamp(0, basics.Scalar(winHeight), basics.Ceil(maxY))
-
-	// Test for each pixel in the bounding box from top left to bottom right
-	for y := int(minY); y < int(maxY); y++ {
-		for x := int(minX); x < int(maxX); x++ {
-			target2D := basics.NewVector3(basics.Scalar(x), basics.Scalar(y), 0)
-			// find weights for interpolation
-			w0, w1, w2 := basics.FindWeights2D(&t[0].Position, &t[1].Position, &t[2].Position, &target2D)
-			if w0 < 0 || w1 < 0 || w2 < 0 {
-				continue // point lands outside the triangle
-			}
-			point := t.InterpolateVertexProps(w0, w1, w2)
-
-			// depth test
-			if zBuffer.Get(x, y) < point.Position.Z { // if the depth buffer has already something closer
-				continue
-			}
-
-			zBuffer.Set(x, y, point.Position.Z)
-
-			// Scaling to uint8 range
-			point.Color = point.Color.Mul(255.0 / 65535.0) // was: colorVector.ThisMul(1 / 65535.0); colorVector.ThisMul(255.0)
-			imageBuffer.Set(x, y, point.Color.ToColor())
-		}
+// newShaderContext Returns the context of the shaders for the triangles of the material in the current viewport
+func (r *RasterRenderer) newShaderContext(material *graphics.Material, lights []renderLight) *shaderContext {
+	return &shaderContext{
+		material:   material,
+		lights:     lights,
+		projection: &r.parameters.projection,
+		near:       r.parameters.viewFrustumSides[4].Point.Z,
+		far:        r.parameters.viewFrustumSides[5].Point.Z,
 	}
 }
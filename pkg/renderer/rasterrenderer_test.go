@@ -0,0 +1,125 @@
+package renderer
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/entities"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestRasterRenderer_CameraErrors(t *testing.T) {
+	sceneGraph := SampleScene()
+
+	_, err := NewRasterRenderer(nil, 80, 60).RenderSceneGraph(sceneGraph)
+	assert.True(t, errors.Is(err, ErrNoCamera), "missing camera node")
+
+	_, err = NewRasterRenderer(sceneGraph.GetNode("cube"), 80, 60).RenderSceneGraph(sceneGraph)
+	assert.True(t, errors.Is(err, ErrNotACamera), "node without a camera object")
+
+	other := entities.NewSceneGraphNode(entities.NewCameraObject("other"), "other")
+	_, err = NewRasterRenderer(other, 80, 60).RenderSceneGraph(sceneGraph)
+	assert.NotNil(t, err, "camera outside of the scene graph")
+
+	camera := sceneGraph.GetNode("camera")
+	r := NewRasterRenderer(camera, 80, 60)
+	sceneGraph.RemoveChild("camera")
+	_, err = r.RenderSceneGraph(sceneGraph)
+	assert.NotNil(t, err, "camera removed from the scene graph")
+
+	sceneGraph = SampleScene()
+	cameraObj := sceneGraph.GetNode("camera").GameObject.(*entities.CameraObject)
+	r = NewRasterRenderer(sceneGraph.GetNode("camera"), 80, 60)
+	for name, set := range map[string]func(){
+		"near 0":        func() { cameraObj.SetClipDistances(0, 100) },
+		"negative near": func() { cameraObj.SetClipDistances(-1, 100) },
+		"near over far": func() { cameraObj.SetClipDistances(10, 5) },
+		"fov 180":       func() { cameraObj.SetFov(180) },
+		"fov 0":         func() { cameraObj.SetFov(0) },
+	} {
+		*cameraObj = *entities.NewPerspectiveCameraObject(cameraObj.Name(), entities.DefaultCameraFov, 0.1, 100)
+		set()
+		_, err = r.RenderSceneGraph(sceneGraph)
+		assert.Truef(t, errors.Is(err, ErrBadCamera), "%s: %v", name, err)
+	}
+	// orthographic cameras can have the near plane behind them
+	*cameraObj = *entities.NewOrthographicCameraObject(cameraObj.Name(), 4, -1, 100)
+	_, err = r.RenderSceneGraph(sceneGraph)
+	assert.Nil(t, err)
+	cameraObj.SetOrthoHeight(0)
+	_, err = r.RenderSceneGraph(sceneGraph)
+	assert.True(t, errors.Is(err, ErrBadCamera), "orthographic camera without height")
+}
+
+func TestRasterRenderer_SetCamera(t *testing.T) {
+	sceneGraph := SampleScene()
+	topCamera := entities.NewSceneGraphNode(entities.NewCameraObject("topCamera"), "top")
+	sceneGraph.AddChild("world", topCamera, basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(0, 60, 0), basics.NewVector3(0, 6, -4)))
+
+	r := NewRasterRenderer(sceneGraph.GetNode("camera"), 80, 60)
+	fromMain := renderRGBA(t, r, sceneGraph).Pix
+	r.imageBuffer.Clear()
+
+	assert.True(t, errors.Is(r.SetCamera(sceneGraph.GetNode("cube")), ErrNotACamera))
+	assert.Equal(t, sceneGraph.GetNode("camera"), r.Camera(), "a failed SetCamera keeps the current camera")
+	assert.True(t, errors.Is(r.SetCamera(nil), ErrNoCamera))
+
+	assert.Nil(t, r.SetCamera(topCamera))
+	assert.Equal(t, topCamera, r.Camera())
+	fromTop := renderRGBA(t, r, sceneGraph).Pix
+	assert.NotEqual(t, fromMain, fromTop)
+	assert.Equal(t, renderRGBA(t, NewRasterRenderer(topCamera, 80, 60), sceneGraph).Pix, fromTop)
+}
+
+// transparencyTestScene Unlit quads facing the camera, from the closest: green with 0.5 opacity at z 0, red with 0.5
+// opacity at z 0.5 and opaque blue at blueZ. The quads are added to the scene in the given order
+func transparencyTestScene(order []string, blueZ basics.Scalar) *entities.SceneGraph {
+	sceneGraph := entities.NewSceneGraph()
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewCameraObject("camera"), "camera"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, -2)))
+	quads := map[string]struct {
+		color   basics.Vector3
+		opacity basics.Scalar
+		z       basics.Scalar
+	}{
+		"green": {basics.NewVector3(0, 65535, 0), 0.5, 0},
+		"red":   {basics.NewVector3(65535, 0, 0), 0.5, 0.5},
+		"blue":  {basics.NewVector3(0, 0, 65535), 1, blueZ},
+	}
+	for _, name := range order {
+		quad := quads[name]
+		material := graphics.NewMaterial(name, quad.color, basics.Vector3{}, 1)
+		material.Opacity = quad.opacity
+		mesh, err := graphics.NewMeshFromReader(strings.NewReader(goldenTexturedQuad), material)
+		if err != nil {
+			panic(err)
+		}
+		model := entities.NewModelObject(name, mesh, false)
+		model.SetShader(&UnlitShader{})
+		faceCamera := basics.NewQuaternionFromEulerAngles(0, -90, 0)
+		sceneGraph.AddChild("world", entities.NewSceneGraphNode(model, name), basics.NewTransform(1, faceCamera, basics.NewVector3(0, 0, quad.z)))
+	}
+	return sceneGraph
+}
+
+func TestRasterRenderer_Transparency(t *testing.T) {
+	var images [][]uint8
+	for _, order := range [][]string{{"green", "red", "blue"}, {"blue", "red", "green"}, {"red", "blue", "green"}} {
+		sceneGraph := transparencyTestScene(order, 1)
+		r := NewRasterRenderer(sceneGraph.GetNode("camera"), 40, 30)
+		images = append(images, renderRGBA(t, r, sceneGraph).Pix)
+		// blue, then red and green blended over it by half
+		assertColor(t, color.RGBA{R: 64, G: 127, B: 64, A: 255}, r.imageBuffer.Get(20, 15), "%v", order)
+		assert.InDelta(t, 3, float64(r.zBuffer.Get(20, 15)), 1e-9, "transparent triangles don't write the depth")
+	}
+	assert.Equal(t, images[0], images[1], "the result does not depend on the order of the scene")
+	assert.Equal(t, images[0], images[2])
+
+	// transparent triangles behind opaque ones are hidden
+	sceneGraph := transparencyTestScene([]string{"green", "red", "blue"}, -1)
+	r := NewRasterRenderer(sceneGraph.GetNode("camera"), 40, 30)
+	renderRGBA(t, r, sceneGraph)
+	assertColor(t, color.RGBA{B: 255, A: 255}, r.imageBuffer.Get(20, 15))
+}
@@ -4,43 +4,54 @@ import (
 	"github.com/tsagae/software3d/pkg/basics"
 	"github.com/tsagae/software3d/pkg/entities"
 	"github.com/tsagae/software3d/pkg/graphics"
-	"image/color"
 )
 
 const (
-	RendermodeNormal = iota
-	RendermodeWireframe
+	RendermodeNormal          = iota // Lighting computed at the vertices and interpolated (Gouraud shading)
+	RendermodeWireframe              // Edges of the meshes, see WireframeSettings
+	RendermodePhong                  // Normals interpolated and lighting computed for each pixel
+	RendermodeShadedWireframe        // Gouraud shading with the visible edges drawn over it
 )
 
-// Parameters Near clip plane is always assumed to be at (0,0,1) looking at (0,0,1)
+// Parameters The view frustum and the projection are built from the camera object and the viewport before rendering
+// every viewport
 type Parameters struct {
-	camera                 *entities.SceneGraphNode
-	planeZ                 basics.Scalar
-	winWidth               int
-	winHeight              int
-	aspectRatio            basics.Scalar
-	hw                     basics.Scalar
-	hh                     basics.Scalar
-	inverseCameraTransform basics.Transform
-	viewFrustumSides       []basics.Plane
-	renderMode             uint8
+	camera           *entities.SceneGraphNode
+	winWidth         int
+	winHeight        int
+	viewport         Viewport // viewport being rendered
+	viewFrustumSides []basics.Plane
+	projection       projection
+	renderMode       uint8
+	workers          int // goroutines rasterizing the tiles
+	tileSize         int
+	antialiasing     uint8
+	wireframe        WireframeSettings
+	frustumCulling   bool
 }
 
+// fragmentFunction Returns the color (range 0-65535) of a pixel from the vertex attributes interpolated in view space,
+// or true if the pixel is discarded
+type fragmentFunction func(fragment *graphics.Vertex) (basics.Vector3, bool)
+
 type renderItem struct {
 	modelObject       *entities.ModelObject
 	completeTransform basics.Transform
+	clipPlanes        []basics.Plane // planes of the view frustum crossing the model, nil if it's entirely inside
 	//distanceFromCamera basics.Scalar //probably unnecessary, could use the z of cameraViewTransform
 }
 
+// renderLight A light with its position and direction in camera space and the values used for every lit point
 type renderLight struct {
-	light    *entities.LightObject
-	position basics.Vector3 //position in camera space
-}
-
-func scaleTriangleOnScreen(triangle *graphics.Triangle, hw, hh, aspectRatio basics.Scalar) {
-	for i := 0; i < 3; i++ {
-		scalePointOnScreen(&triangle[i].Position.X, &triangle[i].Position.Y, hw, hh, aspectRatio)
-	}
+	light       *entities.LightObject
+	transform   basics.Transform // from the space of the light node to camera space
+	position    basics.Vector3   //position in camera space
+	direction   basics.Vector3   // +z of the node for directional and spot lights, +y for hemisphere lights
+	color       basics.Vector3
+	groundColor basics.Vector3
+	cosInner    basics.Scalar // cosines of the half angles of the cone of spot lights
+	cosOuter    basics.Scalar
+	shadow      *shadowMap // nil if the light does not cast shadows or the model does not receive them
 }
 
 // modifies x and y
@@ -51,17 +62,8 @@ func scalePointOnScreen(x *basics.Scalar, y *basics.Scalar, hw basics.Scalar, hh
 	*y *= hh
 }
 
-func projectPointOnViewPlane(p *basics.Vector3) basics.Vector3 {
-	//camera is assumed to be in (0,0,0) in its local space
-	//center of the view plane is assumed to be at (x: 0, y: 0, z: 1)
-	d := *p
-	d.X /= d.Z
-	d.Y /= d.Z
-	return d
-}
-
 // Returns maxX, minX, maxY, minY
-func getMaxMin(p0, p1, p2 basics.Vector3) (basics.Scalar, basics.Scalar, basics.Scalar, basics.Scalar) {
+func getMaxMin(p0, p1, p2 basics.Vector4) (basics.Scalar, basics.Scalar, basics.Scalar, basics.Scalar) {
 	maxX := max(p0.X, p1.X, p2.X)
 	minX := min(p0.X, p1.X, p2.X)
 	maxY := max(p0.Y, p1.Y, p2.Y)
@@ -90,10 +92,7 @@ func getAllItemsToRender(sceneGraph *entities.SceneGraph, inverseCameraTransform
 				completeTransform: objectCameraT,
 			})
 		case *entities.LightObject:
-			lightsToRender = append(lightsToRender, renderLight{
-				v,
-				objectCameraT.Translation,
-			})
+			lightsToRender = append(lightsToRender, newRenderLight(v, &objectCameraT))
 		}
 
 		queue = append(queue, node.Children()...)
@@ -101,82 +100,16 @@ func getAllItemsToRender(sceneGraph *entities.SceneGraph, inverseCameraTransform
 	return nodesToRender, lightsToRender
 }
 
-func lightTriangle(t *graphics.Triangle, item *renderItem, lights []renderLight) {
-	ambientLightColor := basics.Vector3FromColor(color.RGBA{R: 30, G: 30, B: 30, A: 255})
-	forward := basics.Forward()
-	TriangleNormalsPhong(t, &forward, &ambientLightColor, item.modelObject.SpecularExponent(), lights, color.RGBA64{R: 1, G: 1, B: 1, A: 255}, item.modelObject.IgnoreSpecular())
-}
-
-func projectTriangle(t *graphics.Triangle) {
-	// Translate triangle in clip space:
-	// top left: (-1, +1) | bottom right: (+1, -1) | center: (0, 0)
+// projectTriangleOnScreen Returns the screen coordinates of the vertices of t, that is in view space
+func projectTriangleOnScreen(t *graphics.Triangle, projection *projection) [3]basics.Vector4 {
+	var screen [3]basics.Vector4
 	for i := 0; i < 3; i++ {
-		t[i].Position = projectPointOnViewPlane(&t[i].Position)
+		screen[i] = projection.toScreen(&t[i].Position)
 	}
+	return screen
 }
 
-// Renders a line in clip space
-func drawLine(v0, v1 *basics.Vector3, iBuf *graphics.ImageBuffer) {
-	y0 := v0.Y
-	y1 := v1.Y
-	x0 := v0.X
-	x1 := v1.X
-
-	dx := x1 - x0
-	dy := y1 - y0
-
-	if basics.Abs(dx) > basics.Abs(dy) {
-		if v0.X > v1.X {
-			v0, v1 = v1, v0
-		}
-		if dx == 0 {
-			return
-		}
-		genericDrawLine(v0.X, v1.X, v0.Y, dy/dx, basics.Scalar(iBuf.Width()), basics.Scalar(iBuf.Height()), func(a int, b int, c color.RGBA) {
-			iBuf.Set(a, b, c)
-		})
-	} else {
-		if v0.Y > v1.Y {
-			v0, v1 = v1, v0
-		}
-		if dy == 0 {
-			return
-		}
-		genericDrawLine(v0.Y, v1.Y, v0.X, dx/dy, basics.Scalar(iBuf.Height()), basics.Scalar(iBuf.Width()), func(a int, b int, c color.RGBA) {
-			iBuf.Set(b, a, c)
-		})
-	}
-}
-
-// a0, a1: start and end points on the same axis
-// b0: start on the other axis
-// m: slope
-// aMaxCanvas, bMaxCanvas first value outside of canvas for the two axis
-// requires a0 <= a1
-func genericDrawLine(a0, a1, b0, m, aMaxCanvas, bMaxCanvas basics.Scalar, setImage func(int, int, color.RGBA)) {
-	b := b0
-	for a := a0; a <= a1; a++ {
-		if a < 0 || b < 0 || a >= aMaxCanvas || b >= bMaxCanvas {
-			continue
-		}
-		setImage(int(a), int(b), color.RGBA{R: 255, G: 255, B: 255})
-		b += m
-	}
-}
-
-func getViewFrustumSides(aspectRatio basics.Scalar) []basics.Plane {
-	{
-		bottomLeft := basics.Vector3{X: -aspectRatio, Y: -1, Z: 1}
-		bottomRight := basics.Vector3{X: +aspectRatio, Y: -1, Z: 1}
-		topLeft := basics.Vector3{X: -aspectRatio, Y: +1, Z: 1}
-		topRight := basics.Vector3{X: +aspectRatio, Y: +1, Z: 1}
-		forward := basics.Forward()
-		return []basics.Plane{
-			basics.NewPlaneFromPoints(&bottomLeft, &basics.Vector3{}, &bottomRight), //bottom
-			basics.NewPlaneFromPoints(&topRight, &basics.Vector3{}, &topLeft),       //top
-			basics.NewPlaneFromPoints(&bottomRight, &basics.Vector3{}, &topRight),   //right
-			basics.NewPlaneFromPoints(&topLeft, &basics.Vector3{}, &bottomLeft),     //left
-			basics.NewPlaneFromPointNormal(&basics.Vector3{Z: 0.1}, &forward),       //near
-		}
-	}
+// isBackFacing Returns true if the triangle on screen faces away from the camera
+func isBackFacing(screen *[3]basics.Vector4) bool {
+	return (screen[1].X-screen[0].X)*(screen[2].Y-screen[0].Y)-(screen[1].Y-screen[0].Y)*(screen[2].X-screen[0].X) > 0
 }
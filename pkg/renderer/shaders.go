@@ -0,0 +1,170 @@
+package renderer
+
+import (
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/graphics"
+)
+
+// The shaders used by the models without one, chosen by the render mode and ModelObject.PerPixelLighting
+var (
+	gouraudShader = &PhongShader{}
+	phongShader   = &PhongShader{PerPixel: true}
+)
+
+// shaderContext The graphics.ShaderContext of the triangles of a material
+type shaderContext struct {
+	material   *graphics.Material
+	lights     []renderLight
+	projection *projection
+	near       basics.Scalar
+	far        basics.Scalar
+}
+
+func (c *shaderContext) Material() *graphics.Material {
+	return c.material
+}
+
+func (c *shaderContext) Lit(position *basics.Vector3, normal *basics.Vector3, tint *basics.Vector3, viewDirection *basics.Vector3) basics.Vector3 {
+	return BlinnPhong(position, normal, tint, viewDirection, c.material, c.lights)
+}
+
+func (c *shaderContext) ViewDirection(position *basics.Vector3) basics.Vector3 {
+	return c.projection.viewDirection(position)
+}
+
+func (c *shaderContext) DepthRange() (basics.Scalar, basics.Scalar) {
+	return c.near, c.far
+}
+
+// shaderFragment Returns a fragmentFunction running the fragment stage of the shader. Fragments are shaded by many
+// goroutines at once, so the shaders must not change their state in Fragment
+func shaderFragment(shader graphics.Shader, context graphics.ShaderContext) fragmentFunction {
+	return func(fragment *graphics.Vertex) (basics.Vector3, bool) {
+		return shader.Fragment(fragment, context)
+	}
+}
+
+// surfaceTint Returns the vertex color multiplied by the texture of the material
+func surfaceTint(fragment *graphics.Vertex, material *graphics.Material) basics.Vector3 {
+	if material.DiffuseTexture == nil {
+		return fragment.Color
+	}
+	return fragment.Color.MulComponents(material.DiffuseTexture.Sample(fragment.UV.X, fragment.UV.Y).Div(65535))
+}
+
+// normalized Returns the interpolated normal of the fragment with unit length, or zero if it's zero
+func normalized(normal basics.Vector3) basics.Vector3 {
+	if !normal.IsZero() {
+		basics.ThisNormalize(&normal)
+	}
+	return normal
+}
+
+// PhongShader Blinn-Phong lighting with the lights of the scene, the default shading. Without PerPixel the lighting is
+// computed at the vertices and interpolated (Gouraud shading), the texture of the material multiplies the result.
+// With PerPixel the normals are interpolated and the texture is a tint for the ambient and diffuse colors
+type PhongShader struct {
+	PerPixel bool
+}
+
+func (s *PhongShader) Vertex(vertex *graphics.Vertex, context graphics.ShaderContext) {
+	if s.PerPixel {
+		return
+	}
+	forward := basics.Forward()
+	vertex.Color = context.Lit(&vertex.Position, &vertex.Normal, &vertex.Color, &forward)
+}
+
+func (s *PhongShader) Fragment(fragment *graphics.Vertex, context graphics.ShaderContext) (basics.Vector3, bool) {
+	tint := surfaceTint(fragment, context.Material())
+	if !s.PerPixel {
+		return tint, false
+	}
+	normal := normalized(fragment.Normal)
+	viewDirection := context.ViewDirection(&fragment.Position)
+	return context.Lit(&fragment.Position, &normal, &tint, &viewDirection), false
+}
+
+// ToonShader Cel shading, the brightness of the lit color relative to the diffuse color is rounded up to steps of
+// 1 / Bands. The pixels where the surface is seen at a grazing angle, with the cosine between the normal and the view
+// direction below Outline, are drawn black
+type ToonShader struct {
+	Bands   int
+	Outline basics.Scalar
+}
+
+// NewToonShader Returns a toon shader with the given number of bands and a thin outline
+func NewToonShader(bands int) *ToonShader {
+	return &ToonShader{Bands: bands, Outline: 0.2}
+}
+
+func (s *ToonShader) Vertex(vertex *graphics.Vertex, context graphics.ShaderContext) {}
+
+func (s *ToonShader) Fragment(fragment *graphics.Vertex, context graphics.ShaderContext) (basics.Vector3, bool) {
+	material := context.Material()
+	tint := surfaceTint(fragment, material)
+	normal := normalized(fragment.Normal)
+	viewDirection := context.ViewDirection(&fragment.Position)
+	if -normal.Dot(viewDirection) < s.Outline {
+		return basics.Vector3{}, false
+	}
+
+	base := material.Diffuse.MulComponents(tint.Mul(1.0 / 65535.0))
+	baseLuminance := luminance(&base)
+	if baseLuminance == 0 {
+		return base, false
+	}
+	// the lit color is about the base color scaled by the light reaching the point, highlights go to brighter bands
+	lit := context.Lit(&fragment.Position, &normal, &tint, &viewDirection)
+	bands := basics.Scalar(max(s.Bands, 1))
+	level := basics.Ceil(luminance(&lit)/baseLuminance*bands) / bands
+	color := base.Mul(level)
+	color.X = basics.ClampMax(65535, color.X)
+	color.Y = basics.ClampMax(65535, color.Y)
+	color.Z = basics.ClampMax(65535, color.Z)
+	return color, false
+}
+
+// NormalShader Draws the normals in view space as colors, each component from -1 to 1 is mapped to 0-65535
+type NormalShader struct{}
+
+func (s *NormalShader) Vertex(vertex *graphics.Vertex, context graphics.ShaderContext) {}
+
+func (s *NormalShader) Fragment(fragment *graphics.Vertex, context graphics.ShaderContext) (basics.Vector3, bool) {
+	normal := normalized(fragment.Normal)
+	return basics.NewVector3(normal.X+1, normal.Y+1, normal.Z+1).Mul(65535.0 / 2), false
+}
+
+// DepthShader Draws the distance from the camera in grey, white at Near and black at Far. When Far is not greater than
+// Near the clip distances of the camera are used
+type DepthShader struct {
+	Near basics.Scalar
+	Far  basics.Scalar
+}
+
+func (s *DepthShader) Vertex(vertex *graphics.Vertex, context graphics.ShaderContext) {}
+
+func (s *DepthShader) Fragment(fragment *graphics.Vertex, context graphics.ShaderContext) (basics.Vector3, bool) {
+	near, far := s.Near, s.Far
+	if far <= near {
+		near, far = context.DepthRange()
+	}
+	grey := 65535 * (1 - basics.Clamp(0, 1, (fragment.Position.Z-near)/(far-near)))
+	return basics.NewVector3(grey, grey, grey), false
+}
+
+// UnlitShader Draws the diffuse color of the material multiplied by the vertex colors and the texture, without lights
+type UnlitShader struct{}
+
+func (s *UnlitShader) Vertex(vertex *graphics.Vertex, context graphics.ShaderContext) {}
+
+func (s *UnlitShader) Fragment(fragment *graphics.Vertex, context graphics.ShaderContext) (basics.Vector3, bool) {
+	material := context.Material()
+	tint := surfaceTint(fragment, material)
+	return material.Diffuse.MulComponents(tint.Mul(1.0 / 65535.0)), false
+}
+
+// luminance Returns the perceived brightness of a color
+func luminance(color *basics.Vector3) basics.Scalar {
+	return 0.2126*color.X + 0.7152*color.Y + 0.0722*color.Z
+}
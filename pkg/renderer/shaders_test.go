@@ -0,0 +1,116 @@
+package renderer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/entities"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// discardLeftShader Draws the diffuse color and discards the fragments left of the camera
+type discardLeftShader struct {
+	UnlitShader
+}
+
+func (s *discardLeftShader) Fragment(fragment *graphics.Vertex, context graphics.ShaderContext) (basics.Vector3, bool) {
+	if fragment.Position.X < 0 {
+		return basics.Vector3{}, true
+	}
+	return s.UnlitShader.Fragment(fragment, context)
+}
+
+// redVertexShader Sets the vertex colors in the vertex stage, the fragment stage draws them unlit
+type redVertexShader struct{}
+
+func (s *redVertexShader) Vertex(vertex *graphics.Vertex, context graphics.ShaderContext) {
+	vertex.Color = basics.NewVector3(65535, 0, 0)
+}
+
+func (s *redVertexShader) Fragment(fragment *graphics.Vertex, context graphics.ShaderContext) (basics.Vector3, bool) {
+	return fragment.Color, false
+}
+
+// shaderTestScene A white quad facing the camera in front of a blue quad, the camera is at 2 from the white quad
+func shaderTestScene() (*entities.SceneGraph, *entities.ModelObject) {
+	sceneGraph := entities.NewSceneGraph()
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewCameraObject("camera"), "camera"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, -2)))
+	white, err := graphics.NewMeshFromReader(strings.NewReader(goldenTexturedQuad), graphics.NewMaterial("white", basics.NewVector3(65535, 65535, 65535), basics.Vector3{}, 1))
+	if err != nil {
+		panic(err)
+	}
+	blue, err := graphics.NewMeshFromReader(strings.NewReader(goldenTexturedQuad), graphics.NewMaterial("blue", basics.NewVector3(0, 0, 65535), basics.Vector3{}, 1))
+	if err != nil {
+		panic(err)
+	}
+	front := entities.NewModelObject("front", white, false)
+	back := entities.NewModelObject("back", blue, false)
+	back.SetShader(&UnlitShader{})
+	// the quads lie in the xz plane facing +y, they are rotated to face the camera
+	faceCamera := basics.NewQuaternionFromEulerAngles(0, -90, 0)
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(front, "front"), basics.NewTransform(1, faceCamera, basics.Vector3{}))
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(back, "back"), basics.NewTransform(1, faceCamera, basics.NewVector3(0, 0, 1)))
+	light := entities.NewLightObject("light", color.RGBA{R: 255, G: 255, B: 255, A: 255}, nil)
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(light, "light"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, -2)))
+	return sceneGraph, front
+}
+
+func renderShaderTestScene(t *testing.T, shader graphics.Shader) *RasterRenderer {
+	sceneGraph, front := shaderTestScene()
+	front.SetShader(shader)
+	r := NewRasterRenderer(sceneGraph.GetNode("camera"), 40, 30)
+	renderRGBA(t, r, sceneGraph)
+	return r
+}
+
+// assertColor Checks the color of a pixel allowing an error of 1 from the rounding of the interpolated attributes
+func assertColor(t *testing.T, expected color.RGBA, actual color.RGBA, msgAndArgs ...interface{}) {
+	for _, c := range [][2]uint8{{expected.R, actual.R}, {expected.G, actual.G}, {expected.B, actual.B}} {
+		if !assert.InDelta(t, c[0], c[1], 1, msgAndArgs...) {
+			t.Logf("expected %v, actual %v", expected, actual)
+			return
+		}
+	}
+}
+
+func TestShaders_Builtin(t *testing.T) {
+	r := renderShaderTestScene(t, &UnlitShader{})
+	assertColor(t, color.RGBA{R: 255, G: 255, B: 255, A: 255}, r.imageBuffer.Get(20, 15), "unlit draws the diffuse color")
+
+	r = renderShaderTestScene(t, &NormalShader{})
+	assertColor(t, color.RGBA{R: 127, G: 127, B: 0, A: 255}, r.imageBuffer.Get(20, 15), "the normal faces the camera, -z")
+
+	r = renderShaderTestScene(t, &DepthShader{Near: 1, Far: 3})
+	assertColor(t, color.RGBA{R: 127, G: 127, B: 127, A: 255}, r.imageBuffer.Get(20, 15), "half way between near and far")
+
+	r = renderShaderTestScene(t, &redVertexShader{})
+	assertColor(t, color.RGBA{R: 255, A: 255}, r.imageBuffer.Get(20, 15), "colors set by the vertex stage are interpolated")
+
+	// the default shader is the same as PhongShader
+	expected := renderShaderTestScene(t, nil).imageBuffer.ToRGBA().Pix
+	assert.Equal(t, expected, renderShaderTestScene(t, &PhongShader{}).imageBuffer.ToRGBA().Pix)
+}
+
+func TestShaders_Discard(t *testing.T) {
+	r := renderShaderTestScene(t, &discardLeftShader{})
+	assertColor(t, color.RGBA{B: 255, A: 255}, r.imageBuffer.Get(5, 15), "discarded fragments don't hide the quad behind")
+	assertColor(t, color.RGBA{R: 255, G: 255, B: 255, A: 255}, r.imageBuffer.Get(35, 15))
+	assert.InDelta(t, 3, float64(r.zBuffer.Get(5, 15)), 1e-9, "discarded fragments don't write the depth")
+}
+
+func TestToonShader_Bands(t *testing.T) {
+	sceneGraph, front := shaderTestScene()
+	front.SetShader(&ToonShader{Bands: 3})
+	r := NewRasterRenderer(sceneGraph.GetNode("camera"), 40, 30)
+	r.SetRenderMode(RendermodePhong)
+	renderRGBA(t, r, sceneGraph)
+
+	// the light in front of the quad fades towards the borders in steps
+	levels := make(map[color.RGBA]bool)
+	for x := 0; x < 40; x++ {
+		levels[r.imageBuffer.Get(x, 15)] = true
+	}
+	assert.True(t, len(levels) > 1 && len(levels) <= 3, "%d levels", len(levels))
+}
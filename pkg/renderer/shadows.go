@@ -0,0 +1,217 @@
+package renderer
+
+import (
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/entities"
+	"github.com/tsagae/software3d/pkg/graphics"
+)
+
+const (
+	maxSpotShadowFov = 170 // spot lights with a wider cone are clipped by the shadow map
+	minShadowCos     = 0.1 // limits the slope bias on the surfaces parallel to the light
+)
+
+// shadowMap The depth of the closest surfaces seen by a light, rendered from one face for directional and spot lights
+// and six faces for point lights
+type shadowMap struct {
+	faces     []shadowFace
+	bias      basics.Scalar
+	slopeBias basics.Scalar
+	pcfRadius int
+}
+
+// shadowFace The depth seen by a light looking in one direction. Depths are distances along the direction of the face
+type shadowFace struct {
+	fromCamera basics.Transform // from the view space of the camera to the view space of the face
+	projection projection
+	frustum    []basics.Plane
+	depth      graphics.ZBuffer
+}
+
+// cubeFaceRotations Rotations of the faces of the cube map of point lights: +z, -z, +x, -x, +y, -y
+var cubeFaceRotations = [6]basics.Quaternion{
+	basics.NewIdentityQuaternion(),
+	basics.NewQuaternionFromEulerAngles(180, 0, 0),
+	basics.NewQuaternionFromEulerAngles(90, 0, 0),
+	basics.NewQuaternionFromEulerAngles(-90, 0, 0),
+	basics.NewQuaternionFromEulerAngles(0, -90, 0),
+	basics.NewQuaternionFromEulerAngles(0, 90, 0),
+}
+
+// renderShadowMaps Renders the depth of the items casting shadows from every light casting shadows and links the maps
+// to the lights. cameraWorldT is the world transform of the camera, the items and the lights are in its view space
+func (r *RasterRenderer) renderShadowMaps(items []renderItem, lights []renderLight, cameraWorldT *basics.Transform) {
+	used := make(map[*entities.LightObject]bool, len(lights))
+	for i := range lights {
+		light := lights[i].light
+		if !light.CastShadows() {
+			continue
+		}
+		used[light] = true
+		sm := r.shadowMapOf(light)
+		sm.setup(light, lights[i].transform.Cumulate(cameraWorldT), cameraWorldT)
+		for f := range sm.faces {
+			sm.faces[f].render(items)
+		}
+		lights[i].shadow = sm
+	}
+	// drop the maps of the lights that are no longer casting shadows
+	for light := range r.shadowMaps {
+		if !used[light] {
+			delete(r.shadowMaps, light)
+		}
+	}
+}
+
+// shadowMapOf Returns the shadow map of the light, the depth buffers are reused between frames if the size does not change
+func (r *RasterRenderer) shadowMapOf(light *entities.LightObject) *shadowMap {
+	if r.shadowMaps == nil {
+		r.shadowMaps = make(map[*entities.LightObject]*shadowMap)
+	}
+	size := max(light.ShadowSettings().MapSize, 1)
+	faces := 1
+	if light.Type() == entities.LightTypePoint {
+		faces = 6
+	}
+	sm, ok := r.shadowMaps[light]
+	if !ok || len(sm.faces) != faces || sm.faces[0].depth.GetWidth() != size {
+		sm = &shadowMap{faces: make([]shadowFace, faces)}
+		for f := range sm.faces {
+			sm.faces[f].depth = graphics.NewZBuffer(size, size)
+		}
+		r.shadowMaps[light] = sm
+	}
+	return sm
+}
+
+// setup places the faces of the map at lightWorldT, the world transform of the light, and builds their projections
+func (sm *shadowMap) setup(light *entities.LightObject, lightWorldT basics.Transform, cameraWorldT *basics.Transform) {
+	settings := light.ShadowSettings()
+	sm.bias = settings.Bias
+	sm.slopeBias = settings.SlopeBias
+	sm.pcfRadius = max(settings.PCFRadius, 0)
+
+	var camera *entities.CameraObject
+	switch light.Type() {
+	case entities.LightTypeDirectional:
+		camera = entities.NewOrthographicCameraObject(light.Name(), settings.Area, settings.Near, settings.Far)
+	case entities.LightTypeSpot:
+		_, outerAngle := light.ConeAngles()
+		camera = entities.NewPerspectiveCameraObject(light.Name(), min(2*outerAngle, maxSpotShadowFov), settings.Near, settings.Far)
+	default:
+		// the faces are wider than 90 degrees so that the filter finds rendered texels at the seams of the cube
+		size := basics.Scalar(sm.faces[0].depth.GetWidth())
+		margin := 2 * basics.Scalar(sm.pcfRadius+2) / size
+		fov := 2 * basics.RadToDeg(basics.Atan2(1+margin, 1))
+		camera = entities.NewPerspectiveCameraObject(light.Name(), fov, settings.Near, settings.Far)
+	}
+
+	size := sm.faces[0].depth.GetWidth()
+	viewport := NewViewport(nil, 0, 0, size, size)
+	for f := range sm.faces {
+		face := &sm.faces[f]
+		faceWorldT := basics.NewTransform(1, lightWorldT.Rotation, lightWorldT.Translation)
+		if len(sm.faces) == 6 {
+			// the cube map is aligned with the world axes
+			faceWorldT = basics.NewTransform(1, cubeFaceRotations[f], lightWorldT.Translation)
+		}
+		worldToFace := faceWorldT.Inverse()
+		face.fromCamera = cameraWorldT.Cumulate(&worldToFace)
+		face.projection = newProjection(camera, &viewport)
+		face.frustum = getViewFrustum(camera, 1)
+	}
+}
+
+// render rasterizes the depth of the items casting shadows. Back faces are kept so that open meshes cast shadows too
+func (face *shadowFace) render(items []renderItem) {
+	face.depth.Clear()
+	size := face.depth.GetWidth()
+	for _, item := range items {
+		if !item.modelObject.CastShadows() {
+			continue
+		}
+		toFace := item.completeTransform.Cumulate(&face.fromCamera)
+		mesh := item.modelObject.Mesh()
+		iterator := mesh.Iterator()
+		for iterator.HasNext() {
+			t := iterator.Next()
+			t.ThisApplyTransformation(&toFace)
+			for _, t := range ClipTriangleAgainstPlanes(&t, face.frustum) {
+				screen := projectTriangleOnScreen(&t, &face.projection)
+				rasterTriangle(&t, &screen, nil, nil, 0, 0, size, size, nil, &face.depth)
+			}
+		}
+	}
+}
+
+// visibility Returns the fraction of the light reaching the point in the view space of the camera, from 0 in shadow
+// to 1 fully lit. normal is the normal of the surface and lightVector the direction from the point to the light, they
+// scale the bias on the surfaces at grazing angles. Points outside of the map are lit
+func (sm *shadowMap) visibility(position *basics.Vector3, normal *basics.Vector3, lightVector *basics.Vector3) basics.Scalar {
+	face, p, ok := sm.faceOf(position)
+	if !ok {
+		return 1
+	}
+	s := face.projection.toScreen(&p)
+	size := face.depth.GetWidth()
+	// texels are centered on integer coordinates, the face covers -0.5 to size-0.5
+	edge := basics.Scalar(size) - 0.5
+	if s.X < -0.5 || s.Y < -0.5 || s.X > edge || s.Y > edge {
+		return 1
+	}
+	cx, cy := int(basics.Round(s.X)), int(basics.Round(s.Y))
+
+	// the depth of the surface changes by texel * tan(angle) from a texel to the next
+	texel := 2 / (face.projection.scale * basics.Scalar(size))
+	if !face.projection.orthographic {
+		texel *= p.Z
+	}
+	cos := basics.Scalar(1)
+	if length := normal.Length(); length > 0 {
+		cos = basics.Clamp(minShadowCos, 1, basics.Abs(normal.Dot(*lightVector))/length)
+	}
+	tan := basics.Sqrt(1-cos*cos) / cos
+	depth := p.Z - sm.bias - sm.slopeBias*texel*tan*basics.Scalar(sm.pcfRadius+1)
+
+	// samples outside the face are clamped so the seams of cube maps don't leak light
+	lit, samples := 0, 0
+	for y := cy - sm.pcfRadius; y <= cy+sm.pcfRadius; y++ {
+		for x := cx - sm.pcfRadius; x <= cx+sm.pcfRadius; x++ {
+			samples++
+			if depth <= face.depth.Get(min(max(x, 0), size-1), min(max(y, 0), size-1)) {
+				lit++
+			}
+		}
+	}
+	return basics.Scalar(lit) / basics.Scalar(samples)
+}
+
+// faceOf Returns the face seeing the point and the point in the view space of the face. ok is false if the point is
+// outside the depth range of the light
+func (sm *shadowMap) faceOf(position *basics.Vector3) (*shadowFace, basics.Vector3, bool) {
+	for f := range sm.faces {
+		face := &sm.faces[f]
+		p := *position
+		face.fromCamera.ApplyToPoint(&p)
+		// a point belongs to the face of the cube whose axis is the largest component of its direction
+		if len(sm.faces) == 6 && (p.Z <= 0 || p.Z < basics.Abs(p.X) || p.Z < basics.Abs(p.Y)) {
+			continue
+		}
+		near, far := face.frustum[4].Point.Z, face.frustum[5].Point.Z
+		if p.Z < near || p.Z > far {
+			return nil, p, false
+		}
+		return face, p, true
+	}
+	return nil, *position, false
+}
+
+// withoutShadows Returns a copy of the lights that ignores the shadow maps, for the models not receiving shadows
+func withoutShadows(lights []renderLight) []renderLight {
+	unshadowed := make([]renderLight, len(lights))
+	copy(unshadowed, lights)
+	for i := range unshadowed {
+		unshadowed[i].shadow = nil
+	}
+	return unshadowed
+}
@@ -0,0 +1,113 @@
+package renderer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/entities"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"image/color"
+	"testing"
+)
+
+// shadowVisibility Returns the visibility of a world point on a surface facing up from the light of the scene named lightName
+func shadowVisibility(t *testing.T, r *RasterRenderer, sceneGraph *entities.SceneGraph, lightName string, point basics.Vector3) basics.Scalar {
+	light := sceneGraph.GetNode(lightName).GameObject.(*entities.LightObject)
+	sm, ok := r.shadowMaps[light]
+	if !assert.True(t, ok, "no shadow map for %s", lightName) {
+		return 1
+	}
+	cameraWorldT := r.Camera().WorldTransform()
+	inverseCameraT := cameraWorldT.Inverse()
+	inverseCameraT.ApplyToPoint(&point)
+	normal := basics.Up()
+	inverseCameraT.ApplyToVector(&normal)
+	lightPosition := sceneGraph.GetNode(lightName).WorldTransform().Translation
+	inverseCameraT.ApplyToPoint(&lightPosition)
+	lightVector := lightPosition.Sub(point).Normalized()
+	return sm.visibility(&point, &normal, &lightVector)
+}
+
+func TestShadowMap_SpotLight(t *testing.T) {
+	sceneGraph := goldenLightTypesScene(withShadows(goldenSpotLight, "spot"))()
+	r := NewRasterRenderer(sceneGraph.GetNode("camera"), 80, 60)
+	r.SetRenderMode(RendermodePhong)
+	renderRGBA(t, r, sceneGraph)
+
+	assert.Equal(t, basics.Scalar(0), shadowVisibility(t, r, sceneGraph, "spot", basics.NewVector3(0.6, 0, 0.5)), "under the sphere")
+	assert.Equal(t, basics.Scalar(1), shadowVisibility(t, r, sceneGraph, "spot", basics.NewVector3(-1, 0, -1)), "the floor does not shadow itself")
+	assert.Equal(t, basics.Scalar(1), shadowVisibility(t, r, sceneGraph, "spot", basics.NewVector3(0.6, 1.6, 0.5)), "top of the sphere")
+
+	// the border of the shadow is filtered
+	light := sceneGraph.GetNode("spot").GameObject.(*entities.LightObject)
+	settings := light.ShadowSettings()
+	settings.PCFRadius = 2
+	light.SetShadowSettings(settings)
+	renderRGBA(t, r, sceneGraph)
+	partial := false
+	for x := basics.Scalar(0.6); x < 2; x += 0.01 {
+		v := shadowVisibility(t, r, sceneGraph, "spot", basics.NewVector3(x, 0, 0.5))
+		partial = partial || (v > 0 && v < 1)
+	}
+	assert.True(t, partial, "no partial shadow at the border")
+}
+
+func TestShadowMap_PointLight(t *testing.T) {
+	// a point light inside a sphere, every face of the cube map sees the sphere
+	sceneGraph := entities.NewSceneGraph()
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewCameraObject("camera"), "camera"), basics.NewTransform(1, basics.NewQuaternionFromEulerAngles(20, 10, 0), basics.NewVector3(1, 2, -8)))
+	material := graphics.NewMaterial("sphere", basics.NewVector3(50000, 50000, 50000), basics.Vector3{}, 1)
+	sphere := entities.NewModelObject("sphere", readMeshFromFile("../../meshes/sphere.obj", material), false)
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(sphere, "sphere"), basics.NewTransform(2, basics.NewIdentityQuaternion(), basics.Vector3{}))
+	light := entities.NewLightObject("point", color.White, nil)
+	light.SetCastShadows(true)
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(light, "point"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.Vector3{}))
+
+	r := NewRasterRenderer(sceneGraph.GetNode("camera"), 80, 60)
+	r.SetRenderMode(RendermodePhong)
+	renderRGBA(t, r, sceneGraph)
+	assert.Equal(t, 6, len(r.shadowMaps[light].faces))
+
+	directions := []basics.Vector3{basics.Forward(), basics.Backward(), basics.Right(), basics.Left(), basics.Up(), basics.Down(), basics.NewVector3(1, 1, 1).Normalized(), basics.NewVector3(-1, 1, 0).Normalized()}
+	for _, direction := range directions {
+		assert.Equalf(t, basics.Scalar(1), shadowVisibility(t, r, sceneGraph, "point", direction), "inside the sphere towards %v", direction)
+		assert.Equalf(t, basics.Scalar(0), shadowVisibility(t, r, sceneGraph, "point", direction.Mul(3)), "outside the sphere towards %v", direction)
+	}
+}
+
+func TestRasterRenderer_ShadowSettings(t *testing.T) {
+	sceneGraph := goldenLightTypesScene(goldenSpotLight)()
+	r := NewRasterRenderer(sceneGraph.GetNode("camera"), 80, 60)
+	r.SetRenderMode(RendermodePhong)
+	render := func() []uint8 {
+		r.imageBuffer.Clear()
+		return renderRGBA(t, r, sceneGraph).Pix
+	}
+	unshadowed := render()
+	assert.Equal(t, 0, len(r.shadowMaps))
+
+	light := sceneGraph.GetNode("spot").GameObject.(*entities.LightObject)
+	light.SetCastShadows(true)
+	shadowed := render()
+	assert.NotEqual(t, unshadowed, shadowed)
+
+	sphere := sceneGraph.GetNode("sphere").GameObject.(*entities.ModelObject)
+	sphere.SetCastShadows(false)
+	assert.Equal(t, unshadowed, render(), "the only occluder does not cast shadows")
+	sphere.SetCastShadows(true)
+
+	floor := sceneGraph.GetNode("floor").GameObject.(*entities.ModelObject)
+	floor.SetReceiveShadows(false)
+	sphere.SetReceiveShadows(false)
+	assert.Equal(t, unshadowed, render(), "no model receives shadows")
+	floor.SetReceiveShadows(true)
+	sphere.SetReceiveShadows(true)
+	assert.Equal(t, shadowed, render())
+
+	light.SetCastShadows(false)
+	assert.Equal(t, unshadowed, render())
+	assert.Equal(t, 0, len(r.shadowMaps), "the maps of lights not casting shadows are dropped")
+
+	hemisphere := entities.NewHemisphereLightObject("sky", color.White, color.Black)
+	hemisphere.SetCastShadows(true)
+	assert.False(t, hemisphere.CastShadows(), "hemisphere lights do not cast shadows")
+}
@@ -0,0 +1,148 @@
+package renderer
+
+import (
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultTileSize = 32
+
+// rasterJob A triangle ready to be rasterized: clipped, lit and projected on the screen
+type rasterJob struct {
+	triangle graphics.Triangle
+	screen   [3]basics.Vector4
+	fragment fragmentFunction
+	blend    *blendState   // nil for opaque triangles
+	depth    basics.Scalar // average depth in view space, transparent triangles are sorted by it
+}
+
+// tile A rectangle of the screen, from min (included) to max (excluded), and the jobs overlapping it in submission order
+type tile struct {
+	minX int
+	minY int
+	maxX int
+	maxY int
+	jobs []int
+}
+
+// SetWorkers Sets the number of goroutines that rasterize the tiles, values <= 0 use one goroutine per CPU
+func (r *RasterRenderer) SetWorkers(workers int) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	r.parameters.workers = workers
+}
+
+// SetTileSize Sets the side in pixels of the square tiles the screen is split into, values <= 0 use the default size
+func (r *RasterRenderer) SetTileSize(tileSize int) {
+	if tileSize <= 0 {
+		tileSize = defaultTileSize
+	}
+	r.parameters.tileSize = tileSize
+	r.tiles = newTiles(r.parameters.winWidth, r.parameters.winHeight, tileSize)
+}
+
+func newTiles(winWidth int, winHeight int, tileSize int) []tile {
+	tiles := make([]tile, 0, ((winWidth+tileSize-1)/tileSize)*((winHeight+tileSize-1)/tileSize))
+	for y := 0; y < winHeight; y += tileSize {
+		for x := 0; x < winWidth; x += tileSize {
+			tiles = append(tiles, tile{minX: x, minY: y, maxX: min(x+tileSize, winWidth), maxY: min(y+tileSize, winHeight)})
+		}
+	}
+	return tiles
+}
+
+// queueTriangle adds a triangle to the jobs rasterized by rasterizeQueue. Transparent triangles, with a blend state,
+// are kept apart and rasterized after the opaque ones
+func (r *RasterRenderer) queueTriangle(t *graphics.Triangle, screen *[3]basics.Vector4, fragment fragmentFunction, blend *blendState) {
+	job := rasterJob{triangle: *t, screen: *screen, fragment: fragment, blend: blend}
+	if blend == nil {
+		r.jobs = append(r.jobs, job)
+		return
+	}
+	job.depth = t.GetAverageZ()
+	r.transparentJobs = append(r.transparentJobs, job)
+}
+
+// rasterizeQueue bins the queued triangles in the tiles they overlap and rasterizes the tiles in parallel. Every tile is
+// written by a single goroutine that processes its triangles in submission order, so the result does not depend on
+// the number of workers. The opaque triangles come first, then the transparent ones from the farthest to the closest
+func (r *RasterRenderer) rasterizeQueue() {
+	// stable, so triangles at the same depth keep the submission order
+	sort.SliceStable(r.transparentJobs, func(i, j int) bool {
+		return r.transparentJobs[i].depth > r.transparentJobs[j].depth
+	})
+	r.jobs = append(r.jobs, r.transparentJobs...)
+	clear(r.transparentJobs)
+	r.transparentJobs = r.transparentJobs[:0]
+
+	tileSize := r.parameters.tileSize
+	tilesX := (r.parameters.winWidth + tileSize - 1) / tileSize
+	tilesY := (r.parameters.winHeight + tileSize - 1) / tileSize
+	for i := range r.tiles {
+		r.tiles[i].jobs = r.tiles[i].jobs[:0]
+	}
+	margin := sampleMargin(r.zBuffer.Samples())
+	for i := range r.jobs {
+		// same pixel range as rasterTriangle
+		firstX, firstY, lastX, lastY := screenBounds(&r.jobs[i].screen)
+		firstX, firstY, lastX, lastY = firstX-margin, firstY-margin, lastX+margin, lastY+margin
+		if lastX < 0 || lastY < 0 || firstX >= r.parameters.winWidth || firstY >= r.parameters.winHeight {
+			continue
+		}
+		firstTileX, lastTileX := max(firstX, 0)/tileSize, min(lastX/tileSize, tilesX-1)
+		firstTileY, lastTileY := max(firstY, 0)/tileSize, min(lastY/tileSize, tilesY-1)
+		for ty := firstTileY; ty <= lastTileY; ty++ {
+			for tx := firstTileX; tx <= lastTileX; tx++ {
+				t := &r.tiles[ty*tilesX+tx]
+				t.jobs = append(t.jobs, i)
+			}
+		}
+	}
+
+	workers := min(r.parameters.workers, len(r.tiles))
+	if workers <= 1 {
+		for i := range r.tiles {
+			r.rasterizeTile(&r.tiles[i])
+		}
+	} else {
+		var next atomic.Int64
+		var wg sync.WaitGroup
+		wg.Add(workers)
+		for w := 0; w < workers; w++ {
+			go func() {
+				defer wg.Done()
+				for {
+					i := int(next.Add(1) - 1)
+					if i >= len(r.tiles) {
+						return
+					}
+					r.rasterizeTile(&r.tiles[i])
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	// drop the references to the triangles and the fragment functions of this frame
+	clear(r.jobs)
+	r.jobs = r.jobs[:0]
+}
+
+// rasterizeTile rasterizes the jobs of the tile on the part of the tile inside the viewport being rendered
+func (r *RasterRenderer) rasterizeTile(t *tile) {
+	viewport := &r.parameters.viewport
+	minX, minY := max(t.minX, viewport.X), max(t.minY, viewport.Y)
+	maxX, maxY := min(t.maxX, viewport.X+viewport.Width), min(t.maxY, viewport.Y+viewport.Height)
+	if minX >= maxX || minY >= maxY {
+		return
+	}
+	for _, i := range t.jobs {
+		job := &r.jobs[i]
+		rasterTriangle(&job.triangle, &job.screen, job.fragment, job.blend, minX, minY, maxX, maxY, r.colorTarget(), &r.zBuffer)
+	}
+}
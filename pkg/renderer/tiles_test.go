@@ -0,0 +1,57 @@
+package renderer
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"runtime"
+	"testing"
+)
+
+func TestRasterRenderer_TilesAreDeterministic(t *testing.T) {
+	sceneGraph := SampleScene()
+	render := func(workers int, tileSize int, renderMode uint8) []byte {
+		r := NewRasterRenderer(sceneGraph.GetNode("camera"), 317, 211) // sizes that are not multiples of the tiles
+		r.SetWorkers(workers)
+		r.SetTileSize(tileSize)
+		r.SetRenderMode(renderMode)
+		return renderRGBA(t, r, sceneGraph).Pix
+	}
+	for _, renderMode := range []uint8{RendermodeNormal, RendermodePhong} {
+		// a single tile covering the screen is the same as rasterizing every triangle in order on one goroutine
+		expected := render(1, 1024, renderMode)
+		for _, tileSize := range []int{1, 7, 16, 64} {
+			for _, workers := range []int{1, 3, 8} {
+				assert.Equalf(t, expected, render(workers, tileSize, renderMode), "render mode %d, %d workers, tile size %d", renderMode, workers, tileSize)
+			}
+		}
+	}
+}
+
+func TestNewTiles(t *testing.T) {
+	tiles := newTiles(70, 40, 32)
+	assert.Equal(t, 6, len(tiles))
+	assert.Equal(t, tile{minX: 64, minY: 32, maxX: 70, maxY: 40}, tiles[5])
+	covered := 0
+	for _, tile := range tiles {
+		covered += (tile.maxX - tile.minX) * (tile.maxY - tile.minY)
+	}
+	assert.Equal(t, 70*40, covered)
+}
+
+func BenchmarkRasterRenderer_Workers(b *testing.B) {
+	sceneGraph := SampleScene()
+	for _, workers := range []int{1, 2, 4, runtime.NumCPU()} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			r := NewRasterRenderer(sceneGraph.GetNode("camera"), 800, 600)
+			r.SetWorkers(workers)
+			r.SetRenderMode(RendermodePhong)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := r.RenderSceneGraph(sceneGraph); err != nil {
+					b.Fatal(err)
+				}
+				r.imageBuffer.Clear()
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package renderer
+
+import (
+	"fmt"
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/entities"
+	"github.com/tsagae/software3d/pkg/graphics"
+)
+
+// Viewport A rectangle of the image buffer rendered from a camera. X and Y are the bottom left corner, row 0 of the
+// image buffer is the bottom of the screen
+type Viewport struct {
+	Camera *entities.SceneGraphNode
+	X      int
+	Y      int
+	Width  int
+	Height int
+}
+
+func NewViewport(camera *entities.SceneGraphNode, x int, y int, width int, height int) Viewport {
+	return Viewport{Camera: camera, X: x, Y: y, Width: width, Height: height}
+}
+
+// AspectRatio Returns the width of the viewport divided by its height
+func (v *Viewport) AspectRatio() basics.Scalar {
+	return basics.Scalar(v.Width) / basics.Scalar(v.Height)
+}
+
+// GridViewports Returns a viewport for each camera laid out on a grid of columns x rows cells covering a winWidth x
+// winHeight screen. Cameras are placed from the top left cell, left to right and top to bottom. Cells at the right and
+// top borders get the pixels left over by the division
+func GridViewports(cameras []*entities.SceneGraphNode, columns int, rows int, winWidth int, winHeight int) []Viewport {
+	viewports := make([]Viewport, 0, len(cameras))
+	for i, camera := range cameras {
+		if i >= columns*rows {
+			break
+		}
+		col, row := i%columns, rows-1-i/columns
+		x0, x1 := col*winWidth/columns, (col+1)*winWidth/columns
+		y0, y1 := row*winHeight/rows, (row+1)*winHeight/rows
+		viewports = append(viewports, NewViewport(camera, x0, y0, x1-x0, y1-y0))
+	}
+	return viewports
+}
+
+// RenderViewports Renders the scene graph once for every viewport, in order, into the rectangles of the image buffer
+// they cover. Each viewport clears the depth of its rectangle before rendering, the colors are not cleared. Returns an
+// error, without rendering anything, if a viewport is outside the image buffer or its camera is not valid
+func (r *RasterRenderer) RenderViewports(sceneGraph *entities.SceneGraph, viewports []Viewport) (*graphics.ImageBuffer, error) {
+	for i := range viewports {
+		if _, err := r.checkViewport(sceneGraph, &viewports[i]); err != nil {
+			return nil, fmt.Errorf("viewport %d: %w", i, err)
+		}
+	}
+	r.cullingStats = CullingStats{}
+	for i := range viewports {
+		if err := r.renderViewport(sceneGraph, &viewports[i]); err != nil {
+			return nil, fmt.Errorf("viewport %d: %w", i, err)
+		}
+	}
+	r.setPickSceneGraph(sceneGraph)
+	return &r.imageBuffer, nil
+}
+
+// checkViewport Returns the camera object of the viewport or an error if the viewport can't be rendered
+func (r *RasterRenderer) checkViewport(sceneGraph *entities.SceneGraph, viewport *Viewport) (*entities.CameraObject, error) {
+	if viewport.Width <= 0 || viewport.Height <= 0 {
+		return nil, fmt.Errorf("invalid viewport size %dx%d", viewport.Width, viewport.Height)
+	}
+	if viewport.X < 0 || viewport.Y < 0 || viewport.X+viewport.Width > r.parameters.winWidth || viewport.Y+viewport.Height > r.parameters.winHeight {
+		return nil, fmt.Errorf("viewport %dx%d at (%d, %d) is outside of the %dx%d screen", viewport.Width, viewport.Height, viewport.X, viewport.Y, r.parameters.winWidth, r.parameters.winHeight)
+	}
+	camera, err := cameraObjectOf(viewport.Camera)
+	if err != nil {
+		return nil, err
+	}
+	if err := camera.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", ErrBadCamera, viewport.Camera.Name(), err)
+	}
+	if sceneGraph.GetNode(viewport.Camera.Name()) != viewport.Camera {
+		return nil, fmt.Errorf("camera node %q is not part of the scene graph", viewport.Camera.Name())
+	}
+	return camera, nil
+}
+
+func (r *RasterRenderer) renderViewport(sceneGraph *entities.SceneGraph, viewport *Viewport) error {
+	camera, err := r.checkViewport(sceneGraph, viewport)
+	if err != nil {
+		return err
+	}
+	r.setupCamera(camera, viewport)
+	minX, minY, maxX, maxY := viewport.X, viewport.Y, viewport.X+viewport.Width, viewport.Y+viewport.Height
+	r.zBuffer.ClearRegion(minX, minY, maxX, maxY)
+	// wireframes have no surfaces, the edges are drawn straight into the image buffer
+	multisample := r.zBuffer.Samples() > 1 && r.parameters.renderMode != RendermodeWireframe
+	if multisample {
+		r.imageBuffer.CopyToSamples(&r.sampleBuffer, minX, minY, maxX, maxY)
+	}
+	cameraWorldT := viewport.Camera.WorldTransform()
+	inverseCameraT := cameraWorldT.Inverse()
+	itemsToRender, lightsToRender := getAllItemsToRender(sceneGraph, &inverseCameraT)
+	var unshadowedLights []renderLight
+	if r.parameters.renderMode != RendermodeWireframe {
+		r.renderShadowMaps(itemsToRender, lightsToRender, &cameraWorldT)
+		unshadowedLights = withoutShadows(lightsToRender)
+	}
+
+	// shadow maps are rendered from the lights, the models culled from the camera can still cast shadows
+	itemsToRender = r.cullItems(itemsToRender)
+
+	wireframe := r.parameters.renderMode == RendermodeWireframe || r.parameters.renderMode == RendermodeShadedWireframe
+	hiddenLineRemoval := r.parameters.renderMode == RendermodeShadedWireframe || r.parameters.wireframe.HiddenLineRemoval
+	for _, item := range itemsToRender {
+		switch r.parameters.renderMode {
+		case RendermodeNormal, RendermodePhong, RendermodeShadedWireframe:
+			if item.modelObject.ReceiveShadows() {
+				r.renderSingleItem(item, lightsToRender)
+			} else {
+				r.renderSingleItem(item, unshadowedLights)
+			}
+		case RendermodeWireframe:
+			if hiddenLineRemoval {
+				r.renderSingleItemDepth(item)
+			}
+		default:
+			panic("invalid Rendermode")
+		}
+	}
+	r.rasterizeQueue()
+	if multisample {
+		r.imageBuffer.Resolve(&r.sampleBuffer, minX, minY, maxX, maxY)
+	}
+	// the edges are drawn over the surfaces, after the depth of all of them is known
+	if wireframe {
+		for _, item := range itemsToRender {
+			r.renderSingleItemWireFrame(item, hiddenLineRemoval)
+		}
+	}
+	if r.parameters.antialiasing == AntialiasingFXAA {
+		fxaa(&r.imageBuffer, minX, minY, maxX, maxY)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package renderer
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/entities"
+	"image/color"
+	"testing"
+)
+
+func TestGridViewports(t *testing.T) {
+	cameras := []*entities.SceneGraphNode{nil, nil, nil}
+	viewports := GridViewports(cameras, 2, 2, 101, 51)
+	assert.Equal(t, 3, len(viewports))
+	assert.Equal(t, NewViewport(nil, 0, 25, 50, 26), viewports[0], "top left")
+	assert.Equal(t, NewViewport(nil, 50, 25, 51, 26), viewports[1], "top right")
+	assert.Equal(t, NewViewport(nil, 0, 0, 50, 25), viewports[2], "bottom left")
+	assert.Equal(t, 1, len(GridViewports(cameras, 1, 1, 10, 10)), "cameras exceeding the cells are dropped")
+}
+
+func TestRasterRenderer_RenderViewports(t *testing.T) {
+	sceneGraph := SampleScene()
+	camera := sceneGraph.GetNode("camera")
+
+	// a viewport covering the screen is the same as RenderSceneGraph
+	r := NewRasterRenderer(camera, 120, 80)
+	expected := renderRGBA(t, r, sceneGraph).Pix
+	r.imageBuffer.Clear()
+	imageBuffer, err := r.RenderViewports(sceneGraph, []Viewport{NewViewport(camera, 0, 0, 120, 80)})
+	assert.Nil(t, err)
+	assert.Equal(t, expected, imageBuffer.ToRGBA().Pix)
+
+	// the viewport must be the same image as a screen of the same size, moved by the viewport position
+	imageBuffer.Clear()
+	small := renderRGBA(t, NewRasterRenderer(camera, 60, 40), sceneGraph)
+	imageBuffer, err = r.RenderViewports(sceneGraph, []Viewport{NewViewport(camera, 50, 30, 60, 40)})
+	assert.Nil(t, err)
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 120; x++ {
+			var c color.RGBA
+			if x >= 50 && x < 110 && y >= 30 && y < 70 {
+				c = small.RGBAAt(x-50, 39-(y-30))
+			} else {
+				c = color.RGBA{A: 255}
+			}
+			if !assert.Equalf(t, c, imageBuffer.Get(x, y), "pixel %d, %d", x, y) {
+				return
+			}
+		}
+	}
+}
+
+func TestRasterRenderer_RenderViewportsErrors(t *testing.T) {
+	sceneGraph := SampleScene()
+	camera := sceneGraph.GetNode("camera")
+	r := NewRasterRenderer(camera, 100, 100)
+	invalid := []Viewport{
+		NewViewport(camera, 0, 0, 0, 10),
+		NewViewport(camera, -1, 0, 10, 10),
+		NewViewport(camera, 50, 50, 51, 10),
+		NewViewport(sceneGraph.GetNode("cube"), 0, 0, 10, 10),
+	}
+	for _, viewport := range invalid {
+		_, err := r.RenderViewports(sceneGraph, []Viewport{NewViewport(camera, 0, 0, 50, 50), viewport})
+		assert.NotNilf(t, err, "%+v", viewport)
+	}
+	_, err := r.RenderViewports(sceneGraph, []Viewport{NewViewport(nil, 0, 0, 10, 10)})
+	assert.True(t, errors.Is(err, ErrNoCamera))
+
+	// nothing is rendered when a viewport is not valid
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			assert.Equal(t, color.RGBA{A: 255}, r.imageBuffer.Get(x, y))
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package renderer
+
+import (
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"image/color"
+)
+
+// WireframeSettings How the edges of the models are drawn by the wireframe render modes. In RendermodeShadedWireframe
+// the edges are always depth tested against the shaded surfaces
+type WireframeSettings struct {
+	HiddenLineRemoval bool          // RendermodeWireframe draws only the edges not hidden by the surfaces of the models
+	CullBackFaces     bool          // edges between triangles facing away from the camera are not drawn
+	Antialiased       bool          // lines are drawn with Xiaolin Wu's algorithm, blending the two pixels closest to the line
+	DepthBias         basics.Scalar // fraction of their depth the edges are moved towards the camera in the depth test, so the edges of the visible surfaces are not hidden by them
+}
+
+// DefaultWireframeSettings Returns the wireframe settings of new renderers: every edge is drawn with aliased lines
+func DefaultWireframeSettings() WireframeSettings {
+	return WireframeSettings{DepthBias: 0.01}
+}
+
+func (r *RasterRenderer) WireframeSettings() WireframeSettings {
+	return r.parameters.wireframe
+}
+
+func (r *RasterRenderer) SetWireframeSettings(settings WireframeSettings) {
+	r.parameters.wireframe = settings
+}
+
+// renderSingleItemDepth queues the triangles of the model to write only the depth buffer, they hide the edges behind them
+func (r *RasterRenderer) renderSingleItemDepth(item renderItem) {
+	mesh := item.modelObject.Mesh()
+	iterator := mesh.Iterator()
+	for iterator.HasNext() {
+		t := iterator.Next()
+		t.ThisApplyTransformation(&item.completeTransform)
+		for _, t := range ClipTriangleAgainstPlanes(&t, item.clipPlanes) {
+			screen := projectTriangleOnScreen(&t, &r.parameters.projection)
+			if isBackFacing(&screen) {
+				continue
+			}
+			r.queueTriangle(&t, &screen, nil, nil)
+		}
+	}
+}
+
+// renderSingleItemWireFrame draws the edges of the model clipped to the view volume with the wire color of the model.
+// The edges are depth tested when depthTest is true
+func (r *RasterRenderer) renderSingleItemWireFrame(item renderItem, depthTest bool) {
+	mesh := item.modelObject.Mesh()
+	settings := &r.parameters.wireframe
+	viewport := &r.parameters.viewport
+	lines := lineRaster{
+		imageBuffer: &r.imageBuffer,
+		antialiased: settings.Antialiased,
+		depthBias:   settings.DepthBias,
+		color:       item.modelObject.WireColor(),
+		minX:        viewport.X,
+		minY:        viewport.Y,
+		maxX:        viewport.X + viewport.Width,
+		maxY:        viewport.Y + viewport.Height,
+	}
+	if depthTest {
+		lines.zBuffer = &r.zBuffer
+	}
+
+	// vertices in view space, the edges share them
+	positions := r.wirePositions[:0]
+	for i := 0; i < mesh.VertexCount(); i++ {
+		p := mesh.VertexPosition(i)
+		item.completeTransform.ApplyToPoint(&p)
+		positions = append(positions, p)
+	}
+	r.wirePositions = positions
+	frontFacing := func(face int) bool {
+		f := mesh.Face(face)
+		normal := positions[f[1]].Sub(positions[f[0]]).Cross(positions[f[2]].Sub(positions[f[0]]))
+		return normal.Dot(r.parameters.projection.viewDirection(&positions[f[0]])) < 0
+	}
+
+	for _, edge := range item.modelObject.Edges() {
+		if settings.CullBackFaces && !frontFacing(edge.Faces[0]) && (edge.IsBorder() || !frontFacing(edge.Faces[1])) {
+			continue
+		}
+		p0, p1, inside := ClipSegmentAgainstPlanes(&positions[edge.V0], &positions[edge.V1], item.clipPlanes)
+		if !inside {
+			continue
+		}
+		s0 := r.parameters.projection.toScreen(&p0)
+		s1 := r.parameters.projection.toScreen(&p1)
+		lines.draw(&s0, &s1)
+	}
+}
+
+// lineRaster Draws segments on the pixels from (minX, minY) included to (maxX, maxY) excluded of the image buffer
+type lineRaster struct {
+	imageBuffer *graphics.ImageBuffer
+	zBuffer     *graphics.ZBuffer // nil to draw without the depth test
+	depthBias   basics.Scalar
+	antialiased bool
+	color       color.RGBA // with antialiasing the alpha is multiplied by the coverage of the pixels
+	minX        int
+	minY        int
+	maxX        int
+	maxY        int
+}
+
+// draw draws the segment between the points s0 and s1 returned by projection.toScreen. Pixels are sampled at integer
+// coordinates like the triangles, one or two pixels, with antialiasing, for every pixel along the major axis
+func (l *lineRaster) draw(s0, s1 *basics.Vector4) {
+	// a is the major axis, b the other one
+	steep := basics.Abs(s1.Y-s0.Y) > basics.Abs(s1.X-s0.X)
+	a0, b0, a1, b1 := s0.X, s0.Y, s1.X, s1.Y
+	minA, maxA := l.minX, l.maxX
+	if steep {
+		a0, b0, a1, b1 = s0.Y, s0.X, s1.Y, s1.X
+		minA, maxA = l.minY, l.maxY
+	}
+	if a0 > a1 {
+		a0, b0, a1, b1 = a1, b1, a0, b0
+		s0, s1 = s1, s0
+	}
+	length := a1 - a0
+	var slope basics.Scalar
+	if length > 0 {
+		slope = (b1 - b0) / length
+	}
+
+	first, last := max(int(basics.Round(a0)), minA), min(int(basics.Round(a1)), maxA-1)
+	for a := first; a <= last; a++ {
+		var t basics.Scalar
+		if length > 0 {
+			t = basics.Clamp(0, 1, (basics.Scalar(a)-a0)/length)
+		}
+		b := b0 + slope*(basics.Scalar(a)-a0)
+		// z and w are linear in screen space
+		depth := (s0.Z + (s1.Z-s0.Z)*t) / (s0.W + (s1.W-s0.W)*t)
+		if !l.antialiased {
+			l.plot(a, int(basics.Round(b)), steep, depth, 1)
+			continue
+		}
+		floor := basics.Floor(b)
+		l.plot(a, int(floor), steep, depth, 1-(b-floor))
+		l.plot(a, int(floor)+1, steep, depth, b-floor)
+	}
+}
+
+// plot draws the pixel at a, b on the major and minor axis of the line, covered by the fraction coverage of the line
+func (l *lineRaster) plot(a int, b int, steep bool, depth basics.Scalar, coverage basics.Scalar) {
+	x, y := a, b
+	if steep {
+		x, y = b, a
+	}
+	if x < l.minX || y < l.minY || x >= l.maxX || y >= l.maxY {
+		return
+	}
+	if l.zBuffer != nil && depth*(1-l.depthBias) > l.zBuffer.Get(x, y) {
+		return
+	}
+	if !l.antialiased {
+		l.imageBuffer.Set(x, y, l.color)
+		return
+	}
+	c := l.color
+	c.A = uint8(basics.Round(coverage * basics.Scalar(c.A)))
+	if c.A > 0 {
+		l.imageBuffer.Blend(x, y, c, graphics.BlendModeAlpha)
+	}
+}
@@ -0,0 +1,138 @@
+package renderer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tsagae/software3d/pkg/basics"
+	"github.com/tsagae/software3d/pkg/entities"
+	"github.com/tsagae/software3d/pkg/graphics"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// wireframeTestScene A red wired quad in front of the camera and a smaller green wired quad behind it, the front quad
+// faces away from the camera if flipped
+func wireframeTestScene(flipped bool) *entities.SceneGraph {
+	sceneGraph := entities.NewSceneGraph()
+	sceneGraph.AddChild("world", entities.NewSceneGraphNode(entities.NewCameraObject("camera"), "camera"), basics.NewTransform(1, basics.NewIdentityQuaternion(), basics.NewVector3(0, 0, -20)))
+	addQuad := func(name string, wireColor color.RGBA, scale basics.Scalar, pitch basics.Scalar, z basics.Scalar) {
+		mesh, err := graphics.NewMeshFromReader(strings.NewReader(goldenTexturedQuad), graphics.NewMaterial(name, basics.NewVector3(65535, 65535, 65535), basics.Vector3{}, 1))
+		if err != nil {
+			panic(err)
+		}
+		quad := entities.NewModelObject(name, mesh, false)
+		quad.SetShader(&UnlitShader{})
+		quad.SetWireColor(wireColor)
+		sceneGraph.AddChild("world", entities.NewSceneGraphNode(quad, name), basics.NewTransform(scale, basics.NewQuaternionFromEulerAngles(0, pitch, 20), basics.NewVector3(0, 0, z)))
+	}
+	pitch := basics.Scalar(-90)
+	if flipped {
+		pitch = 90
+	}
+	addQuad("front", color.RGBA{R: 255, A: 255}, 1, pitch, 0)
+	addQuad("back", color.RGBA{G: 255, A: 255}, 0.5, -90, 5)
+	return sceneGraph
+}
+
+// countColors Returns how many pixels of the image have each color
+func countColors(imageBuffer *graphics.ImageBuffer) map[color.RGBA]int {
+	colors := make(map[color.RGBA]int)
+	for y := 0; y < imageBuffer.Height(); y++ {
+		for x := 0; x < imageBuffer.Width(); x++ {
+			colors[imageBuffer.Get(x, y)]++
+		}
+	}
+	return colors
+}
+
+func renderWireframe(t *testing.T, sceneGraph *entities.SceneGraph, renderMode uint8, settings WireframeSettings) map[color.RGBA]int {
+	r := NewRasterRenderer(sceneGraph.GetNode("camera"), 80, 60)
+	r.SetRenderMode(renderMode)
+	r.SetWireframeSettings(settings)
+	renderRGBA(t, r, sceneGraph)
+	return countColors(&r.imageBuffer)
+}
+
+func TestWireframe_ColorsAndHiddenLines(t *testing.T) {
+	red, green := color.RGBA{R: 255, A: 255}, color.RGBA{G: 255, A: 255}
+	settings := DefaultWireframeSettings()
+	colors := renderWireframe(t, wireframeTestScene(false), RendermodeWireframe, settings)
+	assert.Equal(t, 3, len(colors), "%v", colors)
+	assert.True(t, colors[red] > 0 && colors[green] > 0, "each model is drawn with its color: %v", colors)
+
+	settings.HiddenLineRemoval = true
+	colors = renderWireframe(t, wireframeTestScene(false), RendermodeWireframe, settings)
+	assert.True(t, colors[red] > 0, "the edges of the front quad are visible")
+	assert.Equal(t, 0, colors[green], "the back quad is hidden by the front one")
+
+	settings.HiddenLineRemoval = false
+	settings.CullBackFaces = true
+	colors = renderWireframe(t, wireframeTestScene(true), RendermodeWireframe, settings)
+	assert.Equal(t, 0, colors[red], "the front quad faces away from the camera")
+	assert.True(t, colors[green] > 0)
+}
+
+func TestWireframe_SharedEdgesDrawnOnce(t *testing.T) {
+	// with a translucent wire color a pixel drawn twice is brighter than the others, the diagonal shared by the two
+	// triangles of the front quad is the only edge near the center of the screen
+	sceneGraph := wireframeTestScene(false)
+	sceneGraph.GetNode("front").GameObject.(*entities.ModelObject).SetWireColor(color.RGBA{R: 255, A: 128})
+	r := NewRasterRenderer(sceneGraph.GetNode("camera"), 80, 60)
+	r.SetRenderMode(RendermodeWireframe)
+	r.SetWireframeSettings(WireframeSettings{HiddenLineRemoval: true, Antialiased: true, DepthBias: 0.01})
+	renderRGBA(t, r, sceneGraph)
+	drawn := 0
+	for y := 27; y < 34; y++ {
+		for x := 37; x < 44; x++ {
+			c := r.imageBuffer.Get(x, y)
+			assert.Truef(t, c.R <= 128, "pixel %d, %d: %v", x, y, c)
+			if c.R > 0 {
+				drawn++
+			}
+		}
+	}
+	assert.True(t, drawn > 0, "the diagonal is not drawn")
+	assert.Equal(t, 5, len(sceneGraph.GetNode("front").GameObject.(*entities.ModelObject).Edges()))
+}
+
+func TestWireframe_ShadedOverlay(t *testing.T) {
+	colors := renderWireframe(t, wireframeTestScene(false), RendermodeShadedWireframe, DefaultWireframeSettings())
+	assert.True(t, colors[color.RGBA{R: 255, A: 255}] > 0, "the edges are drawn over the surfaces")
+	assert.Equal(t, 0, colors[color.RGBA{G: 255, A: 255}], "the edges behind the surfaces are hidden")
+	white := 0
+	for c, n := range colors {
+		if c.R >= 254 && c.G >= 254 && c.B >= 254 {
+			white += n
+		}
+	}
+	assert.True(t, white > 50, "the front quad is shaded")
+}
+
+func TestLineRaster(t *testing.T) {
+	imageBuffer := graphics.NewImageBuffer(10, 10)
+	zBuffer := graphics.NewZBuffer(10, 10)
+	zBuffer.Clear()
+	zBuffer.Set(5, 2, 1)
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	lines := lineRaster{imageBuffer: &imageBuffer, zBuffer: &zBuffer, color: white, minX: 0, minY: 0, maxX: 8, maxY: 10}
+	// from outside the left border to outside the right border at depth 2
+	s0, s1 := basics.NewVector4(-3, 2, 2, 1), basics.NewVector4(12, 2, 2, 1)
+	lines.draw(&s0, &s1)
+	for x := 0; x < 10; x++ {
+		expected := color.RGBA{A: 255}
+		if x < 8 && x != 5 {
+			expected = white
+		}
+		assert.Equalf(t, expected, imageBuffer.Get(x, 2), "pixel %d", x)
+	}
+
+	// half way between two rows the antialiased line covers both by half
+	imageBuffer.Clear()
+	lines = lineRaster{imageBuffer: &imageBuffer, antialiased: true, color: white, minX: 0, minY: 0, maxX: 10, maxY: 10}
+	s0, s1 = basics.NewVector4(0, 4.5, 1, 1), basics.NewVector4(9, 4.5, 1, 1)
+	lines.draw(&s0, &s1)
+	for x := 0; x < 10; x++ {
+		assert.Equal(t, color.RGBA{R: 128, G: 128, B: 128, A: 255}, imageBuffer.Get(x, 4))
+		assert.Equal(t, color.RGBA{R: 128, G: 128, B: 128, A: 255}, imageBuffer.Get(x, 5))
+	}
+}